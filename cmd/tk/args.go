@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/go-clix/cli"
 	"github.com/posener/complete"
 )
@@ -14,3 +16,14 @@ var workflowArgs = cli.Args{
 		return []string{""}
 	}),
 }
+
+// multiWorkflowArgs is like workflowArgs, but accepts multiple environments
+var multiWorkflowArgs = cli.Args{
+	Validator: cli.ValidateFunc(func(args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("accepts at least 1 arg, received 0")
+		}
+		return nil
+	}),
+	Predictor: workflowArgs.Predictor,
+}
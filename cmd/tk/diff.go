@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/tanka"
+	"github.com/grafana/tanka/pkg/term"
+)
+
+// envDiff is the outcome of diffing one of multiple environments
+type envDiff struct {
+	dir     string
+	changes *string
+	// set if the diff violates --fail-on-add or --fail-on-delete
+	policyErr error
+}
+
+// diffResult is what diffing a single environment returned
+type diffResult struct {
+	changes *string
+	err     error
+}
+
+// diffAll diffs all of dirs at once using diff, returning the results in the
+// order of dirs. How many kubectl commands run concurrently is bound by
+// --max-cluster-concurrency (see tanka.WithClusterLimiter) only.
+func diffAll(dirs []string, diff func(string, ...tanka.Modifier) (*string, error), mods []tanka.Modifier) []diffResult {
+	results := make([]diffResult, len(dirs))
+
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			changes, err := diff(dir, mods...)
+			results[i] = diffResult{changes: changes, err: err}
+		}(i, dir)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// diffEnvs diffs all of dirs in parallel using diff (usually tanka.Diff),
+// failing with the first of them that fails
+func diffEnvs(dirs []string, diff func(string, ...tanka.Modifier) (*string, error), mods []tanka.Modifier) ([]envDiff, error) {
+	diffs := make([]envDiff, 0, len(dirs))
+	for i, r := range diffAll(dirs, diff, mods) {
+		dir, changes, err := dirs[i], r.changes, r.err
+		policyErr, violated := err.(tanka.ErrorDiffPolicy)
+		if err != nil && !violated {
+			return nil, fmt.Errorf("diffing %s: %s", dir, err)
+		}
+
+		d := envDiff{dir: dir, changes: changes}
+		if violated {
+			d.policyErr = policyErr
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// writeEnvDiffs writes the diff of each environment to w, below a header
+// naming it, using render (see diffRenderer). With quiet, unchanged
+// environments are left out and only counted at the end. Returns the exit
+// status: ExitStatusPolicy if any environment violates the policy,
+// ExitStatusDiff if any has changes.
+func writeEnvDiffs(w io.Writer, diffs []envDiff, quiet bool, render func(string) string) int {
+	status := ExitStatusClean
+	unchanged := 0
+
+	for _, d := range diffs {
+		if d.changes == nil {
+			unchanged++
+			if !quiet {
+				fmt.Fprintf(w, "=== %s ===\nNo differences.\n\n", d.dir)
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "=== %s ===\n", d.dir)
+		fmt.Fprintln(w, render(*d.changes))
+
+		if status != ExitStatusPolicy {
+			status = ExitStatusDiff
+		}
+		if d.policyErr != nil {
+			fmt.Fprintln(w, d.policyErr)
+			status = ExitStatusPolicy
+		}
+		fmt.Fprintln(w)
+	}
+
+	if quiet {
+		fmt.Fprintf(w, "%d of %d environments unchanged\n", unchanged, len(diffs))
+	}
+	return status
+}
+
+// diffRenderer returns how diffs are shown: Using the external diff tool if
+// given, colored if colorize is set, or as-is otherwise. If the tool fails,
+// the diff is shown without it. The files of the tool are created below
+// tempDir, see util.RenderDiff.
+func diffRenderer(colorize bool, tool []string, tempDir string) func(string) string {
+	builtin := func(d string) string {
+		if colorize {
+			return term.Colordiff(d).String()
+		}
+		return d
+	}
+	if len(tool) == 0 {
+		return builtin
+	}
+
+	return func(d string) string {
+		var buf bytes.Buffer
+		if err := util.RenderDiff(&buf, tool, d, tempDir); err != nil {
+			log.Printf("Warning: %s, showing the diff without it", err)
+			return builtin(d)
+		}
+		return buf.String()
+	}
+}
+
+// renderWriter renders each write using render before passing it to w. Writes
+// hold the diff of whole objects, see tanka.WithDiffStream
+type renderWriter struct {
+	w      io.Writer
+	render func(string) string
+}
+
+func (r renderWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.render(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// envReport is the machine-readable diff of an environment, see --output json
+type envReport struct {
+	Environment string           `json:"environment"`
+	Summary     util.DiffSummary `json:"summary"`
+	Changes     []util.FileDiff  `json:"changes"`
+
+	// set if the diff violates --fail-on-add or --fail-on-delete
+	PolicyViolation string `json:"policyViolation,omitempty"`
+}
+
+// writeEnvReports writes diffs to w as a JSON list holding an envReport per
+// environment. With summarize, the diffs of the objects are left out. Returns
+// the exit status like writeEnvDiffs does.
+func writeEnvReports(w io.Writer, diffs []envDiff, summarize bool) (int, error) {
+	status := ExitStatusClean
+	reports := make([]envReport, 0, len(diffs))
+
+	for _, d := range diffs {
+		r := envReport{Environment: d.dir, Changes: []util.FileDiff{}}
+		if d.changes != nil {
+			r.Changes = util.ParseDiff(*d.changes)
+			r.Summary = util.Summarize(r.Changes)
+		}
+		if summarize {
+			for i := range r.Changes {
+				r.Changes[i].Diff = ""
+			}
+		}
+
+		if len(r.Changes) > 0 && status != ExitStatusPolicy {
+			status = ExitStatusDiff
+		}
+		if d.policyErr != nil {
+			r.PolicyViolation = d.policyErr.Error()
+			status = ExitStatusPolicy
+		}
+		reports = append(reports, r)
+	}
+
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return status, err
+}
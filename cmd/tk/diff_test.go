@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/tanka"
+)
+
+const driftDiff = `diff -u -N /tmp/LIVE/apps-v1.Deployment.loki.loki /tmp/MERGED/apps-v1.Deployment.loki.loki
+--- /tmp/LIVE/apps-v1.Deployment.loki.loki
++++ /tmp/MERGED/apps-v1.Deployment.loki.loki
+@@ -1 +1 @@
+-replicas: 1
++replicas: 2`
+
+// fakeDiff reports drift for the environments of changes only
+func fakeDiff(changes map[string]string) func(string, ...tanka.Modifier) (*string, error) {
+	return func(dir string, mods ...tanka.Modifier) (*string, error) {
+		if d, ok := changes[dir]; ok {
+			return &d, nil
+		}
+		return nil, nil
+	}
+}
+
+var driftEnvs = []string{"environments/cortex", "environments/loki", "environments/tempo"}
+
+// TestDiffEnvsQuiet checks that only the environment with drift is printed
+func TestDiffEnvsQuiet(t *testing.T) {
+	diffs, err := diffEnvs(driftEnvs, fakeDiff(map[string]string{"environments/loki": driftDiff}), nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	status := writeEnvDiffs(&buf, diffs, true, diffRenderer(false, nil, ""))
+	assert.Equal(t, ExitStatusDiff, status)
+	assert.Equal(t, "=== environments/loki ===\n"+driftDiff+"\n\n2 of 3 environments unchanged\n", buf.String())
+}
+
+func TestDiffEnvs(t *testing.T) {
+	diffs, err := diffEnvs(driftEnvs, fakeDiff(map[string]string{"environments/loki": driftDiff}), nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writeEnvDiffs(&buf, diffs, false, diffRenderer(false, nil, ""))
+	assert.Equal(t, `=== environments/cortex ===
+No differences.
+
+=== environments/loki ===
+`+driftDiff+`
+
+=== environments/tempo ===
+No differences.
+
+`, buf.String())
+
+	// none changed
+	buf.Reset()
+	diffs, err = diffEnvs(driftEnvs, fakeDiff(nil), nil)
+	require.NoError(t, err)
+	assert.Equal(t, ExitStatusClean, writeEnvDiffs(&buf, diffs, true, diffRenderer(false, nil, "")))
+	assert.Equal(t, "3 of 3 environments unchanged\n", buf.String())
+}
+
+func TestDiffEnvsPolicy(t *testing.T) {
+	diff := func(dir string, mods ...tanka.Modifier) (*string, error) {
+		d := driftDiff
+		return &d, tanka.ErrorDiffPolicy{Added: 1}
+	}
+	diffs, err := diffEnvs(driftEnvs[:1], diff, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, ExitStatusPolicy, writeEnvDiffs(&buf, diffs, true, diffRenderer(false, nil, "")))
+	assert.Contains(t, buf.String(), "the diff creates 1 object(s), which is forbidden")
+
+	failing := func(dir string, mods ...tanka.Modifier) (*string, error) {
+		return nil, errors.New("cluster unreachable")
+	}
+	_, err = diffEnvs(driftEnvs, failing, nil)
+	assert.EqualError(t, err, "diffing environments/cortex: cluster unreachable")
+}
+
+// TestDiffAll checks that the environments are diffed at once, the results
+// keeping their order
+func TestDiffAll(t *testing.T) {
+	var started sync.WaitGroup
+	started.Add(len(driftEnvs))
+	diff := func(dir string, mods ...tanka.Modifier) (*string, error) {
+		started.Done()
+
+		// serial diffing never gets past this
+		all := make(chan struct{})
+		go func() { started.Wait(); close(all) }()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("diffed serially")
+		}
+		return &dir, nil
+	}
+
+	results := diffAll(driftEnvs, diff, nil)
+	require.Len(t, results, len(driftEnvs))
+	for i, r := range results {
+		require.NoError(t, r.err)
+		assert.Equal(t, driftEnvs[i], *r.changes)
+	}
+}
+
+// TestWriteEnvReports checks that each environment is reported, along with
+// its changed objects
+func TestWriteEnvReports(t *testing.T) {
+	diffs, err := diffEnvs(driftEnvs[:2], fakeDiff(map[string]string{"environments/loki": driftDiff}), nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	status, err := writeEnvReports(&buf, diffs, false)
+	require.NoError(t, err)
+	assert.Equal(t, ExitStatusDiff, status)
+
+	var reports []envReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &reports))
+	require.Len(t, reports, 2)
+
+	assert.Equal(t, envReport{Environment: "environments/cortex", Changes: []util.FileDiff{}}, reports[0])
+	assert.Equal(t, envReport{
+		Environment: "environments/loki",
+		Summary:     util.DiffSummary{Updated: 1, Insertions: 1, Deletions: 1},
+		Changes: []util.FileDiff{{
+			Name:       "apps-v1.Deployment.loki.loki",
+			Action:     util.ActionUpdated,
+			Insertions: 1,
+			Deletions:  1,
+			Diff:       driftDiff + "\n",
+		}},
+	}, reports[1])
+
+	// none changed, objects of changed ones summarized
+	buf.Reset()
+	status, err = writeEnvReports(&buf, diffs[:1], false)
+	require.NoError(t, err)
+	assert.Equal(t, ExitStatusClean, status)
+	assert.Contains(t, buf.String(), `"changes": []`)
+
+	buf.Reset()
+	_, err = writeEnvReports(&buf, diffs, true)
+	require.NoError(t, err)
+	assert.NotContains(t, buf.String(), `"diff"`)
+	assert.Contains(t, buf.String(), `"name": "apps-v1.Deployment.loki.loki"`)
+}
+
+func TestWriteEnvReportsPolicy(t *testing.T) {
+	diff := func(dir string, mods ...tanka.Modifier) (*string, error) {
+		d := driftDiff
+		return &d, tanka.ErrorDiffPolicy{Added: 1}
+	}
+	diffs, err := diffEnvs(driftEnvs[:1], diff, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	status, err := writeEnvReports(&buf, diffs, false)
+	require.NoError(t, err)
+	assert.Equal(t, ExitStatusPolicy, status)
+	assert.Contains(t, buf.String(), `"policyViolation": "the diff creates 1 object(s), which is forbidden"`)
+}
+
+// TestDiffRendererFallback checks that diffs are still shown if the diff tool
+// fails
+func TestDiffRendererFallback(t *testing.T) {
+	render := diffRenderer(false, []string{"tk-missing-diff-tool"}, "")
+	assert.Equal(t, driftDiff, render(driftDiff))
+
+	assert.Equal(t, driftDiff, diffRenderer(false, nil, "")(driftDiff))
+}
+
+// TestRenderWriter checks that each streamed write is rendered on its own
+func TestRenderWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var rendered []string
+	w := renderWriter{w: &buf, render: func(d string) string {
+		rendered = append(rendered, d)
+		return strings.ToUpper(d)
+	}}
+
+	_, err := w.Write([]byte("diff a\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("diff b\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"diff a\n", "diff b\n"}, rendered)
+	assert.Equal(t, "DIFF A\nDIFF B\n", buf.String())
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/go-clix/cli"
@@ -15,7 +18,9 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/spec"
 	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+	"github.com/grafana/tanka/pkg/tanka"
 	"github.com/grafana/tanka/pkg/term"
 )
 
@@ -30,6 +35,8 @@ func envCmd() *cli.Command {
 		envSetCmd(),
 		envListCmd(),
 		envRemoveCmd(),
+		envLintCmd(),
+		envSpecCmd(),
 	)
 
 	return cmd
@@ -86,26 +93,57 @@ func envSetCmd() *cli.Command {
 		}
 
 		cfg := setupConfiguration(path)
+		fields := make(map[string]interface{})
 		if tmp.Spec.APIServer != "" && tmp.Spec.APIServer != cfg.Spec.APIServer {
 			fmt.Printf("updated spec.apiServer (`%s -> `%s`)\n", cfg.Spec.APIServer, tmp.Spec.APIServer)
-			cfg.Spec.APIServer = tmp.Spec.APIServer
+			fields["apiServer"] = tmp.Spec.APIServer
 		}
 		if tmp.Spec.Namespace != "" && tmp.Spec.Namespace != cfg.Spec.Namespace {
 			fmt.Printf("updated spec.namespace (`%s -> `%s`)\n", cfg.Spec.Namespace, tmp.Spec.Namespace)
-			cfg.Spec.Namespace = tmp.Spec.Namespace
+			fields["namespace"] = tmp.Spec.Namespace
 		}
 		if tmp.Spec.DiffStrategy != "" && tmp.Spec.DiffStrategy != cfg.Spec.DiffStrategy {
 			fmt.Printf("updated spec.diffStrategy (`%s -> `%s`)\n", cfg.Spec.DiffStrategy, tmp.Spec.DiffStrategy)
-			cfg.Spec.DiffStrategy = tmp.Spec.DiffStrategy
+			fields["diffStrategy"] = tmp.Spec.DiffStrategy
 		}
 
-		if err := writeJSON(cfg, filepath.Join(path, "spec.json")); err != nil {
-			return err
-		}
+		return patchSpec(filepath.Join(path, spec.Specfile), fields)
+	}
+	return cmd
+}
 
+// patchSpec sets the given fields of `spec` in the spec.json file, keeping
+// everything else as written. Unlike the parsed spec, this holds neither
+// inherited fields nor paths made absolute.
+func patchSpec(file string, fields map[string]interface{}) error {
+	if len(fields) == 0 {
 		return nil
 	}
-	return cmd
+
+	cfg := v1alpha1.New()
+	raw := map[string]interface{}{
+		"apiVersion": cfg.APIVersion,
+		"kind":       cfg.Kind,
+	}
+	data, err := ioutil.ReadFile(file)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("parsing %s: %s", file, err)
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	s, ok := raw["spec"].(map[string]interface{})
+	if !ok {
+		s = make(map[string]interface{})
+		raw["spec"] = s
+	}
+	for k, v := range fields {
+		s[k] = v
+	}
+	return writeJSON(raw, file)
 }
 
 func envAddCmd() *cli.Command {
@@ -209,9 +247,21 @@ func envListCmd() *cli.Command {
 	labelSelector := cmd.Flags().StringP("selector", "l", "", "Label selector. Uses the same syntax as kubectl does")
 
 	useNames := cmd.Flags().Bool("names", false, "plain names output")
+	format := cmd.Flags().String("format", "table", "output format: table or json")
+	withStatus := cmd.Flags().Bool("status", false, "diff each environment against its cluster, reporting whether it is synced, drifted or unreachable")
+	getClusterLimiter := clusterConcurrencyFlag(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
+		switch *format {
+		case "table":
+		case "json":
+			*useJSON = true
+		default:
+			return fmt.Errorf("--format must be one of table or json, not `%s`", *format)
+		}
+
 		envs := []v1alpha1.Config{}
+		envDirs := []string{}
 		dirs := findBaseDirs()
 		var selector labels.Selector
 		var err error
@@ -231,9 +281,14 @@ func envListCmd() *cli.Command {
 			}
 			if selector == nil || selector.Empty() || selector.Matches(env.Metadata) {
 				envs = append(envs, *env)
+				envDirs = append(envDirs, dir)
 			}
 		}
 
+		if *withStatus {
+			return listEnvStatuses(envDirs, envs, *useJSON, tanka.WithClusterLimiter(getClusterLimiter()))
+		}
+
 		if *useJSON {
 			j, err := json.Marshal(envs)
 			if err != nil {
@@ -260,3 +315,134 @@ func envListCmd() *cli.Command {
 	}
 	return cmd
 }
+
+// listEnvStatuses prints how each of envs compares to its cluster
+func listEnvStatuses(dirs []string, envs []v1alpha1.Config, useJSON bool, mods ...tanka.Modifier) error {
+	statuses := envStatuses(dirs, envs, tanka.Diff, mods)
+
+	if useJSON {
+		j, err := json.Marshal(statuses)
+		if err != nil {
+			return fmt.Errorf("Formatting as json: %s", err)
+		}
+		fmt.Println(string(j))
+		return nil
+	}
+
+	if err := writeEnvStatuses(os.Stdout, statuses); err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		switch s.Status {
+		case envUnreachable:
+			log.Printf("%s is unreachable: %s", s.Name, s.Error)
+		case envError:
+			log.Printf("Diffing %s failed: %s", s.Name, s.Error)
+		}
+	}
+	return nil
+}
+
+func envSpecCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "spec <path>",
+		Short: "print the effective spec.json, after inheritance and overrides",
+		Args:  workflowArgs,
+	}
+
+	diffStrategy := cmd.Flags().String("diff-strategy", "", "override spec.diffStrategy, like tk diff does")
+	includeStatus := cmd.Flags().Bool("include-status", false, "override spec.diff.includeStatus, like tk diff does")
+	ignoreWhitespace := cmd.Flags().Bool("ignore-whitespace", false, "override spec.diff.ignoreWhitespace, like tk diff does")
+	sources := cmd.Flags().Bool("sources", false, "list where each field is set instead")
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		env, srcs, err := tanka.EffectiveSpec(args[0],
+			tanka.WithDiffStrategy(*diffStrategy),
+			tanka.WithDiffIncludeStatus(*includeStatus),
+			tanka.WithDiffIgnoreWhitespace(*ignoreWhitespace),
+		)
+		if err != nil {
+			return err
+		}
+
+		if !*sources {
+			out, err := json.MarshalIndent(env, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+
+		fields := make([]string, 0, len(srcs))
+		for f := range srcs {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+		f := "%s\t%s\t\n"
+		fmt.Fprintf(w, f, "FIELD", "SOURCE")
+		for _, field := range fields {
+			src := srcs[field]
+			if rel, err := filepath.Rel(wd, src); err == nil && filepath.IsAbs(src) {
+				src = rel
+			}
+			fmt.Fprintf(w, f, field, src)
+		}
+		w.Flush()
+		fmt.Println("All other fields have their default value.")
+
+		return nil
+	}
+	return cmd
+}
+
+func envLintCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "lint [path]",
+		Short: "find environments targeting the same namespace of the same cluster",
+		Args: cli.Args{
+			Validator: cli.ValidateFunc(func(args []string) error {
+				if len(args) > 1 {
+					return errors.New("At most one path is allowed")
+				}
+				return nil
+			}),
+			Predictor: complete.PredictDirs("*"),
+		},
+	}
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		conflicts, err := tanka.LintNamespaces(dir)
+		if err != nil {
+			return err
+		}
+
+		if len(conflicts) == 0 {
+			log.Println("No environments share a namespace.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+		f := "%s\t%s\t%s\t\n"
+		fmt.Fprintf(w, f, "SERVER", "NAMESPACE", "ENVIRONMENTS")
+		for _, c := range conflicts {
+			fmt.Fprintf(w, f, c.APIServer, c.Namespace, strings.Join(c.Environments, ", "))
+		}
+		w.Flush()
+
+		return fmt.Errorf("%d namespaces are targeted by multiple environments. Set the %q annotation of intentionally shared ones to \"true\"", len(conflicts), tanka.AnnotationSharedNamespace)
+	}
+	return cmd
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPatchSpec checks that only the given fields are changed, leaving the
+// rest of the file as written
+func TestPatchSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tk-env")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "spec.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{
+  "apiVersion": "tanka.dev/v1alpha1",
+  "kind": "Environment",
+  "metadata": {"name": "default"},
+  "spec": {"kubeconfig": "kubeconfig.yaml", "namespace": "default"}
+}`), 0644))
+
+	require.NoError(t, patchSpec(file, map[string]interface{}{"namespace": "loki"}))
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "apiVersion": "tanka.dev/v1alpha1",
+  "kind": "Environment",
+  "metadata": {"name": "default"},
+  "spec": {"kubeconfig": "kubeconfig.yaml", "namespace": "loki"}
+}`, string(data))
+
+	// inheriting everything
+	require.NoError(t, os.Remove(file))
+	require.NoError(t, patchSpec(file, map[string]interface{}{"namespace": "loki"}))
+	data, err = ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "apiVersion": "tanka.dev/v1alpha1",
+  "kind": "Environment",
+  "spec": {"namespace": "loki"}
+}`, string(data))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+	"github.com/grafana/tanka/pkg/tanka"
+)
+
+// states of an environment reported by `tk env list --status`
+const (
+	// the cluster matches the environment
+	envSynced = "synced"
+	// the cluster differs from the environment
+	envDrifted = "drifted"
+	// the cluster could not be talked to
+	envUnreachable = "unreachable"
+	// diffing failed otherwise, e.g. evaluating the Jsonnet
+	envError = "error"
+)
+
+// envStatus is how the cluster of an environment compares to it
+type envStatus struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Server    string `json:"server"`
+
+	// one of envSynced, envDrifted, envUnreachable or envError
+	Status string `json:"status"`
+	// number of objects that differ, if drifted
+	Changes int `json:"changes,omitempty"`
+	// why the cluster is unreachable or diffing failed
+	Error string `json:"error,omitempty"`
+}
+
+// envStatuses compares all of envs (found at the same index of dirs) to their
+// clusters in parallel using diff (usually tanka.Diff). A cluster that can't
+// be talked to is reported as unreachable, any other failure as error, so that
+// a single environment never hides the others.
+func envStatuses(dirs []string, envs []v1alpha1.Config, diff func(string, ...tanka.Modifier) (*string, error), mods []tanka.Modifier) []envStatus {
+	results := diffAll(dirs, diff, mods)
+
+	statuses := make([]envStatus, 0, len(envs))
+	for i, env := range envs {
+		s := envStatus{
+			Name:      env.Metadata.Name,
+			Namespace: env.Spec.Namespace,
+			Server:    env.Spec.APIServer,
+			Status:    envSynced,
+		}
+
+		changes, err := results[i].changes, results[i].err
+		var clusterErr kubernetes.ClusterError
+		switch {
+		case errors.As(err, &clusterErr):
+			s.Status, s.Error = envUnreachable, err.Error()
+		case err != nil:
+			s.Status, s.Error = envError, err.Error()
+		case changes != nil:
+			s.Status, s.Changes = envDrifted, len(util.DiffObjects(*changes))
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// writeEnvStatuses writes statuses to w as a table. Why clusters are
+// unreachable or diffing failed is left out, as errors often span multiple
+// lines.
+func writeEnvStatuses(w io.Writer, statuses []envStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	f := "%s\t%s\t%s\t%s\t\n"
+	fmt.Fprintf(tw, f, "NAME", "NAMESPACE", "SERVER", "STATUS")
+	for _, s := range statuses {
+		status := s.Status
+		if s.Status == envDrifted {
+			status = fmt.Sprintf("%s (%d objects)", s.Status, s.Changes)
+		}
+		fmt.Fprintf(tw, f, s.Name, s.Namespace, s.Server, status)
+	}
+	return tw.Flush()
+}
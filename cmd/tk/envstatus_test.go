@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+	"github.com/grafana/tanka/pkg/tanka"
+)
+
+func statusEnvs(dirs []string) []v1alpha1.Config {
+	envs := make([]v1alpha1.Config, 0, len(dirs))
+	for _, dir := range dirs {
+		env := v1alpha1.New()
+		env.Metadata.Name = dir
+		env.Spec.APIServer = "https://" + dir
+		env.Spec.Namespace = "default"
+		envs = append(envs, *env)
+	}
+	return envs
+}
+
+// TestEnvStatuses checks that each environment is reported on its own, an
+// unreachable cluster not failing the others
+func TestEnvStatuses(t *testing.T) {
+	diff := func(dir string, mods ...tanka.Modifier) (*string, error) {
+		switch dir {
+		case "environments/loki":
+			d := driftDiff
+			return &d, nil
+		case "environments/tempo":
+			return nil, kubernetes.ClusterError{Err: errors.New("connection refused")}
+		}
+		return nil, nil
+	}
+
+	statuses := envStatuses(driftEnvs, statusEnvs(driftEnvs), diff, nil)
+	assert.Equal(t, []envStatus{
+		{Name: "environments/cortex", Namespace: "default", Server: "https://environments/cortex", Status: envSynced},
+		{Name: "environments/loki", Namespace: "default", Server: "https://environments/loki", Status: envDrifted, Changes: 1},
+		{Name: "environments/tempo", Namespace: "default", Server: "https://environments/tempo", Status: envUnreachable, Error: "connection refused"},
+	}, statuses)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeEnvStatuses(&buf, statuses))
+	var rows [][]string
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		rows = append(rows, strings.Fields(l))
+	}
+	assert.Equal(t, [][]string{
+		{"NAME", "NAMESPACE", "SERVER", "STATUS"},
+		{"environments/cortex", "default", "https://environments/cortex", "synced"},
+		{"environments/loki", "default", "https://environments/loki", "drifted", "(1", "objects)"},
+		{"environments/tempo", "default", "https://environments/tempo", "unreachable"},
+	}, rows)
+}
+
+// TestEnvStatusesError checks that other failures are reported for the
+// environment failing only
+func TestEnvStatusesError(t *testing.T) {
+	failing := func(dir string, mods ...tanka.Modifier) (*string, error) {
+		if dir == "environments/loki" {
+			return nil, errors.New("evaluating jsonnet: main.jsonnet:1:1 unexpected end of file")
+		}
+		return nil, nil
+	}
+	statuses := envStatuses(driftEnvs, statusEnvs(driftEnvs), failing, nil)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, envSynced, statuses[0].Status)
+	assert.Equal(t, envStatus{
+		Name:      "environments/loki",
+		Namespace: "default",
+		Server:    "https://environments/loki",
+		Status:    envError,
+		Error:     "evaluating jsonnet: main.jsonnet:1:1 unexpected end of file",
+	}, statuses[1])
+	assert.Equal(t, envSynced, statuses[2].Status)
+}
@@ -1,17 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"os"
-	"path/filepath"
 	"strings"
 
-	"text/template"
-
 	"github.com/go-clix/cli"
 
 	"github.com/grafana/tanka/pkg/tanka"
@@ -29,72 +21,57 @@ func exportCmd() *cli.Command {
 
 	vars := workflowFlags(cmd.Flags())
 	getExtCode := extCodeParser(cmd.Flags())
-	format := cmd.Flags().String("format", "{{.apiVersion}}.{{.kind}}-{{.metadata.name}}", "https://tanka.dev/exporting#filenames")
-	extension := cmd.Flags().String("extension", "yaml", "File extension")
-
-	templateFuncMap := template.FuncMap{
-		"lower": func(s string) string {
-			return strings.ToLower(s)
-		},
-	}
+	allowEnv := allowEnvFlag(cmd.Flags())
+	getFreezeTime := freezeTimeFlag(cmd.Flags())
+	getTraceOut := tracesFlag(cmd.Flags())
+	valuesFiles := valuesFlag(cmd.Flags())
+	format := cmd.Flags().String("format", tanka.DefaultExportFormat, "https://tanka.dev/exporting#filenames")
+	extension := cmd.Flags().String("extension", tanka.DefaultExportExtension, "File extension")
+	sealWith := cmd.Flags().String("seal-secrets", "", "replace Secrets by the output of this command, which receives each on stdin. Without a value, 'kubeseal --format yaml' is used")
+	cmd.Flags().Lookup("seal-secrets").NoOptDefVal = "kubeseal --format yaml"
+	dryRun := cmd.Flags().Bool("dry-run", false, "only list which files would be new, changed or unchanged, without writing anything")
+	prune := cmd.Flags().Bool("prune", false, "remove the files (with the export extension) of outputDir that the export no longer produces. outputDir may be non-empty")
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		// dir must be empty
-		to := args[1]
-		empty, err := dirEmpty(to)
-		if err != nil {
-			return fmt.Errorf("Checking target dir: %s", err)
+		mods := []tanka.Modifier{
+			tanka.WithExtCode(getExtCode()),
+			tanka.WithAllowEnv(*allowEnv),
+			tanka.WithFreezeTime(getFreezeTime()),
+			tanka.WithTraceOut(getTraceOut()),
+			tanka.WithValuesFiles(*valuesFiles),
+			tanka.WithTargets(stringsToRegexps(vars.targets)),
+			tanka.WithExportFormat(*format),
+			tanka.WithExportExtension(*extension),
 		}
-		if !empty {
-			return fmt.Errorf("Target dir `%s` not empty. Aborting.", to)
+		if *sealWith != "" {
+			mods = append(mods, tanka.WithSealSecrets(strings.Fields(*sealWith)))
 		}
 
-		// exit early if the template is bad
-		tmpl, err := template.New("").Funcs(templateFuncMap).Parse(*format)
-		if err != nil {
-			return fmt.Errorf("Parsing name format: %s", err)
+		mods = append(mods, tanka.WithExportPrune(*prune))
+
+		if !*dryRun && !*prune {
+			// directories must be empty
+			sink, err := tanka.OpenSink(args[1])
+			if err != nil {
+				return err
+			}
+			return tanka.Export(args[0], sink, mods...)
 		}
 
-		// get the manifests
-		res, err := tanka.Show(args[0],
-			tanka.WithExtCode(getExtCode()),
-			tanka.WithTargets(stringsToRegexps(vars.targets)),
-		)
+		sink, err := tanka.OpenPruningSink(args[1])
 		if err != nil {
 			return err
 		}
-
-		// write each to a file
-		for _, m := range res {
-			buf := bytes.Buffer{}
-			if err := tmpl.Execute(&buf, m); err != nil {
-				log.Fatalln("executing name template:", err)
-			}
-			name := strings.Replace(buf.String(), "/", "-", -1)
-
-			data := m.String()
-			if err := ioutil.WriteFile(filepath.Join(to, name+"."+*extension), []byte(data), 0644); err != nil {
-				return fmt.Errorf("Writing manifest: %s", err)
-			}
+		if !*dryRun {
+			return tanka.Export(args[0], sink, mods...)
 		}
 
+		plan, err := tanka.PlanExport(args[0], sink, mods...)
+		if err != nil {
+			return err
+		}
+		fmt.Println(plan)
 		return nil
 	}
 	return cmd
 }
-
-func dirEmpty(dir string) (bool, error) {
-	f, err := os.Open(dir)
-	if os.IsNotExist(err) {
-		return true, os.MkdirAll(dir, os.ModePerm)
-	} else if err != nil {
-		return false, err
-	}
-	defer f.Close()
-
-	_, err = f.Readdirnames(1)
-	if err == io.EOF {
-		return true, nil
-	}
-	return false, err
-}
@@ -34,10 +34,13 @@ func fmtCmd() *cli.Command {
 
 	stdout := cmd.Flags().Bool("stdout", false, "print formatted contents to stdout instead of writing to disk")
 	test := cmd.Flags().BoolP("test", "t", false, "exit with non-zero when changes would be made")
+	check := cmd.Flags().Bool("check", false, "list files that are not formatted and exit with non-zero, without changing them. Same as --test")
 	exclude := cmd.Flags().StringSliceP("exclude", "e", []string{"**/.*", ".*", "**/vendor/**", "vendor/**"}, "globs to exclude")
 	verbose := cmd.Flags().BoolP("verbose", "v", false, "print each checked file")
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
+		*test = *test || *check
+
 		if len(args) == 1 && args[0] == ArgStdin {
 			return fmtStdin(*test)
 		}
@@ -3,8 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 
@@ -22,9 +26,18 @@ func evalCmd() *cli.Command {
 
 	getExtCode := extCodeParser(cmd.Flags())
 
+	allowEnv := allowEnvFlag(cmd.Flags())
+	getFreezeTime := freezeTimeFlag(cmd.Flags())
+	getTraceOut := tracesFlag(cmd.Flags())
+	valuesFiles := valuesFlag(cmd.Flags())
+
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		raw, err := tanka.Eval(args[0],
 			tanka.WithExtCode(getExtCode()),
+			tanka.WithAllowEnv(*allowEnv),
+			tanka.WithFreezeTime(getFreezeTime()),
+			tanka.WithTraceOut(getTraceOut()),
+			tanka.WithValuesFiles(*valuesFiles),
 		)
 
 		if err != nil {
@@ -49,12 +62,27 @@ func extCodeParser(fs *pflag.FlagSet) func() map[string]string {
 	values := fs.StringArrayP("extCode", "e", nil, "Inject any Jsonnet from the outside (Format: key=<code>)")
 	strs := fs.StringArray("extVar", nil, "Inject a string from the outside (Format: key=value)")
 
+	return codeParser("extCode", values, strs)
+}
+
+// tlaCodeParser registers --tlaCode and --tlaVar, which pass top level
+// arguments
+func tlaCodeParser(fs *pflag.FlagSet) func() map[string]string {
+	values := fs.StringArray("tlaCode", nil, "Pass a top level argument as Jsonnet (Format: key=<code>)")
+	strs := fs.StringArray("tlaVar", nil, "Pass a top level argument as a string (Format: key=value)")
+
+	return codeParser("tlaCode", values, strs)
+}
+
+// codeParser parses `key=value` pairs of code and strings, quoting the latter
+// so that both can be passed as code
+func codeParser(name string, values, strs *[]string) func() map[string]string {
 	return func() map[string]string {
 		m := make(map[string]string)
 		for _, s := range *values {
 			split := strings.SplitN(s, "=", 2)
 			if len(split) != 2 {
-				log.Fatalf("extCode argument has wrong format: `%s`. Expected `key=<code>`", s)
+				log.Fatalf("%s argument has wrong format: `%s`. Expected `key=<code>`", name, s)
 			}
 			m[split[0]] = split[1]
 		}
@@ -62,10 +90,51 @@ func extCodeParser(fs *pflag.FlagSet) func() map[string]string {
 		for _, s := range *strs {
 			split := strings.SplitN(s, "=", 2)
 			if len(split) != 2 {
-				log.Fatalf("extCode argument has wrong format: `%s`. Expected `key=<value>`", s)
+				log.Fatalf("%s argument has wrong format: `%s`. Expected `key=<value>`", name, s)
 			}
 			m[split[0]] = fmt.Sprintf(`"%s"`, split[1])
 		}
 		return m
 	}
 }
+
+// allowEnvFlag registers --allow-env, which permits `std.native('getenv')`
+func allowEnvFlag(fs *pflag.FlagSet) *bool {
+	return fs.Bool("allow-env", false, "allow Jsonnet to read environment variables using std.native('getenv'). Makes evaluation depend on the host")
+}
+
+// freezeTimeFlag registers --freeze-time, which makes `std.native('now')`
+// return a fixed time
+func freezeTimeFlag(fs *pflag.FlagSet) func() time.Time {
+	value := fs.String("freeze-time", "", "make std.native('now') return this time instead of the current one, for reproducible output (Format: RFC 3339, e.g. 2020-11-01T12:00:00Z)")
+
+	return func() time.Time {
+		if *value == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, *value)
+		if err != nil {
+			log.Fatalf("freeze-time argument has wrong format: `%s`. Expected RFC 3339, e.g. `2020-11-01T12:00:00Z`", *value)
+		}
+		return t
+	}
+}
+
+// valuesFlag registers --values, which merges values files into those of
+// spec.valuesFiles
+func valuesFlag(fs *pflag.FlagSet) *[]string {
+	return fs.StringArray("values", nil, "merge this YAML or JSON file into std.extVar('tanka.dev/values'), after spec.valuesFiles. Can be given multiple times, later ones win")
+}
+
+// tracesFlag registers --traces, which controls whether the messages of
+// `std.trace` are printed to stderr
+func tracesFlag(fs *pflag.FlagSet) func() io.Writer {
+	show := fs.Bool("traces", true, "print the messages of std.trace to stderr, prefixed with the location of the call")
+
+	return func() io.Writer {
+		if !*show {
+			return ioutil.Discard
+		}
+		return os.Stderr
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,7 +11,10 @@ import (
 
 	"github.com/go-clix/cli"
 
+	"github.com/grafana/tanka/pkg/jsonnet"
 	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/process"
 	"github.com/grafana/tanka/pkg/spec"
 	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 )
@@ -40,6 +44,7 @@ func main() {
 		showCmd(),
 		diffCmd(),
 		pruneCmd(),
+		deleteCmd(),
 	)
 
 	rootCmd.AddCommand(
@@ -58,10 +63,50 @@ func main() {
 
 	// Run!
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatalln(err)
+		log.Println(err)
+		os.Exit(exitStatus(err))
 	}
 }
 
+// exit codes for failures, so automation can tell them apart
+const (
+	// any other error
+	ExitStatusError = 1
+	// Jsonnet failed to evaluate
+	ExitStatusEval = 2
+	// the evaluated Jsonnet is not a valid set of Kubernetes objects
+	ExitStatusValidation = 3
+	// talking to the cluster failed
+	ExitStatusCluster = 4
+	// no object could be applied
+	ExitStatusApplyFailed = 5
+	// some objects were applied, others failed
+	ExitStatusApplyPartial = 6
+)
+
+func exitStatus(err error) int {
+	var (
+		evalErr       jsonnet.EvalError
+		validationErr process.ValidationError
+		clusterErr    kubernetes.ClusterError
+		applyErr      kubernetes.ErrorApplyFailed
+	)
+
+	switch {
+	case errors.As(err, &applyErr) && applyErr.Partial():
+		return ExitStatusApplyPartial
+	case errors.As(err, &applyErr):
+		return ExitStatusApplyFailed
+	case errors.As(err, &evalErr):
+		return ExitStatusEval
+	case errors.As(err, &validationErr):
+		return ExitStatusValidation
+	case errors.As(err, &clusterErr):
+		return ExitStatusCluster
+	}
+	return ExitStatusError
+}
+
 func setupConfiguration(baseDir string) *v1alpha1.Config {
 	_, baseDir, rootDir, err := jpath.Resolve(baseDir)
 	if err != nil {
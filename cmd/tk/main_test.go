@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes"
+)
+
+// TestExitStatusApply checks that failed applies exit with a status telling
+// partial from total failures apart
+func TestExitStatusApply(t *testing.T) {
+	denied := errors.New("Service/grafana: admission webhook denied the request")
+
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "partial",
+			err:  kubernetes.ClusterError{Err: kubernetes.ErrorApplyFailed{Count: 1, Applied: 3}},
+			want: ExitStatusApplyPartial,
+		},
+		{
+			name: "partialAbort",
+			err:  kubernetes.ClusterError{Err: kubernetes.ErrorApplyFailed{Count: 1, Applied: 3, Err: denied}},
+			want: ExitStatusApplyPartial,
+		},
+		{
+			name: "total",
+			err:  kubernetes.ClusterError{Err: kubernetes.ErrorApplyFailed{Count: 4}},
+			want: ExitStatusApplyFailed,
+		},
+		{
+			name: "totalAbort",
+			err:  kubernetes.ClusterError{Err: kubernetes.ErrorApplyFailed{Count: 1, Err: denied}},
+			want: ExitStatusApplyFailed,
+		},
+		{
+			name: "cluster",
+			err:  kubernetes.ClusterError{Err: errors.New("connection refused")},
+			want: ExitStatusCluster,
+		},
+		{
+			// github.com/pkg/errors must support unwrapping
+			name: "wrapped",
+			err:  pkgerrors.Wrap(kubernetes.ClusterError{Err: errors.New("connection refused")}, "diffing"),
+			want: ExitStatusCluster,
+		},
+		{
+			name: "other",
+			err:  errors.New("Reading manifests from stdin requires --dangerous-auto-approve"),
+			want: ExitStatusError,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, exitStatus(c.err))
+		})
+	}
+}
+
+// TestPruneDryRun checks that tk prune only deletes with --yes, and that auto
+// approval without it fails instead of silently listing the objects
+func TestPruneDryRun(t *testing.T) {
+	cases := []struct {
+		name                     string
+		yes, dryRun, autoApprove bool
+		want                     bool
+		err                      bool
+	}{
+		{name: "default", want: true},
+		{name: "dryRun", dryRun: true, want: true},
+		{name: "yes", yes: true},
+		{name: "autoApprove", yes: true, autoApprove: true},
+		{name: "autoApproveWithoutYes", autoApprove: true, err: true},
+		{name: "yesAndDryRun", yes: true, dryRun: true, err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := pruneDryRun(c.yes, c.dryRun, c.autoApprove)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
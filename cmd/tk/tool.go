@@ -13,6 +13,7 @@ import (
 
 	"github.com/grafana/tanka/pkg/jsonnet"
 	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/tanka"
 )
 
 func toolCmd() *cli.Command {
@@ -22,6 +23,7 @@ func toolCmd() *cli.Command {
 	}
 	cmd.AddCommand(jpathCmd())
 	cmd.AddCommand(importsCmd())
+	cmd.AddCommand(jsonnetCmd())
 	return cmd
 }
 
@@ -50,6 +52,73 @@ func jpathCmd() *cli.Command {
 	return cmd
 }
 
+func jsonnetCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "jsonnet <file>",
+		Short: "evaluate a file or snippet using the jpath and native functions of Tanka, without any post-processing",
+		Args:  cli.ArgsExact(1),
+	}
+
+	snippet := cmd.Flags().Bool("exec", false, "treat the argument as a Jsonnet snippet instead of a file")
+	getExtCode := extCodeParser(cmd.Flags())
+	getTLACode := tlaCodeParser(cmd.Flags())
+	allowEnv := allowEnvFlag(cmd.Flags())
+	getFreezeTime := freezeTimeFlag(cmd.Flags())
+	getTraceOut := tracesFlag(cmd.Flags())
+	valuesFiles := valuesFlag(cmd.Flags())
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		valuesKey, values, err := tanka.ValuesExtCode(*valuesFiles)
+		if err != nil {
+			return err
+		}
+
+		mods := []jsonnet.Modifier{
+			jsonnet.WithExtCode(valuesKey, values),
+			jsonnet.WithAllowEnv(*allowEnv),
+		}
+		if t := getFreezeTime(); !t.IsZero() {
+			mods = append(mods, jsonnet.WithFreezeTime(t))
+		}
+		for k, v := range getExtCode() {
+			mods = append(mods, jsonnet.WithExtCode(k, v))
+		}
+		for k, v := range getTLACode() {
+			mods = append(mods, jsonnet.WithTLACode(k, v))
+		}
+
+		var out string
+		eval := func() (err error) {
+			if !*snippet {
+				out, err = jsonnet.EvaluateFile(args[0], mods...)
+				return err
+			}
+
+			// snippets use the jpath of the working directory, if it is
+			// part of a project
+			pwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			path, _, _, err := jpath.Resolve(pwd)
+			if err != nil {
+				path = []string{pwd}
+			}
+
+			out, err = jsonnet.Evaluate(args[0], path, mods...)
+			return err
+		}
+
+		if err := jsonnet.CaptureTraces(getTraceOut(), eval); err != nil {
+			return err
+		}
+		fmt.Print(out)
+		return nil
+	}
+
+	return cmd
+}
+
 func importsCmd() *cli.Command {
 	cmd := &cli.Command{
 		Use:   "imports <directory>",
@@ -88,6 +157,11 @@ func importsCmd() *cli.Command {
 			return fmt.Errorf("Resolving imports: %s", err)
 		}
 
+		// deps are relative to the project root, git paths to the repository
+		_, _, projectRoot, err := jpath.Resolve(dir)
+		if err != nil {
+			return fmt.Errorf("Resolving JPATH: %s", err)
+		}
 		root, err := gitRoot()
 		if err != nil {
 			return fmt.Errorf("Invoking git: %s", err)
@@ -95,12 +169,9 @@ func importsCmd() *cli.Command {
 		if modFiles != nil {
 			for _, m := range modFiles {
 				mod := filepath.Join(root, m)
-				if err != nil {
-					return err
-				}
 
 				for _, dep := range deps {
-					if mod == dep {
+					if mod == filepath.Join(projectRoot, dep) {
 						fmt.Printf("Rebuild required. File `%s` imports `%s`, which has been changed in `%s`.\n", args[0], dep, *check)
 						os.Exit(16)
 					}
@@ -43,6 +43,41 @@ func fPageln(r io.Reader) {
 	}
 }
 
+// pager pages everything written to it using fPageln, which is started on the
+// first write. Close waits for the pager to exit
+type pager struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+}
+
+func (p *pager) Write(b []byte) (int, error) {
+	if p.pw == nil {
+		pr, pw := io.Pipe()
+		p.pw, p.done = pw, make(chan struct{})
+		go func() {
+			fPageln(pr)
+			pr.Close()
+			close(p.done)
+		}()
+	}
+
+	// quitting the pager early discards the rest
+	if _, err := p.pw.Write(b); err != nil && err != io.ErrClosedPipe {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close ends the input of the pager and waits for it to exit
+func (p *pager) Close() error {
+	if p.pw == nil {
+		return nil
+	}
+	err := p.pw.Close()
+	<-p.done
+	return err
+}
+
 // writeJSON writes the given object to the path as a JSON file
 func writeJSON(i interface{}, path string) error {
 	out, err := json.MarshalIndent(i, "", "  ")
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/posener/complete"
 	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/go-clix/cli"
 
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
 	"github.com/grafana/tanka/pkg/process"
 	"github.com/grafana/tanka/pkg/tanka"
-	"github.com/grafana/tanka/pkg/term"
 )
 
 // special exit codes for tk diff
@@ -21,8 +29,15 @@ const (
 	ExitStatusClean = 0
 	// differences between the local config and the cluster
 	ExitStatusDiff = 16
+	// the differences create or delete objects, which is forbidden using
+	// --fail-on-add or --fail-on-delete
+	ExitStatusPolicy = 17
 )
 
+// progressLogInterval is how often apply reports progress when stderr is not a
+// terminal
+const progressLogInterval = 10 * time.Second
+
 type workflowFlagVars struct {
 	targets []string
 }
@@ -33,6 +48,48 @@ func workflowFlags(fs *pflag.FlagSet) *workflowFlagVars {
 	return &v
 }
 
+// clusterConcurrencyFlag registers --max-cluster-concurrency. The returned
+// function creates the limiter to share among all kubectl commands of the
+// run, see tanka.WithClusterLimiter.
+func clusterConcurrencyFlag(fs *pflag.FlagSet) func() *client.Limiter {
+	n := fs.Int("max-cluster-concurrency", 0, "run at most this many kubectl commands at once, e.g. to avoid rate limits of the API server (0 is unlimited)")
+	return func() *client.Limiter {
+		return client.NewLimiter(*n)
+	}
+}
+
+// tempDirFlag registers --tmp-dir, defaulting to $TANKA_TMPDIR. The returned
+// function returns the directory to create temporary files below, failing if
+// it is not writable. Empty is the system default.
+func tempDirFlag(fs *pflag.FlagSet) func() (string, error) {
+	dir := fs.String("tmp-dir", os.Getenv("TANKA_TMPDIR"), "create temporary files below this directory instead of the system default ($TANKA_TMPDIR)")
+	return func() (string, error) {
+		return util.CheckTempDir(*dir)
+	}
+}
+
+// pruneResourcesFlag registers --prune-resources-file. The returned function
+// reads the resource types of the file, nil if none is given.
+func pruneResourcesFlag(fs *pflag.FlagSet) func() ([]kubernetes.PruneResource, error) {
+	file := fs.String("prune-resources-file", "", "YAML or JSON list of the only types of objects (<group>/<version>/<kind>) to prune")
+	return func() ([]kubernetes.PruneResource, error) {
+		if *file == "" {
+			return nil, nil
+		}
+
+		f, err := os.Open(*file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return kubernetes.ReadPruneResources(f)
+	}
+}
+
+// defaultMaxErrors is how many failed objects are listed by default, so that
+// a broken environment does not flood the terminal
+const defaultMaxErrors = 100
+
 func applyCmd() *cli.Command {
 	cmd := &cli.Command{
 		Use:   "apply <path>",
@@ -44,20 +101,99 @@ func applyCmd() *cli.Command {
 	force := cmd.Flags().Bool("force", false, "force applying (kubectl apply --force)")
 	validate := cmd.Flags().Bool("validate", true, "validation of resources (kubectl --validate=false)")
 	autoApprove := cmd.Flags().Bool("dangerous-auto-approve", false, "skip interactive approval. Only for automation!")
+	objectTimeout := cmd.Flags().Duration("object-timeout", 0, "abort applying a single object after this duration (e.g. 30s)")
+	waveTimeout := cmd.Flags().Duration("wave-timeout", 5*time.Minute, "how long to wait for the objects of an apply wave (tanka.dev/apply-wave) to become ready")
+	continueOnError := cmd.Flags().Bool("continue-on-error", false, "keep applying the remaining objects when one fails")
+	parallelism := cmd.Flags().Int("parallelism", 1, "how many objects of an apply wave to apply at once")
+	filename := cmd.Flags().StringP("filename", "f", "", "apply pre-rendered manifests from this file (or '-' for stdin) instead of evaluating Jsonnet")
+	diff := cmd.Flags().Bool("diff", false, "diff and apply against the same fetched live state. Objects changed in between fail to apply")
+	onlyChanged := cmd.Flags().Bool("only-changed", false, "apply only the objects that differ from the live state or their last-applied-configuration, skipping unchanged ones")
+	since := cmd.Flags().String("since", "", "skip applying if none of the files the environment imports changed in git since this ref (e.g. main)")
+	createNamespace := cmd.Flags().Bool("create-namespace", false, "create spec.namespace (labeled like the environment) if it does not exist on the cluster")
+	skipAuthCheck := cmd.Flags().Bool("skip-auth-check", false, "don't check the permissions required for applying (kubectl auth can-i) beforehand")
+	serverSide := cmd.Flags().Bool("server-side", false, "use server-side apply (kubectl apply --server-side --field-manager=tanka)")
+	forceConflicts := cmd.Flags().Bool("force-conflicts", false, "take ownership of fields also managed by others. Requires --server-side")
+	noProgress := cmd.Flags().Bool("no-progress", false, "don't report which object is being applied")
+	maxErrors := cmd.Flags().Int("max-errors", defaultMaxErrors, "list at most this many failed objects (0 lists all)")
+	prune := cmd.Flags().Bool("prune", false, "after applying, delete the objects removed from Jsonnet (see tk prune). These are shown along with the diff")
+	getPruneResources := pruneResourcesFlag(cmd.Flags())
 	getExtCode := extCodeParser(cmd.Flags())
+	allowEnv := allowEnvFlag(cmd.Flags())
+	getFreezeTime := freezeTimeFlag(cmd.Flags())
+	getTraceOut := tracesFlag(cmd.Flags())
+	valuesFiles := valuesFlag(cmd.Flags())
+
+	getClusterLimiter := clusterConcurrencyFlag(cmd.Flags())
+	getTempDir := tempDirFlag(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		err := tanka.Apply(args[0],
+		tempDir, err := getTempDir()
+		if err != nil {
+			return err
+		}
+
+		mods := []tanka.Modifier{
 			tanka.WithTargets(stringsToRegexps(vars.targets)),
 			tanka.WithExtCode(getExtCode()),
+			tanka.WithAllowEnv(*allowEnv),
+			tanka.WithFreezeTime(getFreezeTime()),
+			tanka.WithTraceOut(getTraceOut()),
+			tanka.WithValuesFiles(*valuesFiles),
+			tanka.WithTempDir(tempDir),
+			tanka.WithClusterLimiter(getClusterLimiter()),
 			tanka.WithApplyForce(*force),
 			tanka.WithApplyValidate(*validate),
 			tanka.WithApplyAutoApprove(*autoApprove),
-		)
+			tanka.WithApplyObjectTimeout(*objectTimeout),
+			tanka.WithApplyWaveTimeout(*waveTimeout),
+			tanka.WithApplyContinueOnError(*continueOnError),
+			tanka.WithApplyParallelism(*parallelism),
+			tanka.WithApplyDiff(*diff),
+			tanka.WithApplyOnlyChanged(*onlyChanged),
+			tanka.WithApplySince(*since),
+			tanka.WithApplyCreateNamespace(*createNamespace),
+			tanka.WithApplySkipAuthCheck(*skipAuthCheck),
+			tanka.WithApplyServerSide(*serverSide),
+			tanka.WithApplyForceConflicts(*forceConflicts),
+			tanka.WithApplyPrune(*prune),
+			tanka.WithMaxErrors(*maxErrors),
+		}
+
+		resources, err := getPruneResources()
 		if err != nil {
 			return err
 		}
-		return nil
+		mods = append(mods, tanka.WithPruneResources(resources))
+
+		if !*noProgress {
+			// one line per object on a terminal, occasional ones in logs
+			interval := time.Duration(0)
+			if !terminal.IsTerminal(int(os.Stderr.Fd())) {
+				interval = progressLogInterval
+			}
+			mods = append(mods, tanka.WithApplyProgress(os.Stderr, interval))
+		}
+
+		if *forceConflicts && !*serverSide {
+			return fmt.Errorf("--force-conflicts requires --server-side")
+		}
+		if *force && *serverSide {
+			return fmt.Errorf("--force cannot be used with --server-side, use --force-conflicts instead")
+		}
+
+		if *filename == ArgStdin && !*autoApprove {
+			return fmt.Errorf("Reading manifests from stdin requires --dangerous-auto-approve, because the confirmation prompt reads from stdin as well")
+		}
+		if *filename != "" {
+			r, err := openManifests(*filename)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			mods = append(mods, tanka.WithManifests(r))
+		}
+
+		return tanka.Apply(args[0], mods...)
 	}
 	return cmd
 }
@@ -70,14 +206,109 @@ func pruneCmd() *cli.Command {
 	}
 
 	getExtCode := extCodeParser(cmd.Flags())
+
+	allowEnv := allowEnvFlag(cmd.Flags())
+	getFreezeTime := freezeTimeFlag(cmd.Flags())
+	getTraceOut := tracesFlag(cmd.Flags())
+	valuesFiles := valuesFlag(cmd.Flags())
 	autoApprove := cmd.Flags().Bool("dangerous-auto-approve", false, "skip interactive approval. Only for automation!")
 	force := cmd.Flags().Bool("force", false, "force deleting (kubectl delete --force)")
+	gracePeriod := cmd.Flags().Duration("grace-period", 0, "time given to objects to terminate gracefully (kubectl delete --grace-period). Zero uses the default of each object")
+	terminatingTimeout := cmd.Flags().Duration("terminating-timeout", 0, "report objects still terminating after this duration (e.g. because of finalizers) as stuck (default 2m)")
+	removeFinalizers := cmd.Flags().Bool("remove-finalizers", false, "DANGEROUS: remove the finalizers of objects stuck terminating, skipping the cleanup they stand for")
+	yes := cmd.Flags().Bool("yes", false, "prune the objects, after interactive approval. Without it, they are only listed")
+	dryRun := cmd.Flags().Bool("dry-run", false, "only list the objects that would be pruned. This is the default without --yes")
+	getPruneResources := pruneResourcesFlag(cmd.Flags())
+
+	getClusterLimiter := clusterConcurrencyFlag(cmd.Flags())
+	getTempDir := tempDirFlag(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		return tanka.Prune(args[0],
+		listOnly, err := pruneDryRun(*yes, *dryRun, *autoApprove)
+		if err != nil {
+			return err
+		}
+
+		tempDir, err := getTempDir()
+		if err != nil {
+			return err
+		}
+
+		mods := []tanka.Modifier{
 			tanka.WithExtCode(getExtCode()),
+			tanka.WithAllowEnv(*allowEnv),
+			tanka.WithFreezeTime(getFreezeTime()),
+			tanka.WithTraceOut(getTraceOut()),
+			tanka.WithValuesFiles(*valuesFiles),
+			tanka.WithTempDir(tempDir),
+			tanka.WithClusterLimiter(getClusterLimiter()),
 			tanka.WithApplyAutoApprove(*autoApprove),
-			tanka.WithApplyForce(*force),
+			tanka.WithDeleteForce(*force),
+			tanka.WithDeleteGracePeriod(*gracePeriod),
+			tanka.WithDeleteTerminatingTimeout(*terminatingTimeout),
+			tanka.WithDeleteRemoveFinalizers(*removeFinalizers),
+			tanka.WithDeleteDryRun(listOnly),
+		}
+
+		resources, err := getPruneResources()
+		if err != nil {
+			return err
+		}
+		mods = append(mods, tanka.WithPruneResources(resources))
+
+		return tanka.Prune(args[0], mods...)
+	}
+
+	return cmd
+}
+
+// pruneDryRun returns whether tk prune only lists the objects, which it does
+// unless yes is set. Auto approval without yes used to prune, so it is
+// rejected instead of silently pruning nothing.
+func pruneDryRun(yes, dryRun, autoApprove bool) (bool, error) {
+	switch {
+	case yes && dryRun:
+		return false, fmt.Errorf("--yes and --dry-run can't be combined")
+	case autoApprove && !yes:
+		return false, fmt.Errorf("--dangerous-auto-approve requires --yes, without it tk prune only lists the objects")
+	}
+	return !yes, nil
+}
+
+func deleteCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "delete <path>",
+		Short: "delete live objects matching a label selector from the environment's namespace",
+		Args:  workflowArgs,
+	}
+
+	selector := cmd.Flags().StringP("selector", "l", "", "label selector of the objects to delete. Uses the same syntax as kubectl does")
+	autoApprove := cmd.Flags().Bool("dangerous-auto-approve", false, "skip interactive approval. Only for automation!")
+	force := cmd.Flags().Bool("force", false, "force deleting (kubectl delete --force)")
+	gracePeriod := cmd.Flags().Duration("grace-period", 0, "time given to objects to terminate gracefully (kubectl delete --grace-period). Zero uses the default of each object")
+	terminatingTimeout := cmd.Flags().Duration("terminating-timeout", 0, "report objects still terminating after this duration (e.g. because of finalizers) as stuck (default 2m)")
+	removeFinalizers := cmd.Flags().Bool("remove-finalizers", false, "DANGEROUS: remove the finalizers of objects stuck terminating, skipping the cleanup they stand for")
+	dryRun := cmd.Flags().Bool("dry-run", false, "only list the objects that would be deleted")
+
+	getClusterLimiter := clusterConcurrencyFlag(cmd.Flags())
+	getTempDir := tempDirFlag(cmd.Flags())
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		tempDir, err := getTempDir()
+		if err != nil {
+			return err
+		}
+
+		return tanka.Delete(args[0],
+			tanka.WithDeleteSelector(*selector),
+			tanka.WithApplyAutoApprove(*autoApprove),
+			tanka.WithDeleteForce(*force),
+			tanka.WithDeleteGracePeriod(*gracePeriod),
+			tanka.WithDeleteTerminatingTimeout(*terminatingTimeout),
+			tanka.WithDeleteRemoveFinalizers(*removeFinalizers),
+			tanka.WithDeleteDryRun(*dryRun),
+			tanka.WithTempDir(tempDir),
+			tanka.WithClusterLimiter(getClusterLimiter()),
 		)
 	}
 
@@ -86,46 +317,199 @@ func pruneCmd() *cli.Command {
 
 func diffCmd() *cli.Command {
 	cmd := &cli.Command{
-		Use:   "diff <path>",
+		Use:   "diff <path>...",
 		Short: "differences between the configuration and the cluster",
-		Args:  workflowArgs,
+		Args:  multiWorkflowArgs,
 		Predictors: complete.Flags{
-			"diff-strategy": cli.PredictSet("native", "subset"),
+			"diff-strategy": cli.PredictSet("native", "subset", "validate"),
+			"patch-format":  cli.PredictSet("json", "merge"),
+			"output":        cli.PredictSet("text", "json"),
 		},
 	}
 
 	// flags
 	var (
-		vars         = workflowFlags(cmd.Flags())
-		diffStrategy = cmd.Flags().String("diff-strategy", "", "force the diff-strategy to use. Automatically chosen if not set.")
-		summarize    = cmd.Flags().BoolP("summarize", "s", false, "quick summary of the differences, hides file contents")
+		vars          = workflowFlags(cmd.Flags())
+		diffStrategy  = cmd.Flags().String("diff-strategy", "", "force the diff-strategy to use. Automatically chosen if not set. 'validate' only checks the objects against the cluster schemas")
+		summarize     = cmd.Flags().BoolP("summarize", "s", false, "quick summary of the differences, hides file contents")
+		fromSnapshot  = cmd.Flags().String("from-snapshot", "", "diff against previously captured manifests (e.g. from tk show) instead of the cluster")
+		against       = cmd.Flags().String("against-command", "", "diff against the manifests this command prints (e.g. 'tk show <path>' of another Tanka version) instead of the cluster")
+		lastApplied   = cmd.Flags().Bool("last-applied", false, "with --from-snapshot, diff against the last-applied-configuration of each object instead of the full object")
+		ignoreKinds   = cmd.Flags().StringSlice("ignore-kind", nil, "leave objects of this kind out of the diff (Format: <kind> or <group>/<kind>)")
+		includeStatus = cmd.Flags().Bool("include-status", false, "diff the status of objects as well, e.g. for debugging controllers (subset and snapshots only)")
+		patchFormat   = cmd.Flags().String("patch-format", "", "print the changes of each object as a patch instead (Format: json or merge)")
+		explain       = cmd.Flags().Bool("explain", false, "summarize the changes in one line per changed object instead of printing the full diff")
+		nameOnly      = cmd.Flags().Bool("name-only", false, "only list the changed objects, one '<kind>/<name>' per line, e.g. for passing to tk apply --target")
+		withActions   = cmd.Flags().Bool("with-actions", false, "with --name-only, prefix each object by whether it is created, updated or deleted, separated by a tab")
+		ignoreSpace   = cmd.Flags().Bool("ignore-whitespace", false, "ignore CRLF line endings and trailing whitespace in strings (subset and snapshots only)")
+		maxErrors     = cmd.Flags().Int("max-errors", defaultMaxErrors, "list at most this many invalid objects (0 lists all)")
+		revision      = cmd.Flags().Int("revision", 0, "diff against this revision of the rollout history instead (Deployments, StatefulSets and DaemonSets only)")
+		failOnAdd     = cmd.Flags().Bool("fail-on-add", false, fmt.Sprintf("exit with status %d if objects are created", ExitStatusPolicy))
+		failOnDelete  = cmd.Flags().Bool("fail-on-delete", false, fmt.Sprintf("exit with status %d if objects are deleted", ExitStatusPolicy))
+		quietEnvs     = cmd.Flags().Bool("quiet-unchanged-envs", false, "when diffing multiple environments, print only those with changes and count the unchanged ones")
+		withPrune     = cmd.Flags().Bool("with-prune", false, "also show the objects removed from Jsonnet as deleted, like tk prune would delete them")
+		output        = cmd.Flags().String("output", "text", "output format: text or json. json lists the changed objects of each environment, e.g. for CI pipelines")
+		diffTool      = cmd.Flags().String("diff-tool", os.Getenv("TANKA_DIFF_TOOL"), "show the differences using this command (e.g. 'icdiff'), which is given the old and new version of each changed object")
 	)
 
 	getExtCode := extCodeParser(cmd.Flags())
 
+	allowEnv := allowEnvFlag(cmd.Flags())
+	getFreezeTime := freezeTimeFlag(cmd.Flags())
+	getTraceOut := tracesFlag(cmd.Flags())
+	valuesFiles := valuesFlag(cmd.Flags())
+
+	getPruneResources := pruneResourcesFlag(cmd.Flags())
+
+	getClusterLimiter := clusterConcurrencyFlag(cmd.Flags())
+	getTempDir := tempDirFlag(cmd.Flags())
+
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		changes, err := tanka.Diff(args[0],
+		tempDir, err := getTempDir()
+		if err != nil {
+			return err
+		}
+
+		switch *output {
+		case "text":
+		case "json":
+			if *patchFormat != "" || *explain || *nameOnly {
+				return fmt.Errorf("--output json can't be combined with --patch-format, --explain or --name-only")
+			}
+		default:
+			return fmt.Errorf("--output must be one of text or json, not `%s`", *output)
+		}
+
+		mods := []tanka.Modifier{
 			tanka.WithTargets(stringsToRegexps(vars.targets)),
 			tanka.WithExtCode(getExtCode()),
+			tanka.WithAllowEnv(*allowEnv),
+			tanka.WithFreezeTime(getFreezeTime()),
+			tanka.WithTraceOut(getTraceOut()),
+			tanka.WithValuesFiles(*valuesFiles),
+			tanka.WithTempDir(tempDir),
+			tanka.WithClusterLimiter(getClusterLimiter()),
 			tanka.WithDiffStrategy(*diffStrategy),
-			tanka.WithDiffSummarize(*summarize),
-		)
+			// the report summarizes on its own
+			tanka.WithDiffSummarize(*summarize && *output == "text"),
+			tanka.WithDiffIgnoreKinds(*ignoreKinds),
+			tanka.WithDiffIncludeStatus(*includeStatus),
+			tanka.WithDiffPatchFormat(*patchFormat),
+			tanka.WithDiffExplain(*explain),
+			tanka.WithDiffNameOnly(*nameOnly),
+			tanka.WithDiffNameActions(*withActions),
+			tanka.WithDiffIgnoreWhitespace(*ignoreSpace),
+			tanka.WithMaxErrors(*maxErrors),
+			tanka.WithDiffRevision(*revision),
+			tanka.WithDiffLastApplied(*lastApplied),
+			tanka.WithDiffFailOnAdd(*failOnAdd),
+			tanka.WithDiffFailOnDelete(*failOnDelete),
+			tanka.WithDiffPrune(*withPrune),
+		}
+
+		resources, err := getPruneResources()
 		if err != nil {
 			return err
 		}
+		mods = append(mods, tanka.WithPruneResources(resources))
+
+		if *fromSnapshot != "" {
+			if len(args) > 1 {
+				return fmt.Errorf("--from-snapshot can only be used with a single environment")
+			}
+			r, err := openManifests(*fromSnapshot)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			mods = append(mods, tanka.WithDiffSnapshot(r))
+		}
+		if *against != "" {
+			if len(args) > 1 {
+				return fmt.Errorf("--against-command can only be used with a single environment")
+			}
+			mods = append(mods, tanka.WithDiffAgainstCommand(strings.Fields(*against)))
+		}
+
+		if *output == "json" {
+			diffs, err := diffEnvs(args, tanka.Diff, mods)
+			if err != nil {
+				return err
+			}
+			status, err := writeEnvReports(os.Stdout, diffs, *summarize)
+			if err != nil {
+				return err
+			}
+			os.Exit(status)
+		}
+
+		// only actual diffs are colored or shown using the diff tool
+		actualDiff := *patchFormat == "" && !*explain && !*nameOnly
+		colorize := interactive && actualDiff
+		var tool []string
+		if actualDiff && !*summarize {
+			tool = strings.Fields(*diffTool)
+		}
+		// the tool is given the entire objects, not just the hunks
+		mods = append(mods, tanka.WithDiffFullContext(len(tool) > 0))
+		render := diffRenderer(colorize, tool, tempDir)
+
+		// one section per environment
+		if len(args) > 1 || *quietEnvs {
+			diffs, err := diffEnvs(args, tanka.Diff, mods)
+			if err != nil {
+				return err
+			}
+
+			var buf bytes.Buffer
+			status := writeEnvDiffs(&buf, diffs, *quietEnvs, render)
+			if interactive {
+				fPageln(&buf)
+			} else {
+				fmt.Print(buf.String())
+			}
+			os.Exit(status)
+		}
+
+		// the diff of each object is shown as soon as it is computed
+		stream := actualDiff && !*summarize && *revision == 0
+		var out io.Writer = os.Stdout
+		p := &pager{}
+		if colorize {
+			out = p
+		}
+		if stream {
+			mods = append(mods, tanka.WithDiffStream(renderWriter{w: out, render: render}))
+		}
+
+		changes, err := tanka.Diff(args[0], mods...)
+		p.Close()
+		policyErr, violated := err.(tanka.ErrorDiffPolicy)
+		if err != nil && !violated {
+			return err
+		}
 
 		if changes == nil {
 			log.Println("No differences.")
 			os.Exit(ExitStatusClean)
 		}
 
-		if interactive {
-			r := term.Colordiff(*changes)
-			fPageln(r)
-		} else {
-			fmt.Println(*changes)
+		switch {
+		case stream:
+			// already shown, except for the final newline of Println
+			if !colorize {
+				fmt.Println()
+			}
+		case colorize:
+			fPageln(strings.NewReader(render(*changes)))
+		default:
+			fmt.Println(render(*changes))
 		}
 
+		if violated {
+			log.Println(policyErr)
+			os.Exit(ExitStatusPolicy)
+		}
 		os.Exit(ExitStatusDiff)
 		return nil
 	}
@@ -142,6 +526,10 @@ func showCmd() *cli.Command {
 	vars := workflowFlags(cmd.Flags())
 	allowRedirect := cmd.Flags().Bool("dangerous-allow-redirect", false, "allow redirecting output to a file or a pipe.")
 	getExtCode := extCodeParser(cmd.Flags())
+	allowEnv := allowEnvFlag(cmd.Flags())
+	getFreezeTime := freezeTimeFlag(cmd.Flags())
+	getTraceOut := tracesFlag(cmd.Flags())
+	valuesFiles := valuesFlag(cmd.Flags())
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		if !interactive && !*allowRedirect {
 			fmt.Fprintln(os.Stderr, `Redirection of the output of tk show is discouraged and disabled by default.
@@ -152,6 +540,10 @@ Otherwise run tk show --dangerous-allow-redirect to bypass this check.`)
 
 		pretty, err := tanka.Show(args[0],
 			tanka.WithExtCode(getExtCode()),
+			tanka.WithAllowEnv(*allowEnv),
+			tanka.WithFreezeTime(getFreezeTime()),
+			tanka.WithTraceOut(getTraceOut()),
+			tanka.WithValuesFiles(*valuesFiles),
 			tanka.WithTargets(stringsToRegexps(vars.targets)),
 		)
 		if err != nil {
@@ -164,6 +556,20 @@ Otherwise run tk show --dangerous-allow-redirect to bypass this check.`)
 	return cmd
 }
 
+// openManifests opens the file holding pre-rendered manifests. ArgStdin reads
+// from stdin instead.
+func openManifests(name string) (io.ReadCloser, error) {
+	if name == ArgStdin {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("Opening manifests: %s", err)
+	}
+	return f, nil
+}
+
 func stringsToRegexps(exps []string) process.Matchers {
 	regexs, err := process.StrExps(exps...)
 	if err != nil {
@@ -48,6 +48,7 @@ export default {
     "Output filtering",
     "Exporting as YAML",
     "Garbage collection",
+    "Apply waves",
     "Command-line completion",
     "Diff strategies",
 
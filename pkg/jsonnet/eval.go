@@ -3,6 +3,8 @@ package jsonnet
 import (
 	"io/ioutil"
 	"path/filepath"
+	"sync"
+	"time"
 
 	jsonnet "github.com/google/go-jsonnet"
 	"github.com/pkg/errors"
@@ -22,29 +24,102 @@ func EvaluateFile(jsonnetFile string, mods ...Modifier) (string, error) {
 		return "", err
 	}
 
-	jpath, _, _, err := jpath.Resolve(filepath.Dir(jsonnetFile))
+	jpath, _, rootDir, err := jpath.Resolve(filepath.Dir(jsonnetFile))
 	if err != nil {
 		return "", errors.Wrap(err, "resolving jpath")
 	}
-	return Evaluate(string(bytes), jpath, mods...)
+	return evaluate(filepath.Dir(jsonnetFile), rootDir, filepath.Base(jsonnetFile), string(bytes), jpath, mods...)
 }
 
-// Evaluate renders the given jsonnet into a string
+// Evaluate renders the given jsonnet into a string. Relative paths (e.g. of
+// kustomize or helmTemplate) are resolved against the working directory, which
+// configMapFromDir may not read outside of.
 func Evaluate(sonnet string, jpath []string, mods ...Modifier) (string, error) {
+	return evaluate("", "", "main.jsonnet", sonnet, jpath, mods...)
+}
+
+// evaluate renders the given jsonnet into a string. filename is used for error
+// messages, baseDir for resolving relative paths passed to native functions.
+// Native functions reading files are limited to rootDir.
+func evaluate(baseDir, rootDir, filename, sonnet string, jpath []string, mods ...Modifier) (string, error) {
+	vm, err := makeVM(baseDir, rootDir, jpath, mods...)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := vm.EvaluateSnippet(filename, sonnet)
+	if err != nil {
+		return "", EvalError{Err: err}
+	}
+	return out, nil
+}
+
+// Evaluator evaluates many snippets on the same VM, so that the files they
+// import are only parsed once. It is safe for concurrent use.
+type Evaluator struct {
+	mu sync.Mutex
+	vm *jsonnet.VM
+}
+
+// NewEvaluator returns an Evaluator set up like Evaluate
+func NewEvaluator(jpath []string, mods ...Modifier) (*Evaluator, error) {
+	vm, err := makeVM("", "", jpath, mods...)
+	if err != nil {
+		return nil, err
+	}
+	return &Evaluator{vm: vm}, nil
+}
+
+// Evaluate renders the given jsonnet into a string, like Evaluate does
+func (e *Evaluator) Evaluate(sonnet string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out, err := e.vm.EvaluateSnippet("main.jsonnet", sonnet)
+	if err != nil {
+		return "", EvalError{Err: err}
+	}
+	return out, nil
+}
+
+// makeVM returns a VM with the importer and native functions of Tanka,
+// modified by mods
+func makeVM(baseDir, rootDir string, jpath []string, mods ...Modifier) (*jsonnet.VM, error) {
 	vm := jsonnet.MakeVM()
 	vm.Importer(NewExtendedImporter(jpath))
 
+	for _, nf := range native.Funcs() {
+		vm.NativeFunction(nf)
+	}
+	vm.NativeFunction(native.Kustomize(baseDir, nil))
+	vm.NativeFunction(native.HelmTemplate(baseDir, nil))
+	vm.NativeFunction(native.ConfigMapFromDir(baseDir, rootDir))
+	vm.NativeFunction(native.Getenv(false))
+	vm.NativeFunction(native.Now(time.Now))
+
+	// after the native functions, so these can be replaced
 	for _, mod := range mods {
 		if err := mod(vm); err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
-	for _, nf := range native.Funcs() {
-		vm.NativeFunction(nf)
-	}
+	return vm, nil
+}
+
+// EvalError occurs when the Jsonnet VM fails to evaluate, e.g. because of a
+// syntax error, a failed import or an `error` expression
+type EvalError struct {
+	Err error
+}
+
+func (e EvalError) Error() string {
+	return "evaluating jsonnet: " + e.Err.Error()
+}
 
-	return vm.EvaluateSnippet("main.jsonnet", sonnet)
+// Unwrap returns the underlying error of the Jsonnet VM
+func (e EvalError) Unwrap() error {
+	return e.Err
 }
 
 // WithExtCode allows to make the supplied snippet available to Jsonnet as an
@@ -55,3 +130,30 @@ func WithExtCode(key, code string) Modifier {
 		return nil
 	}
 }
+
+// WithTLACode passes the supplied snippet as the top level argument key, used
+// if the evaluated file is a function
+func WithTLACode(key, code string) Modifier {
+	return func(vm *jsonnet.VM) error {
+		vm.TLACode(key, code)
+		return nil
+	}
+}
+
+// WithAllowEnv allows the `getenv` native function to read environment
+// variables, which otherwise fails
+func WithAllowEnv(b bool) Modifier {
+	return func(vm *jsonnet.VM) error {
+		vm.NativeFunction(native.Getenv(b))
+		return nil
+	}
+}
+
+// WithFreezeTime makes the `now` native function always return t, so that the
+// output does not depend on the time of evaluation
+func WithFreezeTime(t time.Time) Modifier {
+	return func(vm *jsonnet.VM) error {
+		vm.NativeFunction(native.Now(func() time.Time { return t }))
+		return nil
+	}
+}
@@ -0,0 +1,86 @@
+package jsonnet
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvaluateError checks that failures of the Jsonnet VM are reported as
+// EvalError
+func TestEvaluateError(t *testing.T) {
+	cases := map[string]string{
+		"syntax": `{ foo: }`,
+		"error":  `{ foo: error "boom" }`,
+		"import": `import "missing.libsonnet"`,
+		"extVar": `std.extVar("missing")`,
+	}
+
+	for name, sonnet := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Evaluate(sonnet, nil)
+			require.Error(t, err)
+
+			var evalErr EvalError
+			assert.True(t, errors.As(err, &evalErr), "expected EvalError, got %T", err)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	out, err := Evaluate(`{ foo: "bar" }`, nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"foo": "bar"}`, out)
+}
+
+// TestEvaluateSnippet checks that snippets have access to the native functions
+// of Tanka, along with ext vars and top level arguments
+func TestEvaluateSnippet(t *testing.T) {
+	out, err := Evaluate(`function(replicas) {
+  config: std.native("parseYaml")("port: 3000")[0],
+  replicas: replicas,
+  env: std.extVar("env"),
+}`, nil,
+		WithExtCode("env", `"prod"`),
+		WithTLACode("replicas", "3"),
+	)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"config": {"port": 3000}, "replicas": 3, "env": "prod"}`, out)
+}
+
+// TestEvaluateAllowEnv checks that `getenv` is available, but only reads the
+// environment once allowed
+func TestEvaluateAllowEnv(t *testing.T) {
+	const sonnet = `std.native("getenv")("TANKA_TEST_MISSING", "dev")`
+
+	_, err := Evaluate(sonnet, nil)
+	var evalErr EvalError
+	require.True(t, errors.As(err, &evalErr), "expected EvalError, got %v", err)
+	assert.Contains(t, err.Error(), "requires --allow-env")
+
+	out, err := Evaluate(sonnet, nil, WithAllowEnv(true))
+	require.NoError(t, err)
+	assert.JSONEq(t, `"dev"`, out)
+}
+
+// TestEvaluateFreezeTime checks that `now` returns the current time, unless
+// frozen
+func TestEvaluateFreezeTime(t *testing.T) {
+	const sonnet = `std.native("now")()`
+
+	before := time.Now().UTC().Truncate(time.Second)
+	out, err := Evaluate(sonnet, nil)
+	require.NoError(t, err)
+	var now time.Time
+	require.NoError(t, json.Unmarshal([]byte(out), &now))
+	assert.False(t, now.Before(before), "%s is before %s", now, before)
+
+	frozen := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	out, err = Evaluate(sonnet, nil, WithFreezeTime(frozen))
+	require.NoError(t, err)
+	assert.JSONEq(t, `"2020-11-01T12:00:00Z"`, out)
+}
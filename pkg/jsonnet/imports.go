@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	jsonnet "github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
@@ -16,21 +17,45 @@ import (
 
 // TransitiveImports returns all recursive imports of an environment
 func TransitiveImports(dir string) ([]string, error) {
-	dir, err := filepath.Abs(dir)
+	deps, err := TransitiveDeps(dir, []string{"main.jsonnet"})
 	if err != nil {
 		return nil, err
 	}
+	return deps.Imports, nil
+}
 
-	dir, err = filepath.EvalSymlinks(dir)
+// Deps are the local files evaluating an environment reads
+type Deps struct {
+	// Imports are the evaluated files and all their recursive imports,
+	// relative to the project root
+	Imports []string
+	// Dirs are the absolute directories read by native functions, such as the
+	// local charts of `helmTemplate`
+	Dirs []string
+	// Dynamic lists the calls of such native functions (by location) whose
+	// directory is only known once evaluated, so that it isn't part of Dirs
+	Dynamic []string
+}
+
+// dirFuncs are the native functions reading local directories, along with the
+// position of that argument
+var dirFuncs = map[string]int{
+	"helmTemplate":     1,
+	"kustomize":        0,
+	"configMapFromDir": 1,
+}
+
+// TransitiveDeps returns the dependencies of evaluating the given files
+// (relative to the environment at dir), see Deps
+func TransitiveDeps(dir string, files []string) (*Deps, error) {
+	dir, err := filepath.Abs(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	mainFile := filepath.Join(dir, "main.jsonnet")
-
-	sonnet, err := ioutil.ReadFile(mainFile)
+	dir, err = filepath.EvalSymlinks(dir)
 	if err != nil {
-		return nil, errors.Wrap(err, "opening file")
+		return nil, err
 	}
 
 	jpath, _, rootDir, err := jpath.Resolve(dir)
@@ -44,34 +69,133 @@ func TransitiveImports(dir string) ([]string, error) {
 		vm.NativeFunction(nf)
 	}
 
-	node, err := jsonnet.SnippetToAST("main.jsonnet", string(sonnet))
-	if err != nil {
-		return nil, errors.Wrap(err, "creating Jsonnet AST")
-	}
-
 	imports := make(map[string]bool)
-	if err = importRecursive(imports, vm, node, "main.jsonnet"); err != nil {
-		return nil, err
+	dirs := nativeDirs{baseDir: dir, dirs: make(map[string]bool)}
+	for _, f := range files {
+		file := filepath.Join(dir, f)
+		sonnet, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening file")
+		}
+
+		node, err := jsonnet.SnippetToAST(f, string(sonnet))
+		if err != nil {
+			return nil, errors.Wrap(err, "creating Jsonnet AST")
+		}
+
+		imports[file] = true
+		dirs.find(node)
+		if err = importRecursive(imports, &dirs, vm, node, file); err != nil {
+			return nil, err
+		}
 	}
 
-	paths := make([]string, 0, len(imports)+1)
+	deps := Deps{Dynamic: dirs.dynamic}
 	for k := range imports {
-		paths = append(paths, k)
+		rel, _ := filepath.Rel(rootDir, k)
+		deps.Imports = append(deps.Imports, rel)
 	}
-	paths = append(paths, mainFile)
+	sort.Strings(deps.Imports)
+	for d := range dirs.dirs {
+		deps.Dirs = append(deps.Dirs, d)
+	}
+	sort.Strings(deps.Dirs)
+
+	return &deps, nil
+}
 
-	for i := range paths {
-		paths[i], _ = filepath.Rel(rootDir, paths[i])
+// nativeDirs records the directories of calls to dirFuncs. Like when
+// evaluating, relative ones are resolved against baseDir.
+type nativeDirs struct {
+	baseDir string
+	dirs    map[string]bool
+	dynamic []string
+}
+
+// find records the calls of dirFuncs in node, without descending into
+// imports. Only direct calls using a string literal can be resolved, any
+// other reference to such a function is dynamic.
+func (n *nativeDirs) find(node ast.Node) {
+	if call, ok := node.(*ast.Apply); ok {
+		if name, ok := nativeFunc(call.Target); ok {
+			if pos, ok := dirFuncs[name]; ok {
+				n.record(name, call, pos)
+			}
+			for _, child := range toolutils.Children(call) {
+				if child != call.Target {
+					n.find(child)
+				}
+			}
+			return
+		}
+	}
+
+	if name, ok := nativeFunc(node); ok {
+		if _, ok := dirFuncs[name]; ok {
+			n.dynamic = append(n.dynamic, node.Loc().String())
+		}
+		return
+	}
+
+	for _, child := range toolutils.Children(node) {
+		n.find(child)
+	}
+}
+
+// record records the directory argument at pos of call
+func (n *nativeDirs) record(name string, call *ast.Apply, pos int) {
+	if pos >= len(call.Arguments.Positional) {
+		n.dynamic = append(n.dynamic, call.Loc().String())
+		return
+	}
+	lit, ok := call.Arguments.Positional[pos].Expr.(*ast.LiteralString)
+	if !ok {
+		n.dynamic = append(n.dynamic, call.Loc().String())
+		return
+	}
+
+	dir := lit.Value
+	switch {
+	case filepath.IsAbs(dir):
+	// charts not starting with a dot are in repositories, see
+	// native.HelmTemplate
+	case name == "helmTemplate" && !strings.HasPrefix(dir, "."):
+		return
+	default:
+		dir = filepath.Join(n.baseDir, dir)
+	}
+	n.dirs[filepath.Clean(dir)] = true
+}
+
+// nativeFunc returns the name of the native function node refers to, if it
+// is `std.native('<name>')`
+func nativeFunc(node ast.Node) (string, bool) {
+	call, ok := node.(*ast.Apply)
+	if !ok || len(call.Arguments.Positional) != 1 {
+		return "", false
+	}
+	index, ok := call.Target.(*ast.Index)
+	if !ok {
+		return "", false
+	}
+	if v, ok := index.Target.(*ast.Var); !ok || v.Id != "std" {
+		return "", false
+	}
+	if method, ok := index.Index.(*ast.LiteralString); !ok || method.Value != "native" {
+		return "", false
 	}
-	sort.Strings(paths)
 
-	return paths, nil
+	name, ok := call.Arguments.Positional[0].Expr.(*ast.LiteralString)
+	if !ok {
+		return "", false
+	}
+	return name.Value, true
 }
 
 // importRecursive takes a Jsonnet VM and recursively imports the AST. Every
 // found import is added to the `list` string slice, which will ultimately
 // contain all recursive imports
-func importRecursive(list map[string]bool, vm *jsonnet.VM, node ast.Node, currentPath string) error {
+func importRecursive(list map[string]bool, dirs *nativeDirs, vm *jsonnet.VM, node ast.Node, currentPath string) error {
 	switch node := node.(type) {
 	// we have an `import`
 	case *ast.Import:
@@ -88,8 +212,9 @@ func importRecursive(list map[string]bool, vm *jsonnet.VM, node ast.Node, curren
 		}
 
 		list[abs] = true
+		dirs.find(contents)
 
-		if err := importRecursive(list, vm, contents, foundAt); err != nil {
+		if err := importRecursive(list, dirs, vm, contents, foundAt); err != nil {
 			return err
 		}
 
@@ -112,7 +237,7 @@ func importRecursive(list map[string]bool, vm *jsonnet.VM, node ast.Node, curren
 	// neither `import` nor `importstr`, probably object or similar: try children
 	default:
 		for _, child := range toolutils.Children(node) {
-			if err := importRecursive(list, vm, child, currentPath); err != nil {
+			if err := importRecursive(list, dirs, vm, child, currentPath); err != nil {
 				return err
 			}
 		}
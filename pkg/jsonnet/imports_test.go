@@ -2,6 +2,7 @@ package jsonnet
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,7 +10,7 @@ import (
 )
 
 // TestTransitiveImports checks that TransitiveImports is able to report all
-// recursive imports of a file
+// recursive imports of a file, including `importstr`
 func TestTransitiveImports(t *testing.T) {
 	imports, err := TransitiveImports("testdata/importTree")
 	fmt.Println(imports)
@@ -21,5 +22,24 @@ func TestTransitiveImports(t *testing.T) {
 		"trees/cherry.jsonnet",
 		"trees/generic.libsonnet",
 		"trees/peach.jsonnet",
+		"trees/peach.txt",
 	}, imports)
 }
+
+// TestTransitiveDeps checks that the local directories of native functions
+// are found, also in imports, and that those not given literally are reported
+func TestTransitiveDeps(t *testing.T) {
+	deps, err := TransitiveDeps("testdata/nativeDirs", []string{"main.jsonnet"})
+	require.NoError(t, err)
+
+	dir, err := filepath.Abs("testdata/nativeDirs")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"apps.libsonnet", "main.jsonnet"}, deps.Imports)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "charts/grafana"),
+		filepath.Join(dir, "kustomize/prometheus"),
+	}, deps.Dirs)
+	require.Len(t, deps.Dynamic, 1)
+	assert.Contains(t, deps.Dynamic[0], "apps.libsonnet:1:")
+}
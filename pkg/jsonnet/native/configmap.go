@@ -0,0 +1,127 @@
+package native
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// configMapKey matches the keys Kubernetes allows in ConfigMaps
+var configMapKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// ConfigMapFromDir returns the `configMapFromDir` native function, which
+// returns a ConfigMap holding each file of a directory, keyed by its name, like
+// the configMapGenerator of kustomize does. Files that are not valid UTF-8 go
+// into `binaryData`. Relative directories are resolved against baseDir, usually
+// the directory of the evaluated file. Only files inside of rootDir (the project
+// root) may be read.
+func ConfigMapFromDir(baseDir, rootDir string) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   "configMapFromDir",
+		Params: ast.Identifiers{"name", "dir"},
+		Func: func(data []interface{}) (interface{}, error) {
+			name, ok := data[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("configMapFromDir: name must be a string, got %T", data[0])
+			}
+			dir, ok := data[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("configMapFromDir: dir must be a string, got %T", data[1])
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(baseDir, dir)
+			}
+
+			cm, err := configMapFromDir(name, dir, rootDir)
+			if err != nil {
+				return nil, fmt.Errorf("configMapFromDir: %s", err)
+			}
+			return cm, nil
+		},
+	}
+}
+
+func configMapFromDir(name, dir, rootDir string) (map[string]interface{}, error) {
+	if err := within(dir, rootDir); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	text := make(map[string]interface{})
+	binary := make(map[string]interface{})
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if !configMapKey.MatchString(f.Name()) {
+			return nil, fmt.Errorf("`%s` is not a valid ConfigMap key. Only alphanumeric characters, `-`, `_` and `.` are allowed", f.Name())
+		}
+
+		file := filepath.Join(dir, f.Name())
+		// symlinks may point elsewhere
+		if err := within(file, rootDir); err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if utf8.Valid(content) {
+			text[f.Name()] = string(content)
+		} else {
+			binary[f.Name()] = base64.StdEncoding.EncodeToString(content)
+		}
+	}
+
+	cm := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name},
+	}
+	if len(text) > 0 {
+		cm["data"] = text
+	}
+	if len(binary) > 0 {
+		cm["binaryData"] = binary
+	}
+	return cm, nil
+}
+
+// within returns an error if path, once symlinks are resolved, is outside of
+// rootDir
+func within(path, rootDir string) error {
+	root, err := realPath(rootDir)
+	if err != nil {
+		return err
+	}
+	real, err := realPath(path)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("`%s` is outside of the project root `%s`", path, rootDir)
+	}
+	return nil
+}
+
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
@@ -0,0 +1,73 @@
+package native
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigMapFromDir checks that text files go into `data` and binary ones
+// into `binaryData`, skipping subdirectories
+func TestConfigMapFromDir(t *testing.T) {
+	f := ConfigMapFromDir("testdata", "testdata")
+
+	got, err := f.Func([]interface{}{"assets", "configmap"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "assets"},
+		"data": map[string]interface{}{
+			"theme.txt": "dark\n",
+		},
+		"binaryData": map[string]interface{}{
+			"logo.png": "iVBORw0KGgoA//4=",
+		},
+	}, got)
+
+	// absolute, but inside of the root
+	abs, err := filepath.Abs("testdata/configmap")
+	require.NoError(t, err)
+	_, err = f.Func([]interface{}{"assets", abs})
+	assert.NoError(t, err)
+}
+
+// TestConfigMapFromDirSandbox checks that nothing outside of the project root
+// can be read, not even using symlinks
+func TestConfigMapFromDirSandbox(t *testing.T) {
+	f := ConfigMapFromDir("testdata/configmap", "testdata/configmap")
+
+	_, err := f.Func([]interface{}{"assets", ".."})
+	assert.EqualError(t, err, "configMapFromDir: `testdata` is outside of the project root `testdata/configmap`")
+
+	_, err = f.Func([]interface{}{"assets", "/etc"})
+	assert.Error(t, err)
+
+	// a symlink pointing outside
+	dir, err := ioutil.TempDir("", "configmap")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.Mkdir(root, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("hunter2"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "secret")))
+
+	_, err = ConfigMapFromDir(root, root).Func([]interface{}{"assets", "."})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is outside of the project root")
+}
+
+func TestConfigMapFromDirInvalidKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configmap")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "my theme.txt"), []byte("dark"), 0644))
+
+	_, err = ConfigMapFromDir(dir, dir).Func([]interface{}{"assets", "."})
+	assert.EqualError(t, err, "configMapFromDir: `my theme.txt` is not a valid ConfigMap key. Only alphanumeric characters, `-`, `_` and `.` are allowed")
+}
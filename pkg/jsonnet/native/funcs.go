@@ -45,40 +45,51 @@ func parseJSON() *jsonnet.NativeFunction {
 	}
 }
 
-// parseYAML wraps `yaml.Unmarshal` to convert a string of yaml document(s) into a (set of) dicts
+// parseYAML wraps `yaml.Unmarshal` to convert a string of yaml document(s) into a (set of) dicts.
+// Documents keep their order, empty (or comment-only) ones are skipped.
 func parseYAML() *jsonnet.NativeFunction {
 	return &jsonnet.NativeFunction{
 		Name:   "parseYaml",
 		Params: ast.Identifiers{"yaml"},
 		Func: func(dataString []interface{}) (interface{}, error) {
-			data := []byte(dataString[0].(string))
-			ret := []interface{}{}
-
-			d := yaml.NewDecoder(bytes.NewReader(data))
-			for {
-				var doc, jsonDoc interface{}
-				if err := d.Decode(&doc); err != nil {
-					if err == io.EOF {
-						break
-					}
-					return nil, errors.Wrap(err, "parsing yaml")
-				}
-
-				jsonRaw, err := json.Marshal(doc)
-				if err != nil {
-					return nil, errors.Wrap(err, "converting yaml to json")
-				}
-
-				if err := json.Unmarshal(jsonRaw, &jsonDoc); err != nil {
-					return nil, errors.Wrap(err, "converting yaml to json")
-				}
-
-				ret = append(ret, jsonDoc)
+			return parseYAMLStream([]byte(dataString[0].(string)))
+		},
+	}
+}
+
+// parseYAMLStream converts a stream of yaml documents into a list of dicts,
+// skipping empty ones
+func parseYAMLStream(data []byte) ([]interface{}, error) {
+	ret := []interface{}{}
+
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc, jsonDoc interface{}
+		if err := d.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
 			}
+			return nil, errors.Wrap(err, "parsing yaml")
+		}
 
-			return ret, nil
-		},
+		// empty document
+		if doc == nil {
+			continue
+		}
+
+		jsonRaw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, errors.Wrap(err, "converting yaml to json")
+		}
+
+		if err := json.Unmarshal(jsonRaw, &jsonDoc); err != nil {
+			return nil, errors.Wrap(err, "converting yaml to json")
+		}
+
+		ret = append(ret, jsonDoc)
 	}
+
+	return ret, nil
 }
 
 // manifestJSONFromJSON reserializes JSON which allows to change the indentation.
@@ -3,9 +3,11 @@ package native
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // callNative calls a native function used by jsonnet VM.
@@ -61,6 +63,25 @@ func TestParseYAMLKeyValue(t *testing.T) {
 	assert.Empty(t, err)
 }
 
+// TestParseYAMLMultiDoc checks that documents keep their order and empty ones
+// are skipped
+func TestParseYAMLMultiDoc(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/multi.yaml")
+	require.NoError(t, err)
+
+	ret, err, callerr := callNative("parseYaml", []interface{}{string(data)})
+
+	assert.Empty(t, callerr)
+	assert.Empty(t, err)
+	require.Len(t, ret, 2)
+
+	names := []string{}
+	for _, doc := range ret.([]interface{}) {
+		names = append(names, doc.(map[string]interface{})["metadata"].(map[string]interface{})["name"].(string))
+	}
+	assert.Equal(t, []string{"first", "second"}, names)
+}
+
 func TestParseYAMLInvalid(t *testing.T) {
 	ret, err, callerr := callNative("parseYaml", []interface{}{"'"})
 
@@ -0,0 +1,34 @@
+package native
+
+import (
+	"fmt"
+	"os"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// Getenv returns the `getenv` native function, which returns the value of an
+// environment variable, or the given default if it is unset. Reading the
+// environment makes evaluation depend on the host, so unless allowed, calling
+// it fails.
+func Getenv(allow bool) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   "getenv",
+		Params: ast.Identifiers{"name", "default"},
+		Func: func(data []interface{}) (interface{}, error) {
+			name, ok := data[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("getenv: name must be a string, got %T", data[0])
+			}
+			if !allow {
+				return nil, fmt.Errorf("getenv: reading $%s requires --allow-env, as it makes the result depend on the environment variables of the host", name)
+			}
+
+			if value, ok := os.LookupEnv(name); ok {
+				return value, nil
+			}
+			return data[1], nil
+		},
+	}
+}
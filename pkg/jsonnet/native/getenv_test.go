@@ -0,0 +1,38 @@
+package native
+
+import (
+	"os"
+	"testing"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetenv(t *testing.T) {
+	require.NoError(t, os.Setenv("TANKA_TEST_CLUSTER", "prod"))
+	defer os.Unsetenv("TANKA_TEST_CLUSTER")
+	os.Unsetenv("TANKA_TEST_MISSING")
+
+	vm := jsonnet.MakeVM()
+	vm.NativeFunction(Getenv(true))
+
+	out, err := vm.EvaluateSnippet("main.jsonnet", `{
+  set: std.native('getenv')('TANKA_TEST_CLUSTER', 'dev'),
+  unset: std.native('getenv')('TANKA_TEST_MISSING', 'dev'),
+  unsetNull: std.native('getenv')('TANKA_TEST_MISSING', null),
+}`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"set": "prod", "unset": "dev", "unsetNull": null}`, out)
+}
+
+// TestGetenvForbidden checks that reading the environment fails unless
+// allowed, even for set variables
+func TestGetenvForbidden(t *testing.T) {
+	require.NoError(t, os.Setenv("TANKA_TEST_CLUSTER", "prod"))
+	defer os.Unsetenv("TANKA_TEST_CLUSTER")
+
+	f := Getenv(false)
+	_, err := f.Func([]interface{}{"TANKA_TEST_CLUSTER", "dev"})
+	assert.EqualError(t, err, "getenv: reading $TANKA_TEST_CLUSTER requires --allow-env, as it makes the result depend on the environment variables of the host")
+}
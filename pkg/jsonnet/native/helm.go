@@ -0,0 +1,139 @@
+package native
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+)
+
+// HelmTemplate returns the `helmTemplate` native function, which renders a
+// Helm chart using `helm template` and returns the resulting objects. Values
+// are passed from Jsonnet on stdin. Relative chart directories are resolved
+// against baseDir, usually the directory of the evaluated file. run may be
+// nil, which runs helm directly.
+func HelmTemplate(baseDir string, run client.Runner) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   "helmTemplate",
+		Params: ast.Identifiers{"name", "chart", "opts"},
+		Func: func(data []interface{}) (interface{}, error) {
+			name, ok := data[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("helmTemplate: name must be a string, got %T", data[0])
+			}
+			chart, ok := data[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("helmTemplate: chart must be a string, got %T", data[1])
+			}
+			opts, ok := data[2].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("helmTemplate: opts must be an object, got %T", data[2])
+			}
+
+			// local charts start with a dot or slash, everything else is
+			// a repository reference like `grafana/loki`
+			if strings.HasPrefix(chart, ".") {
+				chart = filepath.Join(baseDir, chart)
+			}
+
+			values := opts["values"]
+			if values == nil {
+				values = map[string]interface{}{}
+			}
+			valuesJSON, err := json.Marshal(values)
+			if err != nil {
+				return nil, fmt.Errorf("helmTemplate: marshalling values: %s", err)
+			}
+
+			args := []string{"template", name, chart, "--values", "-"}
+			namespace, _ := opts["namespace"].(string)
+			if namespace != "" {
+				args = append(args, "--namespace", namespace)
+			}
+
+			cmd := helmCmd(args...)
+			cmd.Stdin = bytes.NewReader(valuesJSON)
+			out, err := client.Output(run, cmd)
+			if err != nil {
+				return nil, fmt.Errorf("helm template %s %s: %s", name, chart, err)
+			}
+
+			objs, err := parseYAMLStream(out)
+			if err != nil {
+				return nil, err
+			}
+
+			// charts often leave out metadata.namespace, relying on helm
+			// install to supply it instead
+			if namespace != "" {
+				for _, o := range objs {
+					setDefaultNamespace(o, namespace)
+				}
+			}
+
+			return objs, nil
+		},
+	}
+}
+
+// clusterScopedKinds are the built-in kinds that are not namespaced. Without
+// access to the cluster, these are the only ones known to be left alone by
+// setDefaultNamespace
+var clusterScopedKinds = map[string]bool{
+	"APIService":                     true,
+	"CertificateSigningRequest":      true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CSIDriver":                      true,
+	"CSINode":                        true,
+	"CustomResourceDefinition":       true,
+	"IngressClass":                   true,
+	"MutatingWebhookConfiguration":   true,
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"PodSecurityPolicy":              true,
+	"PriorityClass":                  true,
+	"RuntimeClass":                   true,
+	"StorageClass":                   true,
+	"ValidatingWebhookConfiguration": true,
+	"VolumeAttachment":               true,
+}
+
+// setDefaultNamespace sets metadata.namespace of obj, unless it already has one
+// or is of a clusterScopedKinds
+func setDefaultNamespace(obj interface{}, namespace string) {
+	o, ok := obj.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if kind, _ := o["kind"].(string); clusterScopedKinds[kind] {
+		return
+	}
+	meta, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		meta = map[string]interface{}{}
+		o["metadata"] = meta
+	}
+	if ns, _ := meta["namespace"].(string); ns == "" {
+		meta["namespace"] = namespace
+	}
+}
+
+// helmCmd returns a command launching helm, which may be overridden using
+// $TANKA_HELM_PATH
+func helmCmd(args ...string) *exec.Cmd {
+	binary := "helm"
+	if env := os.Getenv("TANKA_HELM_PATH"); env != "" {
+		binary = env
+	}
+	return exec.Command(binary, args...)
+}
@@ -0,0 +1,144 @@
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHelm returns a runner that prints testdata/helm-template.yaml instead of
+// running helm, recording the arguments and values it was called with
+func fakeHelm(t *testing.T, args *[]string, values *string) func(cmd *exec.Cmd) error {
+	out, err := ioutil.ReadFile("testdata/helm-template.yaml")
+	require.NoError(t, err)
+
+	return func(cmd *exec.Cmd) error {
+		*args = cmd.Args[1:]
+		in, err := ioutil.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		*values = string(in)
+		_, err = cmd.Stdout.Write(out)
+		return err
+	}
+}
+
+func TestHelmTemplate(t *testing.T) {
+	var args []string
+	var values string
+	f := HelmTemplate("testdata", fakeHelm(t, &args, &values))
+
+	got, err := f.Func([]interface{}{"loki", "./charts/loki", map[string]interface{}{
+		"namespace": "loki",
+		"values":    map[string]interface{}{"replicas": 3.0},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"template", "loki", filepath.Join("testdata", "charts", "loki"), "--values", "-", "--namespace", "loki"}, args)
+	assert.JSONEq(t, `{"replicas": 3}`, values)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "loki", "namespace": "loki"},
+			"spec": map[string]interface{}{
+				"ports": []interface{}{map[string]interface{}{"port": 3100.0}},
+			},
+		},
+		map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "StatefulSet",
+			"metadata":   map[string]interface{}{"name": "loki", "namespace": "logging"},
+			"spec":       map[string]interface{}{"replicas": 1.0},
+		},
+		// cluster-scoped, so left without a namespace
+		map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"metadata":   map[string]interface{}{"name": "loki"},
+			"rules": []interface{}{map[string]interface{}{
+				"apiGroups": []interface{}{""},
+				"resources": []interface{}{"pods"},
+				"verbs":     []interface{}{"get"},
+			}},
+		},
+	}, got)
+}
+
+func TestHelmTemplateRepository(t *testing.T) {
+	var args []string
+	var values string
+	f := HelmTemplate("testdata", fakeHelm(t, &args, &values))
+
+	got, err := f.Func([]interface{}{"loki", "grafana/loki", map[string]interface{}{}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"template", "loki", "grafana/loki", "--values", "-"}, args)
+	assert.JSONEq(t, `{}`, values)
+
+	// without a namespace, objects are returned as rendered
+	svc := got.([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"name": "loki"}, svc["metadata"])
+}
+
+func TestHelmTemplateMerged(t *testing.T) {
+	var args []string
+	var values string
+	vm := jsonnet.MakeVM()
+	vm.NativeFunction(HelmTemplate("testdata", fakeHelm(t, &args, &values)))
+
+	out, err := vm.EvaluateSnippet("main.jsonnet", `
+local loki = std.native('helmTemplate')('loki', 'grafana/loki', {
+  namespace: 'loki',
+  values: { persistence: { enabled: true } },
+});
+{
+  loki: [
+    o + (if o.kind == 'StatefulSet' then { spec+: { replicas: 3 } } else {})
+    for o in loki
+  ],
+  config: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'loki' } },
+}`)
+	require.NoError(t, err)
+
+	var got struct {
+		Loki []struct {
+			Kind     string
+			Metadata map[string]interface{}
+			Spec     map[string]interface{}
+		}
+		Config map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+
+	assert.JSONEq(t, `{"persistence": {"enabled": true}}`, values)
+
+	require.Len(t, got.Loki, 3)
+	assert.Equal(t, "Service", got.Loki[0].Kind)
+	assert.Equal(t, "loki", got.Loki[0].Metadata["namespace"])
+	assert.Equal(t, "StatefulSet", got.Loki[1].Kind)
+	assert.Equal(t, "logging", got.Loki[1].Metadata["namespace"])
+	assert.Equal(t, 3.0, got.Loki[1].Spec["replicas"])
+	assert.Equal(t, "ClusterRole", got.Loki[2].Kind)
+	assert.NotContains(t, got.Loki[2].Metadata, "namespace")
+	assert.Equal(t, "ConfigMap", got.Config["kind"])
+}
+
+func TestHelmTemplateFailed(t *testing.T) {
+	f := HelmTemplate("/envs/default", func(cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, `Error: failed to download "grafana/missing"`)
+		return errors.New("exit status 1")
+	})
+
+	_, err := f.Func([]interface{}{"missing", "grafana/missing", map[string]interface{}{}})
+	assert.EqualError(t, err, `helm template missing grafana/missing: exit status 1: Error: failed to download "grafana/missing"`)
+}
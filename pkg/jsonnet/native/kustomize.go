@@ -0,0 +1,50 @@
+package native
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+)
+
+// Kustomize returns the `kustomize` native function, which renders a
+// kustomization using `kustomize build` and returns the resulting objects.
+// Relative directories are resolved against baseDir, usually the directory of
+// the evaluated file. run may be nil, which runs kustomize directly.
+func Kustomize(baseDir string, run client.Runner) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   "kustomize",
+		Params: ast.Identifiers{"dir"},
+		Func: func(data []interface{}) (interface{}, error) {
+			dir, ok := data[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("kustomize: dir must be a string, got %T", data[0])
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(baseDir, dir)
+			}
+
+			out, err := client.Output(run, kustomizeCmd("build", dir))
+			if err != nil {
+				return nil, fmt.Errorf("kustomize build %s: %s", dir, err)
+			}
+
+			return parseYAMLStream(out)
+		},
+	}
+}
+
+// kustomizeCmd returns a command launching kustomize, which may be overridden
+// using $TANKA_KUSTOMIZE_PATH
+func kustomizeCmd(args ...string) *exec.Cmd {
+	binary := "kustomize"
+	if env := os.Getenv("TANKA_KUSTOMIZE_PATH"); env != "" {
+		binary = env
+	}
+	return exec.Command(binary, args...)
+}
@@ -0,0 +1,96 @@
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKustomize returns a runner that prints testdata/kustomize-build.yaml
+// instead of running kustomize, recording the arguments it was called with
+func fakeKustomize(t *testing.T, args *[]string) func(cmd *exec.Cmd) error {
+	out, err := ioutil.ReadFile("testdata/kustomize-build.yaml")
+	require.NoError(t, err)
+
+	return func(cmd *exec.Cmd) error {
+		*args = cmd.Args[1:]
+		_, err := cmd.Stdout.Write(out)
+		return err
+	}
+}
+
+func TestKustomize(t *testing.T) {
+	var args []string
+	f := Kustomize("testdata", fakeKustomize(t, &args))
+
+	got, err := f.Func([]interface{}{"kustomize"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"build", filepath.Join("testdata", "kustomize")}, args)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "grafana"},
+			"spec": map[string]interface{}{
+				"ports": []interface{}{map[string]interface{}{"port": 3000.0}},
+			},
+		},
+		map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "grafana"},
+			"spec":       map[string]interface{}{"replicas": 1.0},
+		},
+	}, got)
+}
+
+func TestKustomizeMerged(t *testing.T) {
+	var args []string
+	vm := jsonnet.MakeVM()
+	vm.NativeFunction(Kustomize("testdata", fakeKustomize(t, &args)))
+
+	out, err := vm.EvaluateSnippet("main.jsonnet", `
+local base = std.native('kustomize')('kustomize');
+{
+  base: [
+    o + (if o.kind == 'Deployment' then { spec+: { replicas: 3 } } else {})
+    for o in base
+  ],
+  config: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'grafana' } },
+}`)
+	require.NoError(t, err)
+
+	var got struct {
+		Base []struct {
+			Kind string
+			Spec map[string]interface{}
+		}
+		Config map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+
+	require.Len(t, got.Base, 2)
+	assert.Equal(t, "Service", got.Base[0].Kind)
+	assert.Equal(t, "Deployment", got.Base[1].Kind)
+	assert.Equal(t, 3.0, got.Base[1].Spec["replicas"])
+	assert.Equal(t, "ConfigMap", got.Config["kind"])
+}
+
+func TestKustomizeFailed(t *testing.T) {
+	f := Kustomize("/envs/default", func(cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, "Error: unable to find one of 'kustomization.yaml'")
+		return errors.New("exit status 1")
+	})
+
+	_, err := f.Func([]interface{}{"missing"})
+	assert.EqualError(t, err, "kustomize build /envs/default/missing: exit status 1: Error: unable to find one of 'kustomization.yaml'")
+}
@@ -0,0 +1,22 @@
+package native
+
+import (
+	"time"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// Now returns the `now` native function, which returns the current time of
+// clock as an RFC 3339 timestamp in UTC. Jsonnet itself has no notion of time,
+// so this is the only source of it, which allows to freeze it for
+// reproducible output.
+func Now(clock func() time.Time) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   "now",
+		Params: ast.Identifiers{},
+		Func: func(data []interface{}) (interface{}, error) {
+			return clock().UTC().Format(time.RFC3339), nil
+		},
+	}
+}
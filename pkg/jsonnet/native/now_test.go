@@ -0,0 +1,21 @@
+package native
+
+import (
+	"testing"
+	"time"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNow(t *testing.T) {
+	frozen := time.Date(2020, 11, 1, 13, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	vm := jsonnet.MakeVM()
+	vm.NativeFunction(Now(func() time.Time { return frozen }))
+
+	out, err := vm.EvaluateSnippet("main.jsonnet", `std.native('now')()`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `"2020-11-01T12:30:00Z"`, out)
+}
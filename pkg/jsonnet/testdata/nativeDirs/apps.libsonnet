@@ -0,0 +1,6 @@
+local cm = std.native('configMapFromDir');
+
+{
+  prometheus: std.native('kustomize')('kustomize/prometheus'),
+  dashboards: cm('dashboards', 'dashboards'),
+}
@@ -0,0 +1,74 @@
+package jsonnet
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// traceMu serializes CaptureTraces, as it replaces the global os.Stderr
+var traceMu sync.Mutex
+
+// traceLine matches what the Jsonnet VM writes for each call of `std.trace`
+var traceLine = regexp.MustCompile(`^TRACE: .*?:\d+ `)
+
+// CaptureTraces runs f (usually an evaluation), writing the messages of
+// `std.trace` to w, each prefixed with the location of the call:
+//
+//	TRACE: main.jsonnet:3 message
+//
+// The Jsonnet VM writes these to os.Stderr directly, so unless w is os.Stderr
+// anyway, it is replaced while f runs. Anything else written to it is passed
+// through as-is.
+func CaptureTraces(w io.Writer, f func() error) error {
+	if w == os.Stderr {
+		return f()
+	}
+
+	traceMu.Lock()
+	defer traceMu.Unlock()
+
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	stderr := os.Stderr
+	os.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		forwardTraces(r, w, stderr)
+		close(done)
+	}()
+
+	defer func() {
+		os.Stderr = stderr
+		pw.Close()
+		<-done
+		r.Close()
+	}()
+
+	return f()
+}
+
+// forwardTraces writes the traces read from r to traces, all other lines to
+// other
+func forwardTraces(r io.Reader, traces, other io.Writer) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if traceLine.MatchString(line) {
+				io.WriteString(traces, line)
+			} else {
+				io.WriteString(other, line)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
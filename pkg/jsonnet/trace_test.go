@@ -0,0 +1,52 @@
+package jsonnet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCaptureTraces checks that `std.trace` reaches the given writer with the
+// location of the call, while other output to stderr is passed through
+func TestCaptureTraces(t *testing.T) {
+	stderr, err := ioutil.TempFile("", "stderr")
+	require.NoError(t, err)
+	defer os.Remove(stderr.Name())
+	defer func(f *os.File) { os.Stderr = f }(os.Stderr)
+	os.Stderr = stderr
+
+	var traces bytes.Buffer
+	var out string
+	err = CaptureTraces(&traces, func() error {
+		fmt.Fprintln(os.Stderr, "not a trace")
+
+		var err error
+		out, err = EvaluateFile("testdata/trace/main.jsonnet")
+		return err
+	})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"replicas": 3}`, out)
+	assert.Equal(t, "TRACE: main.jsonnet:4 replicas: 3\n", traces.String())
+
+	passed, err := ioutil.ReadFile(stderr.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "not a trace\n", string(passed))
+	assert.Equal(t, stderr, os.Stderr, "stderr was not restored")
+}
+
+// TestCaptureTracesStderr checks that os.Stderr is left alone if the traces go
+// there anyway
+func TestCaptureTracesStderr(t *testing.T) {
+	stderr := os.Stderr
+	err := CaptureTraces(os.Stderr, func() error {
+		assert.Equal(t, stderr, os.Stderr)
+		return nil
+	})
+	require.NoError(t, err)
+}
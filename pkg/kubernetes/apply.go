@@ -1,74 +1,594 @@
 package kubernetes
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 	"github.com/grafana/tanka/pkg/process"
 )
 
-// ApplyOpts allow set additional parameters for the apply operation
-type ApplyOpts client.ApplyOpts
+// ApplyOpts allow set additional parameters for the apply operation. The
+// flags of kubectl are embedded, all others are handled by Apply itself.
+type ApplyOpts struct {
+	client.ApplyOpts
+
+	// autoApprove allows to skip the interactive approval
+	AutoApprove bool
+
+	// ObjectTimeout aborts the apply of a single object after the given
+	// duration. Zero means no timeout.
+	ObjectTimeout time.Duration
+
+	// ContinueOnError records the failure of an object and moves on to the
+	// next one, instead of aborting the whole apply
+	ContinueOnError bool
+
+	// Parallelism is how many objects of an apply wave (see
+	// process.AnnotationApplyWave) to apply at once. Zero or one applies them
+	// one by one
+	Parallelism int
+
+	// WaveTimeout limits how long to wait for each apply wave (see
+	// process.AnnotationApplyWave) to become ready before applying the next
+	// one, per object. Zero uses the kubectl default.
+	WaveTimeout time.Duration
+
+	// Progress receives a line for each object before it is applied. Nil
+	// disables progress reporting
+	Progress io.Writer
+	// ProgressInterval limits progress reporting to one line per interval, for
+	// when Progress is not a terminal. Zero reports every object
+	ProgressInterval time.Duration
+
+	// MaxErrors limits how many failed objects the summary lists. Zero lists
+	// all of them
+	MaxErrors int
+}
+
+// Apply receives a state object generated using `Reconcile()` and may apply it
+// to the target system. Objects are applied individually, the outcome of each
+// is recorded in the returned ApplyResults. Unless ContinueOnError is set, the
+// first failure aborts the apply.
+//
+// Objects are applied in waves (see process.AnnotationApplyWave). Before the
+// next wave is started, all objects of the current one must be ready. So must
+// the last one, unless state uses neither waves nor process.AnnotationWaitFor.
+// Failed objects (with ContinueOnError) stop the apply at the end of their
+// wave.
+//
+// Within a wave, up to Parallelism objects are applied at once. Namespaces and
+// CustomResourceDefinitions are applied before all other objects of their
+// wave, as these may depend on them. Namespaces must become Active before the
+// rest of the wave is applied.
+func (k *Kubernetes) Apply(state manifest.List, opts ApplyOpts) (ApplyResults, error) {
+	if err := validateApplyOpts(state, opts); err != nil {
+		return nil, err
+	}
+
+	results := make(ApplyResults, 0, len(state))
+	p := progress{w: opts.Progress, interval: opts.ProgressInterval, total: len(state)}
+
+	waves := process.Waves(state)
+	settle := len(waves) > 1 || declaresWaitFor(state)
+	for wi, wave := range waves {
+		for _, batch := range barrier(wave) {
+			applied, err := k.applyBatch(batch, opts, &p, len(results))
+			results = append(results, applied...)
+			if err != nil {
+				return results, clusterErr(results.failure(err))
+			}
+
+			// creating a Namespace takes a moment, objects applied into
+			// it before it is Active are rejected
+			if err := k.waitNamespaces(batch, applied, opts.WaveTimeout); err != nil {
+				return results, err
+			}
+		}
+
+		if results.Failed() > 0 {
+			return results, clusterErr(results.failure(nil))
+		}
+
+		// plain applies return right away, as they always did
+		if wi == len(waves)-1 && !settle {
+			break
+		}
+		if opts.Progress != nil {
+			fmt.Fprintf(opts.Progress, "waiting for wave %d to become ready\n", process.Wave(wave[0]))
+		}
+		if err := k.waitReady(wave, opts.WaveTimeout); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// barrierKinds are applied before all other objects of their wave, because
+// those are likely to require them to exist
+var barrierKinds = map[string]bool{
+	"Namespace":                true,
+	"CustomResourceDefinition": true,
+}
+
+// barrier splits a wave into the objects of barrierKinds and the remaining
+// ones, leaving out empty batches. The order within each batch is kept.
+func barrier(wave manifest.List) []manifest.List {
+	var first, rest manifest.List
+	for _, m := range wave {
+		if barrierKinds[m.Kind()] {
+			first = append(first, m)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+
+	var batches []manifest.List
+	for _, b := range []manifest.List{first, rest} {
+		if len(b) > 0 {
+			batches = append(batches, b)
+		}
+	}
+	return batches
+}
+
+// applyBatch applies up to opts.Parallelism objects of batch at once. offset is
+// the number of objects applied before, for progress reporting.
+//
+// Unless ContinueOnError is set, no further objects are started after a
+// failure, but those in flight are awaited. The results of all objects started
+// are returned in the order of batch, along with the first error among them.
+func (k *Kubernetes) applyBatch(batch manifest.List, opts ApplyOpts, p *progress, offset int) (ApplyResults, error) {
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, parallelism)
+		results = make([]*ApplyResult, len(batch))
+		failed  bool
+	)
+
+	for i, m := range batch {
+		slots <- struct{}{}
+
+		mu.Lock()
+		if failed && !opts.ContinueOnError {
+			mu.Unlock()
+			<-slots
+			break
+		}
+		offset++
+		p.report(offset, m)
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(i int, m manifest.Manifest) {
+			defer wg.Done()
+
+			r := k.applyObject(m, opts)
+
+			mu.Lock()
+			results[i] = &r
+			failed = failed || r.Err != nil
+			mu.Unlock()
+
+			// free the slot only once failed is recorded, so that with a
+			// parallelism of one, nothing is started after a failure
+			<-slots
+		}(i, m)
+	}
+	wg.Wait()
+
+	var applied ApplyResults
+	var err error
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		applied = append(applied, *r)
+		if r.Err != nil && err == nil && !opts.ContinueOnError {
+			err = r.Err
+		}
+	}
+	return applied, err
+}
+
+// waitReady blocks until all objects of the wave are ready. Objects declaring
+// their readiness using process.AnnotationWaitFor are polled until they meet
+// it, all others use the built-in checks of their kind.
+func (k *Kubernetes) waitReady(wave manifest.List, timeout time.Duration) error {
+	for _, m := range wave {
+		conds, err := process.WaitFor(m)
+		if err != nil {
+			return err
+		}
+		if len(conds) > 0 {
+			if err := k.waitFor(m, conds, timeout); err != nil {
+				return clusterErr(err)
+			}
+			continue
+		}
+
+		if err := k.ctl.WaitReady(m.Metadata().Namespace(), m.Kind(), m.Metadata().Name(), timeout); err != nil {
+			return clusterErr(err)
+		}
+	}
+	return nil
+}
+
+// declaresWaitFor returns whether any object of list has a
+// process.AnnotationWaitFor
+func declaresWaitFor(list manifest.List) bool {
+	for _, m := range list {
+		if _, ok := m.Metadata().Annotations()[process.AnnotationWaitFor]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// waitNamespaces blocks until the Namespaces of batch that were applied
+// successfully are Active
+func (k *Kubernetes) waitNamespaces(batch manifest.List, applied ApplyResults, timeout time.Duration) error {
+	failed := make(map[string]bool)
+	for _, r := range applied {
+		if r.Err != nil {
+			failed[r.Name] = true
+		}
+	}
+
+	for _, m := range batch {
+		if m.Kind() != "Namespace" || failed[m.KindName()] {
+			continue
+		}
+		if err := k.ctl.WaitReady("", m.Kind(), m.Metadata().Name(), timeout); err != nil {
+			return clusterErr(err)
+		}
+	}
+	return nil
+}
+
+// progress reports which object is being applied
+type progress struct {
+	w        io.Writer
+	interval time.Duration
+	total    int
+
+	last time.Time
+}
+
+// report prints a line for the i-th object, unless the last one was less than
+// the interval ago. The last object is always reported.
+func (p *progress) report(i int, m manifest.Manifest) {
+	if p.w == nil {
+		return
+	}
+
+	now := time.Now()
+	if p.interval > 0 && i != p.total && now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+
+	fmt.Fprintf(p.w, "applying %d/%d: %s\n", i, p.total, progressName(m))
+}
+
+// progressName formats m as `apiVersion.kind/namespace/name`, omitting the
+// namespace for cluster-wide objects
+func progressName(m manifest.Manifest) string {
+	name := m.APIVersion() + "." + m.Kind() + "/"
+	if ns := m.Metadata().Namespace(); ns != "" {
+		name += ns + "/"
+	}
+	return name + m.Metadata().Name()
+}
+
+// applyObject applies a single object, aborting once the ObjectTimeout is
+// exceeded
+func (k *Kubernetes) applyObject(m manifest.Manifest, opts ApplyOpts) ApplyResult {
+	ctx := context.Background()
+	if opts.ObjectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ObjectTimeout)
+		defer cancel()
+	}
+
+	r := ApplyResult{Name: m.KindName()}
+	objOpts, err := objectApplyOpts(m, opts)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	out, err := k.ctl.Apply(ctx, manifest.List{m}, objOpts)
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		r.TimedOut = true
+		r.Err = fmt.Errorf("%s: timed out after %s", r.Name, opts.ObjectTimeout)
+	case err != nil:
+		_, r.Conflict = err.(client.ErrorConflict)
+		r.Err = errors.Wrap(err, r.Name)
+	default:
+		r.Action = applyAction(out)
+	}
+
+	return r
+}
+
+// objectApplyOpts returns the options to apply m with: those of the
+// environment, overridden by the ones of m (see process.AnnotationApplyOptions
+// and process.AnnotationFieldManager)
+func objectApplyOpts(m manifest.Manifest, opts ApplyOpts) (client.ApplyOpts, error) {
+	o := opts.ApplyOpts
+
+	override, err := process.ObjectApplyOptions(m)
+	if err != nil {
+		return o, err
+	}
+
+	o.Force = o.Force || override.Force
+	if override.ServerSide != nil {
+		o.ServerSide = *override.ServerSide
+	}
+	o.ForceConflicts = o.ForceConflicts || override.ForceConflicts
+	if override.FieldManager != "" {
+		o.FieldManager = override.FieldManager
+	}
+
+	// kubectl rejects this, no matter whether the environment or m asked for
+	// either
+	if o.Force && o.ServerSide {
+		return o, fmt.Errorf("%s: force can't be combined with server-side apply, use `%s` or `%s` (annotation %s) instead", m.KindName(), process.ApplyForceConflicts, process.ApplyClientSide, process.AnnotationApplyOptions)
+	}
+	return o, nil
+}
+
+// validateApplyOpts returns the first error of objectApplyOpts for the objects
+// of state, so that nothing is applied if any of them would fail
+func validateApplyOpts(state manifest.List, opts ApplyOpts) error {
+	for _, m := range state {
+		if _, err := objectApplyOpts(m, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAction extracts what happened to the object from the kubectl output,
+// e.g. `configured` from `deployment.apps/grafana configured`
+func applyAction(out string) string {
+	fields := strings.Fields(out)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+// ApplyResult is the outcome of applying a single object
+type ApplyResult struct {
+	// Name of the object in `<kind>/<name>` format
+	Name string
+
+	// Action kubectl reported, e.g. `created`, `configured`, `unchanged` or
+	// `serverside-applied`
+	Action string
+
+	// Err is set if the apply failed
+	Err error
+	// TimedOut is set if the apply was aborted because of the ObjectTimeout
+	TimedOut bool
+	// Conflict is set if server-side apply failed because other field
+	// managers own some fields
+	Conflict bool
+}
+
+// ApplyResults are the outcomes of all objects of an apply
+type ApplyResults []ApplyResult
+
+// Failed returns how many objects could not be applied, including those that
+// timed out
+func (a ApplyResults) Failed() int {
+	n := 0
+	for _, r := range a {
+		if r.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// String returns a summary of the apply, counting the actions kubectl reported
+// and listing all objects that timed out, conflicted or errored
+func (a ApplyResults) String() string {
+	return a.Summary(0)
+}
+
+// Summary is like String, but lists at most maxErrors failed objects, followed
+// by how many were left out. Zero lists all of them.
+func (a ApplyResults) Summary(maxErrors int) string {
+	timedOut := 0
+	actions := make(map[string]int)
+	for _, r := range a {
+		if r.TimedOut {
+			timedOut++
+		}
+		if r.Action != "" {
+			actions[r.Action]++
+		}
+	}
+
+	s := fmt.Sprintf("Applied %d of %d objects (%d errored, %d timed out)\n",
+		len(a)-a.Failed(), len(a), a.Failed()-timedOut, timedOut)
+
+	if len(actions) > 0 {
+		names := make([]string, 0, len(actions))
+		for action := range actions {
+			names = append(names, action)
+		}
+		sort.Strings(names)
+
+		counts := make([]string, 0, len(names))
+		for _, action := range names {
+			counts = append(counts, fmt.Sprintf("%d %s", actions[action], action))
+		}
+		s += "  " + strings.Join(counts, ", ") + "\n"
+	}
+
+	listed := 0
+	for _, r := range a {
+		if r.Err == nil {
+			continue
+		}
+		if maxErrors > 0 && listed == maxErrors {
+			s += fmt.Sprintf("  ... and %d more\n", a.Failed()-listed)
+			break
+		}
+		listed++
+
+		switch {
+		case r.TimedOut:
+			s += fmt.Sprintf("  TIMEOUT  %s\n", r.Name)
+		case r.Conflict:
+			s += fmt.Sprintf("  CONFLICT %s\n", r.Err)
+		case r.Err != nil:
+			s += fmt.Sprintf("  ERROR    %s\n", r.Err)
+		}
+	}
+
+	return s
+}
+
+// failure returns the ErrorApplyFailed for the results. err is the failure the
+// apply was aborted on, if any.
+func (a ApplyResults) failure(err error) ErrorApplyFailed {
+	return ErrorApplyFailed{Count: a.Failed(), Applied: len(a) - a.Failed(), Err: err}
+}
+
+// ErrorApplyFailed occurs when at least one object could not be applied. Err
+// is the failure the apply was aborted on, unless ContinueOnError was set.
+type ErrorApplyFailed struct {
+	// number of failed objects
+	Count int
+	// number of objects applied successfully nonetheless
+	Applied int
 
-// Apply receives a state object generated using `Reconcile()` and may apply it to the target system
-func (k *Kubernetes) Apply(state manifest.List, opts ApplyOpts) error {
-	return k.ctl.Apply(state, client.ApplyOpts(opts))
+	Err error
+}
+
+func (e ErrorApplyFailed) Error() string {
+	switch {
+	case e.Err != nil:
+		return e.Err.Error()
+	case e.Partial():
+		return fmt.Sprintf("partial failure: %d of %d object(s) failed to apply", e.Count, e.Count+e.Applied)
+	}
+	return fmt.Sprintf("%d object(s) failed to apply", e.Count)
+}
+
+// Unwrap returns the failure the apply was aborted on, if any
+func (e ErrorApplyFailed) Unwrap() error {
+	return e.Err
+}
+
+// Partial returns whether some objects were applied successfully, so the
+// cluster is left in between the previous and the desired state
+func (e ErrorApplyFailed) Partial() bool {
+	return e.Applied > 0
 }
 
 // AnnoationLastApplied is the last-applied-configuration annotation used by kubectl
 const AnnotationLastApplied = "kubectl.kubernetes.io/last-applied-configuration"
 
 // Orphaned returns previously created resources that are missing from the
-// local state. It uses UIDs to safely identify objects.
-func (k *Kubernetes) Orphaned(state manifest.List) (manifest.List, error) {
+// local state. It uses UIDs to safely identify objects. Only objects of the
+// given resource types are considered, or of all types that can be listed if
+// resources is nil.
+func (k *Kubernetes) Orphaned(state manifest.List, resources []PruneResource) (manifest.List, error) {
 	if !k.Env.Spec.InjectLabels {
 		return nil, fmt.Errorf(`spec.injectLabels is set to false in your spec.json. Tanka needs to add
 a label to your resources to reliably detect which were removed from Jsonnet.
 See https://tanka.dev/garbage-collection for more details.`)
 	}
 
-	apiResources, err := k.ctl.Resources()
+	kinds, err := k.pruneKinds(resources)
 	if err != nil {
 		return nil, err
 	}
+	if kinds == "" {
+		return nil, nil
+	}
 
 	start := time.Now()
-	fmt.Print("fetching UID's .. ")
+	fmt.Fprint(os.Stderr, "fetching UID's .. ")
 	uids, err := k.uids(state)
 	if err != nil {
-		return nil, err
-	}
-	fmt.Println("done", time.Since(start))
-
-	var orphaned manifest.List
-
-	// join all kinds that support LIST into a comma separated string for
-	// kubectl
-	kinds := ""
-	for _, r := range apiResources {
-		if !strings.Contains(r.Verbs, "list") {
-			continue
-		}
-
-		kinds += "," + r.FQN()
+		return nil, clusterErr(err)
 	}
-	kinds = strings.TrimPrefix(kinds, ",")
+	fmt.Fprintln(os.Stderr, "done", time.Since(start))
 
 	start = time.Now()
-	fmt.Print("fetching previously created resources .. ")
+	fmt.Fprint(os.Stderr, "fetching previously created resources .. ")
 	// get all resources matching our label
 	matched, err := k.ctl.GetByLabels("", kinds, map[string]string{
 		process.LabelEnvironment: k.Env.Metadata.NameLabel(),
 	})
 	if err != nil {
-		return nil, err
+		return nil, clusterErr(err)
+	}
+	fmt.Fprintln(os.Stderr, "done", time.Since(start))
+
+	orphaned := orphans(matched, uids)
+
+	// managedFields were only fetched to recognize the objects, they would
+	// clutter the diff deleting them
+	for _, m := range orphaned {
+		delete(m.Metadata(), "managedFields")
 	}
-	fmt.Println("done", time.Since(start))
+	return orphaned, nil
+}
 
-	// filter unknown
+// pruneKinds joins the resources into a comma separated string for kubectl.
+// Without resources, all kinds that support LIST are used.
+func (k *Kubernetes) pruneKinds(resources []PruneResource) (string, error) {
+	var kinds []string
+	for _, r := range resources {
+		kinds = append(kinds, r.fqn())
+	}
+	if resources != nil {
+		return strings.Join(kinds, ","), nil
+	}
+
+	apiResources, err := k.ctl.Resources()
+	if err != nil {
+		return "", clusterErr(err)
+	}
+	for _, r := range apiResources {
+		if strings.Contains(r.Verbs, "list") {
+			kinds = append(kinds, r.FQN())
+		}
+	}
+	return strings.Join(kinds, ","), nil
+}
+
+// orphans returns all objects of matched whose UID is not known. Objects that
+// were not explicitly created by Tanka are skipped, as these are usually
+// created by controllers.
+func orphans(matched manifest.List, uids map[string]bool) manifest.List {
+	var orphaned manifest.List
 	for _, m := range matched {
 		// ignore known ones
 		if uids[m.Metadata().UID()] {
@@ -76,7 +596,7 @@ See https://tanka.dev/garbage-collection for more details.`)
 		}
 
 		// skip objects not created explicitely
-		if _, ok := m.Metadata().Annotations()[AnnotationLastApplied]; !ok {
+		if !appliedByTanka(m) {
 			continue
 		}
 
@@ -85,7 +605,33 @@ See https://tanka.dev/garbage-collection for more details.`)
 		uids[m.Metadata().UID()] = true
 	}
 
-	return orphaned, nil
+	return orphaned
+}
+
+// appliedByTanka returns whether m was applied by Tanka: Client-side apply
+// records the last-applied annotation, while server-side apply only lists the
+// field manager in metadata.managedFields
+func appliedByTanka(m manifest.Manifest) bool {
+	if _, ok := m.Metadata().Annotations()[AnnotationLastApplied]; ok {
+		return true
+	}
+
+	manager := client.DefaultFieldManager
+	if custom := m.Metadata().Annotations()[process.AnnotationFieldManager]; custom != "" {
+		manager = custom
+	}
+
+	fields, _ := m.Metadata()["managedFields"].([]interface{})
+	for _, f := range fields {
+		entry, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if entry["manager"] == manager && entry["operation"] == "Apply" {
+			return true
+		}
+	}
+	return false
 }
 
 func (k *Kubernetes) uids(state manifest.List) (map[string]bool, error) {
@@ -0,0 +1,476 @@
+package kubernetes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TestOrphaned checks that only objects that are labeled, explicitly created
+// and missing from the local state are considered orphaned
+func TestOrphaned(t *testing.T) {
+	env := v1alpha1.New()
+	env.Spec.InjectLabels = true
+
+	c := &fakeClient{
+		resources: client.Resources{
+			{Kind: "Deployment", APIGroup: "apps", Verbs: "[create delete get list]"},
+		},
+		live: manifest.List{
+			mUID("apps/v1", "Deployment", "grafana", "1", true),
+		},
+		labeled: manifest.List{
+			// still present locally
+			mUID("apps/v1", "Deployment", "grafana", "1", true),
+			// removed from Jsonnet
+			mUID("apps/v1", "Deployment", "loki", "2", true),
+			// created by a controller, not by us
+			mUID("apps/v1", "Deployment", "generated", "3", false),
+			// server-side applied, lacking the last-applied annotation
+			managedBy(mUID("apps/v1", "Deployment", "prometheus", "4", false), "tanka", "Apply"),
+			managedBy(mUID("apps/v1", "Deployment", "scaled", "5", false), "kube-controller-manager", "Update"),
+		},
+	}
+	k := Kubernetes{Env: *env, ctl: c}
+
+	orphaned, err := k.Orphaned(manifest.List{
+		m("apps/v1", "Deployment", "grafana", "default"),
+	}, nil)
+	require.NoError(t, err)
+
+	names := make([]string, len(orphaned))
+	for i, o := range orphaned {
+		names[i] = o.KindName()
+	}
+	assert.Equal(t, []string{"Deployment/loki", "Deployment/prometheus"}, names)
+}
+
+// TestApplyConflict checks that conflicts are still recognized through the
+// errors wrapping them
+func TestApplyConflict(t *testing.T) {
+	c := &fakeClient{conflict: map[string]bool{"Deployment/grafana": true}}
+	k := Kubernetes{ctl: c}
+
+	results, err := k.Apply(manifest.List{m("apps/v1", "Deployment", "grafana", "default")}, ApplyOpts{})
+	require.Error(t, err)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Conflict)
+
+	var conflict client.ErrorConflict
+	assert.True(t, errors.As(results[0].Err, &conflict))
+	assert.True(t, errors.As(err, &conflict))
+}
+
+// managedBy adds a managedFields entry of the given manager to m
+func managedBy(m manifest.Manifest, manager, operation string) manifest.Manifest {
+	m.Metadata()["managedFields"] = []interface{}{
+		map[string]interface{}{"manager": manager, "operation": operation},
+	}
+	return m
+}
+
+// TestApplyObjects checks that objects are applied one by one, honoring the
+// ObjectTimeout and ContinueOnError
+func TestApplyObjects(t *testing.T) {
+	state := manifest.List{
+		m("v1", "ConfigMap", "config", "default"),
+		m("apps/v1", "Deployment", "stuck", "default"),
+		m("v1", "Service", "broken", "default"),
+		m("apps/v1", "Deployment", "grafana", "default"),
+	}
+
+	newClient := func() *fakeClient {
+		return &fakeClient{
+			hang: map[string]bool{"Deployment/stuck": true},
+			fail: map[string]bool{"Service/broken": true},
+		}
+	}
+	opts := ApplyOpts{ObjectTimeout: 10 * time.Millisecond}
+
+	t.Run("abort", func(t *testing.T) {
+		c := newClient()
+		k := Kubernetes{ctl: c}
+
+		results, err := k.Apply(state, opts)
+		require.Error(t, err)
+		assert.Equal(t, []string{"ConfigMap/config"}, c.applied)
+		require.Len(t, results, 2)
+		assert.True(t, results[1].TimedOut)
+	})
+
+	t.Run("continue", func(t *testing.T) {
+		c := newClient()
+		k := Kubernetes{ctl: c}
+
+		opts := opts
+		opts.ContinueOnError = true
+
+		results, err := k.Apply(state, opts)
+		assert.Equal(t, ClusterError{Err: ErrorApplyFailed{Count: 2, Applied: 2}}, err)
+		assert.EqualError(t, err, "partial failure: 2 of 4 object(s) failed to apply")
+		assert.Equal(t, []string{"ConfigMap/config", "Deployment/grafana"}, c.applied)
+		require.Len(t, results, 4)
+
+		assert.NoError(t, results[0].Err)
+		assert.True(t, results[1].TimedOut)
+		assert.Error(t, results[2].Err)
+		assert.False(t, results[2].TimedOut)
+		assert.NoError(t, results[3].Err)
+
+		assert.Equal(t, `Applied 2 of 4 objects (1 errored, 1 timed out)
+  TIMEOUT  Deployment/stuck
+  ERROR    Service/broken: admission webhook denied the request
+`, results.String())
+	})
+}
+
+// TestApplyMaxErrors checks that the summary lists at most the given amount
+// of failed objects, followed by how many were left out
+func TestApplyMaxErrors(t *testing.T) {
+	results := ApplyResults{{Name: "ConfigMap/config", Action: "created"}}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		results = append(results, ApplyResult{Name: "Service/" + name, Err: errors.New("Service/" + name + ": denied")})
+	}
+
+	assert.Equal(t, `Applied 1 of 6 objects (5 errored, 0 timed out)
+  1 created
+  ERROR    Service/a: denied
+  ERROR    Service/b: denied
+  ... and 3 more
+`, results.Summary(2))
+
+	// no truncation if within the limit
+	assert.Equal(t, results.String(), results.Summary(5))
+	assert.Equal(t, results.String(), results.Summary(0))
+}
+
+func mUID(apiVersion, kind, name, uid string, applied bool) manifest.Manifest {
+	m := m(apiVersion, kind, name, "default")
+	m.Metadata()["uid"] = uid
+	if applied {
+		m.Metadata()["annotations"] = map[string]interface{}{
+			AnnotationLastApplied: "{}",
+		}
+	}
+	return m
+}
+
+// TestApplyActions checks that the actions reported by kubectl are counted in
+// the summary
+func TestApplyActions(t *testing.T) {
+	c := &fakeClient{applyOutput: map[string]string{
+		"ConfigMap/config":   "configmap/config serverside-applied\n",
+		"Deployment/grafana": "deployment.apps/grafana serverside-applied\n",
+		"Service/grafana":    "service/grafana unchanged\n",
+	}}
+	k := Kubernetes{ctl: c}
+
+	results, err := k.Apply(manifest.List{
+		m("v1", "ConfigMap", "config", "default"),
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("v1", "Service", "grafana", "default"),
+	}, ApplyOpts{ApplyOpts: client.ApplyOpts{ServerSide: true}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "serverside-applied", results[0].Action)
+	assert.Equal(t, `Applied 3 of 3 objects (0 errored, 0 timed out)
+  2 serverside-applied, 1 unchanged
+`, results.String())
+}
+
+// TestApplyProgress checks that a progress line is written for each object
+func TestApplyProgress(t *testing.T) {
+	k := Kubernetes{ctl: &fakeClient{}}
+	var buf bytes.Buffer
+
+	cluster := m("rbac.authorization.k8s.io/v1", "ClusterRole", "grafana", "")
+	delete(cluster.Metadata(), "namespace")
+
+	_, err := k.Apply(manifest.List{
+		m("v1", "ConfigMap", "config", "default"),
+		m("apps/v1", "Deployment", "grafana", "monitoring"),
+		cluster,
+	}, ApplyOpts{Progress: &buf})
+	require.NoError(t, err)
+
+	assert.Equal(t, `applying 1/3: v1.ConfigMap/default/config
+applying 2/3: apps/v1.Deployment/monitoring/grafana
+applying 3/3: rbac.authorization.k8s.io/v1.ClusterRole/grafana
+`, buf.String())
+}
+
+// TestApplyProgressInterval checks that only the first and last object are
+// reported when the interval did not yet pass in between
+func TestApplyProgressInterval(t *testing.T) {
+	k := Kubernetes{ctl: &fakeClient{}}
+	var buf bytes.Buffer
+
+	_, err := k.Apply(manifest.List{
+		m("v1", "ConfigMap", "a", "default"),
+		m("v1", "ConfigMap", "b", "default"),
+		m("v1", "ConfigMap", "c", "default"),
+	}, ApplyOpts{Progress: &buf, ProgressInterval: time.Hour})
+	require.NoError(t, err)
+
+	assert.Equal(t, `applying 1/3: v1.ConfigMap/default/a
+applying 3/3: v1.ConfigMap/default/c
+`, buf.String())
+}
+
+func withWave(m manifest.Manifest, wave string) manifest.Manifest {
+	m.Metadata()["annotations"] = map[string]interface{}{process.AnnotationApplyWave: wave}
+	return m
+}
+
+// TestApplyWaves checks that objects are applied wave by wave, in ascending
+// order, and that each wave becomes ready before the next one starts or the
+// apply returns
+func TestApplyWaves(t *testing.T) {
+	state := manifest.List{
+		m("v1", "ConfigMap", "config", "default"),
+		m("apps/v1", "Deployment", "grafana", "default"),
+		withWave(m("batch/v1", "Job", "migrate", "default"), "-1"),
+		withWave(m("v1", "Service", "grafana", "default"), "1"),
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		c := &fakeClient{}
+		k := Kubernetes{ctl: c}
+
+		_, err := k.Apply(state, ApplyOpts{})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			"apply Job/migrate",
+			"wait Job/migrate",
+			"apply ConfigMap/config",
+			"apply Deployment/grafana",
+			"wait ConfigMap/config",
+			"wait Deployment/grafana",
+			"apply Service/grafana",
+			"wait Service/grafana",
+		}, c.calls)
+	})
+
+	t.Run("failedWave", func(t *testing.T) {
+		c := &fakeClient{fail: map[string]bool{"ConfigMap/config": true}}
+		k := Kubernetes{ctl: c}
+
+		results, err := k.Apply(state, ApplyOpts{ContinueOnError: true})
+		require.Error(t, err)
+
+		// the rest of wave 0 is applied, wave 1 is not
+		assert.Equal(t, []string{
+			"apply Job/migrate",
+			"wait Job/migrate",
+			"apply Deployment/grafana",
+		}, c.calls)
+		assert.Len(t, results, 3)
+	})
+}
+
+// TestApplyParallel checks that the objects of a wave are applied concurrently,
+// with at most Parallelism at once, and that all results are collected in
+// order. Namespaces and CRDs are applied before the rest of their wave. Run it
+// using `go test -race` to catch unsynchronized access.
+func TestApplyParallel(t *testing.T) {
+	state := manifest.List{
+		m("v1", "Namespace", "grafana", ""),
+		m("apiextensions.k8s.io/v1", "CustomResourceDefinition", "dashboards.grafana.com", ""),
+	}
+	for i := 0; i < 50; i++ {
+		state = append(state, m("v1", "ConfigMap", fmt.Sprintf("config-%02d", i), "grafana"))
+	}
+
+	c := &fakeClient{applyDelay: 2 * time.Millisecond}
+	k := Kubernetes{ctl: c}
+
+	var progress bytes.Buffer
+	results, err := k.Apply(state, ApplyOpts{Parallelism: 8, Progress: &progress})
+	require.NoError(t, err)
+
+	require.Len(t, results, len(state))
+	for i, r := range results {
+		assert.Equal(t, state[i].KindName(), r.Name)
+	}
+	assert.Len(t, c.applied, len(state))
+	assert.Equal(t, len(state), strings.Count(progress.String(), "\n"))
+
+	// the barrier kinds come first, independent of scheduling
+	assert.ElementsMatch(t, []string{"Namespace/grafana", "CustomResourceDefinition/dashboards.grafana.com"}, c.applied[:2])
+
+	assert.True(t, c.maxInFlight > 1, "expected concurrent applies")
+	assert.True(t, c.maxInFlight <= 8, "expected at most 8 concurrent applies, got %d", c.maxInFlight)
+}
+
+// TestApplyParallelAbort checks that no further objects are started after a
+// failure, while those in flight still report their results
+func TestApplyParallelAbort(t *testing.T) {
+	var state manifest.List
+	for i := 0; i < 20; i++ {
+		state = append(state, m("v1", "ConfigMap", fmt.Sprintf("config-%02d", i), "default"))
+	}
+
+	c := &fakeClient{
+		applyDelay: time.Millisecond,
+		fail:       map[string]bool{"ConfigMap/config-01": true},
+	}
+	k := Kubernetes{ctl: c}
+
+	results, err := k.Apply(state, ApplyOpts{Parallelism: 4})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ConfigMap/config-01")
+
+	assert.True(t, len(results) < len(state), "expected the apply to stop early")
+	assert.Equal(t, 1, results.Failed())
+}
+
+// TestApplyFailure checks that failed applies report how many objects were
+// applied nonetheless, telling partial from total failures apart
+func TestApplyFailure(t *testing.T) {
+	state := manifest.List{
+		m("v1", "ConfigMap", "config", "default"),
+		m("v1", "Service", "grafana", "default"),
+	}
+
+	cases := []struct {
+		name    string
+		fail    map[string]bool
+		opts    ApplyOpts
+		err     error
+		partial bool
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:    "partial",
+			fail:    map[string]bool{"Service/grafana": true},
+			opts:    ApplyOpts{ContinueOnError: true},
+			err:     ErrorApplyFailed{Count: 1, Applied: 1},
+			partial: true,
+		},
+		{
+			name:    "partialAbort",
+			fail:    map[string]bool{"Service/grafana": true},
+			partial: true,
+		},
+		{
+			name: "total",
+			fail: map[string]bool{"ConfigMap/config": true, "Service/grafana": true},
+			opts: ApplyOpts{ContinueOnError: true},
+			err:  ErrorApplyFailed{Count: 2},
+		},
+		{
+			name: "totalAbort",
+			fail: map[string]bool{"ConfigMap/config": true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			k := Kubernetes{ctl: &fakeClient{fail: c.fail}}
+
+			_, err := k.Apply(state, c.opts)
+			if c.fail == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var failed ErrorApplyFailed
+			require.True(t, errors.As(err, &failed), "expected ErrorApplyFailed, got %v", err)
+			assert.Equal(t, c.partial, failed.Partial())
+			if c.err != nil {
+				assert.Equal(t, c.err, failed)
+			} else {
+				assert.Error(t, failed.Err)
+			}
+		})
+	}
+}
+
+// TestApplyNamespaceActive checks that objects are applied only once the
+// Namespaces of their wave are Active
+func TestApplyNamespaceActive(t *testing.T) {
+	c := &fakeClient{}
+	k := Kubernetes{ctl: c}
+
+	_, err := k.Apply(manifest.List{
+		m("v1", "Namespace", "grafana", ""),
+		m("v1", "ConfigMap", "config", "grafana"),
+	}, ApplyOpts{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"apply Namespace/grafana",
+		"wait Namespace/grafana",
+		"apply ConfigMap/config",
+	}, c.calls)
+}
+
+func annotated(obj manifest.Manifest, annotations map[string]interface{}) manifest.Manifest {
+	obj.Metadata()["annotations"] = annotations
+	return obj
+}
+
+// TestApplyObjectOptions checks that objects override the apply options of
+// the environment using annotations, while the others keep them
+func TestApplyObjectOptions(t *testing.T) {
+	state := manifest.List{
+		m("v1", "ConfigMap", "grafana", "default"),
+		annotated(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{
+			process.AnnotationApplyOptions: "force",
+		}),
+		annotated(m("apps/v1", "Deployment", "grafana", "default"), map[string]interface{}{
+			process.AnnotationApplyOptions: "server-side, force-conflicts",
+			process.AnnotationFieldManager: "hpa-controller",
+		}),
+		annotated(m("v1", "Service", "grafana", "default"), map[string]interface{}{
+			process.AnnotationApplyOptions: "client-side",
+		}),
+	}
+
+	c := &fakeClient{}
+	k := Kubernetes{ctl: c}
+
+	_, err := k.Apply(state, ApplyOpts{ApplyOpts: client.ApplyOpts{Validate: true}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]client.ApplyOpts{
+		"ConfigMap/grafana":  {Validate: true},
+		"Job/migrate":        {Validate: true, Force: true},
+		"Deployment/grafana": {Validate: true, ServerSide: true, ForceConflicts: true, FieldManager: "hpa-controller"},
+		"Service/grafana":    {Validate: true},
+	}, c.applyOpts)
+
+	// the environment defaults to server-side apply, which can't be forced
+	c = &fakeClient{}
+	k.ctl = c
+	_, err = k.Apply(state, ApplyOpts{ApplyOpts: client.ApplyOpts{Validate: true, ServerSide: true}})
+	assert.EqualError(t, err, "Job/migrate: force can't be combined with server-side apply, use `force-conflicts` or `client-side` (annotation tanka.dev/apply-options) instead")
+	assert.Empty(t, c.calls)
+
+	state[1] = annotated(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{
+		process.AnnotationApplyOptions: "force, client-side",
+	})
+	_, err = k.Apply(state, ApplyOpts{ApplyOpts: client.ApplyOpts{Validate: true, ServerSide: true}})
+	require.NoError(t, err)
+	assert.Equal(t, client.ApplyOpts{Validate: true, Force: true}, c.applyOpts["Job/migrate"])
+	assert.Equal(t, client.ApplyOpts{Validate: true, ServerSide: true}, c.applyOpts["ConfigMap/grafana"])
+	assert.Equal(t, client.ApplyOpts{Validate: true, ServerSide: true, ForceConflicts: true, FieldManager: "hpa-controller"}, c.applyOpts["Deployment/grafana"])
+	assert.Equal(t, client.ApplyOpts{Validate: true}, c.applyOpts["Service/grafana"])
+
+	// nor be forced by the environment
+	_, err = k.Apply(state[2:3], ApplyOpts{ApplyOpts: client.ApplyOpts{Validate: true, Force: true}})
+	assert.EqualError(t, err, "Deployment/grafana: force can't be combined with server-side apply, use `force-conflicts` or `client-side` (annotation tanka.dev/apply-options) instead")
+}
@@ -0,0 +1,82 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// applyVerbs are the verbs `kubectl apply` may require for each object
+var applyVerbs = []string{"get", "create", "patch"}
+
+// CheckAuth asks the API server whether the current user is permitted to
+// apply the whole state, so that RBAC denials are reported before anything is
+// changed. Kinds unknown to the server (e.g. of CRDs that are about to be
+// created) are skipped.
+func (k *Kubernetes) CheckAuth(state manifest.List) error {
+	resources, err := k.ctl.Resources()
+	if err != nil {
+		return clusterErr(errors.Wrap(err, "listing known api-resources"))
+	}
+
+	var checks []client.AuthCheck
+	for _, m := range state {
+		r, ok := resourceOf(resources, m)
+		if !ok {
+			continue
+		}
+
+		ns := ""
+		if r.Namespaced {
+			ns = m.Metadata().Namespace()
+			if ns == "" {
+				ns = k.Env.Spec.Namespace
+			}
+		}
+
+		for _, v := range applyVerbs {
+			checks = append(checks, client.AuthCheck{
+				Verb:      v,
+				Resource:  strings.TrimSuffix(r.Name+"."+r.APIGroup, "."),
+				Namespace: ns,
+			})
+		}
+	}
+
+	denied, err := k.ctl.CanI(checks)
+	if err != nil {
+		return clusterErr(err)
+	}
+	if len(denied) > 0 {
+		return clusterErr(ErrorAuthDenied{Denied: denied})
+	}
+	return nil
+}
+
+// resourceOf finds the api-resource of m by its kind and API group
+func resourceOf(resources client.Resources, m manifest.Manifest) (client.Resource, bool) {
+	for _, r := range resources {
+		if r.Kind == m.Kind() && r.APIGroup == m.Group() {
+			return r, true
+		}
+	}
+	return client.Resource{}, false
+}
+
+// ErrorAuthDenied occurs when the current user lacks permissions required for
+// applying the state
+type ErrorAuthDenied struct {
+	Denied []client.AuthCheck
+}
+
+func (e ErrorAuthDenied) Error() string {
+	s := fmt.Sprintf("not permitted to perform %d operation(s) required for apply:\n", len(e.Denied))
+	for _, d := range e.Denied {
+		s += fmt.Sprintf("  - %s\n", d)
+	}
+	return s + "Use --skip-auth-check to apply anyways"
+}
@@ -0,0 +1,51 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TestCheckAuth checks that all verbs required by apply are checked in the
+// correct namespace and that denials are aggregated
+func TestCheckAuth(t *testing.T) {
+	env := v1alpha1.New()
+	env.Spec.Namespace = "default"
+
+	c := &fakeClient{
+		resources: client.Resources{
+			{Kind: "Deployment", Name: "deployments", APIGroup: "apps", Namespaced: true},
+			{Kind: "ClusterRole", Name: "clusterroles", APIGroup: "rbac.authorization.k8s.io"},
+		},
+		denied: map[client.AuthCheck]bool{
+			{Verb: "create", Resource: "clusterroles.rbac.authorization.k8s.io"}:   true,
+			{Verb: "patch", Resource: "deployments.apps", Namespace: "monitoring"}: true,
+		},
+	}
+	k := Kubernetes{Env: *env, ctl: c}
+
+	state := manifest.List{
+		m("apps/v1", "Deployment", "grafana", "monitoring"),
+		m("rbac.authorization.k8s.io/v1", "ClusterRole", "grafana", ""),
+		// unknown kind, skipped
+		m("example.com/v1", "Widget", "foo", "default"),
+	}
+	delete(state[1].Metadata(), "namespace")
+
+	err := k.CheckAuth(state)
+	assert.Len(t, c.checked, 6)
+	assert.Contains(t, c.checked, client.AuthCheck{Verb: "get", Resource: "deployments.apps", Namespace: "monitoring"})
+
+	assert.Equal(t, ClusterError{Err: ErrorAuthDenied{Denied: []client.AuthCheck{
+		{Verb: "patch", Resource: "deployments.apps", Namespace: "monitoring"},
+		{Verb: "create", Resource: "clusterroles.rbac.authorization.k8s.io"},
+	}}}, err)
+	assert.Equal(t, `not permitted to perform 2 operation(s) required for apply:
+  - patch deployments.apps in namespace monitoring
+  - create clusterroles.rbac.authorization.k8s.io
+Use --skip-auth-check to apply anyways`, err.Error())
+}
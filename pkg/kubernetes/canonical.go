@@ -0,0 +1,220 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// canonicalize removes fields from both `is` and `should` that carry no
+// information, because the cluster and Jsonnet disagree about how to express
+// "nothing": `null`, `[]`, `{}` and an absent key are all treated the same.
+// Such fields are only dropped if the other side is empty for that key as
+// well, so actual changes (e.g. removing all entries of a list) still show up.
+//
+// Lists listed in unordered (path -> identifying field, see
+// v1alpha1.DiffSpec) are sorted on both sides, so that reordered but otherwise
+// equal lists are no difference.
+//
+// Neither input is modified, copies are returned instead.
+func canonicalize(is, should map[string]interface{}, unordered map[string]string) (map[string]interface{}, map[string]interface{}) {
+	a, b := copyMap(is), copyMap(should)
+	sortUnordered(a, unordered)
+	sortUnordered(b, unordered)
+
+	canonicalMaps(a, b)
+	return a, b
+}
+
+// serverMetadata are the fields of `metadata` the cluster populates on its own
+var serverMetadata = []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp", "selfLink"}
+
+// stripServerFields returns a copy of m without the fields the cluster
+// maintains on its own, which applying can't change anyways: serverMetadata
+// and, unless includeStatus is set, `status`
+func stripServerFields(m map[string]interface{}, includeStatus bool) map[string]interface{} {
+	out := copyMap(m)
+	if !includeStatus {
+		delete(out, "status")
+	}
+	if meta, ok := out["metadata"].(map[string]interface{}); ok {
+		for _, f := range serverMetadata {
+			delete(meta, f)
+		}
+	}
+	return out
+}
+
+// normalizeWhitespace returns a copy of v with all strings using LF line
+// endings and without trailing whitespace on any line. Content edited on
+// Windows thus equals the same content edited elsewhere.
+func normalizeWhitespace(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			out[k] = normalizeWhitespace(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = normalizeWhitespace(e)
+		}
+		return out
+	case string:
+		lines := strings.Split(strings.Replace(x, "\r\n", "\n", -1), "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(l, " \t\r")
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return v
+	}
+}
+
+// sortUnordered sorts all lists of m listed in unordered in place
+func sortUnordered(m map[string]interface{}, unordered map[string]string) {
+	for path, key := range unordered {
+		sortLists(m, strings.Split(path, "."), key)
+	}
+}
+
+// sortLists sorts the list found at path below v by the given key. Lists
+// along the path are descended into element by element.
+func sortLists(v interface{}, path []string, key string) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return
+		}
+		if len(path) == 1 {
+			if l, ok := x[path[0]].([]interface{}); ok {
+				sortList(l, key)
+			}
+			return
+		}
+		sortLists(x[path[0]], path[1:], key)
+	case []interface{}:
+		for _, e := range x {
+			sortLists(e, path, key)
+		}
+	}
+}
+
+// sortList sorts l in place, by the value of key if set or the elements
+// themselves otherwise. Numbers are compared numerically.
+func sortList(l []interface{}, key string) {
+	value := func(i int) interface{} {
+		if key == "" {
+			return l[i]
+		}
+		if m, ok := l[i].(map[string]interface{}); ok {
+			return m[key]
+		}
+		return nil
+	}
+
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := value(i), value(j)
+		if x, ok := a.(float64); ok {
+			if y, ok := b.(float64); ok {
+				return x < y
+			}
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+}
+
+func canonicalMaps(a, b map[string]interface{}) {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	for k := range keys {
+		va, vb := a[k], b[k]
+
+		// recurse first, so maps that only hold empty fields become empty
+		// themselves. An absent map is the same as an empty one.
+		if x, y, ok := asMaps(va, vb); ok {
+			canonicalMaps(x, y)
+			va, vb = x, y
+		}
+		if x, ok := va.([]interface{}); ok {
+			if y, ok := vb.([]interface{}); ok && len(x) == len(y) {
+				for i := range x {
+					cx, okx := x[i].(map[string]interface{})
+					cy, oky := y[i].(map[string]interface{})
+					if okx && oky {
+						canonicalMaps(cx, cy)
+					}
+				}
+			}
+		}
+
+		if isEmpty(va) && isEmpty(vb) {
+			delete(a, k)
+			delete(b, k)
+		}
+	}
+}
+
+// asMaps returns a and b as maps, if at least one of them is a map and the
+// other one either is a map too or is nil
+func asMaps(a, b interface{}) (map[string]interface{}, map[string]interface{}, bool) {
+	x, okx := a.(map[string]interface{})
+	y, oky := b.(map[string]interface{})
+	switch {
+	case okx && oky:
+		return x, y, true
+	case okx && b == nil:
+		return x, map[string]interface{}{}, true
+	case oky && a == nil:
+		return map[string]interface{}{}, y, true
+	}
+	return nil, nil, false
+}
+
+// isEmpty returns whether v is either nil or an empty list or map
+func isEmpty(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(x) == 0
+	case map[string]interface{}:
+		return len(x) == 0
+	}
+	return false
+}
+
+// copyMap deeply copies the maps and lists of m, so canonicalize can modify
+// them freely
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return copyMap(x)
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i := range x {
+			out[i] = copyValue(x[i])
+		}
+		return out
+	}
+	return v
+}
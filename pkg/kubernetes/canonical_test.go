@@ -0,0 +1,286 @@
+package kubernetes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name               string
+		is, should         map[string]interface{}
+		wantIs, wantShould map[string]interface{}
+	}{
+		{
+			name:       "emptyListVsAbsent",
+			is:         map[string]interface{}{"foo": "bar"},
+			should:     map[string]interface{}{"foo": "bar", "args": []interface{}{}},
+			wantIs:     map[string]interface{}{"foo": "bar"},
+			wantShould: map[string]interface{}{"foo": "bar"},
+		},
+		{
+			name:       "nullVsEmptyList",
+			is:         map[string]interface{}{"args": nil},
+			should:     map[string]interface{}{"args": []interface{}{}},
+			wantIs:     map[string]interface{}{},
+			wantShould: map[string]interface{}{},
+		},
+		{
+			name: "nestedEmptyMapVsAbsent",
+			is: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "grafana"},
+			},
+			should: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":        "grafana",
+					"annotations": map[string]interface{}{},
+				},
+				"spec": map[string]interface{}{
+					"volumes": []interface{}{},
+				},
+			},
+			wantIs: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "grafana"},
+			},
+			wantShould: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "grafana"},
+			},
+		},
+		{
+			name: "listOfObjects",
+			is: map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "grafana"},
+				},
+			},
+			should: map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "grafana", "env": []interface{}{}},
+				},
+			},
+			wantIs: map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "grafana"},
+				},
+			},
+			wantShould: map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "grafana"},
+				},
+			},
+		},
+		{
+			// removing all entries is an actual change
+			name:       "emptyVsFilled",
+			is:         map[string]interface{}{"args": []interface{}{"-v"}},
+			should:     map[string]interface{}{"args": []interface{}{}},
+			wantIs:     map[string]interface{}{"args": []interface{}{"-v"}},
+			wantShould: map[string]interface{}{"args": []interface{}{}},
+		},
+	}
+
+	for _, c := range tests {
+		t.Run(c.name, func(t *testing.T) {
+			is, should := canonicalize(c.is, c.should, nil)
+			assert.Equal(t, c.wantIs, is)
+			assert.Equal(t, c.wantShould, should)
+		})
+	}
+}
+
+// TestCanonicalizeCopies makes sure the inputs are left alone, as they are
+// applied to the cluster later on
+func TestCanonicalizeCopies(t *testing.T) {
+	should := map[string]interface{}{
+		"spec": map[string]interface{}{"args": []interface{}{}},
+	}
+	canonicalize(map[string]interface{}{}, should, nil)
+
+	assert.Equal(t, map[string]interface{}{
+		"spec": map[string]interface{}{"args": []interface{}{}},
+	}, should)
+}
+
+// TestSnapshotDifferCanonical checks that `[]` vs absent produces no diff
+func TestSnapshotDifferCanonical(t *testing.T) {
+	live := m("v1", "ConfigMap", "grafana", "default")
+
+	state := m("v1", "ConfigMap", "grafana", "default")
+	state["metadata"].(map[string]interface{})["finalizers"] = []interface{}{}
+
+	d, err := SnapshotDiffer(manifest.List{live}, CompareOpts{})(manifest.List{state}, client.DiffOpts{})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+// TestUnorderedLists checks that lists configured as unordered produce no diff
+// when only their order differs
+func TestUnorderedLists(t *testing.T) {
+	deploy := func(env []interface{}, args []interface{}) manifest.Manifest {
+		d := m("apps/v1", "Deployment", "grafana", "default")
+		d["spec"] = map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name": "grafana",
+							"env":  env,
+							"args": args,
+						},
+					},
+				},
+			},
+		}
+		return d
+	}
+	envVar := func(name, value string) interface{} {
+		return map[string]interface{}{"name": name, "value": value}
+	}
+
+	live := deploy(
+		[]interface{}{envVar("B", "2"), envVar("A", "1"), envVar("C", "3")},
+		[]interface{}{"--port=3000", "--config=/etc/grafana"},
+	)
+	state := deploy(
+		[]interface{}{envVar("A", "1"), envVar("B", "2"), envVar("C", "3")},
+		[]interface{}{"--config=/etc/grafana", "--port=3000"},
+	)
+
+	unordered := map[string]string{
+		"spec.template.spec.containers.env":  "name",
+		"spec.template.spec.containers.args": "",
+	}
+
+	t.Run("snapshot", func(t *testing.T) {
+		d, err := SnapshotDiffer(manifest.List{live}, CompareOpts{DiffSpec: v1alpha1.DiffSpec{UnorderedLists: unordered}})(manifest.List{state}, client.DiffOpts{})
+		require.NoError(t, err)
+		assert.Nil(t, d)
+
+		// without the mode, the reordering is a difference
+		d, err = SnapshotDiffer(manifest.List{live}, CompareOpts{})(manifest.List{state}, client.DiffOpts{})
+		require.NoError(t, err)
+		assert.NotNil(t, d)
+	})
+
+	t.Run("subset", func(t *testing.T) {
+		env := v1alpha1.New()
+		env.Spec.Diff.UnorderedLists = unordered
+		k := Kubernetes{Env: *env, ctl: &fakeClient{live: manifest.List{live}}}
+
+		plan, err := k.Plan(manifest.List{state})
+		require.NoError(t, err)
+		d, err := plan.Diff()
+		require.NoError(t, err)
+		assert.Nil(t, d)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		changed := deploy(
+			[]interface{}{envVar("A", "1"), envVar("B", "20"), envVar("C", "3")},
+			[]interface{}{"--config=/etc/grafana", "--port=3000"},
+		)
+		d, err := SnapshotDiffer(manifest.List{live}, CompareOpts{DiffSpec: v1alpha1.DiffSpec{UnorderedLists: unordered}})(manifest.List{changed}, client.DiffOpts{})
+		require.NoError(t, err)
+		require.NotNil(t, d)
+		assert.Contains(t, *d, "-          value: \"2\"\n+          value: \"20\"\n")
+	})
+}
+
+// TestIncludeStatus checks that `status` and the server populated metadata
+// (such as `metadata.managedFields`) are left out of subset diffs and
+// snapshots by default, while status is compared if IncludeStatus is set
+func TestIncludeStatus(t *testing.T) {
+	live := func(ready int) manifest.Manifest {
+		l := withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1)
+		l.Metadata()["managedFields"] = []interface{}{
+			map[string]interface{}{"manager": "kube-controller-manager"},
+		}
+		l.Metadata()["resourceVersion"] = fmt.Sprint(1000 + ready)
+		l.Metadata()["generation"] = ready
+		l.Metadata()["uid"] = "2c5a4b0e-7d43-4a3b-9a1e-8f1f6c1d0e21"
+		l["status"] = map[string]interface{}{"readyReplicas": ready}
+		return l
+	}
+	state := withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1)
+
+	t.Run("subsetStripped", func(t *testing.T) {
+		d, err := subsetDifference(state, copyMap(live(0)), CompareOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, d.merged, d.live)
+		assert.NotContains(t, d.live, "status")
+	})
+
+	t.Run("subsetIncluded", func(t *testing.T) {
+		d, err := subsetDifference(state, copyMap(live(0)), CompareOpts{DiffSpec: v1alpha1.DiffSpec{IncludeStatus: true}})
+		require.NoError(t, err)
+		assert.Contains(t, d.live, "status:\n    readyReplicas: 0")
+		assert.NotContains(t, d.merged, "status")
+		assert.NotContains(t, d.live, "managedFields")
+	})
+
+	t.Run("snapshotStripped", func(t *testing.T) {
+		d, err := SnapshotDiffer(manifest.List{live(0)}, CompareOpts{})(manifest.List{live(1)}, client.DiffOpts{})
+		require.NoError(t, err)
+		assert.Nil(t, d)
+	})
+
+	t.Run("snapshotIncluded", func(t *testing.T) {
+		d, err := SnapshotDiffer(manifest.List{live(0)}, CompareOpts{DiffSpec: v1alpha1.DiffSpec{IncludeStatus: true}})(manifest.List{live(1)}, client.DiffOpts{})
+		require.NoError(t, err)
+		require.NotNil(t, d)
+		assert.Contains(t, *d, "-  readyReplicas: 0\n+  readyReplicas: 1\n")
+		assert.NotContains(t, *d, "managedFields")
+		assert.NotContains(t, *d, "resourceVersion")
+	})
+}
+
+// TestNormalizeWhitespace checks that strings differing only in their line
+// endings or trailing whitespace are no difference, if requested
+func TestNormalizeWhitespace(t *testing.T) {
+	config := func(data string) manifest.Manifest {
+		c := m("v1", "ConfigMap", "grafana", "default")
+		c["data"] = map[string]interface{}{"grafana.ini": data}
+		return c
+	}
+	crlf := config("[server]  \r\nhttp_port = 3000\r\n")
+	lf := config("[server]\nhttp_port = 3000\n")
+
+	ignore := CompareOpts{DiffSpec: v1alpha1.DiffSpec{IgnoreWhitespace: true}}
+
+	t.Run("subset", func(t *testing.T) {
+		d, err := subsetDifference(lf, copyMap(crlf), ignore)
+		require.NoError(t, err)
+		assert.Equal(t, d.merged, d.live)
+	})
+
+	t.Run("subsetExact", func(t *testing.T) {
+		d, err := subsetDifference(lf, copyMap(crlf), CompareOpts{})
+		require.NoError(t, err)
+		assert.NotEqual(t, d.merged, d.live)
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		d, err := SnapshotDiffer(manifest.List{crlf}, ignore)(manifest.List{lf}, client.DiffOpts{})
+		require.NoError(t, err)
+		assert.Nil(t, d)
+	})
+
+	t.Run("snapshotExact", func(t *testing.T) {
+		d, err := SnapshotDiffer(manifest.List{crlf}, CompareOpts{})(manifest.List{lf}, client.DiffOpts{})
+		require.NoError(t, err)
+		assert.NotNil(t, d)
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		d, err := subsetDifference(config("[server]\nhttp_port = 3001\n"), copyMap(crlf), ignore)
+		require.NoError(t, err)
+		assert.NotEqual(t, d.merged, d.live)
+	})
+}
@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// FieldChange is a single field that differs between two objects
+type FieldChange struct {
+	// Path of the field as a JSON Pointer (RFC 6901), e.g. `/spec/replicas`
+	Path string
+
+	// Old is the value before, nil if the field was added
+	Old interface{}
+	// New is the value after, nil if the field was removed
+	New interface{}
+
+	// Added and Removed tell new and removed fields apart from those that are
+	// (or were) explicitly set to `null`
+	Added, Removed bool
+}
+
+// FieldChanges returns all fields that differ between live and merged, by
+// walking both objects. Objects are compared key by key and lists index by
+// index, all other values (including those changing their type) are reported
+// as a whole. Changes are ordered by path, except surplus list elements,
+// which are removed from the end, so that the changes can be applied in order.
+func FieldChanges(live, merged manifest.Manifest) []FieldChange {
+	return changedValue("", map[string]interface{}(live), map[string]interface{}(merged), nil)
+}
+
+func changedValue(path string, is, should interface{}, changes []FieldChange) []FieldChange {
+	switch a := is.(type) {
+	case map[string]interface{}:
+		if b, ok := should.(map[string]interface{}); ok {
+			return changedMap(path, a, b, changes)
+		}
+	case []interface{}:
+		if b, ok := should.([]interface{}); ok {
+			return changedList(path, a, b, changes)
+		}
+	}
+
+	if reflect.DeepEqual(is, should) {
+		return changes
+	}
+	return append(changes, FieldChange{Path: path, Old: is, New: should})
+}
+
+func changedMap(path string, is, should map[string]interface{}, changes []FieldChange) []FieldChange {
+	for _, k := range sortedKeys(is, should) {
+		p := path + "/" + escapePointer(k)
+		a, inIs := is[k]
+		b, inShould := should[k]
+
+		switch {
+		case !inShould:
+			changes = append(changes, FieldChange{Path: p, Old: a, Removed: true})
+		case !inIs:
+			changes = append(changes, FieldChange{Path: p, New: b, Added: true})
+		default:
+			changes = changedValue(p, a, b, changes)
+		}
+	}
+	return changes
+}
+
+func changedList(path string, is, should []interface{}, changes []FieldChange) []FieldChange {
+	common := len(is)
+	if len(should) < common {
+		common = len(should)
+	}
+
+	for i := 0; i < common; i++ {
+		changes = changedValue(fmt.Sprintf("%s/%d", path, i), is[i], should[i], changes)
+	}
+	for i := common; i < len(should); i++ {
+		changes = append(changes, FieldChange{Path: fmt.Sprintf("%s/%d", path, i), New: should[i], Added: true})
+	}
+	for i := len(is) - 1; i >= common; i-- {
+		changes = append(changes, FieldChange{Path: fmt.Sprintf("%s/%d", path, i), Old: is[i], Removed: true})
+	}
+	return changes
+}
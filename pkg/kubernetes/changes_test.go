@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestFieldChanges(t *testing.T) {
+	cases := []struct {
+		name         string
+		live, merged manifest.Manifest
+		want         []FieldChange
+	}{
+		{
+			name:   "equal",
+			live:   manifest.Manifest{"spec": map[string]interface{}{"replicas": 1}},
+			merged: manifest.Manifest{"spec": map[string]interface{}{"replicas": 1}},
+			want:   nil,
+		},
+		{
+			name: "nested",
+			live: manifest.Manifest{"spec": map[string]interface{}{
+				"replicas": 1,
+				"strategy": map[string]interface{}{"type": "Recreate", "timeout": 30},
+			}},
+			merged: manifest.Manifest{"spec": map[string]interface{}{
+				"replicas": 3,
+				"strategy": map[string]interface{}{"type": "RollingUpdate", "maxSurge": 1},
+			}},
+			want: []FieldChange{
+				{Path: "/spec/replicas", Old: 1, New: 3},
+				{Path: "/spec/strategy/maxSurge", New: 1, Added: true},
+				{Path: "/spec/strategy/timeout", Old: 30, Removed: true},
+				{Path: "/spec/strategy/type", Old: "Recreate", New: "RollingUpdate"},
+			},
+		},
+		{
+			name: "lists",
+			live: manifest.Manifest{"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "grafana", "image": "grafana/grafana:7.0.0"},
+				},
+				"args": []interface{}{"-a", "-b", "-c"},
+			}},
+			merged: manifest.Manifest{"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "grafana", "image": "grafana/grafana:7.1.0"},
+					map[string]interface{}{"name": "sidecar"},
+				},
+				"args": []interface{}{"-a"},
+			}},
+			want: []FieldChange{
+				// surplus elements are removed from the end
+				{Path: "/spec/args/2", Old: "-c", Removed: true},
+				{Path: "/spec/args/1", Old: "-b", Removed: true},
+				{Path: "/spec/containers/0/image", Old: "grafana/grafana:7.0.0", New: "grafana/grafana:7.1.0"},
+				{Path: "/spec/containers/1", New: map[string]interface{}{"name": "sidecar"}, Added: true},
+			},
+		},
+		{
+			name:   "typeChange",
+			live:   manifest.Manifest{"data": map[string]interface{}{"port": "3000", "config": map[string]interface{}{"a": 1}}},
+			merged: manifest.Manifest{"data": map[string]interface{}{"port": 3000, "config": []interface{}{1}}},
+			want: []FieldChange{
+				{Path: "/data/config", Old: map[string]interface{}{"a": 1}, New: []interface{}{1}},
+				{Path: "/data/port", Old: "3000", New: 3000},
+			},
+		},
+		{
+			// explicit nulls are neither added nor removed
+			name:   "null",
+			live:   manifest.Manifest{"spec": map[string]interface{}{"a": nil, "b": 1}},
+			merged: manifest.Manifest{"spec": map[string]interface{}{"a": 1, "b": nil}},
+			want: []FieldChange{
+				{Path: "/spec/a", Old: nil, New: 1},
+				{Path: "/spec/b", Old: 1, New: nil},
+			},
+		},
+		{
+			name:   "escaped",
+			live:   manifest.Manifest{"metadata": map[string]interface{}{"annotations": map[string]interface{}{"tanka.dev/a~b": "1"}}},
+			merged: manifest.Manifest{"metadata": map[string]interface{}{"annotations": map[string]interface{}{}}},
+			want: []FieldChange{
+				{Path: "/metadata/annotations/tanka.dev~1a~0b", Old: "1", Removed: true},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, FieldChanges(c.live, c.merged))
+		})
+	}
+}
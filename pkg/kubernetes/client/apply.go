@@ -1,14 +1,43 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 )
 
-// Apply applies the given yaml to the cluster
-func (k Kubectl) Apply(data manifest.List, opts ApplyOpts) error {
+// DefaultFieldManager is the field manager used for server-side apply, unless
+// ApplyOpts.FieldManager is set
+const DefaultFieldManager = "tanka"
+
+// Apply applies the given yaml to the cluster. kubectl is killed once ctx is
+// done. The output of kubectl (e.g. `deployment.apps/grafana configured`) is
+// returned.
+//
+// Using server-side apply, conflicts with other field managers are forced if
+// ForceConflicts is set, otherwise an ErrorConflict is returned.
+func (k Kubectl) Apply(ctx context.Context, data manifest.List, opts ApplyOpts) (string, error) {
+	cmd := k.ctlContext(ctx, "apply", applyArgs(opts)...)
+
+	var sout, serr bytes.Buffer
+	cmd.Stdout = io.MultiWriter(os.Stdout, &sout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &serr)
+
+	cmd.Stdin = strings.NewReader(data.String())
+
+	err := k.run(cmd)
+	if err != nil && opts.ServerSide && !opts.ForceConflicts && isConflict(serr.String()) {
+		return sout.String(), ErrorConflict{errOut: strings.TrimSpace(serr.String())}
+	}
+	return sout.String(), err
+}
+
+// applyArgs returns the arguments for `kubectl apply`
+func applyArgs(opts ApplyOpts) []string {
 	argv := []string{"-f", "-"}
 	if opts.Force {
 		argv = append(argv, "--force")
@@ -18,11 +47,26 @@ func (k Kubectl) Apply(data manifest.List, opts ApplyOpts) error {
 		argv = append(argv, "--validate=false")
 	}
 
-	cmd := k.ctl("apply", argv...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if opts.ServerSide {
+		manager := opts.FieldManager
+		if manager == "" {
+			manager = DefaultFieldManager
+		}
+		argv = append(argv, "--server-side", "--field-manager="+manager)
 
-	cmd.Stdin = strings.NewReader(data.String())
+		if opts.ForceConflicts {
+			argv = append(argv, "--force-conflicts")
+		}
+	} else if opts.FieldManager != "" {
+		// kubectl records its own manager otherwise
+		argv = append(argv, "--field-manager="+opts.FieldManager)
+	}
+
+	return argv
+}
 
-	return cmd.Run()
+// isConflict returns whether kubectl failed because of field manager conflicts
+// during server-side apply
+func isConflict(stderr string) bool {
+	return strings.Contains(stderr, "Apply failed with") && strings.Contains(stderr, "conflict")
 }
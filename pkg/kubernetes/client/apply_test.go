@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestApplyArgs(t *testing.T) {
+	cases := []struct {
+		name string
+		opts ApplyOpts
+		want []string
+	}{
+		{
+			name: "clientSide",
+			opts: ApplyOpts{Validate: true},
+			want: []string{"-f", "-"},
+		},
+		{
+			name: "serverSide",
+			opts: ApplyOpts{Validate: true, ServerSide: true},
+			want: []string{"-f", "-", "--server-side", "--field-manager=tanka"},
+		},
+		{
+			name: "fieldManager",
+			opts: ApplyOpts{Validate: true, ServerSide: true, FieldManager: "ci"},
+			want: []string{"-f", "-", "--server-side", "--field-manager=ci"},
+		},
+		{
+			name: "clientSideFieldManager",
+			opts: ApplyOpts{Validate: true, FieldManager: "ci"},
+			want: []string{"-f", "-", "--field-manager=ci"},
+		},
+		{
+			name: "forceConflicts",
+			opts: ApplyOpts{ServerSide: true, ForceConflicts: true},
+			want: []string{"-f", "-", "--validate=false", "--server-side", "--field-manager=tanka", "--force-conflicts"},
+		},
+		{
+			// only meaningful for server-side
+			name: "clientSideForce",
+			opts: ApplyOpts{Validate: true, ForceConflicts: true},
+			want: []string{"-f", "-"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, applyArgs(c.opts))
+		})
+	}
+}
+
+// TestApplyConflict checks that conflicts during server-side apply are forced
+// right away if enabled, and returned as ErrorConflict otherwise
+func TestApplyConflict(t *testing.T) {
+	conflicting := func(calls *[][]string) Runner {
+		return func(cmd *exec.Cmd) error {
+			args := cmd.Args[4:] // kubectl apply --context <ctx>
+			*calls = append(*calls, args)
+
+			if strings.Contains(strings.Join(args, " "), "--force-conflicts") {
+				fmt.Fprintln(cmd.Stdout, "deployment.apps/grafana serverside-applied")
+				return nil
+			}
+
+			fmt.Fprintln(cmd.Stderr, `error: Apply failed with 1 conflict: conflict with "kube-controller-manager" using apps/v1: .spec.replicas`)
+			return errors.New("exit status 1")
+		}
+	}
+	data := manifest.List{{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "grafana"},
+	}}
+
+	t.Run("force", func(t *testing.T) {
+		var calls [][]string
+		k := Kubectl{runner: conflicting(&calls)}
+
+		out, err := k.Apply(context.Background(), data, ApplyOpts{Validate: true, ServerSide: true, ForceConflicts: true})
+		require.NoError(t, err)
+		assert.Equal(t, "deployment.apps/grafana serverside-applied\n", out)
+		assert.Equal(t, [][]string{
+			{"-f", "-", "--server-side", "--field-manager=tanka", "--force-conflicts"},
+		}, calls)
+	})
+
+	t.Run("noForce", func(t *testing.T) {
+		var calls [][]string
+		k := Kubectl{runner: conflicting(&calls)}
+
+		_, err := k.Apply(context.Background(), data, ApplyOpts{Validate: true, ServerSide: true})
+		require.IsType(t, ErrorConflict{}, err)
+		assert.Contains(t, err.Error(), ".spec.replicas")
+		assert.Len(t, calls, 1)
+	})
+}
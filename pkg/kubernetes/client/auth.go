@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AuthCheck is a single `kubectl auth can-i` question
+type AuthCheck struct {
+	Verb, Resource string
+	// Namespace is empty for cluster-wide resources
+	Namespace string
+}
+
+func (a AuthCheck) String() string {
+	s := fmt.Sprintf("%s %s", a.Verb, a.Resource)
+	if a.Namespace != "" {
+		s += " in namespace " + a.Namespace
+	}
+	return s
+}
+
+// CanI asks the API server whether the current user is permitted to perform
+// each of the checks and returns those that were denied. Duplicate checks are
+// only asked once.
+func (k Kubectl) CanI(checks []AuthCheck) ([]AuthCheck, error) {
+	seen := make(map[AuthCheck]bool, len(checks))
+	var unique []AuthCheck
+	for _, c := range checks {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		unique = append(unique, c)
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i].String() < unique[j].String()
+	})
+
+	var denied []AuthCheck
+	for _, c := range unique {
+		ok, err := k.canI(c)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			denied = append(denied, c)
+		}
+	}
+
+	return denied, nil
+}
+
+func (k Kubectl) canI(c AuthCheck) (bool, error) {
+	argv := []string{"can-i", c.Verb, c.Resource}
+	if c.Namespace != "" {
+		argv = append(argv, "-n", c.Namespace)
+	}
+
+	cmd := k.ctl("auth", argv...)
+	var sout, serr bytes.Buffer
+	cmd.Stdout = &sout
+	cmd.Stderr = &serr
+
+	// can-i exits non-zero when denied, so the answer is what counts
+	err := k.run(cmd)
+	answer := strings.TrimSpace(sout.String())
+	switch {
+	case answer == "yes":
+		return true, nil
+	case strings.HasPrefix(answer, "no"):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("checking whether to %s: %s", c, strings.TrimPrefix(strings.TrimSpace(serr.String())+"\n"+err.Error(), "\n"))
+	}
+
+	return false, fmt.Errorf("checking whether to %s: unexpected answer `%s`", c, answer)
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCanI checks that each distinct check is asked exactly once and that the
+// denied ones are reported
+func TestCanI(t *testing.T) {
+	allowed := map[string]bool{
+		"create deployments.apps -n default": true,
+		"patch deployments.apps -n default":  true,
+		"create services -n default":         true,
+	}
+
+	var calls []string
+	k := Kubectl{runner: func(cmd *exec.Cmd) error {
+		// kubectl auth --context <ctx> can-i <args>
+		q := strings.Join(cmd.Args[5:], " ")
+		calls = append(calls, q)
+
+		if allowed[q] {
+			fmt.Fprintln(cmd.Stdout, "yes")
+			return nil
+		}
+		fmt.Fprintln(cmd.Stdout, "no")
+		return errors.New("exit status 1")
+	}}
+	k.info.Kubeconfig.Context.Name = "dev"
+
+	denied, err := k.CanI([]AuthCheck{
+		{Verb: "create", Resource: "deployments.apps", Namespace: "default"},
+		{Verb: "patch", Resource: "deployments.apps", Namespace: "default"},
+		{Verb: "create", Resource: "services", Namespace: "default"},
+		{Verb: "patch", Resource: "services", Namespace: "default"},
+		{Verb: "create", Resource: "clusterroles.rbac.authorization.k8s.io"},
+		// duplicate
+		{Verb: "create", Resource: "services", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []AuthCheck{
+		{Verb: "create", Resource: "clusterroles.rbac.authorization.k8s.io"},
+		{Verb: "patch", Resource: "services", Namespace: "default"},
+	}, denied)
+	assert.Len(t, calls, 5)
+}
+
+// TestCanIError checks that a failing kubectl, which answers neither yes nor
+// no, is an error instead of a denial
+func TestCanIError(t *testing.T) {
+	k := Kubectl{runner: func(cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, "Unable to connect to the server")
+		return errors.New("exit status 1")
+	}}
+
+	_, err := k.CanI([]AuthCheck{{Verb: "create", Resource: "services"}})
+	assert.EqualError(t, err, "checking whether to create services: Unable to connect to the server\nexit status 1")
+}
@@ -1,6 +1,10 @@
 package client
 
 import (
+	"context"
+	"io"
+	"time"
+
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 )
 
@@ -10,18 +14,36 @@ type Client interface {
 	Get(namespace, kind, name string) (manifest.Manifest, error)
 	GetByLabels(namespace, kind string, labels map[string]string) (manifest.List, error)
 	GetByState(data manifest.List) (manifest.List, error)
+	// GetBySelector returns all objects of the given kind(s) matching the label
+	// selector (kubectl syntax)
+	GetBySelector(namespace, kind, selector string) (manifest.List, error)
 
 	// Apply the configuration to the cluster. `data` must contain a plaintext
-	// format that is `kubectl-apply(1)` compatible
-	Apply(data manifest.List, opts ApplyOpts) error
+	// format that is `kubectl-apply(1)` compatible. The operation is aborted
+	// once ctx is done. Returns the output of kubectl, one line per object.
+	Apply(ctx context.Context, data manifest.List, opts ApplyOpts) (string, error)
+
+	// WaitReady blocks until the object is ready, e.g. a Job completed or a
+	// Deployment rolled out
+	WaitReady(namespace, kind, name string, timeout time.Duration) error
 
 	// DiffServerSide runs the diff operation on the server and returns the
 	// result in `diff(1)` format
-	DiffServerSide(data manifest.List) (*string, error)
+	DiffServerSide(data manifest.List, opts DiffOpts) (*string, error)
+
+	// ValidateServerSide checks the objects against the schemas of the cluster
+	// using a dry-run, without changing anything
+	ValidateServerSide(data manifest.List) error
+
+	// Patch applies the JSON merge patch (RFC 7386) to the specified object
+	Patch(namespace, kind, name string, patch []byte) error
 
 	// Delete the specified object(s) from the cluster
 	Delete(namespace, kind, name string, opts DeleteOpts) error
 
+	// CanI returns the checks the current user is not permitted to perform
+	CanI(checks []AuthCheck) (denied []AuthCheck, err error)
+
 	// Namespaces the cluster currently has
 	Namespaces() (map[string]bool, error)
 	// Resources returns all known api-resources of the cluster
@@ -36,7 +58,7 @@ type Client interface {
 	Close() error
 }
 
-// ApplyOpts allow to specify additional parameter for apply operations
+// ApplyOpts allow to specify the flags of `kubectl apply`
 type ApplyOpts struct {
 	// force allows to ignore checks and force the operation
 	Force bool
@@ -44,10 +66,41 @@ type ApplyOpts struct {
 	// validate allows to enable/disable kubectl validation
 	Validate bool
 
-	// autoApprove allows to skip the interactive approval
-	AutoApprove bool
+	// ServerSide uses server-side apply instead of the client-side three-way
+	// merge
+	ServerSide bool
+	// ForceConflicts takes ownership of fields also managed by someone else.
+	// Only used with ServerSide
+	ForceConflicts bool
+	// FieldManager recorded in the managedFields of the object. Defaults to
+	// DefaultFieldManager with ServerSide, to the one of kubectl otherwise
+	FieldManager string
+}
+
+// DiffOpts allow to specify additional parameters for diff operations
+type DiffOpts struct {
+	// Out is written the diff as soon as it is computed, in addition to it
+	// being returned. Each write holds the diff of one or more whole objects,
+	// so that it can be rendered on its own
+	Out io.Writer
+
+	// FullContext makes the diff hold the entire objects as context instead
+	// of only the lines around each change, e.g. for an external diff tool.
+	// `kubectl diff` supports this as of 1.18
+	FullContext bool
 }
 
 // DeleteOpts allow to specify additional parameters for delete operations
-// Currently not different from ApplyOpts, but may be required in the future
-type DeleteOpts ApplyOpts
+type DeleteOpts struct {
+	// force the operation (`--force`)
+	Force bool
+
+	// GracePeriod is the time objects are given to terminate gracefully
+	// (`--grace-period`), rounded up to seconds. Zero uses the default of each
+	// object.
+	GracePeriod time.Duration
+
+	// NoWait returns once the deletion is accepted, instead of waiting for
+	// the objects to be gone, e.g. for their finalizers (`--wait=false`)
+	NoWait bool
+}
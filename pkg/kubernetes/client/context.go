@@ -13,10 +13,10 @@ import (
 	funk "github.com/thoas/go-funk"
 )
 
-// findContext returns a valid context from $KUBECONFIG that uses the given
-// apiServer endpoint.
-func findContext(endpoint string) (Config, error) {
-	cluster, context, err := ContextFromIP(endpoint)
+// findContext returns a valid context from kubeconfig ($KUBECONFIG if empty)
+// that uses the given apiServer endpoint.
+func findContext(endpoint, kubeconfig string) (Config, error) {
+	cluster, context, err := contextFromIP(endpoint, kubeconfig)
 	if err != nil {
 		return Config{}, err
 	}
@@ -30,8 +30,9 @@ func findContext(endpoint string) (Config, error) {
 // writeNamespacePatch writes a temporary file that includes only the previously
 // discovered context with the `context.namespace` field set to the default
 // namespace from `spec.json`. Adding this file to `$KUBECONFIG` results in
-// `kubectl` picking this up, effectively setting the default namespace.
-func writeNamespacePatch(context Context, defaultNamespace string) (string, error) {
+// `kubectl` picking this up, effectively setting the default namespace. The
+// file is created below tempDir, the system default if empty.
+func writeNamespacePatch(context Context, defaultNamespace, tempDir string) (string, error) {
 	context.Context.Namespace = defaultNamespace
 
 	patch := map[string]interface{}{
@@ -42,7 +43,7 @@ func writeNamespacePatch(context Context, defaultNamespace string) (string, erro
 		return "", err
 	}
 
-	f, err := ioutil.TempFile("", "tk-kubectx-namespace-*.yaml")
+	f, err := ioutil.TempFile(tempDir, "tk-kubectx-namespace-*.yaml")
 	if err != nil {
 		return "", err
 	}
@@ -56,7 +57,13 @@ func writeNamespacePatch(context Context, defaultNamespace string) (string, erro
 
 // Kubeconfig returns the merged $KUBECONFIG of the host
 func Kubeconfig() (objx.Map, error) {
-	cmd := kubectlCmd("config", "view", "-o", "json")
+	return loadKubeconfig("")
+}
+
+// loadKubeconfig returns the given kubeconfig file, or the merged $KUBECONFIG
+// if file is empty
+func loadKubeconfig(file string) (objx.Map, error) {
+	cmd := kubectlCmd(configViewArgs(file)...)
 	cfgJSON := bytes.Buffer{}
 	cmd.Stdout = &cfgJSON
 	cmd.Stderr = os.Stderr
@@ -68,6 +75,16 @@ func Kubeconfig() (objx.Map, error) {
 	return objx.FromJSON(cfgJSON.String())
 }
 
+// configViewArgs returns the arguments of `kubectl config view` for the given
+// kubeconfig file
+func configViewArgs(file string) []string {
+	args := []string{"config", "view", "-o", "json"}
+	if file != "" {
+		args = append(args, "--kubeconfig", file)
+	}
+	return args
+}
+
 // Contexts returns a list of context names
 func Contexts() ([]string, error) {
 	cmd := kubectlCmd("config", "get-contexts", "-o=name")
@@ -83,7 +100,19 @@ func Contexts() ([]string, error) {
 
 // ContextFromIP searches the $KUBECONFIG for a context using a cluster that matches the apiServer
 func ContextFromIP(apiServer string) (*Cluster, *Context, error) {
-	cfg, err := Kubeconfig()
+	return contextFromIP(apiServer, "")
+}
+
+// KubeconfigContext is like ContextFromIP, but searches kubeconfig instead
+// of $KUBECONFIG, if set
+func KubeconfigContext(apiServer, kubeconfig string) (*Context, error) {
+	_, context, err := contextFromIP(apiServer, kubeconfig)
+	return context, err
+}
+
+// contextFromIP is like ContextFromIP, but searches kubeconfig if set
+func contextFromIP(apiServer, kubeconfig string) (*Cluster, *Context, error) {
+	cfg, err := loadKubeconfig(kubeconfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1,26 +1,37 @@
 package client
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
+	"time"
 )
 
+// Delete removes the specified object from the cluster
 func (k Kubectl) Delete(namespace, kind, name string, opts DeleteOpts) error {
-	argv := []string{
-		"-n", namespace,
-		kind, name,
-	}
+	return k.runDelete(k.deleteCmd(namespace, kind, name, opts))
+}
+
+func (k Kubectl) deleteCmd(namespace, kind, name string, opts DeleteOpts) *exec.Cmd {
+	argv := []string{"-n", namespace, kind, name}
 	if opts.Force {
 		argv = append(argv, "--force")
 	}
+	if opts.GracePeriod > 0 {
+		seconds := (opts.GracePeriod + time.Second - 1) / time.Second
+		argv = append(argv, fmt.Sprintf("--grace-period=%d", seconds))
+	}
+	if opts.NoWait {
+		argv = append(argv, "--wait=false")
+	}
 
-	cmd := k.ctl("delete", argv...)
+	return k.ctl("delete", argv...)
+}
+
+func (k Kubectl) runDelete(cmd *exec.Cmd) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
 
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-
-	return nil
+	return k.run(cmd)
 }
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDeleteCmd checks that the correct kubectl invocations are constructed
+// for deleting objects
+func TestDeleteCmd(t *testing.T) {
+	k := Kubectl{}
+	k.info.Kubeconfig.Context.Name = "dev"
+
+	cases := []struct {
+		name string
+		opts DeleteOpts
+		want []string
+	}{
+		{
+			name: "name",
+			want: []string{"delete", "--context", "dev", "-n", "default", "Deployment", "grafana"},
+		},
+		{
+			name: "force",
+			opts: DeleteOpts{Force: true},
+			want: []string{"delete", "--context", "dev", "-n", "default", "Deployment", "grafana", "--force"},
+		},
+		{
+			name: "gracePeriod",
+			opts: DeleteOpts{GracePeriod: 1500 * time.Millisecond},
+			want: []string{"delete", "--context", "dev", "-n", "default", "Deployment", "grafana", "--grace-period=2"},
+		},
+		{
+			name: "noWait",
+			opts: DeleteOpts{NoWait: true},
+			want: []string{"delete", "--context", "dev", "-n", "default", "Deployment", "grafana", "--wait=false"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cmd := k.deleteCmd("default", "Deployment", "grafana", c.opts)
+			assert.Equal(t, c.want, cmd.Args[1:])
+		})
+	}
+}
+
+func TestPatchCmd(t *testing.T) {
+	k := Kubectl{}
+	k.info.Kubeconfig.Context.Name = "dev"
+
+	cmd := k.patchCmd("monitoring", "Prometheus", "main", []byte(`{"metadata":{"finalizers":null}}`))
+	assert.Equal(t, []string{"patch", "--context", "dev", "-n", "monitoring", "Prometheus", "main", "--type=merge", "-p", `{"metadata":{"finalizers":null}}`}, cmd.Args[1:])
+}
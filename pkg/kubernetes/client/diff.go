@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"io"
 	"os/exec"
 	"regexp"
 	"strings"
@@ -11,9 +12,13 @@ import (
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 )
 
+// fullContextLines is the context of `kubectl diff` with DiffOpts.FullContext,
+// which exceeds the length of any object
+const fullContextLines = "1000000"
+
 // DiffServerSide takes the desired state and computes the differences on the
 // server, returning them in `diff(1)` format
-func (k Kubectl) DiffServerSide(data manifest.List) (*string, error) {
+func (k Kubectl) DiffServerSide(data manifest.List, opts DiffOpts) (*string, error) {
 	cmd := k.ctl("diff", "-f", "-")
 
 	raw := bytes.Buffer{}
@@ -24,7 +29,12 @@ func (k Kubectl) DiffServerSide(data manifest.List) (*string, error) {
 
 	cmd.Stdin = strings.NewReader(data.String())
 
-	err := cmd.Run()
+	// kubectl passes arguments of its diff program as of 1.18
+	if opts.FullContext && !k.Info().ClientVersion.LessThan(semver.MustParse("1.18.0")) {
+		cmd.Env = append(cmd.Env, "KUBECTL_EXTERNAL_DIFF=diff -u -N -U"+fullContextLines)
+	}
+
+	err := k.run(cmd)
 	if diffErr := parseDiffErr(err, fw.buf, k.Info().ClientVersion); diffErr != nil {
 		return nil, diffErr
 	}
@@ -34,6 +44,13 @@ func (k Kubectl) DiffServerSide(data manifest.List) (*string, error) {
 		return nil, nil
 	}
 
+	// kubectl prints the diff of all objects at once, when it is done
+	if opts.Out != nil {
+		if _, err := io.WriteString(opts.Out, s); err != nil {
+			return nil, err
+		}
+	}
+
 	return &s, nil
 }
 
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// TestDiffServerSideFullContext checks that kubectl is told to diff the entire
+// objects with DiffOpts.FullContext, if it knows how to
+func TestDiffServerSideFullContext(t *testing.T) {
+	externalDiff := func(version string, fullContext bool) string {
+		var env []string
+		k := Kubectl{runner: func(cmd *exec.Cmd) error {
+			env = cmd.Env
+			return nil
+		}}
+		k.info.ClientVersion = semver.MustParse(version)
+
+		_, err := k.DiffServerSide(manifest.List{}, DiffOpts{FullContext: fullContext})
+		require.NoError(t, err)
+		for _, e := range env {
+			if strings.HasPrefix(e, "KUBECTL_EXTERNAL_DIFF=") {
+				return strings.TrimPrefix(e, "KUBECTL_EXTERNAL_DIFF=")
+			}
+		}
+		return ""
+	}
+
+	assert.Equal(t, "", externalDiff("1.19.0", false))
+	assert.Equal(t, "diff -u -N -U"+fullContextLines, externalDiff("1.19.0", true))
+	assert.Equal(t, "", externalDiff("1.17.0", true))
+}
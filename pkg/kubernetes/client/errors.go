@@ -11,6 +11,15 @@ func (e ErrorNotFound) Error() string {
 	return e.errOut
 }
 
+// ErrorForbidden means that RBAC does not permit the request
+type ErrorForbidden struct {
+	errOut string
+}
+
+func (e ErrorForbidden) Error() string {
+	return e.errOut
+}
+
 // ErrorUnknownResource means that the requested resource type is unknown to the
 // server
 type ErrorUnknownResource struct {
@@ -21,6 +30,26 @@ func (e ErrorUnknownResource) Error() string {
 	return e.errOut
 }
 
+// ErrorConflict means that server-side apply failed, because other field
+// managers own some of the fields
+type ErrorConflict struct {
+	errOut string
+}
+
+func (e ErrorConflict) Error() string {
+	return e.errOut + "\nUse --force-conflicts to take ownership of these fields"
+}
+
+// ErrorInvalid means that the server rejected an object, because it does not
+// match the schema (OpenAPI or admission)
+type ErrorInvalid struct {
+	errOut string
+}
+
+func (e ErrorInvalid) Error() string {
+	return e.errOut
+}
+
 // ErrorNoContext means that the context that was searched for couldn't be found
 type ErrorNoContext string
 
@@ -1,6 +1,8 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,17 +13,29 @@ import (
 
 // kubectlCmd returns command a object that will launch kubectl at an appropriate path.
 func kubectlCmd(args ...string) *exec.Cmd {
+	return kubectlCmdContext(context.Background(), args...)
+}
+
+// kubectlCmdContext is like kubectlCmd, but kills kubectl once the context is
+// done
+func kubectlCmdContext(ctx context.Context, args ...string) *exec.Cmd {
 	binary := "kubectl"
 	if env := os.Getenv("TANKA_KUBECTL_PATH"); env != "" {
 		binary = env
 	}
 
-	return exec.Command(binary, args...)
+	return exec.CommandContext(ctx, binary, args...)
 }
 
 // ctl returns an `exec.Cmd` for `kubectl`. It also forces the correct context
-// and injects our patched $KUBECONFIG for the default namespace.
+// and injects our patched $KUBECONFIG for the default namespace. If the
+// environment has a kubeconfig of its own, it replaces the one of the host.
 func (k Kubectl) ctl(action string, args ...string) *exec.Cmd {
+	return k.ctlContext(context.Background(), action, args...)
+}
+
+// ctlContext is like ctl, but kills kubectl once the context is done
+func (k Kubectl) ctlContext(ctx context.Context, action string, args ...string) *exec.Cmd {
 	// prepare the arguments
 	argv := []string{action,
 		"--context", k.info.Kubeconfig.Context.Name,
@@ -29,8 +43,8 @@ func (k Kubectl) ctl(action string, args ...string) *exec.Cmd {
 	argv = append(argv, args...)
 
 	// prepare the cmd
-	cmd := kubectlCmd(argv...)
-	cmd.Env = patchKubeconfig(k.nsPatch, os.Environ())
+	cmd := kubectlCmdContext(ctx, argv...)
+	cmd.Env = withTempDir(patchKubeconfig(k.nsPatch, k.kubeconfig, os.Environ()), k.opts.TempDir)
 
 	if os.Getenv("TANKA_KUBECTL_TRACE") != "" {
 		fmt.Println(cmd.String())
@@ -39,9 +53,78 @@ func (k Kubectl) ctl(action string, args ...string) *exec.Cmd {
 	return cmd
 }
 
-func patchKubeconfig(file string, e []string) []string {
-	// prepend namespace patch to $KUBECONFIG
+// Runner runs the given command to completion, like cmd.Run() does. It allows
+// tests to replace kubectl.
+type Runner func(cmd *exec.Cmd) error
+
+// Output runs cmd using runner (cmd.Run() if nil) and returns what it wrote to
+// stdout. If it fails, the error includes what it wrote to stderr.
+func Output(runner Runner, cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	run := cmd.Run
+	if runner != nil {
+		run = func() error { return runner(cmd) }
+	}
+	if err := run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// run runs cmd using the configured Runner (cmd.Run() if nil), once the
+// Limiter permits
+func (k Kubectl) run(cmd *exec.Cmd) error {
+	release := k.opts.Limiter.acquire()
+	defer release()
+
+	if k.runner != nil {
+		return k.runner(cmd)
+	}
+	return cmd.Run()
+}
+
+// Limiter bounds how many kubectl commands run at once, across all clients
+// sharing it, e.g. to stay below the rate limits of the API server while
+// diffing many environments. Commands beyond the limit wait for a running one
+// to finish. A nil Limiter is unlimited.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter returns a Limiter allowing n kubectl commands at once. Zero or
+// less is unlimited, which is nil.
+func NewLimiter(n int) *Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a free slot and returns a function releasing it
+func (l *Limiter) acquire() (release func()) {
+	if l == nil {
+		return func() {}
+	}
+	l.slots <- struct{}{}
+	return func() { <-l.slots }
+}
+
+// patchKubeconfig prepends the namespace patch file to $KUBECONFIG. If set,
+// kubeconfig is used instead of the $KUBECONFIG of the host.
+//
+// `--kubeconfig` can't be used for this, as kubectl then ignores $KUBECONFIG
+// and thus the patch altogether.
+func patchKubeconfig(file, kubeconfig string, e []string) []string {
 	env := newEnv(e)
+	if kubeconfig != "" {
+		env["KUBECONFIG"] = kubeconfig
+	}
 	if _, ok := env["KUBECONFIG"]; !ok {
 		env["KUBECONFIG"] = filepath.Join(homeDir(), ".kube", "config") // kubectl default
 	}
@@ -49,6 +132,17 @@ func patchKubeconfig(file string, e []string) []string {
 	return env.render()
 }
 
+// withTempDir sets $TMPDIR, so that kubectl creates its temporary files (e.g.
+// those of `kubectl diff`) below dir as well. Unchanged if dir is empty.
+func withTempDir(e []string, dir string) []string {
+	if dir == "" {
+		return e
+	}
+	env := newEnv(e)
+	env["TMPDIR"] = dir
+	return env.render()
+}
+
 // environment is a helper type for manipulating os.Environ() more easily
 type environment map[string]string
 
@@ -2,19 +2,27 @@ package client
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const patchFile = "/tmp/tk-nsPatch.yaml"
 
 func TestPatchKubeconfig(t *testing.T) {
 	cases := []struct {
-		name string
-		env  []string
-		want []string
+		name       string
+		kubeconfig string
+		env        []string
+		want       []string
 	}{
 		{
 			name: "none",
@@ -28,12 +36,129 @@ func TestPatchKubeconfig(t *testing.T) {
 			env:  []string{"KUBECONFIG=/home/user/.config/kube"},
 			want: []string{"KUBECONFIG=" + patchFile + ":/home/user/.config/kube"},
 		},
+		{
+			name:       "environment",
+			kubeconfig: "/envs/prod/kubeconfig",
+			env:        []string{"KUBECONFIG=/home/user/.config/kube"},
+			want:       []string{"KUBECONFIG=" + patchFile + ":/envs/prod/kubeconfig"},
+		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			got := patchKubeconfig(patchFile, c.env)
+			got := patchKubeconfig(patchFile, c.kubeconfig, c.env)
 			assert.Equal(t, c.want, got)
 		})
 	}
 }
+
+// TestCtlKubeconfig checks that the kubeconfig of the environment replaces
+// $KUBECONFIG of the host for the commands run against the cluster
+func TestCtlKubeconfig(t *testing.T) {
+	defer os.Setenv("KUBECONFIG", os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBECONFIG", "/home/user/.kube/config")
+
+	kubeconfigOf := func(k Kubectl) string {
+		var env []string
+		k.runner = func(cmd *exec.Cmd) error {
+			env = cmd.Env
+			return nil
+		}
+		k.info.Kubeconfig.Context.Name = "dev"
+		require.NoError(t, k.ValidateServerSide(nil))
+
+		for _, e := range env {
+			if strings.HasPrefix(e, "KUBECONFIG=") {
+				return strings.TrimPrefix(e, "KUBECONFIG=")
+			}
+		}
+		return ""
+	}
+
+	assert.Equal(t, patchFile+":/envs/prod/kubeconfig", kubeconfigOf(Kubectl{nsPatch: patchFile, kubeconfig: "/envs/prod/kubeconfig"}))
+	assert.Equal(t, patchFile+":/home/user/.kube/config", kubeconfigOf(Kubectl{nsPatch: patchFile}))
+}
+
+func TestConfigViewArgs(t *testing.T) {
+	assert.Equal(t, []string{"config", "view", "-o", "json"}, configViewArgs(""))
+	assert.Equal(t, []string{"config", "view", "-o", "json", "--kubeconfig", "/envs/prod/kubeconfig"}, configViewArgs("/envs/prod/kubeconfig"))
+}
+
+// overlapRunner records the maximum number of commands running at once
+type overlapRunner struct {
+	mu             sync.Mutex
+	running, limit int
+}
+
+func (o *overlapRunner) run(cmd *exec.Cmd) error {
+	o.mu.Lock()
+	o.running++
+	if o.running > o.limit {
+		o.limit = o.running
+	}
+	o.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	o.mu.Lock()
+	o.running--
+	o.mu.Unlock()
+
+	_, err := fmt.Fprint(cmd.Stdout, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "grafana"}}`)
+	return err
+}
+
+// TestLimiter checks that no more than the given number of kubectl commands
+// run at once, even across clients sharing the Limiter
+func TestLimiter(t *testing.T) {
+	o := &overlapRunner{}
+
+	get := func(l *Limiter) {
+		k := Kubectl{runner: o.run, opts: Opts{Limiter: l}}
+		clients := []Kubectl{k, k, k}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			for _, k := range clients {
+				wg.Add(1)
+				go func(k Kubectl) {
+					defer wg.Done()
+					_, err := k.Get("default", "ConfigMap", "grafana")
+					assert.NoError(t, err)
+				}(k)
+			}
+		}
+		wg.Wait()
+	}
+
+	get(NewLimiter(2))
+	assert.Equal(t, 2, o.limit)
+
+	// unlimited
+	o.limit = 0
+	get(NewLimiter(0))
+	assert.True(t, o.limit > 2, "expected more than 2 commands at once, got %d", o.limit)
+}
+
+// TestCtlTempDir checks that kubectl is told to create its temporary files
+// below Opts.TempDir, as is the namespace patch
+func TestCtlTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tk-tmpdir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var env []string
+	k := Kubectl{nsPatch: patchFile, opts: Opts{TempDir: dir}, runner: func(cmd *exec.Cmd) error {
+		env = cmd.Env
+		return nil
+	}}
+	require.NoError(t, k.ValidateServerSide(nil))
+	assert.Contains(t, env, "TMPDIR="+dir)
+
+	patch, err := writeNamespacePatch(Context{}, "default", dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(patch))
+
+	// unset by default
+	assert.Equal(t, []string{"A=b"}, withTempDir([]string{"A=b"}, ""))
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Masterminds/semver"
+
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 )
 
@@ -23,7 +25,8 @@ func (k Kubectl) GetByLabels(namespace, kind string, labels map[string]string) (
 		lArgs = append(lArgs, fmt.Sprintf("-l=%s=%s", k, v))
 	}
 
-	var opts getOpts
+	// server-side applied objects are only recognized by their managedFields
+	opts := getOpts{managedFields: true}
 	if namespace == "" {
 		opts.allNamespaces = true
 	}
@@ -35,10 +38,21 @@ func (k Kubectl) GetByLabels(namespace, kind string, labels map[string]string) (
 	return unwrapList(list)
 }
 
+// GetBySelector retrieves all objects matched by the given label selector from
+// the cluster
+func (k Kubectl) GetBySelector(namespace, kind, selector string) (manifest.List, error) {
+	list, err := k.get(namespace, kind, []string{"-l", selector}, getOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrapList(list)
+}
+
 // GetByState returns the full object, including runtime fields for each
-// resource in the state
+// resource in the state. Objects not present in the cluster are omitted.
 func (k Kubectl) GetByState(data manifest.List) (manifest.List, error) {
-	list, err := k.get("", "", []string{"-f", "-"}, getOpts{
+	list, err := k.get("", "", []string{"-f", "-", "--ignore-not-found"}, getOpts{
 		stdin: data.String(),
 	})
 	if err != nil {
@@ -51,6 +65,8 @@ func (k Kubectl) GetByState(data manifest.List) (manifest.List, error) {
 type getOpts struct {
 	allNamespaces bool
 	stdin         string
+	// include metadata.managedFields, which kubectl 1.21+ leaves out by default
+	managedFields bool
 }
 
 func (k Kubectl) get(namespace, kind string, selector []string, opts getOpts) (manifest.Manifest, error) {
@@ -65,6 +81,10 @@ func (k Kubectl) get(namespace, kind string, selector []string, opts getOpts) (m
 		argv = append(argv, "-n", namespace)
 	}
 
+	if opts.managedFields && showsManagedFields(k.info.ClientVersion) {
+		argv = append(argv, "--show-managed-fields")
+	}
+
 	if kind != "" {
 		argv = append(argv, kind)
 	}
@@ -81,10 +101,15 @@ func (k Kubectl) get(namespace, kind string, selector []string, opts getOpts) (m
 	}
 
 	// run command
-	if err := cmd.Run(); err != nil {
+	if err := k.run(cmd); err != nil {
 		return nil, parseGetErr(err, serr.String())
 	}
 
+	// --ignore-not-found prints nothing at all if nothing was found
+	if len(bytes.TrimSpace(sout.Bytes())) == 0 {
+		return manifest.Manifest{"kind": "List", "items": []interface{}{}}, nil
+	}
+
 	// parse result
 	var m manifest.Manifest
 	if err := json.Unmarshal(sout.Bytes(), &m); err != nil {
@@ -98,6 +123,9 @@ func parseGetErr(err error, stderr string) error {
 	if strings.HasPrefix(stderr, "Error from server (NotFound)") {
 		return ErrorNotFound{stderr}
 	}
+	if strings.HasPrefix(stderr, "Error from server (Forbidden)") {
+		return ErrorForbidden{stderr}
+	}
 	if strings.HasPrefix(stderr, "error: the server doesn't have a resource type") {
 		return ErrorUnknownResource{stderr}
 	}
@@ -118,3 +146,9 @@ func unwrapList(list manifest.Manifest) (manifest.List, error) {
 
 	return ms, nil
 }
+
+// showsManagedFields returns whether kubectl of version v knows
+// --show-managed-fields. Older ones always include metadata.managedFields.
+func showsManagedFields(v *semver.Version) bool {
+	return v != nil && !v.LessThan(semver.MustParse("1.21.0"))
+}
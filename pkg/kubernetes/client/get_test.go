@@ -0,0 +1,40 @@
+package client
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetByLabelsManagedFields checks that managedFields are requested from
+// kubectl versions that hide them by default
+func TestGetByLabelsManagedFields(t *testing.T) {
+	for version, want := range map[string]bool{"1.20.4": false, "1.21.0": true} {
+		t.Run(version, func(t *testing.T) {
+			var args []string
+			k := Kubectl{runner: func(cmd *exec.Cmd) error {
+				args = cmd.Args
+				fmt.Fprint(cmd.Stdout, `{"apiVersion": "v1", "kind": "List", "items": []}`)
+				return nil
+			}}
+			k.info.ClientVersion = semver.MustParse(version)
+
+			_, err := k.GetByLabels("", "Deployment.apps", map[string]string{"tanka.dev/environment": "abc"})
+			require.NoError(t, err)
+			assert.Equal(t, want, contains(args, "--show-managed-fields"), args)
+		})
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
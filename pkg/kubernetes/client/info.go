@@ -52,7 +52,7 @@ func (k Kubectl) version() (client, server *semver.Version, err error) {
 	cmd.Stdout = &buf
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := k.run(cmd); err != nil {
 		return nil, nil, err
 	}
 
@@ -18,21 +18,44 @@ type Kubectl struct {
 
 	// internal fields
 	nsPatch string
+	// kubeconfig of the environment, $KUBECONFIG if empty
+	kubeconfig string
+	// runs the kubectl commands. cmd.Run() if nil
+	runner Runner
+	opts   Opts
+}
+
+// Opts configure how Kubectl runs kubectl
+type Opts struct {
+	// TempDir is where temporary files are created (the namespace patch and
+	// those of kubectl), instead of the system default if set, e.g. because
+	// /tmp is noexec or full. See util.CheckTempDir
+	TempDir string
+
+	// Limiter bounds how many kubectl commands run at once. Nil if unlimited
+	Limiter *Limiter
 }
 
 // New returns a instance of Kubectl with a correct context already discovered.
-func New(endpoint, defaultNamespace string) (*Kubectl, error) {
-	k := Kubectl{}
+// If kubeconfig is set, it is used instead of $KUBECONFIG.
+func New(endpoint, defaultNamespace, kubeconfig string, opts Opts) (*Kubectl, error) {
+	k := Kubectl{kubeconfig: kubeconfig, opts: opts}
+
+	if kubeconfig != "" {
+		if _, err := os.Stat(kubeconfig); err != nil {
+			return nil, errors.Wrap(err, "reading kubeconfig of the environment")
+		}
+	}
 
 	// discover context
 	var err error
-	k.info.Kubeconfig, err = findContext(endpoint)
+	k.info.Kubeconfig, err = findContext(endpoint, kubeconfig)
 	if err != nil {
 		return nil, errors.Wrap(err, "finding usable context")
 	}
 
 	// set the default namespace by injecting it into the context
-	nsPatch, err := writeNamespacePatch(k.info.Kubeconfig.Context, defaultNamespace)
+	nsPatch, err := writeNamespacePatch(k.info.Kubeconfig.Context, defaultNamespace, opts.TempDir)
 	if err != nil {
 		return nil, errors.Wrap(err, "creating $KUBECONFIG patch for default namespace")
 	}
@@ -66,7 +89,7 @@ func (k Kubectl) Namespaces() (map[string]bool, error) {
 	cmd.Stdout = &sout
 	cmd.Stderr = os.Stderr
 
-	err := cmd.Run()
+	err := k.run(cmd)
 	if err != nil {
 		return nil, err
 	}
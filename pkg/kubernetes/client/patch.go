@@ -0,0 +1,31 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Patch applies the JSON merge patch (RFC 7386) to the specified object
+func (k Kubectl) Patch(namespace, kind, name string, patch []byte) error {
+	cmd := k.patchCmd(namespace, kind, name, patch)
+	var serr bytes.Buffer
+	cmd.Stderr = &serr
+
+	if err := k.run(cmd); err != nil {
+		return parsePatchErr(err, serr.String())
+	}
+	return nil
+}
+
+func (k Kubectl) patchCmd(namespace, kind, name string, patch []byte) *exec.Cmd {
+	return k.ctl("patch", "-n", namespace, kind, name, "--type=merge", "-p", string(patch))
+}
+
+func parsePatchErr(err error, stderr string) error {
+	if strings.HasPrefix(stderr, "Error from server (NotFound)") {
+		return ErrorNotFound{stderr}
+	}
+	return errors.New(strings.TrimPrefix(stderr+"\n"+err.Error(), "\n"))
+}
@@ -48,7 +48,7 @@ func (k Kubectl) Resources() (Resources, error) {
 	cmd.Stdout = &out
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := k.run(cmd); err != nil {
 		return nil, err
 	}
 
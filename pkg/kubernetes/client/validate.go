@@ -0,0 +1,42 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// ValidateServerSide validates the given objects against the schemas of the
+// cluster, using a server-side dry-run of `kubectl apply`. Nothing is changed.
+// If the server rejects an object, an ErrorInvalid is returned.
+func (k Kubectl) ValidateServerSide(data manifest.List) error {
+	cmd := k.ctl("apply", "-f", "-", "--dry-run=server", "--validate=true")
+
+	var serr bytes.Buffer
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = &serr
+	cmd.Stdin = strings.NewReader(data.String())
+
+	err := k.run(cmd)
+	if err == nil {
+		return nil
+	}
+
+	errOut := strings.TrimSpace(serr.String())
+	if isInvalid(errOut) {
+		return ErrorInvalid{errOut: errOut}
+	}
+	if errOut != "" {
+		return errors.New(errOut)
+	}
+	return err
+}
+
+// isInvalid returns whether kubectl failed because the object did not match
+// the schema, either during client-side validation or the dry-run
+func isInvalid(stderr string) bool {
+	return strings.Contains(stderr, "error validating") || strings.Contains(stderr, "is invalid")
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// TestValidateServerSide checks that objects rejected by the server are
+// reported as ErrorInvalid, while others pass
+func TestValidateServerSide(t *testing.T) {
+	var calls [][]string
+	k := Kubectl{runner: func(cmd *exec.Cmd) error {
+		calls = append(calls, cmd.Args[4:]) // kubectl apply --context <ctx>
+
+		in, err := ioutil.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(in), "kind: Deployment") {
+			fmt.Fprintln(cmd.Stderr, `error: error validating "STDIN": error validating data: ValidationError(Deployment.spec): missing required field "selector" in io.k8s.api.apps.v1.DeploymentSpec`)
+			return errors.New("exit status 1")
+		}
+
+		fmt.Fprintln(cmd.Stdout, "configmap/grafana created (server dry run)")
+		return nil
+	}}
+	k.info.Kubeconfig.Context.Name = "dev"
+
+	obj := func(kind string) manifest.List {
+		return manifest.List{{
+			"apiVersion": "v1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "grafana"},
+		}}
+	}
+
+	require.NoError(t, k.ValidateServerSide(obj("ConfigMap")))
+
+	err := k.ValidateServerSide(obj("Deployment"))
+	require.IsType(t, ErrorInvalid{}, err)
+	assert.Contains(t, err.Error(), `missing required field "selector"`)
+
+	assert.Equal(t, []string{"-f", "-", "--dry-run=server", "--validate=true"}, calls[0])
+}
+
+// TestValidateServerSideError checks that failures unrelated to the schema are
+// not reported as ErrorInvalid
+func TestValidateServerSideError(t *testing.T) {
+	k := Kubectl{runner: func(cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, "Unable to connect to the server")
+		return errors.New("exit status 1")
+	}}
+
+	err := k.ValidateServerSide(manifest.List{})
+	require.Error(t, err)
+	assert.NotEqual(t, ErrorInvalid{}, err)
+	assert.EqualError(t, err, "Unable to connect to the server")
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// WaitReady blocks until the object is ready: Jobs until they completed,
+// Deployments, StatefulSets and DaemonSets until their rollout finished and
+// Namespaces until they are Active. All other kinds are ready right away. A
+// zero timeout uses the kubectl default.
+func (k Kubectl) WaitReady(namespace, kind, name string, timeout time.Duration) error {
+	var action string
+	var argv []string
+	switch kind {
+	case "Namespace":
+		return k.waitNamespace(name, timeout)
+	case "Job":
+		action, argv = "wait", []string{"--for=condition=complete"}
+	case "Deployment", "StatefulSet", "DaemonSet":
+		action, argv = "rollout", []string{"status"}
+	default:
+		return nil
+	}
+
+	argv = append(argv, strings.ToLower(kind)+"/"+name)
+	if namespace != "" {
+		argv = append(argv, "-n", namespace)
+	}
+	if timeout > 0 {
+		argv = append(argv, "--timeout="+timeout.String())
+	}
+
+	cmd := k.ctl(action, argv...)
+	var serr bytes.Buffer
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = &serr
+
+	if err := k.run(cmd); err != nil {
+		return fmt.Errorf("waiting for %s/%s: %s", kind, name, strings.TrimSpace(serr.String()))
+	}
+	return nil
+}
+
+// namespacePollInterval is how often waitNamespace checks the phase
+var namespacePollInterval = time.Second
+
+// defaultNamespaceTimeout is used by waitNamespace if no timeout is given
+const defaultNamespaceTimeout = time.Minute
+
+// waitNamespace polls the phase of the Namespace until it is Active. kubectl
+// has no command for this, as the phase is no condition. A Namespace that is
+// not found yet is polled for as well, as its creation may not have settled.
+func (k Kubectl) waitNamespace(name string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultNamespaceTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		cmd := k.ctl("get", "namespace", name, "-o", "jsonpath={.status.phase}")
+		var sout, serr bytes.Buffer
+		cmd.Stdout = &sout
+		cmd.Stderr = &serr
+
+		state := ""
+		if err := k.run(cmd); err != nil {
+			state = strings.TrimSpace(serr.String())
+		} else if phase := strings.TrimSpace(sout.String()); phase == "Active" {
+			return nil
+		} else {
+			state = "phase is " + phase
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("waiting for Namespace/%s to become Active: timed out after %s: %s", name, timeout, state)
+		}
+		time.Sleep(namespacePollInterval)
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWaitReady checks that each kind is waited for using the matching
+// kubectl command, while kinds without readiness are not waited for at all
+func TestWaitReady(t *testing.T) {
+	var calls [][]string
+	k := Kubectl{runner: func(cmd *exec.Cmd) error {
+		calls = append(calls, cmd.Args[1:])
+		return nil
+	}}
+	k.info.Kubeconfig.Context.Name = "dev"
+
+	require.NoError(t, k.WaitReady("default", "Job", "migrate", time.Minute))
+	require.NoError(t, k.WaitReady("", "Deployment", "grafana", 0))
+	require.NoError(t, k.WaitReady("default", "ConfigMap", "grafana", time.Minute))
+
+	assert.Equal(t, [][]string{
+		{"wait", "--context", "dev", "--for=condition=complete", "job/migrate", "-n", "default", "--timeout=1m0s"},
+		{"rollout", "--context", "dev", "status", "deployment/grafana"},
+	}, calls)
+}
+
+// TestWaitNamespace checks that the phase of a Namespace is polled until it
+// becomes Active, tolerating it not being found at first
+func TestWaitNamespace(t *testing.T) {
+	defer func(i time.Duration) { namespacePollInterval = i }(namespacePollInterval)
+	namespacePollInterval = time.Millisecond
+
+	outputs := []string{"", "Terminating", "Active"}
+	var calls [][]string
+	k := Kubectl{runner: func(cmd *exec.Cmd) error {
+		calls = append(calls, cmd.Args[1:])
+		out := outputs[0]
+		outputs = outputs[1:]
+		if out == "" {
+			fmt.Fprintln(cmd.Stderr, `Error from server (NotFound): namespaces "grafana" not found`)
+			return errors.New("exit status 1")
+		}
+		fmt.Fprint(cmd.Stdout, out)
+		return nil
+	}}
+	k.info.Kubeconfig.Context.Name = "dev"
+
+	require.NoError(t, k.WaitReady("", "Namespace", "grafana", time.Minute))
+	require.Len(t, calls, 3)
+	assert.Equal(t, []string{"get", "--context", "dev", "namespace", "grafana", "-o", "jsonpath={.status.phase}"}, calls[0])
+
+	t.Run("timeout", func(t *testing.T) {
+		k := Kubectl{runner: func(cmd *exec.Cmd) error {
+			fmt.Fprint(cmd.Stdout, "Terminating")
+			return nil
+		}}
+
+		err := k.WaitReady("", "Namespace", "grafana", 5*time.Millisecond)
+		assert.EqualError(t, err, "waiting for Namespace/grafana to become Active: timed out after 5ms: phase is Terminating")
+	})
+}
@@ -1,18 +1,113 @@
 package kubernetes
 
 import (
+	"strings"
+	"time"
+
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
 )
 
-type DeleteOpts client.DeleteOpts
+// DeleteOpts allow to set additional parameters for the delete operation
+type DeleteOpts struct {
+	// Force allows to ignore checks and force the operation
+	Force bool
+
+	// GracePeriod is the time objects are given to terminate gracefully. Zero
+	// uses the default of each object
+	GracePeriod time.Duration
+
+	// TerminatingTimeout is how long a deleted object may take to be gone,
+	// e.g. while its finalizers run, before it is reported as stuck (see
+	// ErrorStuckTerminating). Zero uses defaultTerminatingTimeout
+	TerminatingTimeout time.Duration
+
+	// RemoveFinalizers removes the finalizers of objects stuck terminating, so
+	// that they are gone right away. Dangerous, as the cleanup the finalizers
+	// stand for (e.g. of volumes or cloud resources) is skipped
+	RemoveFinalizers bool
+}
+
+// DeleteOrder returns the objects of state in the order Delete deletes them:
+// the reverse order of applying them (see process.SortReverse). This way,
+// objects are deleted before the Namespaces and CustomResourceDefinitions they
+// depend on. state is left as-is.
+func DeleteOrder(state manifest.List) manifest.List {
+	ordered := append(manifest.List{}, state...)
+	process.SortReverse(ordered)
+	return ordered
+}
 
+// Delete removes the given objects from the cluster, in the DeleteOrder. Once
+// all are deleted, they are waited for at once. Objects still terminating
+// after opts.TerminatingTimeout are reported using ErrorStuckTerminating.
 func (k *Kubernetes) Delete(state manifest.List, opts DeleteOpts) error {
-	for _, m := range state {
-		if err := k.ctl.Delete(m.Metadata().Namespace(), m.Kind(), m.Metadata().Name(), client.DeleteOpts(opts)); err != nil {
-			return err
+	ordered := DeleteOrder(state)
+
+	for _, m := range ordered {
+		if err := k.ctl.Delete(m.Metadata().Namespace(), m.Kind(), m.Metadata().Name(), opts.client()); err != nil {
+			return clusterErr(err)
+		}
+	}
+
+	stuck, err := k.awaitGone(ordered, opts)
+	if err != nil {
+		return err
+	}
+	return opts.stuckErr(stuck)
+}
+
+// BySelector returns all live objects of the environment's namespace that
+// match the label selector (kubectl syntax), regardless of the local state.
+// Passing these to Delete removes exactly the objects returned, even if others
+// match the selector in the meantime.
+func (k *Kubernetes) BySelector(selector string) (manifest.List, error) {
+	kinds, err := k.namespacedKinds()
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := k.ctl.GetBySelector(k.Env.Spec.Namespace, kinds, selector)
+	return matched, clusterErr(err)
+}
+
+// client returns the options passed to kubectl. Tanka waits for the objects
+// to be gone itself, see awaitGone
+func (opts DeleteOpts) client() client.DeleteOpts {
+	return client.DeleteOpts{Force: opts.Force, GracePeriod: opts.GracePeriod, NoWait: true}
+}
+
+func (opts DeleteOpts) terminatingTimeout() time.Duration {
+	if opts.TerminatingTimeout <= 0 {
+		return defaultTerminatingTimeout
+	}
+	return opts.TerminatingTimeout
+}
+
+// stuckErr returns an ErrorStuckTerminating for stuck, if any
+func (opts DeleteOpts) stuckErr(stuck []StuckObject) error {
+	if len(stuck) == 0 {
+		return nil
+	}
+	return ErrorStuckTerminating{Objects: stuck, Timeout: opts.terminatingTimeout()}
+}
+
+// namespacedKinds returns all namespaced kinds of the cluster that support
+// both, LIST and DELETE, as a comma separated string for kubectl
+func (k *Kubernetes) namespacedKinds() (string, error) {
+	apiResources, err := k.ctl.Resources()
+	if err != nil {
+		return "", clusterErr(err)
+	}
+
+	var kinds []string
+	for _, r := range apiResources {
+		if !r.Namespaced || !strings.Contains(r.Verbs, "list") || !strings.Contains(r.Verbs, "delete") {
+			continue
 		}
+		kinds = append(kinds, r.FQN())
 	}
 
-	return nil
+	return strings.Join(kinds, ","), nil
 }
@@ -0,0 +1,192 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TestDeleteOrder checks that objects are deleted in the reverse order of
+// applying them, as planned by DeleteOrder, with the grace period forwarded to
+// each delete
+func TestDeleteOrder(t *testing.T) {
+	state := manifest.List{
+		m("v1", "Namespace", "monitoring", ""),
+		m("apiextensions.k8s.io/v1", "CustomResourceDefinition", "prometheuses.monitoring.coreos.com", ""),
+		m("v1", "ConfigMap", "grafana", "monitoring"),
+		m("monitoring.coreos.com/v1", "Prometheus", "main", "monitoring"),
+		m("apps/v1", "Deployment", "grafana", "monitoring"),
+	}
+
+	c := &fakeClient{}
+	k := Kubernetes{ctl: c}
+
+	var planned []string
+	for _, m := range DeleteOrder(state) {
+		planned = append(planned, m.KindName())
+	}
+	assert.Empty(t, c.deleted)
+
+	require.NoError(t, k.Delete(state, DeleteOpts{GracePeriod: 30 * time.Second}))
+	assert.Equal(t, planned, c.deleted)
+	assert.Equal(t, []string{
+		"Prometheus/main",
+		"Deployment/grafana",
+		"CustomResourceDefinition/prometheuses.monitoring.coreos.com",
+		"ConfigMap/grafana",
+		"Namespace/monitoring",
+	}, c.deleted)
+	assert.Equal(t, client.DeleteOpts{GracePeriod: 30 * time.Second, NoWait: true}, c.deleteOpts)
+
+	// the state is left as-is
+	assert.Equal(t, "Namespace", state[0].Kind())
+}
+
+// TestDeleteBySelector checks that live objects are looked up by selector,
+// limited to the namespaced kinds of the environment's namespace, and that
+// exactly those are deleted
+func TestDeleteBySelector(t *testing.T) {
+	env := v1alpha1.New()
+	env.Spec.Namespace = "monitoring"
+
+	c := &fakeClient{
+		resources: client.Resources{
+			{Kind: "Deployment", APIGroup: "apps", Namespaced: true, Verbs: "[create delete get list]"},
+			{Kind: "Service", Namespaced: true, Verbs: "[create delete get list]"},
+			// cluster-wide
+			{Kind: "ClusterRole", APIGroup: "rbac.authorization.k8s.io", Verbs: "[create delete get list]"},
+			// cannot be deleted
+			{Kind: "Event", Namespaced: true, Verbs: "[get list]"},
+		},
+		labeled: manifest.List{
+			m("apps/v1", "Deployment", "retired", "monitoring"),
+			m("v1", "Service", "retired", "monitoring"),
+		},
+	}
+	k := Kubernetes{Env: *env, ctl: c}
+
+	// preview
+	matched, err := k.BySelector("app=retired")
+	require.NoError(t, err)
+	assert.Equal(t, c.labeled, matched)
+	assert.Equal(t, []string{"monitoring Deployment.apps,Service app=retired"}, c.selected)
+
+	// objects matching afterwards are left alone
+	c.labeled = append(c.labeled, m("v1", "ConfigMap", "new", "monitoring"))
+
+	require.NoError(t, k.Delete(matched, DeleteOpts{}))
+	assert.ElementsMatch(t, []string{"Deployment/retired", "Service/retired"}, c.deleted)
+}
+
+func terminating(apiVersion, kind, name, namespace string, finalizers ...interface{}) manifest.Manifest {
+	obj := m(apiVersion, kind, name, namespace)
+	obj.Metadata()["deletionTimestamp"] = "2020-11-01T12:00:00Z"
+	obj.Metadata()["finalizers"] = finalizers
+	return obj
+}
+
+// TestDeleteStuckTerminating checks that objects still terminating after the
+// timeout are reported, without holding up the others
+func TestDeleteStuckTerminating(t *testing.T) {
+	defer func(i time.Duration) { waitForPollInterval = i }(waitForPollInterval)
+	waitForPollInterval = time.Millisecond
+
+	state := manifest.List{
+		m("apps/v1", "Deployment", "grafana", "monitoring"),
+		m("monitoring.coreos.com/v1", "Prometheus", "main", "monitoring"),
+	}
+	stuck := terminating("monitoring.coreos.com/v1", "Prometheus", "main", "monitoring", "monitoring.coreos.com/cleanup")
+
+	c := &fakeClient{states: map[string]manifest.List{
+		// terminating for a moment only
+		"Deployment/grafana": {terminating("apps/v1", "Deployment", "grafana", "monitoring"), m("apps/v1", "Deployment", "grafana", "monitoring")},
+		"Prometheus/main":    {stuck},
+	}}
+	k := Kubernetes{ctl: c}
+
+	err := k.Delete(state, DeleteOpts{TerminatingTimeout: 10 * time.Millisecond})
+	assert.Equal(t, ErrorStuckTerminating{
+		Objects: []StuckObject{{Name: "Prometheus/main", Finalizers: []string{"monitoring.coreos.com/cleanup"}}},
+		Timeout: 10 * time.Millisecond,
+	}, err)
+	assert.EqualError(t, err, `1 object(s) still terminating after 10ms:
+  - Prometheus/main (finalizers: monitoring.coreos.com/cleanup)
+Check the controllers responsible for the finalizers, or remove them using --remove-finalizers (dangerous: the cleanup they stand for is skipped)`)
+
+	assert.Equal(t, []string{"Prometheus/main", "Deployment/grafana"}, c.deleted)
+	assert.True(t, c.deleteOpts.NoWait)
+	assert.Empty(t, c.patched)
+}
+
+// TestDeleteRemoveFinalizers checks that the finalizers of objects stuck
+// terminating are patched out on request, but not those of others
+func TestDeleteRemoveFinalizers(t *testing.T) {
+	defer func(i time.Duration) { waitForPollInterval = i }(waitForPollInterval)
+	waitForPollInterval = time.Millisecond
+
+	state := manifest.List{
+		m("v1", "ConfigMap", "grafana", "monitoring"),
+		m("monitoring.coreos.com/v1", "Prometheus", "main", "monitoring"),
+	}
+
+	c := &fakeClient{states: map[string]manifest.List{
+		"Prometheus/main": {terminating("monitoring.coreos.com/v1", "Prometheus", "main", "monitoring", "monitoring.coreos.com/cleanup")},
+	}}
+	k := Kubernetes{ctl: c}
+
+	require.NoError(t, k.Delete(state, DeleteOpts{TerminatingTimeout: 10 * time.Millisecond, RemoveFinalizers: true}))
+	assert.Equal(t, []string{`Prometheus/main {"metadata":{"finalizers":null}}`}, c.patched)
+	assert.Equal(t, []string{"Prometheus/main", "ConfigMap/grafana"}, c.deleted)
+}
+
+// TestDeleteAwaitTogether checks that all objects are deleted before waiting,
+// so that the timeout applies to all of them at once
+func TestDeleteAwaitTogether(t *testing.T) {
+	defer func(i time.Duration) { waitForPollInterval = i }(waitForPollInterval)
+	waitForPollInterval = time.Millisecond
+
+	state := manifest.List{
+		m("monitoring.coreos.com/v1", "Prometheus", "main", "monitoring"),
+		m("monitoring.coreos.com/v1", "Alertmanager", "main", "monitoring"),
+	}
+	c := &fakeClient{states: map[string]manifest.List{
+		"Prometheus/main":   {terminating("monitoring.coreos.com/v1", "Prometheus", "main", "monitoring", "monitoring.coreos.com/cleanup")},
+		"Alertmanager/main": {terminating("monitoring.coreos.com/v1", "Alertmanager", "main", "monitoring", "monitoring.coreos.com/cleanup")},
+	}}
+	k := Kubernetes{ctl: c}
+
+	timeout := 50 * time.Millisecond
+	start := time.Now()
+	err := k.Delete(state, DeleteOpts{TerminatingTimeout: timeout})
+	assert.True(t, time.Since(start) < 2*timeout, "waited %s", time.Since(start))
+
+	stuck, ok := err.(ErrorStuckTerminating)
+	require.True(t, ok, err)
+	assert.Len(t, stuck.Objects, 2)
+}
+
+// TestDeleteNamespaceFinalizers checks that the spec.finalizers of Namespaces
+// are reported, but not patched
+func TestDeleteNamespaceFinalizers(t *testing.T) {
+	defer func(i time.Duration) { waitForPollInterval = i }(waitForPollInterval)
+	waitForPollInterval = time.Millisecond
+
+	ns := terminating("v1", "Namespace", "monitoring", "")
+	ns["spec"] = map[string]interface{}{"finalizers": []interface{}{"kubernetes"}}
+
+	c := &fakeClient{states: map[string]manifest.List{"Namespace/monitoring": {ns}}}
+	k := Kubernetes{ctl: c}
+
+	err := k.Delete(manifest.List{m("v1", "Namespace", "monitoring", "")}, DeleteOpts{TerminatingTimeout: 10 * time.Millisecond, RemoveFinalizers: true})
+	assert.Equal(t, ErrorStuckTerminating{
+		Objects: []StuckObject{{Name: "Namespace/monitoring", Finalizers: []string{"kubernetes"}}},
+		Timeout: 10 * time.Millisecond,
+	}, err)
+	assert.Empty(t, c.patched)
+}
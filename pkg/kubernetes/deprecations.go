@@ -0,0 +1,105 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// DeprecatedAPI is an apiVersion that is deprecated for some kinds as of a
+// Kubernetes version and removed in a later one
+type DeprecatedAPI struct {
+	APIVersion string
+	Kinds      []string
+
+	// minor Kubernetes versions, e.g. `1.16`
+	Deprecated, Removed string
+
+	// apiVersion to use instead. Empty if there is none
+	Replacement string
+}
+
+// DeprecatedAPIs are the deprecations of commonly used kinds, see
+// https://kubernetes.io/docs/reference/using-api/deprecation-guide/
+var DeprecatedAPIs = []DeprecatedAPI{
+	{APIVersion: "extensions/v1beta1", Kinds: []string{"Deployment", "DaemonSet", "ReplicaSet"}, Deprecated: "1.9", Removed: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta1", Kinds: []string{"Deployment", "StatefulSet"}, Deprecated: "1.9", Removed: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "apps/v1beta2", Kinds: []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"}, Deprecated: "1.9", Removed: "1.16", Replacement: "apps/v1"},
+	{APIVersion: "extensions/v1beta1", Kinds: []string{"NetworkPolicy"}, Deprecated: "1.9", Removed: "1.16", Replacement: "networking.k8s.io/v1"},
+	{APIVersion: "extensions/v1beta1", Kinds: []string{"PodSecurityPolicy"}, Deprecated: "1.10", Removed: "1.16", Replacement: "policy/v1beta1"},
+	{APIVersion: "extensions/v1beta1", Kinds: []string{"Ingress"}, Deprecated: "1.14", Removed: "1.22", Replacement: "networking.k8s.io/v1"},
+	{APIVersion: "networking.k8s.io/v1beta1", Kinds: []string{"Ingress", "IngressClass"}, Deprecated: "1.19", Removed: "1.22", Replacement: "networking.k8s.io/v1"},
+	{APIVersion: "apiextensions.k8s.io/v1beta1", Kinds: []string{"CustomResourceDefinition"}, Deprecated: "1.16", Removed: "1.22", Replacement: "apiextensions.k8s.io/v1"},
+	{APIVersion: "admissionregistration.k8s.io/v1beta1", Kinds: []string{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"}, Deprecated: "1.16", Removed: "1.22", Replacement: "admissionregistration.k8s.io/v1"},
+	{APIVersion: "rbac.authorization.k8s.io/v1beta1", Kinds: []string{"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"}, Deprecated: "1.17", Removed: "1.22", Replacement: "rbac.authorization.k8s.io/v1"},
+	{APIVersion: "scheduling.k8s.io/v1beta1", Kinds: []string{"PriorityClass"}, Deprecated: "1.14", Removed: "1.22", Replacement: "scheduling.k8s.io/v1"},
+	{APIVersion: "batch/v1beta1", Kinds: []string{"CronJob"}, Deprecated: "1.21", Removed: "1.25", Replacement: "batch/v1"},
+	{APIVersion: "policy/v1beta1", Kinds: []string{"PodDisruptionBudget"}, Deprecated: "1.21", Removed: "1.25", Replacement: "policy/v1"},
+	{APIVersion: "policy/v1beta1", Kinds: []string{"PodSecurityPolicy"}, Deprecated: "1.21", Removed: "1.25"},
+}
+
+// APIDeprecation is an object using a deprecated apiVersion
+type APIDeprecation struct {
+	// Name of the object in `<kind>/<name>` format
+	Name string
+	API  DeprecatedAPI
+
+	// Removed is set if the cluster version no longer serves the apiVersion
+	Removed bool
+}
+
+func (d APIDeprecation) String() string {
+	s := fmt.Sprintf("%s uses %s, which is deprecated since Kubernetes %s and removed in %s.",
+		d.Name, d.API.APIVersion, d.API.Deprecated, d.API.Removed)
+	if d.Removed {
+		s = fmt.Sprintf("%s uses %s, which was removed in Kubernetes %s.",
+			d.Name, d.API.APIVersion, d.API.Removed)
+	}
+
+	if d.API.Replacement != "" {
+		s += fmt.Sprintf(" Use %s instead.", d.API.Replacement)
+	}
+	return s
+}
+
+// Deprecations returns the objects of state using an apiVersion that is
+// deprecated (or removed) in the given Kubernetes version, see DeprecatedAPIs
+func Deprecations(state manifest.List, version *semver.Version) []APIDeprecation {
+	if version == nil {
+		return nil
+	}
+
+	// vendor suffixes (e.g. `1.22.0-gke.1`) are prereleases to semver, which
+	// would sort before the actual release
+	minor := semver.MustParse(fmt.Sprintf("%d.%d", version.Major(), version.Minor()))
+
+	var found []APIDeprecation
+	for _, m := range state {
+		for _, api := range DeprecatedAPIs {
+			if m.APIVersion() != api.APIVersion || !containsKind(api.Kinds, m.Kind()) {
+				continue
+			}
+			if minor.LessThan(semver.MustParse(api.Deprecated)) {
+				continue
+			}
+
+			found = append(found, APIDeprecation{
+				Name:    m.KindName(),
+				API:     api,
+				Removed: !minor.LessThan(semver.MustParse(api.Removed)),
+			})
+		}
+	}
+	return found
+}
+
+func containsKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// TestDeprecations checks that objects are flagged once their apiVersion is
+// deprecated in the version of the cluster, and as removed later on
+func TestDeprecations(t *testing.T) {
+	state := manifest.List{
+		m("extensions/v1beta1", "Ingress", "grafana", "default"),
+		m("networking.k8s.io/v1", "Ingress", "loki", "default"),
+		// extensions/v1beta1 is only deprecated for some kinds
+		m("extensions/v1beta1", "Foo", "bar", "default"),
+	}
+
+	cases := []struct {
+		version string
+		want    []string
+	}{
+		{version: "1.13.4", want: nil},
+		{version: "1.19.3", want: []string{"Ingress/grafana uses extensions/v1beta1, which is deprecated since Kubernetes 1.14 and removed in 1.22. Use networking.k8s.io/v1 instead."}},
+		// vendor suffixes don't hide the removal
+		{version: "1.22.0-gke.1", want: []string{"Ingress/grafana uses extensions/v1beta1, which was removed in Kubernetes 1.22. Use networking.k8s.io/v1 instead."}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.version, func(t *testing.T) {
+			var got []string
+			for _, d := range Deprecations(state, semver.MustParse(c.version)) {
+				got = append(got, d.String())
+			}
+			assert.Equal(t, c.want, got)
+		})
+	}
+
+	// unknown version
+	assert.Nil(t, Deprecations(state, nil))
+}
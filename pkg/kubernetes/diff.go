@@ -1,7 +1,11 @@
 package kubernetes
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"log"
+	"strings"
 
 	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
@@ -9,10 +13,18 @@ import (
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/process"
 )
 
 // Diff takes the desired state and returns the differences from the cluster
 func (k *Kubernetes) Diff(state manifest.List, opts DiffOpts) (*string, error) {
+	ignore := append(append([]string{}, k.Env.Spec.Diff.IgnoreKinds...), opts.IgnoreKinds...)
+	full := state
+	if opts.PruneState != nil {
+		full = opts.PruneState
+	}
+	state = IgnoreKinds(state, ignore)
+
 	// prevent https://github.com/kubernetes/kubernetes/issues/89762 until fixed
 	if k.ctl.Info().ClientVersion.Equal(semver.MustParse("1.18.0")) {
 		return nil, fmt.Errorf(`You seem to be using kubectl 1.18.0, which contains an unfixed issue
@@ -20,14 +32,34 @@ that makes 'kubectl diff' modify resources in your cluster.
 Please downgrade kubectl until https://github.com/kubernetes/kubernetes/issues/89762 is fixed.`)
 	}
 
+	if opts.Out != nil && (opts.Summarize || opts.PatchFormat != "" || opts.Explain || opts.Revision > 0) {
+		return nil, fmt.Errorf("only plain diffs can be streamed, not summaries, patches, explanations or revisions")
+	}
+	if opts.Prune && (opts.PatchFormat != "" || opts.Explain || opts.Revision > 0) {
+		return nil, fmt.Errorf("pruned objects can't be shown in patches, explanations or revisions")
+	}
+
+	if opts.PatchFormat != "" {
+		if opts.Explain {
+			return nil, fmt.Errorf("patches can't be explained")
+		}
+		return k.diffPatch(state, opts)
+	}
+	if opts.Explain {
+		return k.diffExplain(state, opts)
+	}
+	if opts.Revision > 0 {
+		return k.diffRevision(state, opts)
+	}
+
 	// required for separating
 	namespaces, err := k.ctl.Namespaces()
 	if err != nil {
-		return nil, errors.Wrap(err, "listing namespaces")
+		return nil, clusterErr(errors.Wrap(err, "listing namespaces"))
 	}
 	resources, err := k.ctl.Resources()
 	if err != nil {
-		return nil, errors.Wrap(err, "listing known api-resources")
+		return nil, clusterErr(errors.Wrap(err, "listing known api-resources"))
 	}
 
 	// separate resources in groups
@@ -47,20 +79,40 @@ Please downgrade kubectl until https://github.com/kubernetes/kubernetes/issues/8
 	if err != nil {
 		return nil, err
 	}
+	if s := k.strategy(opts.Strategy); k.normalize != nil && s != "subset" {
+		log.Printf("Warning: spec.diff.normalize is only used by the subset diff-strategy. It is ignored by `%s`.", s)
+	}
+
+	steps := multiDiff{{differ: liveDiff, state: live}}
 
-	// reports all resources as new
-	staticDiff := StaticDiffer(true)
+	// reports all resources as new. Validating only, these are left out, as
+	// the server can't dry-run into a namespace that does not exist yet
+	if k.strategy(opts.Strategy) != "validate" {
+		steps = append(steps, multiDiff{{differ: StaticDiffer(true), state: soon}}...)
+	}
 
 	// run the diff
-	d, err := multiDiff{
-		{differ: liveDiff, state: live},
-		{differ: staticDiff, state: soon},
-	}.diff()
+	d, err := steps.diff(opts.DiffOpts)
 
-	switch {
-	case err != nil:
-		return nil, err
-	case d == nil:
+	if v, ok := err.(process.ValidationError); ok {
+		if violations, ok := v.Err.(ErrorSchemaViolations); ok {
+			violations.MaxErrors = opts.MaxErrors
+			v.Err = violations
+		}
+		return nil, v
+	}
+	if err != nil {
+		return nil, clusterErr(err)
+	}
+
+	// the orphans are found using all objects, but ignored kinds are not
+	// shown
+	if opts.Prune {
+		if d, err = k.withOrphans(d, full, ignore, opts.PruneResources, opts.Out); err != nil {
+			return nil, err
+		}
+	}
+	if d == nil {
 		return nil, nil
 	}
 
@@ -71,6 +123,94 @@ Please downgrade kubectl until https://github.com/kubernetes/kubernetes/issues/8
 	return d, nil
 }
 
+// diffPatch expresses the differences as patches, see Plan.Patch
+func (k *Kubernetes) diffPatch(state manifest.List, opts DiffOpts) (*string, error) {
+	if opts.Summarize {
+		return nil, fmt.Errorf("summarizing is not supported for patches")
+	}
+	if opts.PatchFormat != PatchFormatJSON && opts.PatchFormat != PatchFormatMerge {
+		return nil, ErrorPatchFormatUnknown{Requested: opts.PatchFormat}
+	}
+
+	p, err := k.Plan(state)
+	if err != nil {
+		return nil, err
+	}
+	return p.Patch(opts.PatchFormat)
+}
+
+// diffExplain summarizes the differences per object, see Plan.Explain
+func (k *Kubernetes) diffExplain(state manifest.List, opts DiffOpts) (*string, error) {
+	if opts.Summarize {
+		return nil, fmt.Errorf("summarizing is not supported for explanations")
+	}
+	if opts.Revision > 0 {
+		return nil, fmt.Errorf("revisions can't be explained")
+	}
+
+	p, err := k.Plan(state)
+	if err != nil {
+		return nil, err
+	}
+	return p.Explain()
+}
+
+// withOrphans appends the deletion of the objects pruning would delete to d,
+// which is streamed to out as well if set
+func (k *Kubernetes) withOrphans(d *string, state manifest.List, ignore []string, resources []PruneResource, out io.Writer) (*string, error) {
+	orphaned, err := k.Orphaned(state, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := StaticDiffer(false)(IgnoreKinds(orphaned, ignore), client.DiffOpts{})
+	if err != nil || deleted == nil {
+		return d, err
+	}
+
+	s := ""
+	if d != nil {
+		s = *d
+	}
+	add := *deleted
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		add = "\n" + add
+	}
+	if err := streamDiff(out, add); err != nil {
+		return nil, err
+	}
+
+	s += add
+	return &s, nil
+}
+
+// IgnoreKinds returns the state without objects of any of the given kinds.
+// Kinds may be given as `kind` or `group/kind`, case-insensitive.
+func IgnoreKinds(state manifest.List, kinds []string) manifest.List {
+	if len(kinds) == 0 {
+		return state
+	}
+
+	out := make(manifest.List, 0, len(state))
+	for _, m := range state {
+		if !matchesKind(m, kinds) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func matchesKind(m manifest.Manifest, kinds []string) bool {
+	group := m.Group()
+
+	for _, k := range kinds {
+		if strings.EqualFold(k, m.Kind()) || strings.EqualFold(k, group+"/"+m.Kind()) {
+			return true
+		}
+	}
+	return false
+}
+
 type separateOpts struct {
 	namespaces map[string]bool
 	resources  client.Resources
@@ -126,11 +266,16 @@ func (e ErrorDiffStrategyUnknown) Error() string {
 	return fmt.Sprintf("diff strategy `%s` does not exist. Pick one of: %v", e.Requested, strats)
 }
 
-func (k *Kubernetes) differ(override string) (Differ, error) {
-	strategy := k.Env.Spec.DiffStrategy
+// strategy returns the diff-strategy to use, which is override if set
+func (k *Kubernetes) strategy(override string) string {
 	if override != "" {
-		strategy = override
+		return override
 	}
+	return k.Env.Spec.DiffStrategy
+}
+
+func (k *Kubernetes) differ(override string) (Differ, error) {
+	strategy := k.strategy(override)
 
 	d, ok := k.differs[strategy]
 	if !ok {
@@ -146,21 +291,25 @@ func (k *Kubernetes) differ(override string) (Differ, error) {
 // StaticDiffer returns a differ that reports all resources as either created or
 // deleted.
 func StaticDiffer(create bool) Differ {
-	return func(state manifest.List) (*string, error) {
-		s := ""
+	return func(state manifest.List, opts client.DiffOpts) (*string, error) {
+		buf := bytes.Buffer{}
 		for _, m := range state {
 			is, should := m.String(), ""
 			if create {
 				is, should = should, is
 			}
 
-			d, err := util.DiffStr(util.DiffName(m), is, should)
-			if err != nil {
+			obj := bytes.Buffer{}
+			if err := util.DiffStrTo(&obj, util.DiffName(m), is, should, opts.FullContext); err != nil {
+				return nil, err
+			}
+			if err := streamDiff(opts.Out, obj.String()); err != nil {
 				return nil, err
 			}
-			s += d
+			buf.Write(obj.Bytes())
 		}
 
+		s := buf.String()
 		if s == "" {
 			return nil, nil
 		}
@@ -176,10 +325,10 @@ type multiDiff []struct {
 	state  manifest.List
 }
 
-func (m multiDiff) diff() (*string, error) {
+func (m multiDiff) diff(opts client.DiffOpts) (*string, error) {
 	diff := ""
 	for _, d := range m {
-		s, err := d.differ(d.state)
+		s, err := d.differ(d.state, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -195,3 +344,23 @@ func (m multiDiff) diff() (*string, error) {
 	}
 	return &diff, nil
 }
+
+// diffStr is util.DiffStr, holding the entire objects as context if
+// opts.FullContext is set
+func diffStr(opts client.DiffOpts, name, is, should string) (string, error) {
+	buf := bytes.Buffer{}
+	if err := util.DiffStrTo(&buf, name, is, should, opts.FullContext); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// streamDiff writes d, the diff of whole objects, to out, unless out is nil or
+// there are no differences
+func streamDiff(out io.Writer, d string) error {
+	if out == nil || d == "" {
+		return nil
+	}
+	_, err := io.WriteString(out, d)
+	return err
+}
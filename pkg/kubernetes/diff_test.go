@@ -1,12 +1,17 @@
 package kubernetes
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/Masterminds/semver"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 )
 
 // TestSeparate checks that separate properly separates resources:
@@ -145,3 +150,162 @@ func m(apiVersion, kind, name, namespace string) manifest.Manifest {
 		},
 	}
 }
+
+// TestDiffIgnoreKinds checks that ignored kinds (from spec.json and DiffOpts)
+// never reach the differ
+func TestDiffIgnoreKinds(t *testing.T) {
+	env := v1alpha1.New()
+	env.Spec.DiffStrategy = "record"
+	env.Spec.Diff.IgnoreKinds = []string{"EndpointSlice"}
+
+	c := &fakeClient{
+		info:       client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		namespaces: map[string]bool{"default": true},
+	}
+
+	var diffed []string
+	k := Kubernetes{Env: *env, ctl: c, differs: map[string]Differ{
+		"record": func(state manifest.List, _ client.DiffOpts) (*string, error) {
+			for _, m := range state {
+				diffed = append(diffed, m.KindName())
+			}
+			return nil, nil
+		},
+	}}
+
+	_, err := k.Diff(manifest.List{
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("discovery.k8s.io/v1beta1", "EndpointSlice", "grafana-abc", "default"),
+		m("monitoring.coreos.com/v1", "ServiceMonitor", "grafana", "default"),
+		m("example.com/v1", "ServiceMonitor", "grafana", "default"),
+	}, DiffOpts{IgnoreKinds: []string{"monitoring.coreos.com/servicemonitor"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"Deployment/grafana",
+		"ServiceMonitor/grafana",
+	}, diffed)
+}
+
+// applied returns m as it is on the cluster after applying it, with the uid
+func applied(m manifest.Manifest, uid string) manifest.Manifest {
+	m.Metadata()["uid"] = uid
+	m.Metadata()["annotations"] = map[string]interface{}{AnnotationLastApplied: "{}"}
+	return m
+}
+
+// TestDiffPrune checks that objects removed from Jsonnet are shown as deleted,
+// unless of ignored kinds
+func TestDiffPrune(t *testing.T) {
+	env := v1alpha1.New()
+	env.Spec.DiffStrategy = "record"
+	env.Spec.InjectLabels = true
+
+	state := manifest.List{m("apps/v1", "Deployment", "grafana", "default")}
+	c := &fakeClient{
+		info:       client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		namespaces: map[string]bool{"default": true},
+		resources:  client.Resources{{Kind: "Deployment", APIGroup: "apps", Verbs: "[list]"}},
+		live:       manifest.List{applied(m("apps/v1", "Deployment", "grafana", "default"), "1")},
+		labeled: manifest.List{
+			applied(m("apps/v1", "Deployment", "grafana", "default"), "1"),
+			applied(m("apps/v1", "Deployment", "retired", "default"), "2"),
+			applied(m("v1", "ConfigMap", "retired", "default"), "3"),
+		},
+	}
+
+	changes, err := util.DiffStr("apps-v1.Deployment.default.grafana", "replicas: 1\n", "replicas: 2\n")
+	require.NoError(t, err)
+	k := Kubernetes{Env: *env, ctl: c, differs: map[string]Differ{
+		"record": func(manifest.List, client.DiffOpts) (*string, error) {
+			return &changes, nil
+		},
+	}}
+
+	d, err := k.Diff(state, DiffOpts{Prune: true, IgnoreKinds: []string{"ConfigMap"}})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, []util.ObjectChange{
+		{Name: "apps-v1.Deployment.default.grafana", Action: util.ActionUpdated},
+		{Name: "apps-v1.Deployment.default.retired", Action: util.ActionDeleted},
+	}, util.DiffObjects(*d))
+	assert.Contains(t, *d, "-  name: retired\n")
+
+	// objects not diffed are still part of the environment
+	live := c.live
+	c.live = append(manifest.List{applied(m("apps/v1", "Deployment", "retired", "default"), "2")}, live...)
+	d, err = k.Diff(state, DiffOpts{Prune: true, PruneState: append(manifest.List{m("apps/v1", "Deployment", "retired", "default")}, state...)})
+	c.live = live
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, []util.ObjectChange{
+		{Name: "apps-v1.Deployment.default.grafana", Action: util.ActionUpdated},
+		{Name: "v1.ConfigMap.default.retired", Action: util.ActionDeleted},
+	}, util.DiffObjects(*d))
+
+	// nothing changed but the orphans
+	k.differs["record"] = func(manifest.List, client.DiffOpts) (*string, error) { return nil, nil }
+	d, err = k.Diff(state, DiffOpts{Prune: true})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Len(t, util.DiffObjects(*d), 2)
+
+	// without
+	d, err = k.Diff(state, DiffOpts{})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	_, err = k.Diff(state, DiffOpts{Prune: true, Explain: true})
+	assert.EqualError(t, err, "pruned objects can't be shown in patches, explanations or revisions")
+}
+
+// writes records each write to it
+type writes []string
+
+func (w *writes) Write(p []byte) (int, error) {
+	*w = append(*w, string(p))
+	return len(p), nil
+}
+
+// TestDiffStream checks that the diff of each object is streamed on its own,
+// including the orphans, and that together they are the returned diff
+func TestDiffStream(t *testing.T) {
+	env := v1alpha1.New()
+	env.Spec.DiffStrategy = "static"
+	env.Spec.InjectLabels = true
+
+	state := manifest.List{
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("v1", "ConfigMap", "grafana", "default"),
+	}
+	c := &fakeClient{
+		info:       client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		namespaces: map[string]bool{"default": true},
+		resources:  client.Resources{{Kind: "Deployment", APIGroup: "apps", Verbs: "[list]"}},
+		labeled: manifest.List{
+			applied(m("apps/v1", "Deployment", "retired", "default"), "2"),
+		},
+	}
+	k := Kubernetes{Env: *env, ctl: c, differs: map[string]Differ{
+		"static": StaticDiffer(true),
+	}}
+
+	var w writes
+	d, err := k.Diff(state, DiffOpts{DiffOpts: client.DiffOpts{Out: &w}, Prune: true})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+
+	want := []util.ObjectChange{
+		{Name: "apps-v1.Deployment.default.grafana", Action: util.ActionCreated},
+		{Name: "v1.ConfigMap.default.grafana", Action: util.ActionCreated},
+		{Name: "apps-v1.Deployment.default.retired", Action: util.ActionDeleted},
+	}
+	require.Len(t, w, len(want))
+	for i, change := range want {
+		assert.Equal(t, []util.ObjectChange{change}, util.DiffObjects(w[i]))
+	}
+	assert.Equal(t, *d, strings.Join(w, ""))
+
+	_, err = k.Diff(state, DiffOpts{DiffOpts: client.DiffOpts{Out: &w}, Summarize: true})
+	assert.EqualError(t, err, "only plain diffs can be streamed, not summaries, patches, explanations or revisions")
+}
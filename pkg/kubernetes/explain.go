@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+)
+
+// explainValueMax is the longest value shown as-is in an explanation, longer
+// ones are only reported as updated
+const explainValueMax = 24
+
+// Explain summarizes the differences between the fetched live state and the
+// state in one line per changed object, e.g.
+//
+//	Deployment/frontend: spec.replicas 2→3, spec.template.spec.containers[0].image updated
+//
+// Objects are compared like SubsetDiffer does. Lines are ordered by DiffName.
+func (p Plan) Explain() (*string, error) {
+	type line struct{ name, text string }
+	var lines []line
+
+	for _, m := range p.State {
+		name := fmt.Sprintf("%s/%s", m.Kind(), m.Metadata().Name())
+
+		l := p.Live(m)
+		if l == nil {
+			lines = append(lines, line{util.DiffName(m), name + ": created"})
+			continue
+		}
+
+		is, should, err := comparableSubset(m, copyMap(l), p.diff)
+		if err != nil {
+			return nil, err
+		}
+		changes := FieldChanges(is, should)
+		if len(changes) == 0 {
+			continue
+		}
+
+		reasons := make([]string, 0, len(changes))
+		for _, c := range changes {
+			reasons = append(reasons, explainChange(c))
+		}
+		lines = append(lines, line{util.DiffName(m), name + ": " + strings.Join(reasons, ", ")})
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].name < lines[j].name })
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.text
+	}
+	s := strings.Join(texts, "\n")
+	return &s, nil
+}
+
+// explainChange describes a single FieldChange, showing short scalar values
+// inline
+func explainChange(c FieldChange) string {
+	path := explainPath(c.Path)
+	switch {
+	case c.Added:
+		return path + " added"
+	case c.Removed:
+		return path + " removed"
+	}
+
+	was, okWas := explainValue(c.Old)
+	now, okNow := explainValue(c.New)
+	if !okWas || !okNow {
+		return path + " updated"
+	}
+	return fmt.Sprintf("%s %s→%s", path, was, now)
+}
+
+// explainPath turns a JSON Pointer into the dotted notation of kubectl
+// explain, e.g. `/spec/containers/0/image` into `spec.containers[0].image`
+func explainPath(pointer string) string {
+	if pointer == "" {
+		return "."
+	}
+
+	var b strings.Builder
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for _, k := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if _, err := strconv.Atoi(k); err == nil {
+			fmt.Fprintf(&b, "[%s]", k)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(unescape.Replace(k))
+	}
+	return b.String()
+}
+
+// explainValue returns v as JSON, if it is a scalar short enough to be shown
+func explainValue(v interface{}) (string, bool) {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return "", false
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil || len(data) > explainValueMax {
+		return "", false
+	}
+	return string(data), true
+}
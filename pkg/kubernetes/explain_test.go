@@ -0,0 +1,101 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func TestExplainChange(t *testing.T) {
+	cases := []struct {
+		name   string
+		change FieldChange
+		want   string
+	}{
+		{
+			name:   "scalar",
+			change: FieldChange{Path: "/spec/replicas", Old: 2, New: 3},
+			want:   "spec.replicas 2→3",
+		},
+		{
+			name:   "string",
+			change: FieldChange{Path: "/spec/template/spec/containers/0/image", Old: "nginx:1.19", New: "nginx:1.20"},
+			want:   `spec.template.spec.containers[0].image "nginx:1.19"→"nginx:1.20"`,
+		},
+		{
+			name:   "long",
+			change: FieldChange{Path: "/data/config", Old: "a very long configuration file", New: "another configuration"},
+			want:   "data.config updated",
+		},
+		{
+			name:   "object",
+			change: FieldChange{Path: "/spec/selector", Old: map[string]interface{}{}, New: "app"},
+			want:   "spec.selector updated",
+		},
+		{
+			name:   "added",
+			change: FieldChange{Path: "/metadata/labels/tier", New: "frontend", Added: true},
+			want:   "metadata.labels.tier added",
+		},
+		{
+			name:   "removed",
+			change: FieldChange{Path: "/metadata/annotations/tanka.dev~1apply-wave", Old: "1", Removed: true},
+			want:   "metadata.annotations.tanka.dev/apply-wave removed",
+		},
+		{
+			name:   "null",
+			change: FieldChange{Path: "/spec/paused", Old: nil, New: true},
+			want:   "spec.paused null→true",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, explainChange(c.change))
+		})
+	}
+}
+
+// TestPlanExplain checks that changed objects are explained in one line each,
+// ordered by DiffName, leaving out unchanged ones
+func TestPlanExplain(t *testing.T) {
+	c := &fakeClient{
+		info: client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		live: manifest.List{
+			withImage(m("apps/v1", "Deployment", "frontend", "default"), "nginx:1.19"),
+			withReplicas(m("apps/v1", "Deployment", "backend", "default"), 2),
+			m("v1", "ConfigMap", "unchanged", "default"),
+		},
+	}
+	k := Kubernetes{Env: *v1alpha1.New(), ctl: c}
+
+	frontend := withImage(m("apps/v1", "Deployment", "frontend", "default"), "grafana/frontend:2020-11-01-abcdef")
+	frontend.Metadata()["labels"] = map[string]interface{}{"tier": "web"}
+
+	d, err := k.Diff(manifest.List{
+		frontend,
+		withReplicas(m("apps/v1", "Deployment", "backend", "default"), 3),
+		m("v1", "ConfigMap", "unchanged", "default"),
+		m("v1", "ConfigMap", "created", "default"),
+	}, DiffOpts{Explain: true})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, `Deployment/backend: spec.replicas 2→3
+Deployment/frontend: metadata.labels added, spec.template.spec.containers[0].image updated
+ConfigMap/created: created`, *d)
+
+	d, err = k.Diff(manifest.List{
+		m("v1", "ConfigMap", "unchanged", "default"),
+	}, DiffOpts{Explain: true})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	_, err = k.Diff(nil, DiffOpts{Explain: true, Summarize: true})
+	assert.Error(t, err)
+}
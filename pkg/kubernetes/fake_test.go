@@ -0,0 +1,216 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// fakeClient is a client.Client that never talks to a cluster. Only the
+// methods required by the tests are implemented, calling any other one panics.
+type fakeClient struct {
+	client.Client
+
+	// returned by Info()
+	info client.Info
+	// returned by Namespaces()
+	namespaces map[string]bool
+
+	// returned by Resources()
+	resources client.Resources
+	// returned by GetByState()
+	live manifest.List
+	// successive results of Get() per object (`kind/name`), the last one is
+	// repeated. Takes precedence over live
+	states map[string]manifest.List
+	// errors returned by Get() per object (`kind/name`)
+	getErrs map[string]error
+	// number of calls to GetByState()
+	fetched int
+	// returned by GetByLabels()
+	labeled manifest.List
+	// records the kinds passed to GetByLabels()
+	listed []string
+
+	// records all objects passed to Delete() as `kind/name`
+	deleted []string
+	// options of the last call to Delete()
+	deleteOpts client.DeleteOpts
+	// records all objects passed to Patch() as `kind/name patch`. Patching
+	// drops the states of the object, so that it is gone afterwards
+	patched []string
+	// records all calls to GetBySelector() as `namespace kind selector`
+	selected []string
+
+	// records all objects passed to Apply() as `kind/name`
+	applied []string
+	// records all objects passed to Apply()
+	appliedObjects manifest.List
+	// options passed to Apply() per object (`kind/name`)
+	applyOpts map[string]client.ApplyOpts
+	// output of Apply() per object (`kind/name`)
+	applyOutput map[string]string
+	// objects (`kind/name`) for which Apply() blocks until ctx is done
+	hang map[string]bool
+	// objects (`kind/name`) for which Apply() and Delete() fail
+	fail map[string]bool
+	// objects (`kind/name`) for which Apply() fails with a client.ErrorConflict
+	conflict map[string]bool
+	// how long each Apply() takes
+	applyDelay time.Duration
+	// highest number of Apply() calls in flight at once
+	maxInFlight, inFlight int
+	// guards the records of Apply(), which is called concurrently
+	mu sync.Mutex
+
+	// records all checks passed to CanI()
+	checked []client.AuthCheck
+	// checks CanI() reports as denied
+	denied map[client.AuthCheck]bool
+
+	// records all objects passed to Apply() and WaitReady() in order, as
+	// `apply kind/name` and `wait kind/name`
+	calls []string
+
+	// records all objects passed to ValidateServerSide() as `kind/name`
+	validated []string
+	// objects (`kind/name`) ValidateServerSide() reports as invalid
+	invalid map[string]bool
+}
+
+func (f *fakeClient) Resources() (client.Resources, error) {
+	return f.resources, nil
+}
+
+// Get returns the next state of the object, or the object of f.live with the
+// given kind and name
+func (f *fakeClient) Get(namespace, kind, name string) (manifest.Manifest, error) {
+	if err := f.getErrs[kind+"/"+name]; err != nil {
+		return nil, err
+	}
+	if states, ok := f.states[kind+"/"+name]; ok && len(states) > 0 {
+		if len(states) > 1 {
+			f.states[kind+"/"+name] = states[1:]
+		}
+		return states[0], nil
+	}
+
+	for _, m := range f.live {
+		if m.Kind() == kind && m.Metadata().Name() == name {
+			return m, nil
+		}
+	}
+	return nil, client.ErrorNotFound{}
+}
+
+func (f *fakeClient) GetByState(data manifest.List) (manifest.List, error) {
+	f.fetched++
+	return f.live, nil
+}
+
+func (f *fakeClient) GetByLabels(namespace, kind string, labels map[string]string) (manifest.List, error) {
+	f.listed = append(f.listed, kind)
+	return f.labeled, nil
+}
+
+func (f *fakeClient) Delete(namespace, kind, name string, opts client.DeleteOpts) error {
+	if f.fail[kind+"/"+name] {
+		return errors.New("forbidden")
+	}
+	f.deleted = append(f.deleted, kind+"/"+name)
+	f.deleteOpts = opts
+	return nil
+}
+
+func (f *fakeClient) Patch(namespace, kind, name string, patch []byte) error {
+	f.patched = append(f.patched, kind+"/"+name+" "+string(patch))
+	delete(f.states, kind+"/"+name)
+	return nil
+}
+
+func (f *fakeClient) Apply(ctx context.Context, data manifest.List, opts client.ApplyOpts) (string, error) {
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(f.applyDelay)
+
+	out := ""
+	for _, m := range data {
+		name := m.KindName()
+		switch {
+		case f.hang[name]:
+			<-ctx.Done()
+			return "", ctx.Err()
+		case f.fail[name]:
+			return "", errors.New("admission webhook denied the request")
+		case f.conflict[name]:
+			return "", client.ErrorConflict{}
+		}
+
+		f.mu.Lock()
+		f.applied = append(f.applied, name)
+		f.calls = append(f.calls, "apply "+name)
+		f.appliedObjects = append(f.appliedObjects, m)
+		if f.applyOpts == nil {
+			f.applyOpts = make(map[string]client.ApplyOpts)
+		}
+		f.applyOpts[name] = opts
+		f.mu.Unlock()
+		out += f.applyOutput[name]
+	}
+	return out, nil
+}
+
+func (f *fakeClient) GetBySelector(namespace, kind, selector string) (manifest.List, error) {
+	f.selected = append(f.selected, namespace+" "+kind+" "+selector)
+	return f.labeled, nil
+}
+
+func (f *fakeClient) CanI(checks []client.AuthCheck) ([]client.AuthCheck, error) {
+	f.checked = append(f.checked, checks...)
+
+	var denied []client.AuthCheck
+	for _, c := range checks {
+		if f.denied[c] {
+			denied = append(denied, c)
+		}
+	}
+	return denied, nil
+}
+
+func (f *fakeClient) WaitReady(namespace, kind, name string, timeout time.Duration) error {
+	f.calls = append(f.calls, "wait "+kind+"/"+name)
+	return nil
+}
+
+func (f *fakeClient) ValidateServerSide(data manifest.List) error {
+	for _, m := range data {
+		f.validated = append(f.validated, m.KindName())
+		if f.invalid[m.KindName()] {
+			return client.ErrorInvalid{}
+		}
+	}
+	return nil
+}
+
+func (f *fakeClient) Info() client.Info {
+	return f.info
+}
+
+func (f *fakeClient) Namespaces() (map[string]bool, error) {
+	return f.namespaces, nil
+}
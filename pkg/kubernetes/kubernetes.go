@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
 
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
@@ -18,19 +19,23 @@ type Kubernetes struct {
 	ctl client.Client
 
 	// Diffing
-	differs map[string]Differ // List of diff strategies
+	differs   map[string]Differ // List of diff strategies
+	normalize Normalizer        // implements spec.diff.normalize
 }
 
 // Differ is responsible for comparing the given manifests to the cluster and
-// returning differences (if any) in `diff(1)` format.
-type Differ func(manifest.List) (*string, error)
-
-// New creates a new Kubernetes with an initialized client
-func New(env v1alpha1.Config) (*Kubernetes, error) {
+// returning differences (if any) in `diff(1)` format. The diff of each object
+// is also written to opts.Out once computed, if set.
+type Differ func(state manifest.List, opts client.DiffOpts) (*string, error)
+
+// New creates a new Kubernetes with an initialized client, which runs kubectl
+// as configured by opts. normalize implements spec.diff.normalize, it is nil if
+// that is unset.
+func New(env v1alpha1.Config, normalize Normalizer, opts client.Opts) (*Kubernetes, error) {
 	// setup client
-	ctl, err := client.New(env.Spec.APIServer, env.Spec.Namespace)
+	ctl, err := client.New(env.Spec.APIServer, env.Spec.Namespace, env.Spec.Kubeconfig, opts)
 	if err != nil {
-		return nil, err
+		return nil, ClusterError{Err: errors.Wrap(err, "connecting to Kubernetes")}
 	}
 
 	// setup diffing
@@ -43,17 +48,25 @@ func New(env v1alpha1.Config) (*Kubernetes, error) {
 	}
 
 	k := Kubernetes{
-		Env: env,
-		ctl: ctl,
-		differs: map[string]Differ{
-			"native": ctl.DiffServerSide,
-			"subset": SubsetDiffer(ctl),
-		},
+		Env:       env,
+		ctl:       ctl,
+		normalize: normalize,
+	}
+	k.differs = map[string]Differ{
+		"native": ctl.DiffServerSide,
+		"subset": SubsetDiffer(ctl, k.compareOpts()),
+		// validation only, no drift
+		"validate": ValidateDiffer(ctl),
 	}
 
 	return &k, nil
 }
 
+// compareOpts returns how the subset strategy compares objects
+func (k *Kubernetes) compareOpts() CompareOpts {
+	return CompareOpts{DiffSpec: k.Env.Spec.Diff, Normalize: k.normalize}
+}
+
 // Close runs final cleanup
 func (k *Kubernetes) Close() error {
 	return k.ctl.Close()
@@ -61,11 +74,42 @@ func (k *Kubernetes) Close() error {
 
 // DiffOpts allow to specify additional parameters for diff operations
 type DiffOpts struct {
-	// Use `diffstat(1)` to create a histogram of the changes instead
+	// Out streams the diff, see client.DiffOpts. Only plain diffs are
+	// streamed, not summaries, patches, explanations or revisions
+	client.DiffOpts
+
+	// Create a histogram of the changes instead, see util.Diffstat
 	Summarize bool
 
 	// Set the diff-strategy. If unset, the value set in the spec is used
 	Strategy string
+
+	// Kinds to leave out of the diff, in addition to spec.diff.ignoreKinds
+	IgnoreKinds []string
+
+	// Express the changes as patches instead (PatchFormatJSON or
+	// PatchFormatMerge)
+	PatchFormat string
+
+	// Explain summarizes the changes in one line per object instead, see
+	// Plan.Explain
+	Explain bool
+
+	// MaxErrors limits how many objects are listed if validation fails. Zero
+	// lists all of them
+	MaxErrors int
+
+	// Revision compares against this revision of the rollout history instead
+	// of the current live state. Zero compares against the current state
+	Revision int
+
+	// Prune also shows the deletion of the objects pruning would delete (see
+	// Orphaned), limited to PruneResources if set. These are found using
+	// PruneState, defaulting to the diffed state, which must hold all objects
+	// of the environment, including those not diffed
+	Prune          bool
+	PruneResources []PruneResource
+	PruneState     manifest.List
 }
 
 // Info about the client, etc.
@@ -73,6 +117,29 @@ func (k *Kubernetes) Info() client.Info {
 	return k.ctl.Info()
 }
 
+// ClusterError occurs when communicating with the cluster fails, e.g. because
+// it is unreachable, kubectl failed or the API server rejected a request
+type ClusterError struct {
+	Err error
+}
+
+func (e ClusterError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e ClusterError) Unwrap() error {
+	return e.Err
+}
+
+// clusterErr wraps err into a ClusterError, unless it is nil or one already
+func clusterErr(err error) error {
+	if _, ok := err.(ClusterError); ok || err == nil {
+		return err
+	}
+	return ClusterError{Err: err}
+}
+
 func objectspec(m manifest.Manifest) string {
 	return fmt.Sprintf("%s/%s",
 		m.Kind(),
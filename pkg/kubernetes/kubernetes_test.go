@@ -0,0 +1,41 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TestClusterError checks that failures of the client are returned as
+// ClusterError
+func TestClusterError(t *testing.T) {
+	state := manifest.List{m("v1", "Service", "broken", "default")}
+	c := &fakeClient{fail: map[string]bool{"Service/broken": true}}
+	k := Kubernetes{Env: *v1alpha1.New(), ctl: c}
+
+	cases := map[string]func() error{
+		"apply": func() error {
+			_, err := k.Apply(state, ApplyOpts{})
+			return err
+		},
+		"applyContinueOnError": func() error {
+			_, err := k.Apply(state, ApplyOpts{ContinueOnError: true})
+			return err
+		},
+		"delete": func() error {
+			return k.Delete(state, DeleteOpts{})
+		},
+	}
+
+	for name, fn := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := fn()
+			var clusterErr ClusterError
+			assert.True(t, errors.As(err, &clusterErr), "expected ClusterError, got %T", err)
+		})
+	}
+}
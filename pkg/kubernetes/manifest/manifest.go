@@ -52,7 +52,7 @@ func (m Manifest) Verify() error {
 	}
 
 	// Lists don't have `metadata`
-	if !strings.HasSuffix(m.Kind(), "List") {
+	if !strings.HasSuffix(o.Get("kind").Str(), "List") {
 		if !o.Get("metadata").IsMSI() {
 			err.add("metadata")
 		}
@@ -86,6 +86,21 @@ func (m Manifest) APIVersion() string {
 	return m["apiVersion"].(string)
 }
 
+// Group returns the API group of apiVersion, which is empty for the core group
+// (e.g. `v1`)
+func (m Manifest) Group() string {
+	if i := strings.Index(m.APIVersion(), "/"); i >= 0 {
+		return m.APIVersion()[:i]
+	}
+	return ""
+}
+
+// Version returns the version of apiVersion, without the API group
+func (m Manifest) Version() string {
+	v := m.APIVersion()
+	return v[strings.Index(v, "/")+1:]
+}
+
 // Metadata returns the metadata of this object
 func (m Manifest) Metadata() Metadata {
 	if m["metadata"] == nil {
@@ -0,0 +1,160 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Get returns the value at the given path (e.g.
+// `spec.template.spec.containers[0].image`) and whether it exists. Lists are
+// indexed using `[n]`.
+func (m Manifest) Get(path string) (interface{}, bool) {
+	keys, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var cur interface{} = map[string]interface{}(m)
+	for _, k := range keys {
+		switch x := cur.(type) {
+		case map[string]interface{}:
+			if k.index {
+				return nil, false
+			}
+			v, ok := x[k.name]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			if !k.index || k.i >= len(x) {
+				return nil, false
+			}
+			cur = x[k.i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Set sets the value at the given path (see Get). Missing objects along the
+// path are created, missing lists or list elements are an error.
+func (m Manifest) Set(path string, value interface{}) error {
+	keys, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	var cur interface{} = map[string]interface{}(m)
+	for i, k := range keys {
+		last := i == len(keys)-1
+
+		switch x := cur.(type) {
+		case map[string]interface{}:
+			if k.index {
+				return fmt.Errorf("%s: %s is an object, not a list", path, pathString(keys[:i]))
+			}
+			if last {
+				x[k.name] = value
+				return nil
+			}
+
+			next, ok := x[k.name]
+			if !ok || next == nil {
+				if keys[i+1].index {
+					return fmt.Errorf("%s: list %s does not exist", path, pathString(keys[:i+1]))
+				}
+				next = make(map[string]interface{})
+				x[k.name] = next
+			}
+			cur = next
+		case []interface{}:
+			if !k.index {
+				return fmt.Errorf("%s: %s is a list, not an object", path, pathString(keys[:i]))
+			}
+			if k.i >= len(x) {
+				return fmt.Errorf("%s: index %d out of range, %s has %d elements", path, k.i, pathString(keys[:i]), len(x))
+			}
+			if last {
+				x[k.i] = value
+				return nil
+			}
+			cur = x[k.i]
+		default:
+			return fmt.Errorf("%s: %s is a %T, neither an object nor a list", path, pathString(keys[:i]), cur)
+		}
+	}
+	return nil
+}
+
+// pathKey is an element of a path, either a key of an object or an index of a
+// list
+type pathKey struct {
+	name  string
+	index bool
+	i     int
+}
+
+// ValidatePath returns an error if path can't be used with Get and Set
+func ValidatePath(path string) error {
+	_, err := parsePath(path)
+	return err
+}
+
+// parsePath splits a path like `a.b[0].c` into its keys
+func parsePath(path string) ([]pathKey, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var keys []pathKey
+	for _, seg := range strings.Split(path, ".") {
+		name := seg
+		if i := strings.Index(seg, "["); i >= 0 {
+			name = seg[:i]
+		}
+		if name == "" && !strings.HasPrefix(seg, "[") || name != "" && strings.ContainsAny(name, "]") {
+			return nil, fmt.Errorf("invalid path `%s`", path)
+		}
+		if name != "" {
+			keys = append(keys, pathKey{name: name})
+		}
+
+		// indices, e.g. `[0][1]`
+		rest := seg[len(name):]
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if !strings.HasPrefix(rest, "[") || end < 0 {
+				return nil, fmt.Errorf("invalid path `%s`", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid index `%s` in path `%s`", rest[1:end], path)
+			}
+			keys = append(keys, pathKey{index: true, i: i})
+			rest = rest[end+1:]
+		}
+	}
+	return keys, nil
+}
+
+// pathString formats keys as a path again, for error messages
+func pathString(keys []pathKey) string {
+	s := ""
+	for _, k := range keys {
+		if k.index {
+			s += fmt.Sprintf("[%d]", k.i)
+			continue
+		}
+		if s != "" {
+			s += "."
+		}
+		s += k.name
+	}
+	if s == "" {
+		return "the manifest"
+	}
+	return s
+}
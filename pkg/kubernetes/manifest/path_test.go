@@ -0,0 +1,87 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pathFixture() Manifest {
+	return Manifest{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "grafana"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":  "grafana",
+							"image": "grafana/grafana:7.0.0",
+							"args":  []interface{}{"--config", "/etc/grafana.ini"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestGet(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{name: "toplevel", path: "kind", want: "Deployment", ok: true},
+		{name: "nested", path: "metadata.name", want: "grafana", ok: true},
+		{name: "index", path: "spec.template.spec.containers[0].image", want: "grafana/grafana:7.0.0", ok: true},
+		{name: "nestedIndex", path: "spec.template.spec.containers[0].args[1]", want: "/etc/grafana.ini", ok: true},
+		{name: "missing", path: "metadata.namespace"},
+		{name: "missingParent", path: "status.replicas"},
+		{name: "outOfRange", path: "spec.template.spec.containers[1].image"},
+		{name: "indexOnObject", path: "metadata[0]"},
+		{name: "keyOnList", path: "spec.template.spec.containers.image"},
+		{name: "throughScalar", path: "kind.name"},
+		{name: "invalid", path: "spec..template"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := pathFixture().Get(c.path)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	m := pathFixture()
+
+	// existing values
+	require.NoError(t, m.Set("metadata.name", "loki"))
+	assert.Equal(t, "loki", m.Metadata().Name())
+
+	require.NoError(t, m.Set("spec.template.spec.containers[0].image", "grafana/grafana:7.1.0"))
+	got, _ := m.Get("spec.template.spec.containers[0].image")
+	assert.Equal(t, "grafana/grafana:7.1.0", got)
+
+	// intermediate objects are created
+	require.NoError(t, m.Set("spec.template.metadata.labels.app", "grafana"))
+	got, ok := m.Get("spec.template.metadata.labels")
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"app": "grafana"}, got)
+
+	// lists are not
+	assert.EqualError(t, m.Set("spec.volumes[0].name", "config"),
+		"spec.volumes[0].name: list spec.volumes does not exist")
+	assert.EqualError(t, m.Set("spec.template.spec.containers[1].image", "loki"),
+		"spec.template.spec.containers[1].image: index 1 out of range, spec.template.spec.containers has 1 elements")
+	assert.EqualError(t, m.Set("kind.name", "x"),
+		"kind.name: kind is a string, neither an object nor a list")
+	assert.EqualError(t, m.Set("metadata[0]", "x"),
+		"metadata[0]: metadata is an object, not a list")
+	assert.Error(t, m.Set("", "x"))
+}
@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+)
+
+// ErrorNamespaceMissing occurs when spec.namespace neither exists on the
+// cluster nor is created by the environment itself
+type ErrorNamespaceMissing struct {
+	Namespace string
+}
+
+func (e ErrorNamespaceMissing) Error() string {
+	return fmt.Sprintf("namespace `%s` (spec.namespace) does not exist on the cluster. Create it using --create-namespace or add a Namespace object to the environment", e.Namespace)
+}
+
+// CheckNamespace returns an ErrorNamespaceMissing if spec.namespace does not
+// exist on the cluster, unless state contains the Namespace, so that it is
+// created by applying state, or no object of state would be placed in it. If
+// reading the Namespace is forbidden, it is assumed to exist.
+func (k *Kubernetes) CheckNamespace(state manifest.List) error {
+	ns := k.Env.Spec.Namespace
+	if ns == "" {
+		return nil
+	}
+
+	for _, m := range state {
+		if m.Kind() == "Namespace" && m.Metadata().Name() == ns {
+			return nil
+		}
+	}
+
+	_, err := k.ctl.Get("", "Namespace", ns)
+	switch err.(type) {
+	case nil:
+		return nil
+	case client.ErrorForbidden:
+		log.Printf("Warning: not permitted to check whether namespace `%s` (spec.namespace) exists, assuming it does", ns)
+		return nil
+	case client.ErrorNotFound:
+	default:
+		return clusterErr(errors.Wrapf(err, "getting namespace `%s`", ns))
+	}
+
+	resources, err := k.ctl.Resources()
+	if err != nil {
+		return clusterErr(errors.Wrap(err, "listing known api-resources"))
+	}
+	for _, m := range state {
+		explicit := m.Metadata().HasNamespace() && m.Metadata().Namespace() == ns
+		implicit := !m.Metadata().HasNamespace() && resources.Namespaced(m)
+		if explicit || implicit {
+			return ErrorNamespaceMissing{Namespace: ns}
+		}
+	}
+	return nil
+}
+
+// CreateNamespace creates the given Namespace, labeled using
+// process.NamespaceLabels, and waits for it to become Active
+func (k *Kubernetes) CreateNamespace(name string, timeout time.Duration) error {
+	labels := make(map[string]interface{})
+	for key, value := range process.NamespaceLabels(k.Env) {
+		labels[key] = value
+	}
+
+	ns := manifest.Manifest{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": labels,
+		},
+	}
+
+	if _, err := k.ctl.Apply(context.Background(), manifest.List{ns}, client.ApplyOpts{Validate: true}); err != nil {
+		return clusterErr(errors.Wrapf(err, "creating namespace `%s`", name))
+	}
+	return clusterErr(k.ctl.WaitReady("", "Namespace", name, timeout))
+}
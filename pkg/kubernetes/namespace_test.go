@@ -0,0 +1,110 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func namespaceEnv(namespace string) v1alpha1.Config {
+	env := v1alpha1.New()
+	env.Metadata.Name = "environments/loki"
+	env.Metadata.Labels = map[string]string{"team": "logging"}
+	env.Spec.Namespace = namespace
+	env.Spec.InjectLabels = true
+	return *env
+}
+
+func TestCheckNamespace(t *testing.T) {
+	c := &fakeClient{
+		live: manifest.List{m("v1", "Namespace", "default", "")},
+		resources: client.Resources{
+			{Kind: "ConfigMap", Namespaced: true},
+			{Kind: "ClusterRole", Namespaced: false},
+		},
+	}
+	k := Kubernetes{Env: namespaceEnv("loki"), ctl: c}
+	state := manifest.List{m("v1", "ConfigMap", "loki", "loki")}
+
+	// fail fast
+	err := k.CheckNamespace(state)
+	assert.Equal(t, ErrorNamespaceMissing{Namespace: "loki"}, err)
+	assert.EqualError(t, err, "namespace `loki` (spec.namespace) does not exist on the cluster. Create it using --create-namespace or add a Namespace object to the environment")
+
+	// created by the environment itself
+	withNs := append(manifest.List{m("v1", "Namespace", "loki", "")}, state...)
+	assert.NoError(t, k.CheckNamespace(withNs))
+
+	// placed in the namespace implicitly
+	implicit := manifest.Manifest{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "loki"},
+	}
+	assert.Error(t, k.CheckNamespace(manifest.List{implicit}))
+
+	// nothing placed in the namespace
+	assert.NoError(t, k.CheckNamespace(manifest.List{
+		m("v1", "ConfigMap", "loki", "default"),
+		m("rbac.authorization.k8s.io/v1", "ClusterRole", "loki", ""),
+	}))
+
+	// not permitted to check
+	c.getErrs = map[string]error{"Namespace/loki": client.ErrorForbidden{}}
+	assert.NoError(t, k.CheckNamespace(state))
+
+	c.getErrs = map[string]error{"Namespace/loki": errors.New("connection refused")}
+	assert.IsType(t, ClusterError{}, k.CheckNamespace(state))
+	c.getErrs = nil
+
+	// exists
+	c.live = append(c.live, m("v1", "Namespace", "loki", ""))
+	assert.NoError(t, k.CheckNamespace(state))
+
+	// no namespace set
+	k.Env.Spec.Namespace = ""
+	assert.NoError(t, k.CheckNamespace(state))
+}
+
+// TestCreateNamespace checks that the Namespace is labeled like the
+// environment and waited for
+func TestCreateNamespace(t *testing.T) {
+	c := &fakeClient{}
+	k := Kubernetes{Env: namespaceEnv("loki"), ctl: c}
+
+	require.NoError(t, k.CreateNamespace("loki", 0))
+	assert.Equal(t, []string{"apply Namespace/loki", "wait Namespace/loki"}, c.calls)
+
+	require.Len(t, c.appliedObjects, 1)
+	assert.Equal(t, map[string]interface{}{
+		"team":                  "logging",
+		"tanka.dev/environment": k.Env.Metadata.NameLabel(),
+	}, c.appliedObjects[0].Metadata()["labels"])
+
+	// Pod Security Standards
+	c = &fakeClient{}
+	k.ctl = c
+	k.Env.Spec.NamespaceLabels = map[string]string{
+		"pod-security.kubernetes.io/enforce": "restricted",
+		"team":                               "loki",
+	}
+	require.NoError(t, k.CreateNamespace("loki", 0))
+	require.Len(t, c.appliedObjects, 1)
+	assert.Equal(t, map[string]interface{}{
+		"team":                               "loki",
+		"pod-security.kubernetes.io/enforce": "restricted",
+		"tanka.dev/environment":              k.Env.Metadata.NameLabel(),
+	}, c.appliedObjects[0].Metadata()["labels"])
+
+	c = &fakeClient{fail: map[string]bool{"Namespace/loki": true}}
+	k.ctl = c
+	err := k.CreateNamespace("loki", 0)
+	assert.IsType(t, ClusterError{}, err)
+	assert.Empty(t, c.calls)
+}
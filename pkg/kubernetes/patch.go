@@ -0,0 +1,163 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+)
+
+const (
+	// PatchFormatJSON expresses changes as a JSON Patch (RFC 6902)
+	PatchFormatJSON = "json"
+	// PatchFormatMerge expresses changes as a JSON Merge Patch (RFC 7386)
+	PatchFormatMerge = "merge"
+)
+
+// ErrorPatchFormatUnknown occurs when a patch format is requested that does
+// not exist
+type ErrorPatchFormatUnknown struct {
+	Requested string
+}
+
+func (e ErrorPatchFormatUnknown) Error() string {
+	return fmt.Sprintf("patch format `%s` does not exist. Pick one of: [%s %s]", e.Requested, PatchFormatJSON, PatchFormatMerge)
+}
+
+// Patch expresses the differences between the fetched live state and the
+// state as patches in the given format, instead of a textual diff. Objects are
+// compared like SubsetDiffer does. The result is a JSON object holding the
+// patch for each changed object, keyed by its DiffName.
+func (p Plan) Patch(format string) (*string, error) {
+	if format != PatchFormatJSON && format != PatchFormatMerge {
+		return nil, ErrorPatchFormatUnknown{Requested: format}
+	}
+
+	patches := make(map[string]interface{})
+	for _, m := range p.State {
+		rawIs := map[string]interface{}{}
+		if l := p.Live(m); l != nil {
+			rawIs = copyMap(l)
+		}
+
+		is, should, err := comparableSubset(m, rawIs, p.diff)
+		if err != nil {
+			return nil, err
+		}
+		switch format {
+		case PatchFormatJSON:
+			if ops := jsonPatch(is, should); len(ops) > 0 {
+				patches[util.DiffName(m)] = ops
+			}
+		case PatchFormatMerge:
+			if patch := mergePatch(is, should); len(patch) > 0 {
+				patches[util.DiffName(m)] = patch
+			}
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.MarshalIndent(patches, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	return &s, nil
+}
+
+// PatchOp is a single operation of a JSON Patch
+type PatchOp struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+// MarshalJSON omits the value of `remove` operations only, so that `null`
+// values are retained otherwise
+func (o PatchOp) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{o.Op, o.Path, o.Value})
+}
+
+// jsonPatch returns the JSON Patch operations that turn is into should
+func jsonPatch(is, should map[string]interface{}) []PatchOp {
+	var ops []PatchOp
+	for _, c := range FieldChanges(is, should) {
+		switch {
+		case c.Removed:
+			ops = append(ops, PatchOp{Op: "remove", Path: c.Path})
+		case c.Added:
+			ops = append(ops, PatchOp{Op: "add", Path: c.Path, Value: c.New})
+		default:
+			ops = append(ops, PatchOp{Op: "replace", Path: c.Path, Value: c.New})
+		}
+	}
+	return ops
+}
+
+// mergePatch returns the JSON Merge Patch that turns is into should. Removed
+// keys are set to `null`, lists are always replaced as a whole.
+func mergePatch(is, should map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for _, k := range sortedKeys(is, should) {
+		a, inIs := is[k]
+		b, inShould := should[k]
+
+		switch {
+		case !inShould:
+			patch[k] = nil
+		case !inIs:
+			patch[k] = b
+		default:
+			ma, aIsMap := a.(map[string]interface{})
+			mb, bIsMap := b.(map[string]interface{})
+			if aIsMap && bIsMap {
+				if sub := mergePatch(ma, mb); len(sub) > 0 {
+					patch[k] = sub
+				}
+				continue
+			}
+			if !reflect.DeepEqual(a, b) {
+				patch[k] = b
+			}
+		}
+	}
+	return patch
+}
+
+// sortedKeys returns the keys of all given maps, sorted
+func sortedKeys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	keys := []string{}
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901)
+func escapePointer(k string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+}
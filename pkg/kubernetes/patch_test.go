@@ -0,0 +1,123 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func patchFixture() (is, should map[string]interface{}) {
+	is = map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "grafana",
+			"labels": map[string]interface{}{"app": "grafana", "tier": "frontend"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 1,
+			"ports":    []interface{}{3000, 3001},
+		},
+	}
+	should = map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "grafana",
+			"labels":      map[string]interface{}{"app": "grafana"},
+			"annotations": map[string]interface{}{"tanka.dev/apply-wave": "1"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 2,
+			"ports":    []interface{}{3000},
+		},
+	}
+	return is, should
+}
+
+func TestJSONPatch(t *testing.T) {
+	is, should := patchFixture()
+
+	assert.Equal(t, []PatchOp{
+		// added
+		{Op: "add", Path: "/metadata/annotations", Value: map[string]interface{}{"tanka.dev/apply-wave": "1"}},
+		// removed
+		{Op: "remove", Path: "/metadata/labels/tier"},
+		{Op: "remove", Path: "/spec/ports/1"},
+		// changed
+		{Op: "replace", Path: "/spec/replicas", Value: 2},
+	}, jsonPatch(is, should))
+
+	// no ops without changes
+	assert.Empty(t, jsonPatch(should, should))
+
+	// keys are escaped
+	ops := jsonPatch(map[string]interface{}{}, map[string]interface{}{"a/b~c": nil})
+	assert.Equal(t, []PatchOp{{Op: "add", Path: "/a~1b~0c", Value: nil}}, ops)
+
+	data, err := json.Marshal(ops)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"op": "add", "path": "/a~1b~0c", "value": null}]`, string(data))
+
+	data, err = json.Marshal(PatchOp{Op: "remove", Path: "/spec"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"op": "remove", "path": "/spec"}`, string(data))
+}
+
+func TestMergePatch(t *testing.T) {
+	is, should := patchFixture()
+
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			// added
+			"annotations": map[string]interface{}{"tanka.dev/apply-wave": "1"},
+			// removed
+			"labels": map[string]interface{}{"tier": nil},
+		},
+		"spec": map[string]interface{}{
+			// changed
+			"replicas": 2,
+			// lists are replaced as a whole
+			"ports": []interface{}{3000},
+		},
+	}, mergePatch(is, should))
+
+	assert.Empty(t, mergePatch(should, should))
+}
+
+// TestPlanPatch checks that patches are keyed by object and that unchanged
+// objects are left out
+func TestPlanPatch(t *testing.T) {
+	c := &fakeClient{
+		info: client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		live: manifest.List{
+			withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1),
+			m("v1", "ConfigMap", "unchanged", "default"),
+		},
+	}
+	k := Kubernetes{Env: *v1alpha1.New(), ctl: c}
+
+	d, err := k.Diff(manifest.List{
+		withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 2),
+		m("v1", "ConfigMap", "unchanged", "default"),
+	}, DiffOpts{PatchFormat: PatchFormatJSON})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.JSONEq(t, `{
+		"apps-v1.Deployment.default.grafana": [
+			{"op": "replace", "path": "/spec/replicas", "value": 2}
+		]
+	}`, *d)
+
+	d, err = k.Diff(manifest.List{
+		m("v1", "ConfigMap", "unchanged", "default"),
+	}, DiffOpts{PatchFormat: PatchFormatMerge})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	_, err = k.Diff(nil, DiffOpts{PatchFormat: "strategic"})
+	assert.IsType(t, ErrorPatchFormatUnknown{}, err)
+}
@@ -0,0 +1,172 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+)
+
+// Plan is the desired state together with the live state it is compared
+// against. Diffing and applying a Plan both act on the same fetched live state,
+// so nothing is applied that has not been shown before.
+type Plan struct {
+	State manifest.List
+
+	// live objects, keyed by planKey
+	live map[string]manifest.Manifest
+	// namespace of objects that don't specify one
+	defaultNs string
+	// how to compare
+	diff CompareOpts
+}
+
+// Plan fetches the live state of all objects of state at once
+func (k *Kubernetes) Plan(state manifest.List) (*Plan, error) {
+	live, err := k.ctl.GetByState(state)
+	if err != nil {
+		return nil, clusterErr(errors.Wrap(err, "getting state from cluster"))
+	}
+
+	p := Plan{
+		State:     state,
+		live:      make(map[string]manifest.Manifest, len(live)),
+		defaultNs: k.Env.Spec.Namespace,
+		diff:      k.compareOpts(),
+	}
+	for _, m := range live {
+		p.live[planKey(m, m.Metadata().Namespace())] = m
+	}
+
+	return &p, nil
+}
+
+// Live returns the fetched live object of m, or nil if it does not exist yet
+func (p Plan) Live(m manifest.Manifest) manifest.Manifest {
+	if l, ok := p.live[planKey(m, m.Metadata().Namespace())]; ok {
+		return l
+	}
+
+	// implicit default namespace
+	if !m.Metadata().HasNamespace() {
+		return p.live[planKey(m, p.defaultNs)]
+	}
+	return nil
+}
+
+// Diff compares the state against the fetched live state, considering only
+// the fields present in the state (like SubsetDiffer)
+func (p Plan) Diff() (*string, error) {
+	var diffs string
+	for _, m := range p.State {
+		rawIs := map[string]interface{}{}
+		if l := p.Live(m); l != nil {
+			rawIs = copyMap(l)
+		}
+
+		d, err := subsetDifference(m, rawIs, p.diff)
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := util.DiffStr(d.name, d.live, d.merged)
+		if err != nil {
+			return nil, errors.Wrap(err, "invoking diff")
+		}
+		diffs += s
+	}
+
+	if diffs == "" {
+		return nil, nil
+	}
+	return &diffs, nil
+}
+
+// Changed returns the objects of the state that differ from their fetched live
+// state, including those that don't exist yet. The order of the state is kept.
+//
+// The subset diff can't tell fields removed from the state, so objects also
+// count as changed if they differ from the last-applied-configuration of their
+// live object. Objects lacking it (e.g. applied server-side) are compared by
+// their subset only.
+func (p Plan) Changed() (manifest.List, error) {
+	var changed manifest.List
+	for _, m := range p.State {
+		l := p.Live(m)
+		if l == nil {
+			changed = append(changed, m)
+			continue
+		}
+
+		d, err := subsetDifference(m, copyMap(l), p.diff)
+		if err != nil {
+			return nil, err
+		}
+		if d.live != d.merged {
+			changed = append(changed, m)
+			continue
+		}
+
+		differs, err := differsFromApplied(m, l, p.diff)
+		if err != nil {
+			return nil, err
+		}
+		if differs {
+			changed = append(changed, m)
+		}
+	}
+	return changed, nil
+}
+
+// differsFromApplied returns whether m differs from the
+// AnnotationLastApplied of the live object l, compared like snapshots are.
+// False if l has none.
+func differsFromApplied(m, l manifest.Manifest, opts CompareOpts) (bool, error) {
+	applied, err := LastApplied(manifest.List{l})
+	if err != nil || len(applied) == 0 {
+		return false, err
+	}
+
+	m, old, err := normalizePair(m, applied[0], opts.Normalize)
+	if err != nil {
+		return false, err
+	}
+
+	is, should := canonicalize(
+		stripServerFields(old, opts.IncludeStatus),
+		stripServerFields(m, opts.IncludeStatus),
+		opts.UnorderedLists,
+	)
+	if opts.IgnoreWhitespace {
+		is = normalizeWhitespace(is).(map[string]interface{})
+		should = normalizeWhitespace(should).(map[string]interface{})
+	}
+	return manifest.Manifest(is).String() != manifest.Manifest(should).String(), nil
+}
+
+// ApplyPlan applies the state of the plan. The fields the cluster populates on
+// its own (serverMetadata) are stripped from the state, e.g. if it was
+// exported from a cluster. Instead, the resourceVersion of each fetched live
+// object is sent along, so the API server rejects the change with a conflict if
+// the object has been modified since the plan was made.
+func (k *Kubernetes) ApplyPlan(p *Plan, opts ApplyOpts) (ApplyResults, error) {
+	state := make(manifest.List, 0, len(p.State))
+	for _, m := range p.State {
+		l := p.Live(m)
+		m = manifest.Manifest(stripServerFields(m, true))
+		if l != nil {
+			m.Metadata()["resourceVersion"] = l.Metadata()["resourceVersion"]
+		}
+		state = append(state, m)
+	}
+
+	return k.Apply(state, opts)
+}
+
+// planKey identifies m by kind, namespace and name. The apiVersion is omitted
+// on purpose, only the group is considered.
+func planKey(m manifest.Manifest, namespace string) string {
+	return strings.Join([]string{m.Group(), m.Kind(), namespace, m.Metadata().Name()}, "/")
+}
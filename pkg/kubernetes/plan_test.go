@@ -0,0 +1,227 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TestPlan checks that the diff and the apply of a Plan are based on the same,
+// once fetched live state
+func TestPlan(t *testing.T) {
+	live := withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1)
+	live.Metadata()["resourceVersion"] = "42"
+	live.Metadata()["uid"] = "1"
+
+	c := &fakeClient{live: manifest.List{live}}
+	env := v1alpha1.New()
+	env.Spec.Namespace = "default"
+	k := Kubernetes{Env: *env, ctl: c}
+
+	state := manifest.List{
+		withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 2),
+		m("v1", "Service", "grafana", "default"),
+	}
+
+	plan, err := k.Plan(state)
+	require.NoError(t, err)
+
+	d, err := plan.Diff()
+	require.NoError(t, err)
+	require.NotNil(t, d)
+
+	// changed replicas in the Deployment, the Service is created
+	assert.Contains(t, *d, "-    replicas: 1\n")
+	assert.Contains(t, *d, "+    replicas: 2\n")
+	assert.Contains(t, *d, "MERGED-v1.Service.default.grafana")
+	// runtime fields are not compared
+	assert.NotContains(t, *d, "resourceVersion")
+
+	results, err := k.ApplyPlan(plan, ApplyOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, results.Failed())
+
+	// live state fetched only once, for both diff and apply
+	assert.Equal(t, 1, c.fetched)
+
+	// the fetched resourceVersion is used as a precondition
+	require.Len(t, c.appliedObjects, 2)
+	assert.Equal(t, "42", c.appliedObjects[0].Metadata()["resourceVersion"])
+	_, ok := c.appliedObjects[1].Metadata()["resourceVersion"]
+	assert.False(t, ok)
+
+	// the state itself is left untouched
+	_, ok = state[0].Metadata()["resourceVersion"]
+	assert.False(t, ok)
+}
+
+// TestApplyPlanServerMetadata checks that the fields the cluster populates are
+// stripped from the state, e.g. if it was exported using kubectl get
+func TestApplyPlanServerMetadata(t *testing.T) {
+	live := m("v1", "ConfigMap", "config", "default")
+	live.Metadata()["resourceVersion"] = "42"
+
+	c := &fakeClient{live: manifest.List{live}}
+	env := v1alpha1.New()
+	env.Spec.Namespace = "default"
+	k := Kubernetes{Env: *env, ctl: c}
+
+	exported := func(name string) manifest.Manifest {
+		e := m("v1", "ConfigMap", name, "default")
+		e.Metadata()["resourceVersion"] = "7"
+		e.Metadata()["uid"] = "1"
+		e.Metadata()["creationTimestamp"] = "2020-06-01T12:00:00Z"
+		return e
+	}
+
+	plan, err := k.Plan(manifest.List{exported("config"), exported("created")})
+	require.NoError(t, err)
+	_, err = k.ApplyPlan(plan, ApplyOpts{})
+	require.NoError(t, err)
+
+	require.Len(t, c.appliedObjects, 2)
+	for _, a := range c.appliedObjects {
+		assert.NotContains(t, a.Metadata(), "uid", a.KindName())
+		assert.NotContains(t, a.Metadata(), "creationTimestamp", a.KindName())
+	}
+
+	// only the fetched resourceVersion is sent
+	assert.Equal(t, "42", c.appliedObjects[0].Metadata()["resourceVersion"])
+	assert.NotContains(t, c.appliedObjects[1].Metadata(), "resourceVersion")
+}
+
+// TestPlanDefaultNamespace checks that objects without a namespace are matched
+// to live objects in the environment's default namespace
+func TestPlanDefaultNamespace(t *testing.T) {
+	live := m("v1", "ConfigMap", "config", "default")
+	c := &fakeClient{live: manifest.List{live}}
+	env := v1alpha1.New()
+	env.Spec.Namespace = "default"
+	k := Kubernetes{Env: *env, ctl: c}
+
+	state := m("v1", "ConfigMap", "config", "")
+	delete(state.Metadata(), "namespace")
+
+	plan, err := k.Plan(manifest.List{state})
+	require.NoError(t, err)
+	assert.NotNil(t, plan.Live(state))
+
+	// no differences, rather than a created object
+	d, err := plan.Diff()
+	require.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+// TestPlanChanged checks that only objects differing from the live state (or
+// missing from it) are considered changed, and that only those are applied
+func TestPlanChanged(t *testing.T) {
+	liveDeploy := withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1)
+	liveDeploy.Metadata()["resourceVersion"] = "42"
+	liveConfig := m("v1", "ConfigMap", "config", "default")
+	liveConfig.Metadata()["uid"] = "1"
+	liveConfig["data"] = map[string]interface{}{"theme": "dark"}
+
+	c := &fakeClient{live: manifest.List{liveDeploy, liveConfig}}
+	env := v1alpha1.New()
+	env.Spec.Namespace = "default"
+	k := Kubernetes{Env: *env, ctl: c}
+
+	config := m("v1", "ConfigMap", "config", "default")
+	config["data"] = map[string]interface{}{"theme": "dark"}
+	state := manifest.List{
+		withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 2),
+		config,
+		m("v1", "Service", "grafana", "default"),
+	}
+
+	plan, err := k.Plan(state)
+	require.NoError(t, err)
+
+	changed, err := plan.Changed()
+	require.NoError(t, err)
+
+	_, err = k.Apply(changed, ApplyOpts{})
+	require.NoError(t, err)
+
+	// the unchanged ConfigMap is skipped
+	assert.Equal(t, []string{"Deployment/grafana", "Service/grafana"}, c.applied)
+	assert.Equal(t, 1, c.fetched)
+}
+
+// TestPlanChangedRemoved checks that fields removed since the last apply make
+// an object changed, although its subset is equal
+func TestPlanChangedRemoved(t *testing.T) {
+	lastApplied := func(data map[string]interface{}) manifest.Manifest {
+		applied := m("v1", "ConfigMap", "config", "default")
+		applied["data"] = data
+
+		annotation, err := json.Marshal(applied)
+		require.NoError(t, err)
+
+		live := manifest.Manifest(copyMap(applied))
+		live.Metadata()["annotations"] = map[string]interface{}{AnnotationLastApplied: string(annotation)}
+		live.Metadata()["uid"] = "1"
+		return live
+	}
+
+	config := m("v1", "ConfigMap", "config", "default")
+	config["data"] = map[string]interface{}{"theme": "dark"}
+
+	env := v1alpha1.New()
+	env.Spec.Namespace = "default"
+	for name, c := range map[string]struct {
+		live    manifest.Manifest
+		changed bool
+	}{
+		"removed":   {live: lastApplied(map[string]interface{}{"theme": "dark", "debug": "true"}), changed: true},
+		"unchanged": {live: lastApplied(map[string]interface{}{"theme": "dark"})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			k := Kubernetes{Env: *env, ctl: &fakeClient{live: manifest.List{c.live}}}
+			plan, err := k.Plan(manifest.List{config})
+			require.NoError(t, err)
+
+			changed, err := plan.Changed()
+			require.NoError(t, err)
+			assert.Equal(t, c.changed, len(changed) == 1)
+		})
+	}
+}
+
+// TestPlanNormalized checks that explanations and patches compare objects
+// normalized like the subset diff does
+func TestPlanNormalized(t *testing.T) {
+	live := m("v1", "ConfigMap", "config", "default")
+	live.Metadata()["labels"] = map[string]interface{}{"team": "grafana"}
+	live["data"] = map[string]interface{}{"config.ini": "a: b\r\n"}
+
+	env := v1alpha1.New()
+	env.Spec.Namespace = "default"
+	env.Spec.Diff.IgnoreWhitespace = true
+	normalize := func(obj map[string]interface{}) (map[string]interface{}, error) {
+		m := manifest.Manifest(copyMap(obj))
+		delete(m.Metadata(), "labels")
+		return m, nil
+	}
+	k := Kubernetes{Env: *env, ctl: &fakeClient{live: manifest.List{live}}, normalize: normalize}
+
+	config := m("v1", "ConfigMap", "config", "default")
+	config["data"] = map[string]interface{}{"config.ini": "a: b\n"}
+	plan, err := k.Plan(manifest.List{config})
+	require.NoError(t, err)
+
+	explained, err := plan.Explain()
+	require.NoError(t, err)
+	assert.Nil(t, explained)
+
+	for _, format := range []string{PatchFormatJSON, PatchFormatMerge} {
+		patch, err := plan.Patch(format)
+		require.NoError(t, err)
+		assert.Nil(t, patch, format)
+	}
+}
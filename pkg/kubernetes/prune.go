@@ -0,0 +1,121 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// PruneResource is a type of objects prune may delete
+type PruneResource struct {
+	// Group is empty for the core group
+	Group   string
+	Version string
+	Kind    string
+}
+
+// ParsePruneResource parses the `group/version/kind` (`version/kind` for the
+// core group) notation, e.g. `apps/v1/Deployment` or `v1/ConfigMap`
+func ParsePruneResource(s string) (PruneResource, error) {
+	parts := strings.Split(s, "/")
+	for _, p := range parts {
+		if p == "" {
+			parts = nil
+		}
+	}
+
+	switch len(parts) {
+	case 2:
+		return PruneResource{Version: parts[0], Kind: parts[1]}, nil
+	case 3:
+		return PruneResource{Group: parts[0], Version: parts[1], Kind: parts[2]}, nil
+	}
+	return PruneResource{}, fmt.Errorf("`%s` is not a resource type. Use `<group>/<version>/<kind>`, or `<version>/<kind>` for the core group", s)
+}
+
+// ReadPruneResources reads a YAML (or JSON) list of resource types in the
+// notation of ParsePruneResource
+func ReadPruneResources(r io.Reader) ([]PruneResource, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrap(err, "parsing prune resources")
+	}
+
+	resources := make([]PruneResource, 0, len(list))
+	for _, s := range list {
+		r, err := ParsePruneResource(s)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+// APIVersion returns the apiVersion of objects of this type
+func (r PruneResource) APIVersion() string {
+	if r.Group == "" {
+		return r.Version
+	}
+	return r.Group + "/" + r.Version
+}
+
+func (r PruneResource) String() string {
+	return r.APIVersion() + "/" + r.Kind
+}
+
+// fqn returns the `kind.version.group` notation of `kubectl get`. The core
+// group keeps its trailing dot (`ConfigMap.v1.`), as kubectl would otherwise
+// take the version for the group.
+func (r PruneResource) fqn() string {
+	return r.Kind + "." + r.Version + "." + r.Group
+}
+
+// matches returns whether m is of this type
+func (r PruneResource) matches(m manifest.Manifest) bool {
+	return m.APIVersion() == r.APIVersion() && m.Kind() == r.Kind
+}
+
+// ErrorNotPrunable occurs when objects are of types prune may not delete.
+// These could not be pruned once removed from Jsonnet.
+type ErrorNotPrunable struct {
+	Names []string
+}
+
+func (e ErrorNotPrunable) Error() string {
+	return fmt.Sprintf("the types of these objects are missing from the prune resources, so they could never be pruned:\n  %s\nAdd their types (`<group>/<version>/<kind>`) to the list", strings.Join(e.Names, "\n  "))
+}
+
+// CheckPrunable returns an ErrorNotPrunable if objects of state are of types
+// missing from resources
+func CheckPrunable(state manifest.List, resources []PruneResource) error {
+	var missing []string
+	for _, m := range state {
+		found := false
+		for _, r := range resources {
+			if r.matches(m) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, m.APIVersion()+"/"+m.KindName())
+		}
+	}
+
+	if len(missing) > 0 {
+		return ErrorNotPrunable{Names: missing}
+	}
+	return nil
+}
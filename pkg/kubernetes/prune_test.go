@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func TestReadPruneResources(t *testing.T) {
+	want := []PruneResource{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Version: "v1", Kind: "ConfigMap"},
+	}
+
+	// YAML
+	got, err := ReadPruneResources(strings.NewReader("- apps/v1/Deployment\n- v1/ConfigMap\n"))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// JSON
+	got, err = ReadPruneResources(strings.NewReader(`["apps/v1/Deployment", "v1/ConfigMap"]`))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	for _, invalid := range []string{"Deployment", "apps//Deployment", "a/b/c/d"} {
+		_, err = ReadPruneResources(strings.NewReader(`["` + invalid + `"]`))
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestOrphanedResources checks that the given resource types replace the ones
+// derived from the server
+func TestOrphanedResources(t *testing.T) {
+	env := v1alpha1.New()
+	env.Spec.InjectLabels = true
+
+	c := &fakeClient{
+		resources: client.Resources{
+			{Kind: "Deployment", APIGroup: "apps", Verbs: "[create delete get list]"},
+			{Kind: "Secret", Verbs: "[create delete get list]"},
+		},
+	}
+	k := Kubernetes{Env: *env, ctl: c}
+
+	state := manifest.List{m("apps/v1", "Deployment", "grafana", "default")}
+
+	_, err := k.Orphaned(state, nil)
+	require.NoError(t, err)
+	_, err = k.Orphaned(state, []PruneResource{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Version: "v1", Kind: "ConfigMap"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"Deployment.apps,Secret",
+		"Deployment.v1.apps,ConfigMap.v1.",
+	}, c.listed)
+}
+
+// TestCheckPrunable checks that objects of types missing from the prune
+// resources are reported
+func TestCheckPrunable(t *testing.T) {
+	resources := []PruneResource{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Version: "v1", Kind: "ConfigMap"},
+	}
+
+	assert.NoError(t, CheckPrunable(manifest.List{
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("v1", "ConfigMap", "grafana", "default"),
+	}, resources))
+
+	err := CheckPrunable(manifest.List{
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("v1", "Service", "grafana", "default"),
+		// other version than allowed
+		m("apps/v1beta1", "Deployment", "loki", "default"),
+	}, resources)
+	assert.Equal(t, ErrorNotPrunable{Names: []string{"v1/Service/grafana", "apps/v1beta1/Deployment/loki"}}, err)
+}
@@ -0,0 +1,180 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// AnnotationDeploymentRevision is set on the ReplicaSets of a Deployment by
+// the deployment controller, holding the revision of each
+const AnnotationDeploymentRevision = "deployment.kubernetes.io/revision"
+
+// historyKinds maps kinds with revision history to the kind of object their
+// revisions are stored in
+var historyKinds = map[string]string{
+	"Deployment":  "ReplicaSet",
+	"StatefulSet": "ControllerRevision",
+	"DaemonSet":   "ControllerRevision",
+}
+
+// ErrorNoRevisionHistory occurs when a revision is requested for an object
+// whose kind keeps no revision history
+type ErrorNoRevisionHistory struct {
+	Name string
+}
+
+func (e ErrorNoRevisionHistory) Error() string {
+	return fmt.Sprintf("%s keeps no revision history. Only Deployments, StatefulSets and DaemonSets do, use --target to select them", e.Name)
+}
+
+// ErrorRevisionNotFound occurs when the requested revision of an object does
+// not exist (anymore), e.g. because of its revisionHistoryLimit
+type ErrorRevisionNotFound struct {
+	Name     string
+	Revision int
+}
+
+func (e ErrorRevisionNotFound) Error() string {
+	return fmt.Sprintf("revision %d of %s not found", e.Revision, e.Name)
+}
+
+// diffRevision compares the state against the given revision of each object
+// instead of its current live state, see Revision
+func (k *Kubernetes) diffRevision(state manifest.List, opts DiffOpts) (*string, error) {
+	for _, m := range state {
+		if _, ok := historyKinds[m.Kind()]; !ok {
+			return nil, ErrorNoRevisionHistory{Name: m.KindName()}
+		}
+	}
+
+	var diffs string
+	for _, m := range state {
+		ns := m.Metadata().Namespace()
+		if ns == "" {
+			ns = k.Env.Spec.Namespace
+		}
+
+		live, err := k.ctl.Get(ns, m.Kind(), m.Metadata().Name())
+		if err != nil {
+			return nil, clusterErr(errors.Wrap(err, "getting state from cluster"))
+		}
+
+		old, err := k.Revision(live, opts.Revision)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := subsetDifference(m, old, k.compareOpts())
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := diffStr(opts.DiffOpts, d.name, d.live, d.merged)
+		if err != nil {
+			return nil, errors.Wrap(err, "invoking diff")
+		}
+		diffs += s
+	}
+
+	if diffs == "" {
+		return nil, nil
+	}
+	return &diffs, nil
+}
+
+// Revision returns live as it was at the given revision of its rollout
+// history. Only the pod template is part of the history, so this is the
+// current live object with the pod template of that revision.
+//
+// Deployments keep their history in ReplicaSets, StatefulSets and DaemonSets
+// in ControllerRevisions. Both are found using the selector of live and must
+// be owned by it.
+func (k *Kubernetes) Revision(live manifest.Manifest, revision int) (manifest.Manifest, error) {
+	historyKind, ok := historyKinds[live.Kind()]
+	if !ok {
+		return nil, ErrorNoRevisionHistory{Name: live.KindName()}
+	}
+
+	spec, _ := live["spec"].(map[string]interface{})
+	selector, _ := spec["selector"].(map[string]interface{})
+	labels := manifest.Metadata(map[string]interface{}{"labels": selector["matchLabels"]}).Labels()
+
+	history, err := k.ctl.GetByLabels(live.Metadata().Namespace(), historyKind, labels)
+	if err != nil {
+		return nil, clusterErr(errors.Wrapf(err, "listing revisions of %s", live.KindName()))
+	}
+
+	for _, h := range history {
+		if !ownedBy(h, live) || revisionOf(h) != revision {
+			continue
+		}
+
+		template, ok := templateOf(h)
+		if !ok {
+			return nil, fmt.Errorf("revision %d of %s holds no pod template", revision, live.KindName())
+		}
+
+		old := manifest.Manifest(copyMap(live))
+		if err := old.Set("spec.template", template); err != nil {
+			return nil, err
+		}
+		return old, nil
+	}
+
+	return nil, ErrorRevisionNotFound{Name: live.KindName(), Revision: revision}
+}
+
+// ownedBy returns whether m is owned by the object with the uid of owner
+func ownedBy(m, owner manifest.Manifest) bool {
+	refs, _ := m.Metadata()["ownerReferences"].([]interface{})
+	for _, r := range refs {
+		ref, ok := r.(map[string]interface{})
+		if ok && ref["uid"] == owner.Metadata().UID() {
+			return true
+		}
+	}
+	return false
+}
+
+// revisionOf returns the revision a ReplicaSet or ControllerRevision holds, or
+// 0 if unknown
+func revisionOf(m manifest.Manifest) int {
+	if m.Kind() == "ControllerRevision" {
+		rev, _ := m["revision"].(float64)
+		return int(rev)
+	}
+
+	rev, _ := strconv.Atoi(m.Metadata().Annotations()[AnnotationDeploymentRevision])
+	return rev
+}
+
+// templateOf returns the pod template stored in a ReplicaSet or
+// ControllerRevision. Labels and fields added by the controllers are removed.
+func templateOf(m manifest.Manifest) (map[string]interface{}, bool) {
+	path := "spec.template"
+	if m.Kind() == "ControllerRevision" {
+		path = "data.spec.template"
+	}
+
+	v, ok := m.Get(path)
+	if !ok {
+		return nil, false
+	}
+	template, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	template = copyMap(template)
+	delete(template, "$patch")
+	if labels, ok := manifest.Manifest(template).Get("metadata.labels"); ok {
+		if labels, ok := labels.(map[string]interface{}); ok {
+			delete(labels, "pod-template-hash")
+		}
+	}
+	return template, true
+}
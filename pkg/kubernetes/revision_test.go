@@ -0,0 +1,119 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func withImage(m manifest.Manifest, image string) manifest.Manifest {
+	m["spec"] = map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"app": "grafana"},
+		},
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": map[string]interface{}{"app": "grafana"},
+			},
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "grafana", "image": image},
+				},
+			},
+		},
+	}
+	return m
+}
+
+// replicaSet returns a ReplicaSet of the Deployment with the given uid, as the
+// deployment controller creates it for each revision
+func replicaSet(owner string, revision, image string) manifest.Manifest {
+	rs := withImage(m("apps/v1", "ReplicaSet", "grafana-"+revision, "default"), image)
+	rs.Metadata()["annotations"] = map[string]interface{}{AnnotationDeploymentRevision: revision}
+	rs.Metadata()["ownerReferences"] = []interface{}{
+		map[string]interface{}{"kind": "Deployment", "name": "grafana", "uid": owner},
+	}
+
+	labels, _ := rs.Get("spec.template.metadata.labels")
+	labels.(map[string]interface{})["pod-template-hash"] = "5d8f7" + revision
+	return rs
+}
+
+// TestDiffRevision checks that the state is diffed against the pod template of
+// the requested revision, taken from the ReplicaSets owned by the Deployment
+func TestDiffRevision(t *testing.T) {
+	live := withImage(m("apps/v1", "Deployment", "grafana", "default"), "grafana/grafana:7.1.0")
+	live.Metadata()["uid"] = "1"
+
+	c := &fakeClient{
+		info: client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		live: manifest.List{live},
+		labeled: manifest.List{
+			replicaSet("1", "1", "grafana/grafana:6.7.0"),
+			replicaSet("1", "2", "grafana/grafana:7.0.0"),
+			replicaSet("1", "3", "grafana/grafana:7.1.0"),
+			// same labels, other owner
+			replicaSet("2", "1", "grafana/grafana:5.0.0"),
+		},
+	}
+	k := Kubernetes{Env: *v1alpha1.New(), ctl: c}
+
+	state := manifest.List{withImage(m("apps/v1", "Deployment", "grafana", "default"), "grafana/grafana:7.1.0")}
+
+	d, err := k.Diff(state, DiffOpts{Revision: 2})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Regexp(t, `\n-\s+- image: grafana/grafana:7.0.0\n\+\s+- image: grafana/grafana:7.1.0\n`, *d)
+	assert.NotContains(t, *d, "pod-template-hash")
+
+	// the current revision equals the state
+	d, err = k.Diff(state, DiffOpts{Revision: 3})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	_, err = k.Diff(state, DiffOpts{Revision: 4})
+	assert.Equal(t, ErrorRevisionNotFound{Name: "Deployment/grafana", Revision: 4}, err)
+
+	_, err = k.Diff(append(state, m("v1", "Service", "grafana", "default")), DiffOpts{Revision: 2})
+	assert.Equal(t, ErrorNoRevisionHistory{Name: "Service/grafana"}, err)
+}
+
+// TestRevisionControllerRevision checks that the pod template is taken from
+// the ControllerRevisions of StatefulSets and DaemonSets
+func TestRevisionControllerRevision(t *testing.T) {
+	live := withImage(m("apps/v1", "StatefulSet", "grafana", "default"), "grafana/grafana:7.1.0")
+	live.Metadata()["uid"] = "1"
+
+	old := withImage(m("apps/v1", "StatefulSet", "grafana", "default"), "grafana/grafana:7.0.0")
+	template, _ := old.Get("spec.template")
+	template.(map[string]interface{})["$patch"] = "replace"
+
+	rev := m("apps/v1", "ControllerRevision", "grafana-5d8f7", "default")
+	rev.Metadata()["ownerReferences"] = []interface{}{
+		map[string]interface{}{"kind": "StatefulSet", "name": "grafana", "uid": "1"},
+	}
+	rev["revision"] = float64(1)
+	rev["data"] = map[string]interface{}{
+		"spec": map[string]interface{}{"template": template},
+	}
+
+	k := Kubernetes{ctl: &fakeClient{labeled: manifest.List{rev}}}
+
+	got, err := k.Revision(live, 1)
+	require.NoError(t, err)
+
+	image, _ := got.Get("spec.template.spec.containers[0].image")
+	assert.Equal(t, "grafana/grafana:7.0.0", image)
+	_, ok := got.Get("spec.template.$patch")
+	assert.False(t, ok)
+
+	// live itself is left untouched
+	image, _ = live.Get("spec.template.spec.containers[0].image")
+	assert.Equal(t, "grafana/grafana:7.1.0", image)
+}
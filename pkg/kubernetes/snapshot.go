@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+)
+
+// SnapshotDiffer returns a Differ that compares the state against a previously
+// captured snapshot (e.g. the output of `tk show`) instead of the cluster.
+// Objects are matched by their DiffName: those only present in the snapshot
+// are reported as deleted, those only present in the state as created. Lists
+// in opts.UnorderedLists are compared regardless of their order. Unless
+// opts.IncludeStatus is set, `status` is not compared. If
+// opts.IgnoreWhitespace is set, line endings and trailing whitespace of strings
+// are ignored. If opts.Normalize is set, it is run on both sides beforehand,
+// see v1alpha1.DiffSpec.
+func SnapshotDiffer(snapshot manifest.List, opts CompareOpts) Differ {
+	return func(state manifest.List, diffOpts client.DiffOpts) (*string, error) {
+		known := make(map[string]manifest.Manifest, len(snapshot))
+		for _, m := range snapshot {
+			known[util.DiffName(m)] = m
+		}
+
+		s := ""
+		seen := make(map[string]bool, len(state))
+		for _, m := range state {
+			name := util.DiffName(m)
+			seen[name] = true
+
+			is, should := "", m.String()
+			if old, ok := known[name]; ok {
+				m, old, err := normalizePair(m, old, opts.Normalize)
+				if err != nil {
+					return nil, err
+				}
+
+				canonIs, canonShould := canonicalize(
+					stripServerFields(old, opts.IncludeStatus),
+					stripServerFields(m, opts.IncludeStatus),
+					opts.UnorderedLists,
+				)
+				if opts.IgnoreWhitespace {
+					canonIs = normalizeWhitespace(canonIs).(map[string]interface{})
+					canonShould = normalizeWhitespace(canonShould).(map[string]interface{})
+				}
+				is, should = manifest.Manifest(canonIs).String(), manifest.Manifest(canonShould).String()
+			}
+
+			d, err := diffStr(diffOpts, name, is, should)
+			if err != nil {
+				return nil, err
+			}
+			if err := streamDiff(diffOpts.Out, d); err != nil {
+				return nil, err
+			}
+			s += d
+		}
+
+		// removed since the snapshot
+		for _, m := range snapshot {
+			name := util.DiffName(m)
+			if seen[name] {
+				continue
+			}
+
+			d, err := diffStr(diffOpts, name, m.String(), "")
+			if err != nil {
+				return nil, err
+			}
+			if err := streamDiff(diffOpts.Out, d); err != nil {
+				return nil, err
+			}
+			s += d
+		}
+
+		if s == "" {
+			return nil, nil
+		}
+
+		return &s, nil
+	}
+}
+
+// LastApplied returns the last-applied-configuration (AnnotationLastApplied)
+// of each object of list, which is what was last applied using client-side
+// apply. Objects lacking the annotation are left out, so that diffing against
+// the result reports them as created.
+func LastApplied(list manifest.List) (manifest.List, error) {
+	out := make(manifest.List, 0, len(list))
+	for _, m := range list {
+		data, ok := m.Metadata().Annotations()[AnnotationLastApplied]
+		if !ok {
+			continue
+		}
+
+		var applied manifest.Manifest
+		if err := json.Unmarshal([]byte(data), &applied); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s of %s", AnnotationLastApplied, m.KindName())
+		}
+		out = append(out, applied)
+	}
+	return out, nil
+}
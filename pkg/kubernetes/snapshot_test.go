@@ -0,0 +1,119 @@
+package kubernetes
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// TestSnapshotDiffer checks that the state is diffed against the snapshot
+// object-by-object, reporting objects missing on either side as
+// created/deleted
+func TestSnapshotDiffer(t *testing.T) {
+	snapshot := manifest.List{
+		withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1),
+		m("v1", "Service", "loki", "default"),
+		m("v1", "ConfigMap", "unchanged", "default"),
+	}
+
+	state := manifest.List{
+		m("v1", "ConfigMap", "unchanged", "default"),
+		withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 2),
+		m("v1", "Service", "prometheus", "default"),
+	}
+
+	d, err := SnapshotDiffer(snapshot, CompareOpts{})(state, client.DiffOpts{})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+
+	// one diff per changed object, unchanged ConfigMap omitted
+	heads := regexp.MustCompile(`(?m)^diff -u -N LIVE-(\S+) `).FindAllStringSubmatch(*d, -1)
+	names := make([]string, 0, len(heads))
+	for _, h := range heads {
+		names = append(names, h[1])
+	}
+	assert.Equal(t, []string{
+		"apps-v1.Deployment.default.grafana",
+		"v1.Service.default.prometheus",
+		"v1.Service.default.loki",
+	}, names)
+
+	assert.Contains(t, *d, "-  replicas: 1\n+  replicas: 2\n")
+	assert.Regexp(t, `@@ -0,0 \+1,\d+ @@\n\+apiVersion: v1\n\+kind: Service\n\+metadata:\n\+  name: prometheus`, *d)
+	assert.Regexp(t, `@@ -1,\d+ \+0,0 @@\n-apiVersion: v1\n-kind: Service\n-metadata:\n-  name: loki`, *d)
+
+	// identical snapshot yields no diff
+	d, err = SnapshotDiffer(state, CompareOpts{})(state, client.DiffOpts{})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+// TestSnapshotDifferFullContext checks that the diff holds the entire objects
+// only if requested
+func TestSnapshotDifferFullContext(t *testing.T) {
+	snapshot := manifest.List{withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1)}
+	state := manifest.List{withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 2)}
+
+	d, err := SnapshotDiffer(snapshot, CompareOpts{})(state, client.DiffOpts{})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.NotContains(t, *d, " apiVersion: apps/v1\n")
+
+	d, err = SnapshotDiffer(snapshot, CompareOpts{})(state, client.DiffOpts{FullContext: true})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Contains(t, *d, " apiVersion: apps/v1\n")
+	assert.Contains(t, *d, "-  replicas: 1\n+  replicas: 2\n")
+}
+
+func withReplicas(m manifest.Manifest, replicas int) manifest.Manifest {
+	m["spec"] = map[string]interface{}{"replicas": replicas}
+	return m
+}
+
+// TestLastApplied checks that the last-applied-configuration of each object is
+// returned, leaving out those lacking it
+func TestLastApplied(t *testing.T) {
+	live := withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 3)
+	live["status"] = map[string]interface{}{"readyReplicas": 3}
+	live.Metadata()["annotations"] = map[string]interface{}{
+		AnnotationLastApplied: `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"grafana","namespace":"default"},"spec":{"replicas":1}}`,
+	}
+
+	got, err := LastApplied(manifest.List{
+		live,
+		// created by a controller
+		m("v1", "ConfigMap", "generated", "default"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, manifest.List{
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "grafana", "namespace": "default"},
+			"spec":       map[string]interface{}{"replicas": float64(1)},
+		},
+	}, got)
+
+	// the state is compared against what was applied, not the live object
+	state := manifest.List{
+		withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 2),
+		m("v1", "ConfigMap", "generated", "default"),
+	}
+	d, err := SnapshotDiffer(got, CompareOpts{})(state, client.DiffOpts{})
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Contains(t, *d, "-  replicas: 1\n+  replicas: 2\n")
+	assert.NotContains(t, *d, "readyReplicas")
+	assert.Regexp(t, `@@ -0,0 \+1,\d+ @@\n\+apiVersion: v1\n\+kind: ConfigMap`, *d)
+
+	// broken annotations are reported
+	live.Metadata()["annotations"] = map[string]interface{}{AnnotationLastApplied: "{"}
+	_, err = LastApplied(manifest.List{live})
+	assert.Error(t, err)
+}
@@ -1,16 +1,26 @@
 package kubernetes
 
 import (
-	"strings"
-
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v3"
 
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 )
 
+// CompareOpts configure how the subset strategy and snapshots compare objects
+type CompareOpts struct {
+	v1alpha1.DiffSpec
+
+	// Normalize implements DiffSpec.Normalize. Nil if unset
+	Normalize Normalizer
+}
+
+// Normalizer returns a normalized copy of obj, see v1alpha1.DiffSpec.Normalize
+type Normalizer func(obj map[string]interface{}) (map[string]interface{}, error)
+
 type difference struct {
 	name         string
 	live, merged string
@@ -20,15 +30,21 @@ type difference struct {
 // comparing only the fields present in the desired state. This algorithm might
 // miss information, but is all that's possible on cluster versions lower than
 // 1.13.
-func SubsetDiffer(c client.Client) Differ {
-	return func(state manifest.List) (*string, error) {
+//
+// Lists in opts.UnorderedLists are compared regardless of their order. Unless
+// opts.IncludeStatus is set, `status` is not compared. If
+// opts.IgnoreWhitespace is set, line endings and trailing whitespace of strings
+// are ignored. If opts.Normalize is set, it is run on both sides beforehand,
+// see v1alpha1.DiffSpec.
+func SubsetDiffer(c client.Client, opts CompareOpts) Differ {
+	return func(state manifest.List, diffOpts client.DiffOpts) (*string, error) {
 		docs := []difference{}
 
 		errCh := make(chan error)
 		resultCh := make(chan difference)
 
 		for _, rawShould := range state {
-			go parallelSubsetDiff(c, rawShould, resultCh, errCh)
+			go parallelSubsetDiff(c, rawShould, opts, resultCh, errCh)
 		}
 
 		var lastErr error
@@ -49,16 +65,23 @@ func SubsetDiffer(c client.Client) Differ {
 
 		var diffs string
 		for _, d := range docs {
-			diffStr, err := util.DiffStr(d.name, d.live, d.merged)
+			s, err := diffStr(diffOpts, d.name, d.live, d.merged)
 			if err != nil {
 				return nil, errors.Wrap(err, "invoking diff")
 			}
-			if diffStr != "" {
-				diffStr += "\n"
+			if s == "" {
+				continue
 			}
-			diffs += diffStr
+
+			// objects are separated by an empty line
+			if diffs != "" {
+				s = "\n" + s
+			}
+			if err := streamDiff(diffOpts.Out, s); err != nil {
+				return nil, err
+			}
+			diffs += s
 		}
-		diffs = strings.TrimSuffix(diffs, "\n")
 
 		if diffs == "" {
 			return nil, nil
@@ -68,8 +91,8 @@ func SubsetDiffer(c client.Client) Differ {
 	}
 }
 
-func parallelSubsetDiff(c client.Client, should manifest.Manifest, r chan difference, e chan error) {
-	diff, err := subsetDiff(c, should)
+func parallelSubsetDiff(c client.Client, should manifest.Manifest, opts CompareOpts, r chan difference, e chan error) {
+	diff, err := subsetDiff(c, should, opts)
 	if err != nil {
 		e <- err
 		return
@@ -77,9 +100,7 @@ func parallelSubsetDiff(c client.Client, should manifest.Manifest, r chan differ
 	r <- *diff
 }
 
-func subsetDiff(c client.Client, m manifest.Manifest) (*difference, error) {
-	name := util.DiffName(m)
-
+func subsetDiff(c client.Client, m manifest.Manifest, opts CompareOpts) (*difference, error) {
 	// kubectl output -> current state
 	rawIs, err := c.Get(
 		m.Metadata().Namespace(),
@@ -93,12 +114,23 @@ func subsetDiff(c client.Client, m manifest.Manifest) (*difference, error) {
 		return nil, errors.Wrap(err, "getting state from cluster")
 	}
 
-	should, err := yaml.Marshal(m)
+	return subsetDifference(m, rawIs, opts)
+}
+
+// subsetDifference computes the difference between m and the subset of the
+// live object rawIs, which is empty if the object does not exist yet
+func subsetDifference(m manifest.Manifest, rawIs map[string]interface{}, opts CompareOpts) (*difference, error) {
+	canonIs, canonShould, err := comparableSubset(m, rawIs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	should, err := yaml.Marshal(canonShould)
 	if err != nil {
 		return nil, err
 	}
 
-	is, err := yaml.Marshal(subset(m, rawIs))
+	is, err := yaml.Marshal(canonIs)
 	if err != nil {
 		return nil, err
 	}
@@ -107,12 +139,76 @@ func subsetDiff(c client.Client, m manifest.Manifest) (*difference, error) {
 	}
 
 	return &difference{
-		name:   name,
+		name:   util.DiffName(m),
 		live:   string(is),
 		merged: string(should),
 	}, nil
 }
 
+// comparableSubset prepares m and the live object rawIs for comparing them
+// like SubsetDiffer does: Both are normalized (see normalizePair), reduced to
+// their subset (see subsetPair) and, if opts.IgnoreWhitespace is set, have
+// their whitespace normalized
+func comparableSubset(m manifest.Manifest, rawIs map[string]interface{}, opts CompareOpts) (is, should map[string]interface{}, err error) {
+	m, rawIs, err = normalizePair(m, rawIs, opts.Normalize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	is, should = subsetPair(m, rawIs, opts)
+	if opts.IgnoreWhitespace {
+		is = normalizeWhitespace(is).(map[string]interface{})
+		should = normalizeWhitespace(should).(map[string]interface{})
+	}
+	return is, should, nil
+}
+
+// normalizePair runs the normalizer (if any) on both m and the live object
+// rawIs. An empty rawIs (the object does not exist yet) is left as is.
+func normalizePair(m manifest.Manifest, rawIs map[string]interface{}, normalize Normalizer) (manifest.Manifest, map[string]interface{}, error) {
+	if normalize == nil {
+		return m, rawIs, nil
+	}
+
+	should, err := normalize(m)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "normalizing %s", m.KindName())
+	}
+	if len(rawIs) == 0 {
+		return should, rawIs, nil
+	}
+
+	is, err := normalize(rawIs)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "normalizing live %s", m.KindName())
+	}
+	return should, is, nil
+}
+
+// subsetPair returns the subset of the live object rawIs and m, both
+// canonicalized so that they can be compared directly
+func subsetPair(m manifest.Manifest, rawIs map[string]interface{}, opts CompareOpts) (is, should map[string]interface{}) {
+	// fields the cluster maintains on its own
+	m = manifest.Manifest(stripServerFields(m, opts.IncludeStatus))
+	rawIs = stripServerFields(rawIs, opts.IncludeStatus)
+
+	// subset compares lists element by element, so these need to be in the
+	// same order beforehand
+	sortUnordered(m, opts.UnorderedLists)
+	sortUnordered(rawIs, opts.UnorderedLists)
+
+	// status is never set locally, so it would be dropped by subset. Keep the
+	// live one, to see how it differs from nothing
+	status, hasStatus := rawIs["status"]
+	sub := subset(m, rawIs)
+	if opts.IncludeStatus && hasStatus {
+		sub["status"] = status
+	}
+
+	// null, [] and {} vs absent fields are no difference
+	return canonicalize(sub, m, nil)
+}
+
 // subset removes all keys from is, that are not present in should.
 // It makes is a subset of should.
 // Kubernetes returns more keys than we can know about.
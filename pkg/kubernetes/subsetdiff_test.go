@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 )
 
 func TestSubset(t *testing.T) {
@@ -141,3 +144,35 @@ func TestSubset(t *testing.T) {
 		})
 	}
 }
+
+// TestSubsetNormalize checks that the Normalizer is run on both sides, so that
+// the annotation it strips makes no difference
+func TestSubsetNormalize(t *testing.T) {
+	annotated := func(scaled string) manifest.Manifest {
+		m := withReplicas(m("apps/v1", "Deployment", "grafana", "default"), 1)
+		m.Metadata()["annotations"] = map[string]interface{}{
+			"autoscaler.example.com/last-scaled": scaled,
+		}
+		return m
+	}
+
+	strip := func(obj map[string]interface{}) (map[string]interface{}, error) {
+		obj = copyMap(obj)
+		delete(obj["metadata"].(map[string]interface{}), "annotations")
+		return obj, nil
+	}
+
+	state := annotated("2020-06-02T08:30:00Z")
+	live := annotated("2020-06-01T12:00:00Z")
+
+	d, err := subsetDifference(state, copyMap(live), CompareOpts{})
+	require.NoError(t, err)
+	assert.NotEqual(t, d.live, d.merged)
+
+	d, err = subsetDifference(state, copyMap(live), CompareOpts{Normalize: strip})
+	require.NoError(t, err)
+	assert.Equal(t, d.live, d.merged)
+
+	// the state itself is left untouched
+	assert.Contains(t, state.Metadata(), "annotations")
+}
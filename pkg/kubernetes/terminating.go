@@ -0,0 +1,173 @@
+package kubernetes
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// defaultTerminatingTimeout is used by awaitGone if no timeout is given
+const defaultTerminatingTimeout = 2 * time.Minute
+
+// removeFinalizersPatch is the merge patch clearing `metadata.finalizers`
+var removeFinalizersPatch = []byte(`{"metadata":{"finalizers":null}}`)
+
+// StuckObject is a deleted object that is still terminating
+type StuckObject struct {
+	// `kind/name` of the object
+	Name string
+	// finalizers the object still has, including the spec.finalizers of
+	// Namespaces
+	Finalizers []string
+}
+
+// ErrorStuckTerminating means that deleted objects did not go away within
+// DeleteOpts.TerminatingTimeout, usually because the controllers responsible
+// for their finalizers did not complete them
+type ErrorStuckTerminating struct {
+	Objects []StuckObject
+	Timeout time.Duration
+}
+
+func (e ErrorStuckTerminating) Error() string {
+	s := fmt.Sprintf("%d object(s) still terminating after %s:\n", len(e.Objects), e.Timeout)
+	for _, o := range e.Objects {
+		finalizers := "none"
+		if len(o.Finalizers) > 0 {
+			finalizers = strings.Join(o.Finalizers, ", ")
+		}
+		s += fmt.Sprintf("  - %s (finalizers: %s)\n", o.Name, finalizers)
+	}
+	return s + "Check the controllers responsible for the finalizers, or remove them using --remove-finalizers (dangerous: the cleanup they stand for is skipped)"
+}
+
+// awaitGone polls the deleted objects until all of them are gone from the
+// cluster. Those still terminating after opts.TerminatingTimeout are returned
+// as stuck, unless opts.RemoveFinalizers is set: then their finalizers are
+// removed and they are waited for once more.
+func (k *Kubernetes) awaitGone(deleted manifest.List, opts DeleteOpts) ([]StuckObject, error) {
+	timeout := opts.terminatingTimeout()
+
+	left, err := k.pollGone(deleted, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.RemoveFinalizers {
+		return stuckObjects(left), nil
+	}
+
+	var stuck []StuckObject
+	var retry manifest.List
+	for _, t := range left {
+		if fs := namespaceFinalizers(t.live); len(fs) > 0 {
+			log.Printf("Warning: %s is held by spec.finalizers (%s), which only the namespace controller removes once all objects of the Namespace are gone. These are left alone.", t.m.KindName(), strings.Join(fs, ", "))
+		}
+
+		fs := finalizers(t.live)
+		if len(fs) == 0 {
+			stuck = append(stuck, t.stuck())
+			continue
+		}
+
+		log.Printf("Warning: removing the finalizers (%s) of %s, which is stuck terminating. The cleanup they stand for is skipped.", strings.Join(fs, ", "), t.m.KindName())
+		if err := k.ctl.Patch(t.m.Metadata().Namespace(), t.m.Kind(), t.m.Metadata().Name(), removeFinalizersPatch); err != nil {
+			if _, ok := err.(client.ErrorNotFound); ok {
+				continue
+			}
+			return nil, clusterErr(err)
+		}
+		retry = append(retry, t.m)
+	}
+
+	left, err = k.pollGone(retry, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return append(stuck, stuckObjects(left)...), nil
+}
+
+// terminatingObject is a deleted object along with its live state, which is
+// still terminating
+type terminatingObject struct {
+	m, live manifest.Manifest
+}
+
+func (t terminatingObject) stuck() StuckObject {
+	return StuckObject{
+		Name:       t.m.KindName(),
+		Finalizers: append(finalizers(t.live), namespaceFinalizers(t.live)...),
+	}
+}
+
+func stuckObjects(list []terminatingObject) []StuckObject {
+	var stuck []StuckObject
+	for _, t := range list {
+		stuck = append(stuck, t.stuck())
+	}
+	return stuck
+}
+
+// pollGone polls all of deleted at once, until they are gone. Those still
+// terminating once timeout passed are returned, in the order of deleted. An
+// object that is no longer terminating has been recreated (e.g. by its owner)
+// and counts as gone.
+func (k *Kubernetes) pollGone(deleted manifest.List, timeout time.Duration) ([]terminatingObject, error) {
+	deadline := time.Now().Add(timeout)
+	pending := deleted
+	for {
+		var left []terminatingObject
+		for _, m := range pending {
+			live, err := k.ctl.Get(m.Metadata().Namespace(), m.Kind(), m.Metadata().Name())
+			if _, ok := err.(client.ErrorNotFound); ok {
+				continue
+			}
+			if err != nil {
+				return nil, clusterErr(err)
+			}
+			if _, terminating := live.Metadata()["deletionTimestamp"]; !terminating {
+				continue
+			}
+			left = append(left, terminatingObject{m: m, live: live})
+		}
+
+		if len(left) == 0 || time.Now().After(deadline) {
+			return left, nil
+		}
+
+		pending = make(manifest.List, 0, len(left))
+		for _, t := range left {
+			pending = append(pending, t.m)
+		}
+		time.Sleep(waitForPollInterval)
+	}
+}
+
+// finalizers returns the `metadata.finalizers` of m
+func finalizers(m manifest.Manifest) []string {
+	list, _ := m.Metadata()["finalizers"].([]interface{})
+	return toStrings(list)
+}
+
+// namespaceFinalizers returns the `spec.finalizers` of m if it is a Namespace
+// (usually `kubernetes`). Unlike those of the metadata, these can't be
+// patched out, but only be removed using the `finalize` subresource.
+func namespaceFinalizers(m manifest.Manifest) []string {
+	if m.Kind() != "Namespace" {
+		return nil
+	}
+	spec, _ := m["spec"].(map[string]interface{})
+	list, _ := spec["finalizers"].([]interface{})
+	return toStrings(list)
+}
+
+func toStrings(list []interface{}) []string {
+	out := make([]string, 0, len(list))
+	for _, f := range list {
+		out = append(out, fmt.Sprint(f))
+	}
+	return out
+}
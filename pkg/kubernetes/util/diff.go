@@ -3,11 +3,11 @@ package util
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
@@ -15,66 +15,228 @@ import (
 
 // DiffName computes the filename for use with `DiffStr`
 func DiffName(m manifest.Manifest) string {
+	return DiffIdentity(m).String()
+}
+
+// Identity holds the components DiffName is made of. As `/` is replaced in
+// DiffName, `apps/v1` and `apps-v1` can't be told apart from the name alone,
+// so these should be used instead of parsing it.
+type Identity struct {
+	// Group is empty for the core group, e.g. for `v1`
+	Group   string
+	Version string
+
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// DiffIdentity returns the Identity of m
+func DiffIdentity(m manifest.Manifest) Identity {
+	return Identity{
+		Group:     m.Group(),
+		Version:   m.Version(),
+		Kind:      m.Kind(),
+		Namespace: m.Metadata().Namespace(),
+		Name:      m.Metadata().Name(),
+	}
+}
+
+// APIVersion joins group and version like `apiVersion` does
+func (i Identity) APIVersion() string {
+	if i.Group == "" {
+		return i.Version
+	}
+	return i.Group + "/" + i.Version
+}
+
+// String returns the DiffName
+func (i Identity) String() string {
 	return strings.Replace(fmt.Sprintf("%s.%s.%s.%s",
-		m.APIVersion(),
-		m.Kind(),
-		m.Metadata().Namespace(),
-		m.Metadata().Name(),
+		i.APIVersion(),
+		i.Kind,
+		i.Namespace,
+		i.Name,
 	), "/", "-", -1)
 }
 
-// DiffStr computes the differences between the strings `is` and `should` using the
-// UNIX `diff(1)` utility.
+// DiffStr computes the differences between the strings `is` and `should` in
+// the unified format of `diff -u -N`, without invoking any external tools
 func DiffStr(name, is, should string) (string, error) {
-	dir, err := ioutil.TempDir("", "diff")
-	if err != nil {
+	buf := bytes.Buffer{}
+	if err := DiffStrTo(&buf, name, is, should, false); err != nil {
 		return "", err
 	}
-	defer os.RemoveAll(dir)
+	return buf.String(), nil
+}
 
-	if err := ioutil.WriteFile(filepath.Join(dir, "LIVE-"+name), []byte(is), os.ModePerm); err != nil {
-		return "", err
+// DiffStrTo is like DiffStr, but writes the differences to w hunk by hunk.
+// With fullContext, the diff holds the entire objects as context instead of
+// only the lines around each change, so that both sides of the diff (see
+// Sides) are the full documents, e.g. for an external diff tool.
+func DiffStrTo(w io.Writer, name, is, should string, fullContext bool) error {
+	// most objects are unchanged, which needs no diff at all
+	if is == should {
+		return nil
 	}
-	if err := ioutil.WriteFile(filepath.Join(dir, "MERGED-"+name), []byte(should), os.ModePerm); err != nil {
-		return "", err
+	return unified(w, name, is, should, fullContext)
+}
+
+// Changes counts the objects of a diff by how they are changed
+type Changes struct {
+	Created, Updated, Deleted int
+}
+
+// Action is how a diff changes an object
+type Action string
+
+// Actions of ObjectChange
+const (
+	ActionCreated Action = "created"
+	ActionUpdated Action = "updated"
+	ActionDeleted Action = "deleted"
+)
+
+// ObjectChange is a single changed object of a diff
+type ObjectChange struct {
+	// Name of the changed file, which is the DiffName for diffs of DiffStr.
+	// `kubectl diff` names files `<group>.<version>.<kind>.<namespace>.<name>`
+	Name   string
+	Action Action
+}
+
+// FileDiff is the diff of a single object, as part of a unified diff
+type FileDiff struct {
+	// Name of the changed file, see ObjectChange
+	Name   string `json:"name"`
+	Action Action `json:"action"`
+
+	// number of added and removed lines
+	Insertions int `json:"insertions"`
+	Deletions  int `json:"deletions"`
+
+	// Diff is the part of the unified diff about this file, including its
+	// headers
+	Diff string `json:"diff,omitempty"`
+}
+
+// hunkHeader matches the header of a hunk, e.g. `@@ -1,4 +1,5 @@`. Omitted
+// counts are one.
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// DiffChanges classifies each file of the unified diff d (as produced by
+// DiffStr), see DiffObjects
+func DiffChanges(d string) Changes {
+	var c Changes
+	for _, o := range DiffObjects(d) {
+		switch o.Action {
+		case ActionCreated:
+			c.Created++
+		case ActionDeleted:
+			c.Deleted++
+		default:
+			c.Updated++
+		}
 	}
+	return c
+}
 
-	buf := bytes.Buffer{}
-	merged := filepath.Join(dir, "MERGED-"+name)
-	live := filepath.Join(dir, "LIVE-"+name)
-	cmd := exec.Command("diff", "-u", "-N", live, merged)
-	cmd.Stdout = &buf
-	err = cmd.Run()
-
-	// the diff utility exits with `1` if there are differences. We need to not fail there.
-	if exitError, ok := err.(*exec.ExitError); ok && err != nil {
-		if exitError.ExitCode() != 1 {
-			return "", err
+// DiffObjects classifies each file of the unified diff d (as produced by
+// DiffStr or `kubectl diff`), see ParseDiff
+func DiffObjects(d string) []ObjectChange {
+	var objects []ObjectChange
+	for _, f := range ParseDiff(d) {
+		objects = append(objects, ObjectChange{Name: f.Name, Action: f.Action})
+	}
+	return objects
+}
+
+// ParseDiff splits the unified diff d (as produced by DiffStr or `kubectl
+// diff`) into its files: Files only added to empty ones are created, those
+// emptied entirely are deleted and all others are updated.
+func ParseDiff(d string) []FileDiff {
+	var files []FileDiff
+	lines := strings.Split(strings.TrimSuffix(d, "\n"), "\n")
+
+	// the current file, starting at line start, and the remainder of the
+	// current hunk
+	var f FileDiff
+	var oldLines, newLines, oldLeft, newLeft int
+	start := -1
+	done := func(end int) {
+		if start < 0 {
+			return
+		}
+
+		f.Action = ActionUpdated
+		switch {
+		case oldLines == 0:
+			f.Action = ActionCreated
+		case newLines == 0:
+			f.Action = ActionDeleted
 		}
+		f.Diff = strings.Join(lines[start:end], "\n") + "\n"
+		files = append(files, f)
 	}
 
-	out := buf.String()
-	if out != "" {
-		out = fmt.Sprintf("diff -u -N %s %s\n%s", live, merged, out)
+	for i, l := range lines {
+		// hunk contents, which may look like headers as well
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(l, "-"):
+				oldLeft--
+				f.Deletions++
+			case strings.HasPrefix(l, "+"):
+				newLeft--
+				f.Insertions++
+			case strings.HasPrefix(l, "\\"):
+				// no newline at end of file
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(l, "--- "):
+			// the `diff` command line belongs to the file as well
+			next := i
+			if i > 0 && strings.HasPrefix(lines[i-1], "diff ") {
+				next = i - 1
+			}
+			done(next)
+
+			start, oldLines, newLines = next, 0, 0
+			f = FileDiff{Name: fileName(strings.TrimPrefix(l, "--- "))}
+		case hunkHeader.MatchString(l):
+			match := hunkHeader.FindStringSubmatch(l)
+			oldLeft, newLeft = hunkCount(match[1]), hunkCount(match[2])
+			oldLines += oldLeft
+			newLines += newLeft
+		}
 	}
+	done(len(lines))
 
-	return out, nil
+	return files
 }
 
-// Diffstat uses `diffstat(1)` utility to summarize a `diff(1)` output
-func Diffstat(d string) (*string, error) {
-	cmd := exec.Command("diffstat", "-C")
-	buf := bytes.Buffer{}
-	cmd.Stdout = &buf
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = strings.NewReader(d)
-
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("invoking diffstat(1): %s", err.Error())
+// fileName returns the name of the object of a `---` file header, which is
+// followed by a tab and the modification time. DiffStr prefixes the file with
+// `LIVE-`, while `kubectl diff` puts it into a `LIVE-*` directory.
+func fileName(header string) string {
+	if i := strings.Index(header, "\t"); i >= 0 {
+		header = header[:i]
 	}
+	return strings.TrimPrefix(filepath.Base(header), "LIVE-")
+}
 
-	out := buf.String()
-	return &out, nil
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
 }
 
 // FilteredErr is a filtered Stderr. If one of the regular expressions match, the current input is discarded.
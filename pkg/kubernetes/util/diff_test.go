@@ -0,0 +1,237 @@
+package util
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestDiffStrTo(t *testing.T) {
+	is := "replicas: 1\nimage: grafana\n"
+	should := "replicas: 3\nimage: grafana\n"
+
+	var buf bytes.Buffer
+	require.NoError(t, DiffStrTo(&buf, "apps-v1.Deployment.default.grafana", is, should, false))
+
+	str, err := DiffStr("apps-v1.Deployment.default.grafana", is, should)
+	require.NoError(t, err)
+
+	assert.Equal(t, `diff -u -N LIVE-apps-v1.Deployment.default.grafana MERGED-apps-v1.Deployment.default.grafana
+--- LIVE-apps-v1.Deployment.default.grafana
++++ MERGED-apps-v1.Deployment.default.grafana
+@@ -1,2 +1,2 @@
+-replicas: 1
++replicas: 3
+ image: grafana
+`, buf.String())
+	assert.Equal(t, str, buf.String())
+}
+
+func TestDiffStrToEqual(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, DiffStrTo(&buf, "v1.ConfigMap.default.grafana", "a: b\n", "a: b\n", false))
+
+	// no header without differences
+	assert.Empty(t, buf.String())
+}
+
+// TestDiffStrNative checks that no external diff tool is invoked
+func TestDiffStrNative(t *testing.T) {
+	defer func(r func(*exec.Cmd) error) { runDiff = r }(runDiff)
+	calls := 0
+	runDiff = func(cmd *exec.Cmd) error {
+		calls++
+		return cmd.Run()
+	}
+
+	d, err := DiffStr("v1.ConfigMap.default.grafana", "a: b\n", "a: b\n")
+	require.NoError(t, err)
+	assert.Empty(t, d)
+
+	d, err = DiffStr("v1.ConfigMap.default.grafana", "a: b\n", "a: c\n")
+	require.NoError(t, err)
+	assert.Contains(t, d, "-a: b\n+a: c\n")
+	assert.Equal(t, 0, calls)
+}
+
+const benchObject = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+  namespace: default
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - image: grafana/grafana:7.3.0
+        name: grafana
+`
+
+// BenchmarkDiffStrEqual diffs an unchanged object, which skips the diff
+// entirely
+func BenchmarkDiffStrEqual(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := DiffStr("apps-v1.Deployment.default.grafana", benchObject, benchObject); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDiffStr(b *testing.B) {
+	changed := strings.Replace(benchObject, "replicas: 1", "replicas: 3", 1)
+	for i := 0; i < b.N; i++ {
+		if _, err := DiffStr("apps-v1.Deployment.default.grafana", benchObject, changed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDiffChanges(t *testing.T) {
+	diff := func(is, should string) string {
+		d, err := DiffStr("v1.ConfigMap.default.grafana", is, should)
+		require.NoError(t, err)
+		return d
+	}
+
+	cases := []struct {
+		name string
+		diff string
+		want Changes
+	}{
+		{
+			name: "none",
+			diff: "",
+			want: Changes{},
+		},
+		{
+			name: "updated",
+			diff: diff("a: b\nc: d\n", "a: b\nc: e\n"),
+			want: Changes{Updated: 1},
+		},
+		{
+			name: "created",
+			diff: diff("", "a: b\nc: d\n"),
+			want: Changes{Created: 1},
+		},
+		{
+			name: "deleted",
+			diff: diff("a: b\n", ""),
+			want: Changes{Deleted: 1},
+		},
+		{
+			// removed lines looking like file headers must not start a new file
+			name: "headerLike",
+			diff: diff("-- a\n++ b\n", "") + diff("a: b\n", "a: c\n"),
+			want: Changes{Updated: 1, Deleted: 1},
+		},
+		{
+			name: "mixed",
+			diff: diff("", "a: b\n") + diff("a: b\n", "a: c\n") + diff("", "c: d\n"),
+			want: Changes{Created: 2, Updated: 1},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, DiffChanges(c.diff))
+		})
+	}
+}
+
+// TestDiffObjects checks that the changed objects are named after their files,
+// both those of DiffStr and `kubectl diff`
+func TestDiffObjects(t *testing.T) {
+	created, err := DiffStr("v1.ConfigMap.default.grafana", "", "a: b\n")
+	require.NoError(t, err)
+	updated, err := DiffStr("apps-v1.Deployment.default.grafana", "a: b\n", "a: c\n")
+	require.NoError(t, err)
+	unchanged, err := DiffStr("v1.Service.default.grafana", "a: b\n", "a: b\n")
+	require.NoError(t, err)
+
+	kubectl := `diff -u -N /tmp/LIVE-4211/apps.v1.StatefulSet.loki.ingester /tmp/MERGED-4211/apps.v1.StatefulSet.loki.ingester
+--- /tmp/LIVE-4211/apps.v1.StatefulSet.loki.ingester	2020-11-01 12:00:00.000000000 +0000
++++ /tmp/MERGED-4211/apps.v1.StatefulSet.loki.ingester	2020-11-01 12:00:00.000000000 +0000
+@@ -1 +1 @@
+-replicas: 1
++replicas: 2
+`
+
+	assert.Equal(t, []ObjectChange{
+		{Name: "v1.ConfigMap.default.grafana", Action: ActionCreated},
+		{Name: "apps-v1.Deployment.default.grafana", Action: ActionUpdated},
+		{Name: "apps.v1.StatefulSet.loki.ingester", Action: ActionUpdated},
+	}, DiffObjects(created+updated+unchanged+kubectl))
+	assert.Empty(t, DiffObjects(""))
+}
+
+// TestParseDiff checks that the diff is split into its files without loss
+func TestParseDiff(t *testing.T) {
+	updated, err := DiffStr("apps-v1.Deployment.default.grafana", "replicas: 1\nimage: grafana\n", "replicas: 3\nimage: grafana\n")
+	require.NoError(t, err)
+	deleted, err := DiffStr("v1.ConfigMap.default.grafana", "a: b\n-- c\n", "")
+	require.NoError(t, err)
+
+	files := ParseDiff(updated + deleted)
+	assert.Equal(t, []FileDiff{
+		{Name: "apps-v1.Deployment.default.grafana", Action: ActionUpdated, Insertions: 1, Deletions: 1, Diff: updated},
+		{Name: "v1.ConfigMap.default.grafana", Action: ActionDeleted, Deletions: 2, Diff: deleted},
+	}, files)
+	assert.Empty(t, ParseDiff(""))
+}
+
+func TestDiffIdentity(t *testing.T) {
+	cases := []struct {
+		name     string
+		manifest manifest.Manifest
+		want     Identity
+		diffName string
+	}{
+		{
+			name: "core",
+			manifest: manifest.Manifest{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "grafana", "namespace": "default"},
+			},
+			want:     Identity{Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "grafana"},
+			diffName: "v1.ConfigMap.default.grafana",
+		},
+		{
+			name: "grouped",
+			manifest: manifest.Manifest{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "grafana", "namespace": "default"},
+			},
+			want:     Identity{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "grafana"},
+			diffName: "apps-v1.Deployment.default.grafana",
+		},
+		{
+			name: "cluster-wide",
+			manifest: manifest.Manifest{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "ClusterRole",
+				"metadata":   map[string]interface{}{"name": "grafana"},
+			},
+			want:     Identity{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole", Name: "grafana"},
+			diffName: "rbac.authorization.k8s.io-v1.ClusterRole..grafana",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			id := DiffIdentity(c.manifest)
+			assert.Equal(t, c.want, id)
+			assert.Equal(t, c.manifest.APIVersion(), id.APIVersion())
+			assert.Equal(t, c.diffName, id.String())
+			assert.Equal(t, c.diffName, DiffName(c.manifest))
+		})
+	}
+}
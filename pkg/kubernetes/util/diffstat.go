@@ -0,0 +1,102 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffstatWidth is the width Diffstat scales its histogram to, like
+// `diffstat(1)` does by default
+const diffstatWidth = 80
+
+// DiffSummary totals the changes of a diff
+type DiffSummary struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+
+	Insertions int `json:"insertions"`
+	Deletions  int `json:"deletions"`
+}
+
+// Summarize totals the changes of files
+func Summarize(files []FileDiff) DiffSummary {
+	var s DiffSummary
+	for _, f := range files {
+		switch f.Action {
+		case ActionCreated:
+			s.Created++
+		case ActionDeleted:
+			s.Deleted++
+		default:
+			s.Updated++
+		}
+		s.Insertions += f.Insertions
+		s.Deletions += f.Deletions
+	}
+	return s
+}
+
+// Diffstat summarizes the unified diff d in the format of `diffstat(1)`: A
+// histogram of the added and removed lines of each file, followed by the
+// totals.
+func Diffstat(d string) (*string, error) {
+	files := ParseDiff(d)
+
+	nameWidth, maxChanges := 0, 0
+	for _, f := range files {
+		if len(f.Name) > nameWidth {
+			nameWidth = len(f.Name)
+		}
+		if n := f.Insertions + f.Deletions; n > maxChanges {
+			maxChanges = n
+		}
+	}
+	countWidth := len(fmt.Sprint(maxChanges))
+
+	// room left for the histogram, after ` <name> | <count> `
+	graphWidth := diffstatWidth - nameWidth - countWidth - 5
+	if graphWidth < 10 {
+		graphWidth = 10
+	}
+
+	buf := bytes.Buffer{}
+	for _, f := range files {
+		plus, minus := f.Insertions, f.Deletions
+		if total := plus + minus; total > graphWidth {
+			plus = scale(plus, total, graphWidth)
+			minus = scale(minus, total, graphWidth)
+		}
+		fmt.Fprintf(&buf, " %-*s | %*d %s%s\n", nameWidth, f.Name, countWidth, f.Insertions+f.Deletions,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+
+	s := Summarize(files)
+	fmt.Fprintf(&buf, " %s changed, %s, %s\n",
+		plural(len(files), "file"),
+		plural(s.Insertions, "insertion")+"(+)",
+		plural(s.Deletions, "deletion")+"(-)",
+	)
+
+	out := buf.String()
+	return &out, nil
+}
+
+// scale scales n of total to width, keeping non-zero counts visible
+func scale(n, total, width int) int {
+	if n == 0 {
+		return 0
+	}
+	if s := n * width / total; s > 0 {
+		return s
+	}
+	return 1
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
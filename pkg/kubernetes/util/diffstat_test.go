@@ -0,0 +1,46 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffstat(t *testing.T) {
+	updated, err := DiffStr("apps-v1.Deployment.default.grafana", "replicas: 1\nimage: grafana\n", "replicas: 3\nimage: grafana\n")
+	require.NoError(t, err)
+	created, err := DiffStr("v1.ConfigMap.default.grafana", "", "a: b\nc: d\n")
+	require.NoError(t, err)
+
+	s, err := Diffstat(updated + created)
+	require.NoError(t, err)
+	assert.Equal(t, ` apps-v1.Deployment.default.grafana | 2 +-
+ v1.ConfigMap.default.grafana       | 2 ++
+ 2 files changed, 3 insertions(+), 1 deletion(-)
+`, *s)
+}
+
+// TestDiffstatScaled checks that the histogram fits diffstatWidth
+func TestDiffstatScaled(t *testing.T) {
+	d, err := DiffStr("v1.ConfigMap.default.grafana", "a: b\n", strings.Repeat("c: d\n", 200))
+	require.NoError(t, err)
+
+	s, err := Diffstat(d)
+	require.NoError(t, err)
+	lines := strings.Split(*s, "\n")
+	assert.True(t, len(lines[0]) <= diffstatWidth, lines[0])
+	assert.True(t, strings.HasPrefix(lines[0], " v1.ConfigMap.default.grafana | 201 +++"), lines[0])
+	assert.True(t, strings.HasSuffix(lines[0], "+-"), lines[0])
+	assert.Equal(t, " 1 file changed, 200 insertions(+), 1 deletion(-)", lines[1])
+}
+
+func TestSummarize(t *testing.T) {
+	d, err := DiffStr("v1.ConfigMap.default.grafana", "a: b\n", "a: c\nd: e\n")
+	require.NoError(t, err)
+	deleted, err := DiffStr("v1.Service.default.grafana", "a: b\n", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, DiffSummary{Updated: 1, Deleted: 1, Insertions: 2, Deletions: 2}, Summarize(ParseDiff(d+deleted)))
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runDiff runs the command of an external diff tool
+var runDiff = (*exec.Cmd).Run
+
+// RenderDiff shows the unified diff d using the external diff tool (such as
+// `icdiff` or `diff -y`), which is given the command and its arguments. The
+// tool is run once per changed object on two files, LIVE-<name> and
+// MERGED-<name>, which hold the changed lines along with their context (see
+// Sides). To pass the entire objects, d must be computed with the full context
+// (see DiffStrTo).
+// Like diff(1), the tool may exit with status 1 if the files differ. The files
+// are created below tempDir, the system default if empty (see CheckTempDir).
+func RenderDiff(w io.Writer, tool []string, d, tempDir string) error {
+	if len(tool) == 0 {
+		return fmt.Errorf("no diff tool given")
+	}
+
+	dir, err := ioutil.TempDir(tempDir, "diff")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range ParseDiff(d) {
+		is, should := Sides(f)
+
+		live := filepath.Join(dir, "LIVE-"+f.Name)
+		merged := filepath.Join(dir, "MERGED-"+f.Name)
+		if err := ioutil.WriteFile(live, []byte(is), 0644); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(merged, []byte(should), 0644); err != nil {
+			return err
+		}
+
+		args := append(append([]string{}, tool[1:]...), live, merged)
+		cmd := exec.Command(tool[0], args...)
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+
+		// differences are no error
+		err := runDiff(cmd)
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("invoking %s: %s", tool[0], err)
+		}
+	}
+	return nil
+}
+
+// Sides returns the lines f removes and adds, along with their context, as
+// they are before and after the change. With the full context, these are the
+// entire documents.
+func Sides(f FileDiff) (is, should string) {
+	var a, b strings.Builder
+	inHunk := false
+
+	for _, l := range strings.SplitAfter(f.Diff, "\n") {
+		if hunkHeader.MatchString(l) {
+			inHunk = true
+			continue
+		}
+		if !inHunk || l == "" {
+			continue
+		}
+
+		switch l[0] {
+		case ' ':
+			a.WriteString(l[1:])
+			b.WriteString(l[1:])
+		case '-':
+			a.WriteString(l[1:])
+		case '+':
+			b.WriteString(l[1:])
+		}
+	}
+	return a.String(), b.String()
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderDiff checks that the tool is run once per changed object, on files
+// holding both sides
+func TestRenderDiff(t *testing.T) {
+	defer func(r func(*exec.Cmd) error) { runDiff = r }(runDiff)
+	var calls [][]string
+	runDiff = func(cmd *exec.Cmd) error {
+		files := cmd.Args[len(cmd.Args)-2:]
+		call := append([]string{}, cmd.Args[:len(cmd.Args)-2]...)
+		for _, f := range files {
+			data, err := ioutil.ReadFile(f)
+			require.NoError(t, err)
+			call = append(call, filepath.Base(f), string(data))
+		}
+		calls = append(calls, call)
+
+		_, err := cmd.Stdout.Write([]byte("rendered\n"))
+		return err
+	}
+
+	updated, err := DiffStr("v1.ConfigMap.default.grafana", "a: b\nc: d\n", "a: b\nc: e\n")
+	require.NoError(t, err)
+	created, err := DiffStr("v1.Service.default.grafana", "", "a: b\n")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, RenderDiff(&buf, []string{"icdiff", "--no-headers"}, updated+created, ""))
+	assert.Equal(t, "rendered\nrendered\n", buf.String())
+	assert.Equal(t, [][]string{
+		{"icdiff", "--no-headers",
+			"LIVE-v1.ConfigMap.default.grafana", "a: b\nc: d\n",
+			"MERGED-v1.ConfigMap.default.grafana", "a: b\nc: e\n"},
+		{"icdiff", "--no-headers",
+			"LIVE-v1.Service.default.grafana", "",
+			"MERGED-v1.Service.default.grafana", "a: b\n"},
+	}, calls)
+}
+
+func TestRenderDiffFailing(t *testing.T) {
+	d, err := DiffStr("v1.ConfigMap.default.grafana", "a: b\n", "a: c\n")
+	require.NoError(t, err)
+
+	// diff(1) exits with 1 on differences
+	var buf bytes.Buffer
+	require.NoError(t, RenderDiff(&buf, []string{"diff"}, d, ""))
+	assert.Contains(t, buf.String(), "< a: b\n---\n> a: c\n")
+
+	err = RenderDiff(&buf, []string{"tk-missing-diff-tool"}, d, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invoking tk-missing-diff-tool")
+
+	assert.EqualError(t, RenderDiff(&buf, nil, d, ""), "no diff tool given")
+}
+
+// TestSides checks that the unchanged parts between hunks are left out
+func TestSides(t *testing.T) {
+	is := text(numbered(20)...)
+	lines := numbered(20)
+	lines[0], lines[19] = "one", "twenty"
+	d, err := DiffStr("v1.ConfigMap.default.grafana", is, text(lines...))
+	require.NoError(t, err)
+
+	files := ParseDiff(d)
+	require.Len(t, files, 1)
+	live, merged := Sides(files[0])
+	assert.Equal(t, text("1", "2", "3", "4", "17", "18", "19", "20"), live)
+	assert.Equal(t, text("one", "2", "3", "4", "17", "18", "19", "twenty"), merged)
+}
+
+// TestSidesFullContext checks that the sides are the entire documents with the
+// full context
+func TestSidesFullContext(t *testing.T) {
+	is := text(numbered(20)...)
+	lines := numbered(20)
+	lines[0], lines[19] = "one", "twenty"
+	var buf bytes.Buffer
+	require.NoError(t, DiffStrTo(&buf, "v1.ConfigMap.default.grafana", is, text(lines...), true))
+
+	files := ParseDiff(buf.String())
+	require.Len(t, files, 1)
+	assert.Equal(t, 2, files[0].Insertions)
+	live, merged := Sides(files[0])
+	assert.Equal(t, is, live)
+	assert.Equal(t, text(lines...), merged)
+}
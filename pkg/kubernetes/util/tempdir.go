@@ -0,0 +1,46 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// CheckTempDir returns the absolute path of dir, for creating temporary files
+// (for diffing, and those of kubectl) below it instead of the system default,
+// e.g. because /tmp is noexec or full. Returns an error if dir is not a
+// writable directory. Empty stays empty, which means the system default, like
+// ioutil.TempDir and ioutil.TempFile take it.
+func CheckTempDir(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := checkWritable(abs); err != nil {
+		return "", fmt.Errorf("temporary directory `%s` can't be used: %s", dir, err)
+	}
+	return abs, nil
+}
+
+// checkWritable returns an error if no files can be created in dir
+func checkWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+
+	f, err := ioutil.TempFile(dir, "tk-writable-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderDiffTempDir checks that external diff tools are given files below
+// the given directory
+func TestRenderDiffTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tk-tmpdir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(r func(*exec.Cmd) error) { runDiff = r }(runDiff)
+	var files []string
+	runDiff = func(cmd *exec.Cmd) error {
+		files = cmd.Args[len(cmd.Args)-2:]
+		return cmd.Run()
+	}
+
+	d, err := DiffStr("v1.ConfigMap.default.grafana", "a: b\n", "a: c\n")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, RenderDiff(&buf, []string{"diff", "-u"}, d, dir))
+	assert.Contains(t, buf.String(), "-a: b\n+a: c\n")
+
+	require.Len(t, files, 2)
+	for _, f := range files {
+		assert.True(t, strings.HasPrefix(f, dir+string(filepath.Separator)), f)
+	}
+
+	// cleaned up afterwards
+	left, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, left)
+}
+
+func TestCheckTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tk-tmpdir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	got, err := CheckTempDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, got)
+
+	// the system default
+	got, err = CheckTempDir("")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	missing := filepath.Join(dir, "missing")
+	_, err = CheckTempDir(missing)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "temporary directory `"+missing+"` can't be used")
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	_, err = CheckTempDir(file)
+	assert.EqualError(t, err, "temporary directory `"+file+"` can't be used: not a directory")
+}
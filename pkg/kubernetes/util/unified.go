@@ -0,0 +1,286 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// contextLines is how many unchanged lines surround each change, like
+// `diff -u` does, unless the full context is requested
+const contextLines = 3
+
+// maxEditDistance bounds the work of editScript. Inputs differing by more
+// lines than this are diffed as replaced entirely, which is still a correct
+// (if longer) diff.
+const maxEditDistance = 1024
+
+// op is a single step of an edit script
+type op int
+
+const (
+	opEqual op = iota
+	opDelete
+	opInsert
+)
+
+// edit is a single line of an edit script, which is taken from a (opDelete,
+// opEqual) or b (opInsert)
+type edit struct {
+	op   op
+	a, b int
+}
+
+// unified writes the differences between is and should to w in the format of
+// `diff -u -N`, using LIVE-<name> and MERGED-<name> as file names. With
+// fullContext, all unchanged lines are context.
+func unified(w io.Writer, name, is, should string, fullContext bool) error {
+	a, b := splitLines(is), splitLines(should)
+	edits := editScript(a, b)
+
+	live, merged := "LIVE-"+name, "MERGED-"+name
+	if _, err := fmt.Fprintf(w, "diff -u -N %s %s\n--- %s\n+++ %s\n", live, merged, live, merged); err != nil {
+		return err
+	}
+
+	context := contextLines
+	if fullContext {
+		context = len(edits)
+	}
+	for _, h := range hunks(edits, context) {
+		if err := writeHunk(w, a, b, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLines splits s into lines, each of which keeps its trailing newline.
+// Only the last one may lack it.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript computes the shortest edit script turning a into b, using the
+// algorithm of Myers ("An O(ND) Difference Algorithm and Its Variations").
+// Common lines at the start and end are skipped beforehand, as most diffs
+// only change a few lines of a large object.
+func editScript(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, edit{op: opEqual, a: i, b: i})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix)...)
+	for i := suffix; i > 0; i-- {
+		edits = append(edits, edit{op: opEqual, a: len(a) - i, b: len(b) - i})
+	}
+	return edits
+}
+
+// myers returns the edit script of a and b, with line indices shifted by
+// offset
+func myers(a, b []string, offset int) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxEditDistance {
+		max = maxEditDistance
+	}
+
+	// v[k+max] is the furthest x reached on diagonal k. trace keeps the
+	// diagonals -d to d of v of each step d for backtracking
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	found := n == 0 && m == 0
+
+	for d := 0; d <= max && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+max] < v[k+1+max]) {
+				x = v[k+1+max]
+			} else {
+				x = v[k-1+max] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[k+max] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[max-d:max+d+1]...))
+	}
+
+	if !found {
+		return replaceAll(n, m, offset)
+	}
+
+	// walk back from (n, m) to (0, 0)
+	var rev []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+
+		var prevK int
+		if d == 0 {
+			prevK = 0
+		} else {
+			prev := trace[d-1]
+			if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+				prevK = k + 1
+			} else {
+				prevK = k - 1
+			}
+		}
+
+		prevX := 0
+		if d > 0 {
+			prevX = trace[d-1][prevK+d-1]
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			rev = append(rev, edit{op: opEqual, a: x + offset, b: y + offset})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, edit{op: opInsert, b: y + offset})
+		} else {
+			x--
+			rev = append(rev, edit{op: opDelete, a: x + offset})
+		}
+	}
+
+	edits := make([]edit, len(rev))
+	for i, e := range rev {
+		edits[len(rev)-1-i] = e
+	}
+	return edits
+}
+
+// replaceAll deletes all n lines of a and inserts all m lines of b
+func replaceAll(n, m, offset int) []edit {
+	edits := make([]edit, 0, n+m)
+	for i := 0; i < n; i++ {
+		edits = append(edits, edit{op: opDelete, a: i + offset})
+	}
+	for i := 0; i < m; i++ {
+		edits = append(edits, edit{op: opInsert, b: i + offset})
+	}
+	return edits
+}
+
+// hunks groups the changes of edits along with context unchanged lines around
+// each. Changes closer than twice the context share a hunk.
+func hunks(edits []edit, context int) [][]edit {
+	var out [][]edit
+
+	start, end := -1, -1
+	for i, e := range edits {
+		if e.op == opEqual {
+			continue
+		}
+
+		from := i - context
+		if from < 0 {
+			from = 0
+		}
+		if start >= 0 && from > end {
+			out = append(out, edits[start:end])
+			start = -1
+		}
+		if start < 0 {
+			start = from
+		}
+
+		end = i + 1 + context
+		if end > len(edits) {
+			end = len(edits)
+		}
+	}
+	if start >= 0 {
+		out = append(out, edits[start:end])
+	}
+	return out
+}
+
+// writeHunk writes the hunk h of the edit script of a and b
+func writeHunk(w io.Writer, a, b []string, h []edit) error {
+	// lines of a and b before the hunk. A side without lines in the hunk is
+	// empty altogether, as any line of it would be context.
+	aStart, bStart := 0, 0
+	aCount, bCount := 0, 0
+	for _, e := range h {
+		if e.op != opInsert {
+			if aCount == 0 {
+				aStart = e.a
+			}
+			aCount++
+		}
+		if e.op != opDelete {
+			if bCount == 0 {
+				bStart = e.b
+			}
+			bCount++
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount)); err != nil {
+		return err
+	}
+
+	for _, e := range h {
+		var prefix, line string
+		switch e.op {
+		case opEqual:
+			prefix, line = " ", a[e.a]
+		case opDelete:
+			prefix, line = "-", a[e.a]
+		case opInsert:
+			prefix, line = "+", b[e.b]
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n\\ No newline at end of file\n"
+		}
+		if _, err := io.WriteString(w, prefix+line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hunkRange formats the range of a hunk header, which is 1-based. Counts of
+// one are omitted and empty ranges name the line before them.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// numbered returns the lines `1` to `n`
+func numbered(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprint(i + 1)
+	}
+	return lines
+}
+
+func text(lines ...string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// TestUnified checks that the output equals that of `diff -u -N`
+func TestUnified(t *testing.T) {
+	long := numbered(20)
+	changed := append([]string{}, long...)
+	changed[1] = "two"
+	changed[17] = "eighteen"
+
+	cases := []struct {
+		name       string
+		is, should string
+		want       string
+	}{
+		{
+			name:   "middle",
+			is:     text(long[:10]...),
+			should: text(append(append([]string{}, long[:5]...), append([]string{"5a"}, long[5:10]...)...)...),
+			want: `@@ -3,6 +3,7 @@
+ 3
+ 4
+ 5
++5a
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			name:   "hunks",
+			is:     text(long...),
+			should: text(changed...),
+			want: `@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -15,6 +15,6 @@
+ 15
+ 16
+ 17
+-18
++eighteen
+ 19
+ 20
+`,
+		},
+		{
+			// changes up to twice the context apart share a hunk
+			name:   "adjacent",
+			is:     text(long[:10]...),
+			should: text(append(append([]string{}, changed[:8]...), "8a", "9", "10")...),
+			want: `@@ -1,10 +1,11 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+ 6
+ 7
+ 8
++8a
+ 9
+ 10
+`,
+		},
+		{
+			name:   "created",
+			is:     "",
+			should: "a: b\nc: d\n",
+			want: `@@ -0,0 +1,2 @@
++a: b
++c: d
+`,
+		},
+		{
+			name:   "deleted",
+			is:     "a: b\n",
+			should: "",
+			want: `@@ -1 +0,0 @@
+-a: b
+`,
+		},
+		{
+			name:   "noNewline",
+			is:     "a: b\nc: d",
+			should: "a: b\nc: e",
+			want: `@@ -1,2 +1,2 @@
+ a: b
+-c: d
+\ No newline at end of file
++c: e
+\ No newline at end of file
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := DiffStr("v1.ConfigMap.default.grafana", c.is, c.should)
+			require.NoError(t, err)
+
+			header := "diff -u -N LIVE-v1.ConfigMap.default.grafana MERGED-v1.ConfigMap.default.grafana\n" +
+				"--- LIVE-v1.ConfigMap.default.grafana\n" +
+				"+++ MERGED-v1.ConfigMap.default.grafana\n"
+			assert.Equal(t, header+c.want, d)
+		})
+	}
+}
+
+// TestEditScript checks that applying the edit script turns a into b, also
+// beyond maxEditDistance
+func TestEditScript(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []string
+	}{
+		{name: "empty"},
+		{name: "equal", a: numbered(5), b: numbered(5)},
+		{name: "reordered", a: []string{"a", "b", "c", "a", "b", "b", "a"}, b: []string{"c", "b", "a", "b", "a", "c"}},
+		{name: "replaced", a: numbered(maxEditDistance), b: strings.Split(strings.Repeat("x,", maxEditDistance), ",")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, e := range editScript(c.a, c.b) {
+				switch e.op {
+				case opEqual:
+					require.Equal(t, c.a[e.a], c.b[e.b])
+					got = append(got, c.a[e.a])
+				case opInsert:
+					got = append(got, c.b[e.b])
+				}
+			}
+			assert.Equal(t, c.b, got)
+		})
+	}
+}
+
+// TestEditScriptShortest checks that the edit script is minimal
+func TestEditScriptShortest(t *testing.T) {
+	a := []string{"a", "b", "c", "a", "b", "b", "a"}
+	b := []string{"c", "b", "a", "b", "a", "c"}
+
+	changes := 0
+	for _, e := range editScript(a, b) {
+		if e.op != opEqual {
+			changes++
+		}
+	}
+	assert.Equal(t, 5, changes)
+}
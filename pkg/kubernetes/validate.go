@@ -0,0 +1,63 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+)
+
+// ValidateDiffer returns a differ that does not compare against the cluster at
+// all. Instead, it validates each object against the cluster's schemas using a
+// server-side dry-run. Objects the server rejects are reported together, as a
+// process.ValidationError holding an ErrorSchemaViolations.
+func ValidateDiffer(c client.Client) Differ {
+	return func(state manifest.List, _ client.DiffOpts) (*string, error) {
+		var violations []SchemaViolation
+		for _, m := range state {
+			err := c.ValidateServerSide(manifest.List{m})
+			switch err.(type) {
+			case nil:
+			case client.ErrorInvalid:
+				violations = append(violations, SchemaViolation{Name: m.KindName(), Err: err})
+			default:
+				return nil, err
+			}
+		}
+
+		if len(violations) > 0 {
+			return nil, process.ValidationError{Err: ErrorSchemaViolations{Violations: violations}}
+		}
+		return nil, nil
+	}
+}
+
+// SchemaViolation is an object the server rejected during validation
+type SchemaViolation struct {
+	// Name of the object in `<kind>/<name>` format
+	Name string
+	// Err is the reason the server gave
+	Err error
+}
+
+// ErrorSchemaViolations occurs when objects do not match the schemas of the
+// cluster
+type ErrorSchemaViolations struct {
+	Violations []SchemaViolation
+
+	// MaxErrors limits how many violations are listed. Zero lists all of them
+	MaxErrors int
+}
+
+func (e ErrorSchemaViolations) Error() string {
+	s := fmt.Sprintf("%d object(s) failed validation:", len(e.Violations))
+	for i, v := range e.Violations {
+		if e.MaxErrors > 0 && i == e.MaxErrors {
+			s += fmt.Sprintf("\n  ... and %d more", len(e.Violations)-i)
+			break
+		}
+		s += fmt.Sprintf("\n  - %s: %s", v.Name, v.Err)
+	}
+	return s
+}
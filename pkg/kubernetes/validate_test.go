@@ -0,0 +1,92 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TestValidate checks that every object is validated on its own and that all
+// rejected ones are reported as a ValidationError, instead of a diff
+func TestValidate(t *testing.T) {
+	env := v1alpha1.New()
+	c := &fakeClient{
+		info:       client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		namespaces: map[string]bool{"default": true},
+		invalid:    map[string]bool{"Deployment/grafana": true},
+	}
+	k := Kubernetes{Env: *env, ctl: c, differs: map[string]Differ{
+		"validate": ValidateDiffer(c),
+	}}
+
+	state := manifest.List{
+		m("v1", "ConfigMap", "grafana", "default"),
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("v1", "Service", "grafana", "default"),
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		c.validated = nil
+		d, err := k.Diff(state, DiffOpts{Strategy: "validate"})
+		assert.Nil(t, d)
+
+		var verr process.ValidationError
+		require.True(t, errors.As(err, &verr), "expected ValidationError, got %T", err)
+
+		violations, ok := verr.Err.(ErrorSchemaViolations)
+		require.True(t, ok)
+		require.Len(t, violations.Violations, 1)
+		assert.Equal(t, "Deployment/grafana", violations.Violations[0].Name)
+
+		assert.Equal(t, []string{"ConfigMap/grafana", "Deployment/grafana", "Service/grafana"}, c.validated)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		c.validated = nil
+		d, err := k.Diff(state[:1], DiffOpts{Strategy: "validate"})
+		require.NoError(t, err)
+		assert.Nil(t, d)
+		assert.Equal(t, []string{"ConfigMap/grafana"}, c.validated)
+	})
+}
+
+// TestValidateMaxErrors checks that only the given amount of violations is
+// listed, followed by how many were left out
+func TestValidateMaxErrors(t *testing.T) {
+	env := v1alpha1.New()
+	c := &fakeClient{
+		info:       client.Info{ClientVersion: semver.MustParse("1.19.0")},
+		namespaces: map[string]bool{"default": true},
+		invalid:    map[string]bool{},
+	}
+	k := Kubernetes{Env: *env, ctl: c, differs: map[string]Differ{
+		"validate": ValidateDiffer(c),
+	}}
+
+	var state manifest.List
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		state = append(state, m("v1", "ConfigMap", name, "default"))
+		c.invalid["ConfigMap/"+name] = true
+	}
+
+	_, err := k.Diff(state, DiffOpts{Strategy: "validate", MaxErrors: 3})
+	require.Error(t, err)
+	assert.Regexp(t, `^5 object\(s\) failed validation:
+  - ConfigMap/a: .*
+  - ConfigMap/b: .*
+  - ConfigMap/c: .*
+  \.\.\. and 2 more$`, err.(process.ValidationError).Err.Error())
+
+	_, err = k.Diff(state, DiffOpts{Strategy: "validate"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "more")
+	assert.Contains(t, err.Error(), "ConfigMap/e")
+}
@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+)
+
+// waitForPollInterval is how often waitFor fetches the object
+var waitForPollInterval = time.Second
+
+// defaultWaitForTimeout is used by waitFor if no timeout is given
+const defaultWaitForTimeout = 5 * time.Minute
+
+// waitFor polls the live object of m until it meets all conditions (see
+// process.AnnotationWaitFor). An object that is not found yet is polled for as
+// well, as its creation may not have settled.
+func (k *Kubernetes) waitFor(m manifest.Manifest, conds []process.Condition, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultWaitForTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		state := ""
+		live, err := k.ctl.Get(m.Metadata().Namespace(), m.Kind(), m.Metadata().Name())
+		if err != nil {
+			state = err.Error()
+		} else if unmet := unmetConditions(live, conds); len(unmet) == 0 {
+			return nil
+		} else {
+			state = strings.Join(unmet, ", ")
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("waiting for %s to meet %s: timed out after %s: %s", m.KindName(), process.AnnotationWaitFor, timeout, state)
+		}
+		time.Sleep(waitForPollInterval)
+	}
+}
+
+// unmetConditions describes the conditions live does not meet, along with the
+// current value of the field
+func unmetConditions(live manifest.Manifest, conds []process.Condition) []string {
+	var unmet []string
+	for _, c := range conds {
+		if c.Met(live) {
+			continue
+		}
+
+		v, ok := live.Get(c.Path)
+		if !ok {
+			unmet = append(unmet, fmt.Sprintf("%s is not set", c.Path))
+			continue
+		}
+		unmet = append(unmet, fmt.Sprintf("%s is %v, wants %s", c.Path, v, c))
+	}
+	return unmet
+}
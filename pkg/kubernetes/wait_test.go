@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+)
+
+func cluster(phase string) manifest.Manifest {
+	c := m("example.com/v1", "Cluster", "etcd", "default")
+	if phase != "" {
+		c["status"] = map[string]interface{}{"phase": phase}
+	}
+	return c
+}
+
+// TestApplyWaitFor checks that objects declaring their readiness are polled
+// until they meet it, before the next wave is applied
+func TestApplyWaitFor(t *testing.T) {
+	defer func(i time.Duration) { waitForPollInterval = i }(waitForPollInterval)
+	waitForPollInterval = time.Millisecond
+
+	c := &fakeClient{
+		states: map[string]manifest.List{
+			"Cluster/etcd": {cluster(""), cluster("Pending"), cluster("Running")},
+		},
+	}
+	k := Kubernetes{ctl: c}
+
+	etcd := withWave(cluster(""), "0")
+	etcd.Metadata().Annotations()[process.AnnotationWaitFor] = "status.phase==Running"
+
+	_, err := k.Apply(manifest.List{
+		etcd,
+		withWave(m("apps/v1", "Deployment", "backup", "default"), "1"),
+	}, ApplyOpts{})
+	require.NoError(t, err)
+
+	// polled using Get, not the built-in checks
+	assert.Equal(t, []string{"apply Cluster/etcd", "apply Deployment/backup", "wait Deployment/backup"}, c.calls)
+	assert.Equal(t, cluster("Running"), c.states["Cluster/etcd"][0])
+}
+
+// TestApplyWaitForLastWave checks that the last wave is awaited as well, if it
+// declares its readiness
+func TestApplyWaitForLastWave(t *testing.T) {
+	defer func(i time.Duration) { waitForPollInterval = i }(waitForPollInterval)
+	waitForPollInterval = time.Millisecond
+
+	c := &fakeClient{
+		states: map[string]manifest.List{
+			"Cluster/etcd": {cluster(""), cluster("Pending"), cluster("Running")},
+		},
+	}
+	k := Kubernetes{ctl: c}
+
+	etcd := cluster("")
+	etcd.Metadata()["annotations"] = map[string]interface{}{process.AnnotationWaitFor: "status.phase==Running"}
+
+	_, err := k.Apply(manifest.List{etcd, m("v1", "ConfigMap", "config", "default")}, ApplyOpts{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"apply Cluster/etcd", "apply ConfigMap/config", "wait ConfigMap/config"}, c.calls)
+	assert.Equal(t, cluster("Running"), c.states["Cluster/etcd"][0])
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	defer func(i time.Duration) { waitForPollInterval = i }(waitForPollInterval)
+	waitForPollInterval = time.Millisecond
+
+	c := &fakeClient{
+		states: map[string]manifest.List{"Cluster/etcd": {cluster("Pending")}},
+	}
+	k := Kubernetes{ctl: c}
+
+	conds, err := process.ParseWaitFor("status.phase==Running")
+	require.NoError(t, err)
+	err = k.waitFor(cluster(""), conds, 10*time.Millisecond)
+	assert.EqualError(t, err, "waiting for Cluster/etcd to meet tanka.dev/wait-for: timed out after 10ms: status.phase is Pending, wants status.phase==Running")
+
+	// not found yet
+	err = k.waitFor(m("example.com/v1", "Cluster", "missing", "default"), conds, 10*time.Millisecond)
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// AnnotationApplyOptions overrides the apply options of the environment for a
+// single object. It holds a comma separated list of ApplyForce,
+// ApplyServerSide, ApplyClientSide and ApplyForceConflicts, e.g.
+// `server-side,force-conflicts`.
+const AnnotationApplyOptions = MetadataPrefix + "/apply-options"
+
+// AnnotationFieldManager sets the field manager of server-side apply for a
+// single object, e.g. because a controller co-owns it
+const AnnotationFieldManager = MetadataPrefix + "/field-manager"
+
+// Values of AnnotationApplyOptions
+const (
+	// replace the object if it can't be patched (`kubectl apply --force`)
+	ApplyForce = "force"
+	// use server-side apply
+	ApplyServerSide = "server-side"
+	// use client-side apply, even if the environment uses server-side apply
+	ApplyClientSide = "client-side"
+	// take ownership of fields also managed by others, using server-side apply
+	ApplyForceConflicts = "force-conflicts"
+)
+
+// ApplyOptions are the options an object overrides using
+// AnnotationApplyOptions and AnnotationFieldManager. Unset ones keep those of
+// the environment.
+type ApplyOptions struct {
+	Force bool
+	// ServerSide is nil unless either ApplyServerSide or ApplyClientSide is
+	// given
+	ServerSide     *bool
+	ForceConflicts bool
+	FieldManager   string
+}
+
+// ObjectApplyOptions returns the apply options m overrides
+func ObjectApplyOptions(m manifest.Manifest) (ApplyOptions, error) {
+	var opts ApplyOptions
+	opts.FieldManager, _ = annotation(m, AnnotationFieldManager)
+
+	list, ok := annotation(m, AnnotationApplyOptions)
+	if !ok {
+		return opts, nil
+	}
+
+	for _, o := range strings.Split(list, ",") {
+		switch o = strings.TrimSpace(o); o {
+		case ApplyForce:
+			opts.Force = true
+		case ApplyServerSide, ApplyClientSide:
+			serverSide := o == ApplyServerSide
+			if opts.ServerSide != nil && *opts.ServerSide != serverSide {
+				return opts, fmt.Errorf("%s: annotation %s can't hold both `%s` and `%s`", m.KindName(), AnnotationApplyOptions, ApplyServerSide, ApplyClientSide)
+			}
+			opts.ServerSide = &serverSide
+		case ApplyForceConflicts:
+			opts.ForceConflicts = true
+		case "":
+		default:
+			return opts, fmt.Errorf("%s: annotation %s holds unknown option `%s`, must be one of `%s`, `%s`, `%s` or `%s`", m.KindName(), AnnotationApplyOptions, o, ApplyForce, ApplyServerSide, ApplyClientSide, ApplyForceConflicts)
+		}
+	}
+
+	// kubectl rejects this
+	if opts.Force && opts.ServerSide != nil && *opts.ServerSide {
+		return opts, fmt.Errorf("%s: annotation %s can't hold both `%s` and `%s`", m.KindName(), AnnotationApplyOptions, ApplyForce, ApplyServerSide)
+	}
+	return opts, nil
+}
+
+// ValidateApplyOptions returns an error if any object has an
+// AnnotationApplyOptions that can't be parsed
+func ValidateApplyOptions(list manifest.List) error {
+	for _, m := range list {
+		if _, err := ObjectApplyOptions(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
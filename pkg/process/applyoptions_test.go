@@ -0,0 +1,83 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func applyOptionsObj(options, fieldManager string) manifest.Manifest {
+	m := manifest.Manifest(mkobj("Deployment", "grafana", "default"))
+	annotations := map[string]interface{}{AnnotationApplyOptions: options}
+	if fieldManager != "" {
+		annotations[AnnotationFieldManager] = fieldManager
+	}
+	m.Metadata()["annotations"] = annotations
+	return m
+}
+
+func TestObjectApplyOptions(t *testing.T) {
+	serverSide, clientSide := true, false
+
+	cases := []struct {
+		name         string
+		options      string
+		fieldManager string
+		want         ApplyOptions
+		err          string
+	}{
+		{
+			name:    "force",
+			options: "force",
+			want:    ApplyOptions{Force: true},
+		},
+		{
+			name:         "serverSide",
+			options:      "server-side, force-conflicts",
+			fieldManager: "hpa-controller",
+			want:         ApplyOptions{ServerSide: &serverSide, ForceConflicts: true, FieldManager: "hpa-controller"},
+		},
+		{
+			name:    "clientSide",
+			options: "client-side,",
+			want:    ApplyOptions{ServerSide: &clientSide},
+		},
+		{
+			name:    "unknown",
+			options: "force,prune",
+			err:     "Deployment/grafana: annotation tanka.dev/apply-options holds unknown option `prune`, must be one of `force`, `server-side`, `client-side` or `force-conflicts`",
+		},
+		{
+			name:    "bothSides",
+			options: "server-side,client-side",
+			err:     "Deployment/grafana: annotation tanka.dev/apply-options can't hold both `server-side` and `client-side`",
+		},
+		{
+			name:    "forceServerSide",
+			options: "force,server-side",
+			err:     "Deployment/grafana: annotation tanka.dev/apply-options can't hold both `force` and `server-side`",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ObjectApplyOptions(applyOptionsObj(c.options, c.fieldManager))
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+
+	// none at all
+	got, err := ObjectApplyOptions(manifest.Manifest(mkobj("Deployment", "grafana", "default")))
+	require.NoError(t, err)
+	assert.Equal(t, ApplyOptions{}, got)
+
+	assert.Error(t, ValidateApplyOptions(manifest.List{applyOptionsObj("replace", "")}))
+}
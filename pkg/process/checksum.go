@@ -0,0 +1,164 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// AnnotationChecksum holds the hash of all ConfigMaps and Secrets referenced by
+// a pod template, so that pods are restarted once their config changes
+const AnnotationChecksum = MetadataPrefix + "/config-checksum"
+
+// podTemplatePaths maps kinds to the location of their pod template
+var podTemplatePaths = map[string]string{
+	"Deployment":  "spec.template",
+	"StatefulSet": "spec.template",
+	"DaemonSet":   "spec.template",
+	"ReplicaSet":  "spec.template",
+	"Job":         "spec.template",
+	"CronJob":     "spec.jobTemplate.spec.template",
+}
+
+// Checksums annotates the pod template of each workload with a hash of the
+// ConfigMaps and Secrets it references. References are resolved within the
+// list only, objects without a namespace are in defaultNs. Workloads
+// referencing none of the objects in the list are left untouched.
+func Checksums(list manifest.List, defaultNs string) manifest.List {
+	configs := make(map[ref]manifest.Manifest)
+	for _, m := range list {
+		if m.Kind() != "ConfigMap" && m.Kind() != "Secret" {
+			continue
+		}
+		configs[ref{kind: m.Kind(), ns: namespaceOr(m, defaultNs), name: m.Metadata().Name()}] = m
+	}
+
+	for _, m := range list {
+		path, ok := podTemplatePaths[m.Kind()]
+		if !ok {
+			continue
+		}
+		v, _ := m.Get(path)
+		tpl, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		spec, ok := tpl["spec"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		ns := namespaceOr(m, defaultNs)
+		data := make(map[string]interface{})
+		for _, r := range podRefs(spec) {
+			r.ns = ns
+			c, ok := configs[r]
+			if !ok {
+				continue
+			}
+			data[r.kind+"/"+r.name] = map[string]interface{}{
+				"data":       c["data"],
+				"binaryData": c["binaryData"],
+				"stringData": c["stringData"],
+			}
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		// map keys are marshalled in sorted order, so this is stable
+		raw, err := json.Marshal(data)
+		if err != nil {
+			continue
+		}
+
+		meta, ok := tpl["metadata"].(map[string]interface{})
+		if !ok {
+			meta = make(map[string]interface{})
+			tpl["metadata"] = meta
+		}
+		manifest.Metadata(meta).Annotations()[AnnotationChecksum] = fmt.Sprintf("%x", sha256.Sum256(raw))
+	}
+
+	return list
+}
+
+// ref identifies a ConfigMap or Secret
+type ref struct {
+	kind, ns, name string
+}
+
+// podRefs returns all ConfigMaps and Secrets referenced by the pod spec, using
+// volumes, envFrom or env. The namespace is left empty.
+func podRefs(spec map[string]interface{}) []ref {
+	seen := make(map[ref]bool)
+	add := func(kind string, obj interface{}, field string) {
+		o, ok := obj.(map[string]interface{})
+		if !ok {
+			return
+		}
+		name, ok := o[field].(string)
+		if !ok || name == "" {
+			return
+		}
+		seen[ref{kind: kind, name: name}] = true
+	}
+
+	for _, v := range items(spec["volumes"]) {
+		add("ConfigMap", v["configMap"], "name")
+		add("Secret", v["secret"], "secretName")
+
+		projected, _ := v["projected"].(map[string]interface{})
+		for _, s := range items(projected["sources"]) {
+			add("ConfigMap", s["configMap"], "name")
+			add("Secret", s["secret"], "name")
+		}
+	}
+
+	containers := append(items(spec["containers"]), items(spec["initContainers"])...)
+	for _, c := range containers {
+		for _, e := range items(c["envFrom"]) {
+			add("ConfigMap", e["configMapRef"], "name")
+			add("Secret", e["secretRef"], "name")
+		}
+		for _, e := range items(c["env"]) {
+			from, _ := e["valueFrom"].(map[string]interface{})
+			add("ConfigMap", from["configMapKeyRef"], "name")
+			add("Secret", from["secretKeyRef"], "name")
+		}
+	}
+
+	refs := make([]ref, 0, len(seen))
+	for r := range seen {
+		refs = append(refs, r)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].kind != refs[j].kind {
+			return refs[i].kind < refs[j].kind
+		}
+		return refs[i].name < refs[j].name
+	})
+	return refs
+}
+
+// items returns the objects of a list, skipping anything else
+func items(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, i := range list {
+		if o, ok := i.(map[string]interface{}); ok {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+func namespaceOr(m manifest.Manifest, defaultNs string) string {
+	if ns := m.Metadata().Namespace(); ns != "" {
+		return ns
+	}
+	return defaultNs
+}
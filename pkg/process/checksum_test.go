@@ -0,0 +1,105 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func checksumFixture(data string) manifest.List {
+	return manifest.List{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "grafana-config"},
+			"data":       map[string]interface{}{"grafana.ini": data},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "grafana-admin", "namespace": "default"},
+			"stringData": map[string]interface{}{"password": "hunter2"},
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "grafana"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"volumes": []interface{}{
+							map[string]interface{}{
+								"name":      "config",
+								"configMap": map[string]interface{}{"name": "grafana-config"},
+							},
+						},
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name": "grafana",
+								"envFrom": []interface{}{
+									map[string]interface{}{
+										"secretRef": map[string]interface{}{"name": "grafana-admin"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "unrelated"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "unrelated"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func checksumOf(m manifest.Manifest) (string, bool) {
+	// annotation keys contain dots, so they can't be part of the path
+	meta, ok := m.Get(podTemplatePaths[m.Kind()] + ".metadata")
+	if !ok {
+		return "", false
+	}
+	sum, ok := manifest.Metadata(meta.(map[string]interface{})).Annotations()[AnnotationChecksum]
+	return sum, ok
+}
+
+func TestChecksums(t *testing.T) {
+	got := Checksums(checksumFixture("[server]"), "default")
+
+	sum, ok := checksumOf(got[2])
+	require.True(t, ok, "annotation missing")
+	assert.Len(t, sum, 64)
+
+	// no references, no annotation
+	_, ok = checksumOf(got[3])
+	assert.False(t, ok)
+
+	// stable
+	again := Checksums(checksumFixture("[server]"), "default")
+	sumAgain, _ := checksumOf(again[2])
+	assert.Equal(t, sum, sumAgain)
+
+	// changes with the referenced config
+	changed := Checksums(checksumFixture("[server]\nhttp_port = 3001"), "default")
+	sumChanged, _ := checksumOf(changed[2])
+	assert.NotEqual(t, sum, sumChanged)
+
+	// references are only resolved within the same namespace
+	other := Checksums(checksumFixture("[server]"), "monitoring")
+	sumOther, _ := checksumOf(other[2])
+	assert.NotEqual(t, sum, sumOther)
+}
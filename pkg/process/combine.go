@@ -0,0 +1,54 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// Combine merges the objects produced by multiple entrypoints into a single,
+// sorted list. Objects with the same identity (group, kind, namespace and name)
+// produced by more than one entrypoint are a collision, which is an error,
+// because only one of them could ever exist in the cluster.
+func Combine(sets map[string]manifest.List) (manifest.List, error) {
+	// deterministic order of entrypoints
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out manifest.List
+	owners := make(map[string]string)
+	for _, name := range names {
+		for _, m := range sets[name] {
+			id := identity(m)
+			if owner, ok := owners[id]; ok {
+				return nil, ValidationError{Err: ErrorCollision{Object: m.KindName(), Entrypoints: []string{owner, name}}}
+			}
+			owners[id] = name
+			out = append(out, m)
+		}
+	}
+
+	Sort(out)
+	return out, nil
+}
+
+// identity uniquely identifies an object in the cluster. The API version is
+// omitted, because the same object may be served by multiple versions.
+func identity(m manifest.Manifest) string {
+	return fmt.Sprintf("%s/%s/%s/%s", m.Group(), m.Kind(), m.Metadata().Namespace(), m.Metadata().Name())
+}
+
+// ErrorCollision occurs when multiple entrypoints produce the same object
+type ErrorCollision struct {
+	Object      string
+	Entrypoints []string
+}
+
+func (e ErrorCollision) Error() string {
+	return fmt.Sprintf("`%s` is produced by multiple entrypoints: %s", e.Object, strings.Join(e.Entrypoints, ", "))
+}
@@ -0,0 +1,73 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestCombine(t *testing.T) {
+	t.Run("distinct", func(t *testing.T) {
+		got, err := Combine(map[string]manifest.List{
+			"app.jsonnet": {
+				obj("apps/v1", "Deployment", "grafana", ""),
+			},
+			"infra.jsonnet": {
+				obj("v1", "Namespace", "monitoring", ""),
+				obj("v1", "Service", "grafana", ""),
+			},
+		})
+		require.NoError(t, err)
+
+		// sorted across entrypoints
+		assert.Equal(t, manifest.List{
+			obj("v1", "Namespace", "monitoring", ""),
+			obj("v1", "Service", "grafana", ""),
+			obj("apps/v1", "Deployment", "grafana", ""),
+		}, got)
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		_, err := Combine(map[string]manifest.List{
+			"app.jsonnet": {
+				obj("apps/v1", "Deployment", "grafana", "default"),
+			},
+			"infra.jsonnet": {
+				obj("v1", "Service", "grafana", "default"),
+			},
+			// same object, even though a different version
+			"legacy.jsonnet": {
+				obj("apps/v1beta1", "Deployment", "grafana", "default"),
+			},
+		})
+		assert.Equal(t, ValidationError{Err: ErrorCollision{
+			Object:      "Deployment/grafana",
+			Entrypoints: []string{"app.jsonnet", "legacy.jsonnet"},
+		}}, err)
+	})
+
+	t.Run("namespaces", func(t *testing.T) {
+		_, err := Combine(map[string]manifest.List{
+			"a.jsonnet": {obj("apps/v1", "Deployment", "grafana", "dev")},
+			"b.jsonnet": {obj("apps/v1", "Deployment", "grafana", "prod")},
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func obj(apiVersion, kind, name, namespace string) manifest.Manifest {
+	m := manifest.Manifest{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+	}
+	if namespace != "" {
+		m.Metadata()["namespace"] = namespace
+	}
+	return m
+}
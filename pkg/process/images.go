@@ -0,0 +1,100 @@
+package process
+
+import (
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// containerLists are the fields of a pod spec holding containers
+var containerLists = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// RewriteImages replaces the registry (or any other prefix) of the image of
+// each container according to rules, see v1alpha1.ImageRewrite. The first
+// matching rule wins.
+func RewriteImages(list manifest.List, rules []v1alpha1.ImageRewrite) manifest.List {
+	for _, m := range list {
+		path := "spec"
+		if tpl, ok := podTemplatePaths[m.Kind()]; ok {
+			path = tpl + ".spec"
+		} else if m.Kind() != "Pod" {
+			continue
+		}
+
+		for _, field := range containerLists {
+			containers, _ := m.Get(path + "." + field)
+			for _, c := range items(containers) {
+				image, ok := c["image"].(string)
+				if !ok {
+					continue
+				}
+				c["image"] = rewriteImage(image, rules)
+			}
+		}
+	}
+	return list
+}
+
+// rewriteImage applies the first matching rule to image. Only the repository
+// is matched, the tag or digest is kept as-is.
+func rewriteImage(image string, rules []v1alpha1.ImageRewrite) string {
+	repo, ref := splitImage(image)
+
+	for _, r := range rules {
+		for _, name := range []string{repo, qualifyImage(repo)} {
+			if rest, ok := trimRepoPrefix(name, r.From); ok {
+				return strings.TrimSuffix(r.To, "/") + rest + ref
+			}
+		}
+	}
+	return image
+}
+
+// splitImage splits an image into its repository and the `:tag` and/or
+// `@digest` following it
+func splitImage(image string) (repo, ref string) {
+	repo = image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo, ref = repo[:i], repo[i:]
+	}
+
+	// a colon before the last slash is the port of the registry
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, ref = repo[:i], repo[i:]+ref
+	}
+	return repo, ref
+}
+
+// qualifyImage returns the fully qualified name of repo, like the container
+// runtime resolves it: Without a registry, Docker Hub is implied, which keeps
+// official images in `library/`.
+func qualifyImage(repo string) string {
+	i := strings.Index(repo, "/")
+	if i < 0 {
+		return "docker.io/library/" + repo
+	}
+
+	host := repo[:i]
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return repo
+	}
+	return "docker.io/" + repo
+}
+
+// trimRepoPrefix returns the remainder of repo after prefix, which must end at
+// a path component
+func trimRepoPrefix(repo, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return "", false
+	}
+
+	if repo == prefix {
+		return "", true
+	}
+	if strings.HasPrefix(repo, prefix+"/") {
+		return repo[len(prefix):], true
+	}
+	return "", false
+}
@@ -0,0 +1,100 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+var imageRules = []v1alpha1.ImageRewrite{
+	{From: "quay.io/prometheus", To: "mirror.local/prometheus"},
+	{From: "docker.io", To: "mirror.local/dockerhub/"},
+	{From: "localhost:5000", To: "mirror.local/dev"},
+}
+
+func TestRewriteImage(t *testing.T) {
+	cases := map[string]string{
+		// tag
+		"quay.io/prometheus/prometheus:v2.20.0": "mirror.local/prometheus/prometheus:v2.20.0",
+		// digest
+		"quay.io/prometheus/node-exporter@sha256:cf66a6bbd573fd819ea09c72e21b528e9252d58d01ae13564a29749de1e48e0f": "mirror.local/prometheus/node-exporter@sha256:cf66a6bbd573fd819ea09c72e21b528e9252d58d01ae13564a29749de1e48e0f",
+		// tag and digest
+		"quay.io/prometheus/alertmanager:v0.21.0@sha256:24a5204b418e8fa0214cfb628486749003b039c279c7a6c5b3e5ad4a0e8fd2e3": "mirror.local/prometheus/alertmanager:v0.21.0@sha256:24a5204b418e8fa0214cfb628486749003b039c279c7a6c5b3e5ad4a0e8fd2e3",
+		// no tag
+		"quay.io/prometheus/pushgateway": "mirror.local/prometheus/pushgateway",
+
+		// implicit docker.io
+		"grafana/grafana:7.1.0":      "mirror.local/dockerhub/grafana/grafana:7.1.0",
+		"nginx:1.19":                 "mirror.local/dockerhub/library/nginx:1.19",
+		"docker.io/grafana/loki:1.6": "mirror.local/dockerhub/grafana/loki:1.6",
+
+		// registry with port
+		"localhost:5000/app:dev": "mirror.local/dev/app:dev",
+
+		// not matching: other registry, prefix not ending at a component
+		"gcr.io/google-containers/pause:3.2":   "gcr.io/google-containers/pause:3.2",
+		"quay.io/prometheus-operator/operator": "quay.io/prometheus-operator/operator",
+	}
+
+	for image, want := range cases {
+		assert.Equal(t, want, rewriteImage(image, imageRules), image)
+	}
+}
+
+func TestRewriteImages(t *testing.T) {
+	podSpec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"initContainers":      []interface{}{map[string]interface{}{"name": "init", "image": "busybox:1.32"}},
+			"containers":          []interface{}{map[string]interface{}{"name": "grafana", "image": "grafana/grafana:7.1.0"}},
+			"ephemeralContainers": []interface{}{map[string]interface{}{"name": "debug", "image": "gcr.io/distroless/base"}},
+		}
+	}
+
+	list := RewriteImages(manifest.List{
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "grafana"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{"spec": podSpec()},
+			},
+		},
+		{
+			"apiVersion": "batch/v1beta1",
+			"kind":       "CronJob",
+			"metadata":   map[string]interface{}{"name": "backup"},
+			"spec": map[string]interface{}{
+				"jobTemplate": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"template": map[string]interface{}{"spec": podSpec()},
+					},
+				},
+			},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   map[string]interface{}{"name": "debug"},
+			"spec":       podSpec(),
+		},
+	}, imageRules)
+
+	paths := map[string]string{
+		"Deployment": "spec.template.spec",
+		"CronJob":    "spec.jobTemplate.spec.template.spec",
+		"Pod":        "spec",
+	}
+	for _, m := range list {
+		path := paths[m.Kind()]
+
+		image, _ := m.Get(path + ".initContainers[0].image")
+		assert.Equal(t, "mirror.local/dockerhub/library/busybox:1.32", image, m.Kind())
+		image, _ = m.Get(path + ".containers[0].image")
+		assert.Equal(t, "mirror.local/dockerhub/grafana/grafana:7.1.0", image, m.Kind())
+		image, _ = m.Get(path + ".ephemeralContainers[0].image")
+		assert.Equal(t, "gcr.io/distroless/base", image, m.Kind())
+	}
+}
@@ -0,0 +1,45 @@
+package process
+
+import (
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// NamespaceLabels returns the labels of the Namespace of the environment
+// (spec.namespace): those of the environment, overridden by
+// spec.namespaceLabels, and tanka.dev/environment if spec.injectLabels is set
+func NamespaceLabels(cfg v1alpha1.Config) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range cfg.Metadata.Labels {
+		labels[k] = v
+	}
+	for k, v := range cfg.Spec.NamespaceLabels {
+		labels[k] = v
+	}
+	if cfg.Spec.InjectLabels {
+		labels[LabelEnvironment] = cfg.Metadata.NameLabel()
+	}
+	return labels
+}
+
+// LabelNamespace adds the NamespaceLabels to the Namespace of the environment,
+// if the list contains it. Labels the object already has are kept as they are.
+func LabelNamespace(list manifest.List, cfg v1alpha1.Config) manifest.List {
+	if cfg.Spec.Namespace == "" {
+		return list
+	}
+
+	for _, m := range list {
+		if m.Kind() != "Namespace" || m.Metadata().Name() != cfg.Spec.Namespace {
+			continue
+		}
+
+		labels := m.Metadata().Labels()
+		for k, v := range NamespaceLabels(cfg) {
+			if _, ok := labels[k]; !ok {
+				labels[k] = v
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,72 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func namespaceCfg() v1alpha1.Config {
+	cfg := v1alpha1.New()
+	cfg.Metadata.Name = "environments/loki"
+	cfg.Metadata.Labels = map[string]string{"team": "logging", "tier": "backend"}
+	cfg.Spec.Namespace = "loki"
+	cfg.Spec.InjectLabels = true
+	cfg.Spec.NamespaceLabels = map[string]string{
+		"pod-security.kubernetes.io/enforce": "restricted",
+		"pod-security.kubernetes.io/warn":    "restricted",
+		"tier":                               "storage",
+	}
+	return *cfg
+}
+
+func TestNamespaceLabels(t *testing.T) {
+	cfg := namespaceCfg()
+	assert.Equal(t, map[string]string{
+		"team":                               "logging",
+		"tier":                               "storage",
+		"pod-security.kubernetes.io/enforce": "restricted",
+		"pod-security.kubernetes.io/warn":    "restricted",
+		LabelEnvironment:                     cfg.Metadata.NameLabel(),
+	}, NamespaceLabels(cfg))
+
+	cfg.Spec.InjectLabels = false
+	assert.NotContains(t, NamespaceLabels(cfg), LabelEnvironment)
+}
+
+// TestLabelNamespace checks that the labels are merged into the Namespace of
+// the environment only, keeping the ones it already has
+func TestLabelNamespace(t *testing.T) {
+	cfg := namespaceCfg()
+
+	ns := manifest.Manifest(mkobj("Namespace", "loki", ""))
+	ns.Metadata()["labels"] = map[string]interface{}{
+		"pod-security.kubernetes.io/enforce": "baseline",
+		"owner":                              "loki",
+	}
+	other := manifest.Manifest(mkobj("Namespace", "cortex", ""))
+	cm := manifest.Manifest(mkobj("ConfigMap", "loki", "loki"))
+
+	list := LabelNamespace(Label(manifest.List{ns, other, cm}, cfg), cfg)
+
+	got := make(map[string]map[string]string)
+	for _, m := range list {
+		got[m.KindName()] = m.Metadata().Labels()
+	}
+
+	assert.Equal(t, map[string]string{
+		"owner":                              "loki",
+		"team":                               "logging",
+		"tier":                               "storage",
+		"pod-security.kubernetes.io/enforce": "baseline",
+		"pod-security.kubernetes.io/warn":    "restricted",
+		LabelEnvironment:                     cfg.Metadata.NameLabel(),
+	}, got["Namespace/loki"])
+
+	unmanaged := map[string]string{LabelEnvironment: cfg.Metadata.NameLabel()}
+	assert.Equal(t, unmanaged, got["Namespace/cortex"])
+	assert.Equal(t, unmanaged, got["ConfigMap/loki"])
+}
@@ -13,13 +13,19 @@ const (
 // Process converts the raw Jsonnet evaluation result (JSON tree) into a flat
 // list of Kubernetes objects, also applying some transformations:
 // - tanka.dev/** labels
+// - spec.namespaceLabels on the Namespace of the environment
+// - tanka.dev/config-checksum annotations, if enabled
+// - rewriting of container images, if configured
 // - filtering
-// - best-effort sorting
-func Process(raw map[string]interface{}, cfg v1alpha1.Config, exprs Matchers) (manifest.List, error) {
+// - best-effort sorting, by apply wave first
+//
+// Instead of the Jsonnet result, raw may also be a list of objects, e.g. as
+// returned by ParseStream
+func Process(raw interface{}, cfg v1alpha1.Config, exprs Matchers) (manifest.List, error) {
 	// Scan for everything that looks like a Kubernetes object
 	extracted, err := Extract(raw)
 	if err != nil {
-		return nil, err
+		return nil, ValidationError{Err: err}
 	}
 
 	out := make(manifest.List, 0, len(extracted))
@@ -27,8 +33,33 @@ func Process(raw map[string]interface{}, cfg v1alpha1.Config, exprs Matchers) (m
 		out = append(out, m)
 	}
 
+	if err := ValidateWaves(out); err != nil {
+		return nil, ValidationError{Err: err}
+	}
+	if err := ValidateSkip(out); err != nil {
+		return nil, ValidationError{Err: err}
+	}
+	if err := ValidateWaitFor(out); err != nil {
+		return nil, ValidationError{Err: err}
+	}
+	if err := ValidateApplyOptions(out); err != nil {
+		return nil, ValidationError{Err: err}
+	}
+
 	// tanka.dev/** labels
 	out = Label(out, cfg)
+	out = LabelNamespace(out, cfg)
+
+	// hash referenced config into pod templates. Runs before filtering, so
+	// that references to objects not targeted are still resolved
+	if cfg.Spec.ChecksumAnnotations {
+		out = Checksums(out, cfg.Spec.Namespace)
+	}
+
+	// pull images from elsewhere, e.g. a mirror
+	if len(cfg.Spec.ImageRewrite) > 0 {
+		out = RewriteImages(out, cfg.Spec.ImageRewrite)
+	}
 
 	// Perhaps filter for kind/name expressions
 	if len(exprs) > 0 {
@@ -41,6 +72,21 @@ func Process(raw map[string]interface{}, cfg v1alpha1.Config, exprs Matchers) (m
 	return out, nil
 }
 
+// ValidationError occurs when the evaluated Jsonnet (or any other input) does
+// not describe a valid set of Kubernetes objects
+type ValidationError struct {
+	Err error
+}
+
+func (e ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error, e.g. an ErrorPrimitiveReached
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
 // Label conditionally adds tanka.dev/** labels to each manifest in the List
 func Label(list manifest.List, cfg v1alpha1.Config) manifest.List {
 	for i, m := range list {
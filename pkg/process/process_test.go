@@ -54,6 +54,13 @@ func TestProcess(t *testing.T) {
 			},
 			targets: MustStrExps(`deployment/.*`),
 		},
+		{
+			name: "invalid",
+			deep: map[string]interface{}{
+				"note": "neither apiVersion nor kind",
+			},
+			err: ValidationError{Err: ErrorPrimitiveReached{path: ".", key: "note", primitive: "neither apiVersion nor kind"}},
+		},
 		{
 			name: "targets-caseInsensitive",
 			deep: testDataDeep().Deep,
@@ -0,0 +1,76 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// AnnotationSkip excludes an object from an operation, while it is still
+// shown and exported. Either SkipApply, SkipDiff or SkipAll.
+const AnnotationSkip = MetadataPrefix + "/skip"
+
+// Values of AnnotationSkip
+const (
+	// never applied (nor shown in the diff of apply)
+	SkipApply = "apply"
+	// never diffed
+	SkipDiff = "diff"
+	// neither applied nor diffed
+	SkipAll = "all"
+)
+
+// Skip returns the list without the objects that are annotated to skip op
+// (SkipApply or SkipDiff). The order is kept.
+func Skip(list manifest.List, op string) manifest.List {
+	out := make(manifest.List, 0, len(list))
+	for _, m := range list {
+		if s, _ := skip(m); s == op || s == SkipAll {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// ValidateSkip returns an error if any object has an AnnotationSkip of an
+// unknown value
+func ValidateSkip(list manifest.List) error {
+	for _, m := range list {
+		s, ok := skip(m)
+		if !ok {
+			continue
+		}
+
+		switch s {
+		case SkipApply, SkipDiff, SkipAll:
+		default:
+			return fmt.Errorf("%s: annotation %s must be one of `%s`, `%s` or `%s`, got `%s`", m.KindName(), AnnotationSkip, SkipApply, SkipDiff, SkipAll, s)
+		}
+	}
+	return nil
+}
+
+// skip returns the AnnotationSkip of m
+func skip(m manifest.Manifest) (string, bool) {
+	return annotation(m, AnnotationSkip)
+}
+
+// annotation returns the annotation key of m. Unlike Metadata().Annotations(),
+// m is not modified if it has no annotations
+func annotation(m manifest.Manifest, key string) (string, bool) {
+	meta, ok := m["metadata"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	switch a := meta["annotations"].(type) {
+	case map[string]interface{}:
+		s, ok := a[key].(string)
+		return s, ok
+	case map[string]string:
+		s, ok := a[key]
+		return s, ok
+	}
+	return "", false
+}
@@ -0,0 +1,40 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func skipobj(kind, name, skip string) manifest.Manifest {
+	m := manifest.Manifest(mkobj(kind, name, "default"))
+	if skip != "" {
+		m.Metadata()["annotations"] = map[string]interface{}{AnnotationSkip: skip}
+	}
+	return m
+}
+
+func TestSkip(t *testing.T) {
+	list := manifest.List{
+		skipobj("ConfigMap", "grafana", ""),
+		skipobj("Deployment", "grafana", SkipApply),
+		skipobj("Service", "grafana", SkipDiff),
+		skipobj("Ingress", "grafana", SkipAll),
+	}
+
+	assert.Equal(t, manifest.List{
+		skipobj("ConfigMap", "grafana", ""),
+		skipobj("Service", "grafana", SkipDiff),
+	}, Skip(list, SkipApply))
+
+	assert.Equal(t, manifest.List{
+		skipobj("ConfigMap", "grafana", ""),
+		skipobj("Deployment", "grafana", SkipApply),
+	}, Skip(list, SkipDiff))
+
+	assert.NoError(t, ValidateSkip(list))
+	assert.EqualError(t, ValidateSkip(manifest.List{skipobj("ConfigMap", "grafana", "show")}),
+		"ConfigMap/grafana: annotation tanka.dev/skip must be one of `apply`, `diff` or `all`, got `show`")
+}
@@ -46,11 +46,16 @@ var kindOrder = []string{
 
 // Sort orders manifests in a stable order, taking order-dependencies of these
 // into consideration. This is best-effort based:
+// - Lower apply waves (AnnotationApplyWave) first
 // - Use the static kindOrder list if possible
 // - Sort alphabetically by kind otherwise
 // - If kind equal, sort alphabetically by name
 func Sort(list manifest.List) {
 	sort.SliceStable(list, func(i int, j int) bool {
+		if wi, wj := Wave(list[i]), Wave(list[j]); wi != wj {
+			return wi < wj
+		}
+
 		var io, jo int
 
 		// anything that is not in kindOrder will get to the end of the install list.
@@ -86,3 +91,13 @@ func Sort(list manifest.List) {
 		return list[i].Metadata().Name() < list[j].Metadata().Name()
 	})
 }
+
+// SortReverse orders manifests the opposite way Sort does, which is the order
+// to delete them in: workloads and custom resources first, their Namespaces and
+// CustomResourceDefinitions last.
+func SortReverse(list manifest.List) {
+	Sort(list)
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+}
@@ -130,3 +130,20 @@ func mkobj(kind string, name string, ns string) map[string]interface{} {
 
 	return ret
 }
+
+func TestSortReverse(t *testing.T) {
+	list := manifest.List{
+		mkobj("Deployment", "deployment", "default"),
+		mkobj("Namespace", "default", ""),
+		mkobj("Issuer", "issuer", "default"),
+		mkobj("CustomResourceDefinition", "crd", ""),
+	}
+
+	SortReverse(list)
+	require.Equal(t, manifest.List{
+		mkobj("Issuer", "issuer", "default"),
+		mkobj("Deployment", "deployment", "default"),
+		mkobj("CustomResourceDefinition", "crd", ""),
+		mkobj("Namespace", "default", ""),
+	}, list)
+}
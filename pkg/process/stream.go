@@ -0,0 +1,47 @@
+package process
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ParseStream reads a stream of YAML documents (as produced by `tk show` or
+// `kubectl get -o yaml`) into a raw JSON tree that can be passed to Process in
+// place of the Jsonnet evaluation result. Empty documents are skipped.
+func ParseStream(r io.Reader) ([]interface{}, error) {
+	docs := []interface{}{}
+
+	d := yaml.NewDecoder(r)
+	for {
+		var doc interface{}
+		if err := d.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "parsing yaml")
+		}
+
+		if doc == nil {
+			continue
+		}
+
+		// round-trip through JSON, so that the types match those of the
+		// Jsonnet output
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, errors.Wrap(err, "converting yaml to json")
+		}
+
+		var jsonDoc interface{}
+		if err := json.Unmarshal(data, &jsonDoc); err != nil {
+			return nil, errors.Wrap(err, "converting yaml to json")
+		}
+
+		docs = append(docs, jsonDoc)
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,75 @@
+package process
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TestParseStream checks that a stream of pre-rendered manifests flows through
+// the regular processing (validation, sorting)
+func TestParseStream(t *testing.T) {
+	stream := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: monitoring
+`
+
+	raw, err := ParseStream(strings.NewReader(stream))
+	require.NoError(t, err)
+	require.Len(t, raw, 2)
+
+	got, err := Process(raw, *v1alpha1.New(), nil)
+	require.NoError(t, err)
+
+	// Namespace sorted first
+	assert.Equal(t, manifest.List{
+		{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "monitoring"},
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "grafana"},
+			"spec":       map[string]interface{}{"replicas": float64(1)},
+		},
+	}, got)
+}
+
+// TestParseStreamInvalid checks that objects of the stream are validated
+func TestParseStreamInvalid(t *testing.T) {
+	stream := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {}
+`
+
+	raw, err := ParseStream(strings.NewReader(stream))
+	require.NoError(t, err)
+
+	_, err = Process(raw, *v1alpha1.New(), nil)
+	var schemaErr *manifest.SchemaError
+	require.True(t, errors.As(err, &schemaErr), "expected SchemaError, got %T", err)
+	assert.True(t, schemaErr.Missing("metadata.name"))
+}
@@ -0,0 +1,118 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// AnnotationWaitFor declares when an object is ready, e.g. for custom
+// resources that have readiness semantics of their own. It holds conditions on
+// fields of the live object joined by `&&`, such as
+// `status.phase==Running && status.ready!=false`.
+const AnnotationWaitFor = MetadataPrefix + "/wait-for"
+
+// Condition is a single comparison of an AnnotationWaitFor expression
+type Condition struct {
+	// Path of the field, see manifest.Get
+	Path string
+	// Value to compare against. Strings are compared as-is, all other values
+	// using their JSON representation
+	Value string
+	// Negate requires the field not to be Value (`!=`)
+	Negate bool
+}
+
+func (c Condition) String() string {
+	op := "=="
+	if c.Negate {
+		op = "!="
+	}
+	return c.Path + op + c.Value
+}
+
+// Met returns whether m meets the condition. A missing field never does.
+func (c Condition) Met(m manifest.Manifest) bool {
+	v, ok := m.Get(c.Path)
+	if !ok {
+		return false
+	}
+	return (conditionValue(v) == c.Value) != c.Negate
+}
+
+// conditionValue returns v in the form Condition.Value is written in
+func conditionValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// ParseWaitFor parses an AnnotationWaitFor expression. Values may be quoted
+// using `"` or `'`, e.g. to compare against the string `"true"`. Each condition
+// is split at its first `==` or `!=`, so values may contain these operators,
+// but not `&&`.
+func ParseWaitFor(expr string) ([]Condition, error) {
+	var conds []Condition
+	for _, part := range strings.Split(expr, "&&") {
+		part = strings.TrimSpace(part)
+
+		c := Condition{}
+		op := "=="
+		i := strings.Index(part, op)
+		if j := strings.Index(part, "!="); j >= 0 && (i < 0 || j < i) {
+			c.Negate, op, i = true, "!=", j
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("condition `%s` must have the form `<field>==<value>` or `<field>!=<value>`", part)
+		}
+		c.Path = strings.TrimSpace(part[:i])
+		c.Value = unquote(strings.TrimSpace(part[i+len(op):]))
+		if c.Path == "" {
+			return nil, fmt.Errorf("condition `%s` lacks a field", part)
+		}
+		if err := manifest.ValidatePath(c.Path); err != nil {
+			return nil, fmt.Errorf("condition `%s`: %s", part, err)
+		}
+
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// WaitFor returns the conditions of the AnnotationWaitFor of m, if any
+func WaitFor(m manifest.Manifest) ([]Condition, error) {
+	expr, ok := annotation(m, AnnotationWaitFor)
+	if !ok {
+		return nil, nil
+	}
+	conds, err := ParseWaitFor(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: annotation %s: %s", m.KindName(), AnnotationWaitFor, err)
+	}
+	return conds, nil
+}
+
+// ValidateWaitFor returns an error if any object has an AnnotationWaitFor that
+// can't be parsed
+func ValidateWaitFor(list manifest.List) error {
+	for _, m := range list {
+		if _, err := WaitFor(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
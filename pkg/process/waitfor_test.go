@@ -0,0 +1,80 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestParseWaitFor(t *testing.T) {
+	conds, err := ParseWaitFor(`status.phase == Running && status.conditions[0].status!="False"`)
+	require.NoError(t, err)
+	assert.Equal(t, []Condition{
+		{Path: "status.phase", Value: "Running"},
+		{Path: "status.conditions[0].status", Value: "False", Negate: true},
+	}, conds)
+
+	// split at the first operator
+	conds, err = ParseWaitFor(`status.message=="a!=b" && status.reason!=a==b`)
+	require.NoError(t, err)
+	assert.Equal(t, []Condition{
+		{Path: "status.message", Value: "a!=b"},
+		{Path: "status.reason", Value: "a==b", Negate: true},
+	}, conds)
+
+	for _, expr := range []string{"status.phase", "==Running", "status..phase==Running", "status.phase==Running &&"} {
+		_, err := ParseWaitFor(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestConditionMet(t *testing.T) {
+	m := manifest.Manifest{
+		"status": map[string]interface{}{
+			"phase":    "Running",
+			"ready":    true,
+			"replicas": float64(3),
+		},
+	}
+
+	cases := map[string]bool{
+		"status.phase==Running":                       true,
+		"status.phase!=Running":                       false,
+		"status.phase==Pending":                       false,
+		"status.ready==true":                          true,
+		"status.ready=='true'":                        true,
+		"status.replicas==3":                          true,
+		"status.replicas!=1":                          true,
+		"status.missing==x":                           false,
+		"status.missing!=x":                           false,
+		"status.phase==Running && status.replicas==3": true,
+		"status.phase==Running && status.replicas==1": false,
+	}
+
+	for expr, want := range cases {
+		conds, err := ParseWaitFor(expr)
+		require.NoError(t, err, expr)
+
+		met := true
+		for _, c := range conds {
+			met = met && c.Met(m)
+		}
+		assert.Equal(t, want, met, expr)
+	}
+}
+
+func TestValidateWaitFor(t *testing.T) {
+	cr := manifest.Manifest{
+		"apiVersion": "example.com/v1",
+		"kind":       "Cluster",
+		"metadata": map[string]interface{}{
+			"name":        "etcd",
+			"annotations": map[string]interface{}{AnnotationWaitFor: "status.phase"},
+		},
+	}
+	err := ValidateWaitFor(manifest.List{cr})
+	assert.EqualError(t, err, "Cluster/etcd: annotation tanka.dev/wait-for: condition `status.phase` must have the form `<field>==<value>` or `<field>!=<value>`")
+}
@@ -0,0 +1,83 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// AnnotationApplyWave groups objects into waves, which are applied one after
+// another in ascending order. Objects without it are in wave 0.
+const AnnotationApplyWave = MetadataPrefix + "/apply-wave"
+
+// Wave returns the apply wave of m. Invalid values, which ValidateWaves
+// reports, are wave 0 as well.
+func Wave(m manifest.Manifest) int {
+	w, _ := wave(m)
+	return w
+}
+
+func wave(m manifest.Manifest) (int, error) {
+	meta, ok := m["metadata"].(map[string]interface{})
+	if !ok {
+		return 0, nil
+	}
+
+	var s string
+	switch a := meta["annotations"].(type) {
+	case map[string]interface{}:
+		v, ok := a[AnnotationApplyWave]
+		if !ok {
+			return 0, nil
+		}
+		if s, ok = v.(string); !ok {
+			return 0, fmt.Errorf("%s: annotation %s must be a string, got %T", m.KindName(), AnnotationApplyWave, v)
+		}
+	case map[string]string:
+		if s, ok = a[AnnotationApplyWave]; !ok {
+			return 0, nil
+		}
+	default:
+		return 0, nil
+	}
+
+	w, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: annotation %s must be an integer, got `%s`", m.KindName(), AnnotationApplyWave, s)
+	}
+	return w, nil
+}
+
+// ValidateWaves returns an error if any object has an apply wave that is not
+// an integer
+func ValidateWaves(list manifest.List) error {
+	for _, m := range list {
+		if _, err := wave(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waves splits the list into its apply waves, in ascending order. The order
+// of objects within a wave is kept.
+func Waves(list manifest.List) []manifest.List {
+	byWave := make(map[int]manifest.List)
+	var order []int
+	for _, m := range list {
+		w := Wave(m)
+		if _, ok := byWave[w]; !ok {
+			order = append(order, w)
+		}
+		byWave[w] = append(byWave[w], m)
+	}
+
+	sort.Ints(order)
+	waves := make([]manifest.List, 0, len(order))
+	for _, w := range order {
+		waves = append(waves, byWave[w])
+	}
+	return waves
+}
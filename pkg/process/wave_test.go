@@ -0,0 +1,49 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func waveobj(kind, name, wave string) manifest.Manifest {
+	m := manifest.Manifest(mkobj(kind, name, "default"))
+	if wave != "" {
+		m.Metadata()["annotations"] = map[string]interface{}{AnnotationApplyWave: wave}
+	}
+	return m
+}
+
+func TestWaves(t *testing.T) {
+	list := manifest.List{
+		waveobj("Service", "grafana", "1"),
+		waveobj("Deployment", "grafana", ""),
+		waveobj("ConfigMap", "grafana", "0"),
+		waveobj("Job", "migrate", "-1"),
+	}
+
+	// waves first, kinds within a wave
+	Sort(list)
+	assert.Equal(t, manifest.List{
+		waveobj("Job", "migrate", "-1"),
+		waveobj("ConfigMap", "grafana", "0"),
+		waveobj("Deployment", "grafana", ""),
+		waveobj("Service", "grafana", "1"),
+	}, list)
+
+	assert.Equal(t, []manifest.List{
+		{waveobj("Job", "migrate", "-1")},
+		{waveobj("ConfigMap", "grafana", "0"), waveobj("Deployment", "grafana", "")},
+		{waveobj("Service", "grafana", "1")},
+	}, Waves(list))
+}
+
+func TestValidateWaves(t *testing.T) {
+	require.NoError(t, ValidateWaves(manifest.List{waveobj("Job", "migrate", "-1")}))
+
+	err := ValidateWaves(manifest.List{waveobj("Job", "migrate", "first")})
+	assert.EqualError(t, err, "Job/migrate: annotation tanka.dev/apply-wave must be an integer, got `first`")
+}
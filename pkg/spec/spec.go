@@ -5,9 +5,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
 	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 )
 
@@ -18,7 +20,13 @@ const APIGroup = "tanka.dev"
 const Specfile = "spec.json"
 
 // ParseDir parses the given environments `spec.json` into a `v1alpha1.Config`
-// object with the name set to the directories name
+// object with the name set to the directories name. A relative
+// `spec.kubeconfig` is made absolute, using the directory of the `spec.json`
+// it is set in.
+//
+// The `spec.json` files of the parent directories up to the project root (see
+// jpath.FindRoot) are used as defaults, the closest one wins: Objects are
+// merged recursively, all other values are replaced.
 func ParseDir(baseDir, name string) (*v1alpha1.Config, error) {
 	fi, err := os.Stat(baseDir)
 	if err != nil {
@@ -28,7 +36,7 @@ func ParseDir(baseDir, name string) (*v1alpha1.Config, error) {
 		return nil, errors.New("baseDir is not an directory")
 	}
 
-	data, err := ioutil.ReadFile(filepath.Join(baseDir, Specfile))
+	merged, err := readSpec(baseDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			c := v1alpha1.New()
@@ -38,9 +46,179 @@ func ParseDir(baseDir, name string) (*v1alpha1.Config, error) {
 		return nil, err
 	}
 
+	for _, dir := range parentDirs(baseDir) {
+		defaults, err := readSpec(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		merged = mergeSpec(defaults, merged)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
 	return Parse(data, name)
 }
 
+// Sources returns the `spec.json` file each field of the spec of baseDir is
+// set in, keyed by the path of the field (e.g. `spec.namespace`), following
+// the same inheritance as ParseDir. Only fields set in any of the files are
+// included, objects are descended into, all other values are leaves.
+func Sources(baseDir string) (map[string]string, error) {
+	// farthest first, so that the closer ones override
+	dirs := append([]string{baseDir}, parentDirs(baseDir)...)
+
+	sources := make(map[string]string)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		file, err := filepath.Abs(filepath.Join(dirs[i], Specfile))
+		if err != nil {
+			return nil, err
+		}
+
+		msi, err := readSpec(dirs[i])
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		recordSources(sources, "", msi, file)
+	}
+
+	// always inferred from the directory, see ParseDir
+	delete(sources, "metadata.name")
+	return sources, nil
+}
+
+// recordSources sets the source of all leaves of obj to file, replacing those
+// of previous files like mergeSpec does
+func recordSources(sources map[string]string, prefix string, obj map[string]interface{}, file string) {
+	for k, v := range obj {
+		path := prefix + k
+		if o, ok := v.(map[string]interface{}); ok {
+			delete(sources, path)
+			recordSources(sources, path+".", o, file)
+			continue
+		}
+
+		for p := range sources {
+			if strings.HasPrefix(p, path+".") {
+				delete(sources, p)
+			}
+		}
+		sources[path] = file
+	}
+}
+
+// readSpec reads the `spec.json` of dir, making a relative `spec.kubeconfig`,
+// `spec.valuesFiles` and `spec.diff.normalize` absolute
+func readSpec(dir string) (map[string]interface{}, error) {
+	file := filepath.Join(dir, Specfile)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var msi map[string]interface{}
+	if err := json.Unmarshal(data, &msi); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", file)
+	}
+
+	if s, ok := msi["spec"].(map[string]interface{}); ok {
+		if err := absPath(s, "kubeconfig", dir); err != nil {
+			return nil, err
+		}
+		if err := absPaths(s, "valuesFiles", dir); err != nil {
+			return nil, err
+		}
+		if d, ok := s["diff"].(map[string]interface{}); ok {
+			if err := absPath(d, "normalize", dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return msi, nil
+}
+
+// absPath makes the relative path at key of obj absolute, relative to dir
+func absPath(obj map[string]interface{}, key, dir string) error {
+	p, ok := obj[key].(string)
+	if !ok || p == "" || filepath.IsAbs(p) {
+		return nil
+	}
+
+	abs, err := filepath.Abs(filepath.Join(dir, p))
+	if err != nil {
+		return err
+	}
+	obj[key] = abs
+	return nil
+}
+
+// absPaths is like absPath, but for a list of paths
+func absPaths(obj map[string]interface{}, key, dir string) error {
+	list, ok := obj[key].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	for i, v := range list {
+		p, ok := v.(string)
+		if !ok || p == "" || filepath.IsAbs(p) {
+			continue
+		}
+
+		abs, err := filepath.Abs(filepath.Join(dir, p))
+		if err != nil {
+			return err
+		}
+		list[i] = abs
+	}
+	return nil
+}
+
+// parentDirs returns the parent directories of baseDir up to and including
+// the project root, closest first. Without a project root, there are none.
+func parentDirs(baseDir string) []string {
+	abs, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil
+	}
+	root, err := jpath.FindRoot(abs)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for dir := abs; dir != root; {
+		dir = filepath.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// mergeSpec merges override into defaults. Objects are merged recursively,
+// other values of override replace those of defaults.
+func mergeSpec(defaults, override map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(defaults)+len(override))
+	for k, v := range defaults {
+		out[k] = v
+	}
+
+	for k, v := range override {
+		o, isObj := v.(map[string]interface{})
+		d, wasObj := out[k].(map[string]interface{})
+		if isObj && wasObj {
+			out[k] = mergeSpec(d, o)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
 // Parse parses the json `data` into a `v1alpha1.Config` object.
 // `name` is the name of the environment
 func Parse(data []byte, name string) (*v1alpha1.Config, error) {
@@ -0,0 +1,98 @@
+package spec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseDirKubeconfig checks that a relative kubeconfig is resolved against
+// the directory of the environment, while absolute ones are kept
+func TestParseDirKubeconfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tk-spec")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cases := map[string]string{
+		"kubeconfig":            filepath.Join(dir, "kubeconfig"),
+		"../clusters/prod.yaml": filepath.Join(filepath.Dir(dir), "clusters", "prod.yaml"),
+		"/etc/kubeconfig":       "/etc/kubeconfig",
+	}
+
+	for kubeconfig, want := range cases {
+		data := []byte(`{"spec": {"kubeconfig": "` + kubeconfig + `"}}`)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, Specfile), data, 0644))
+
+		got, err := ParseDir(dir, "test")
+		require.NoError(t, err)
+		assert.Equal(t, want, got.Spec.Kubeconfig, kubeconfig)
+	}
+}
+
+// TestParseDirParents checks that the spec.json files of the parent
+// directories up to the project root are merged into the one of the
+// environment, the closest one winning
+func TestParseDirParents(t *testing.T) {
+	root, err := ioutil.TempDir("", "tk-spec")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"tkrc.yaml": "",
+		"spec.json": `{
+			"metadata": {"labels": {"team": "infra", "tier": "root"}},
+			"spec": {"apiServer": "https://root:6443", "namespace": "default", "diffStrategy": "subset", "kubeconfig": "kubeconfig"}
+		}`,
+		// no spec.json in clusters/
+		"clusters/eu/spec.json": `{
+			"metadata": {"labels": {"tier": "eu"}},
+			"spec": {"apiServer": "https://eu:6443", "namespace": "eu"}
+		}`,
+		"clusters/eu/prod/spec.json": `{
+			"metadata": {"labels": {"tier": "prod"}},
+			"spec": {"namespace": "prod"}
+		}`,
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+
+	got, err := ParseDir(filepath.Join(root, "clusters/eu/prod"), "clusters/eu/prod")
+	require.NoError(t, err)
+
+	assert.Equal(t, "clusters/eu/prod", got.Metadata.Name)
+	assert.Equal(t, map[string]string{"team": "infra", "tier": "prod"}, got.Metadata.Labels)
+	assert.Equal(t, "https://eu:6443", got.Spec.APIServer)
+	assert.Equal(t, "prod", got.Spec.Namespace)
+	assert.Equal(t, "subset", got.Spec.DiffStrategy)
+	// relative to the spec.json it is set in
+	assert.Equal(t, filepath.Join(root, "kubeconfig"), got.Spec.Kubeconfig)
+
+	// each field is attributed to the closest spec.json setting it
+	sources, err := Sources(filepath.Join(root, "clusters/eu/prod"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"metadata.labels.team": filepath.Join(root, "spec.json"),
+		"metadata.labels.tier": filepath.Join(root, "clusters/eu/prod/spec.json"),
+		"spec.apiServer":       filepath.Join(root, "clusters/eu/spec.json"),
+		"spec.namespace":       filepath.Join(root, "clusters/eu/prod/spec.json"),
+		"spec.diffStrategy":    filepath.Join(root, "spec.json"),
+		"spec.kubeconfig":      filepath.Join(root, "spec.json"),
+	}, sources)
+
+	// the middle level is merged with the root only
+	got, err = ParseDir(filepath.Join(root, "clusters/eu"), "clusters/eu")
+	require.NoError(t, err)
+	assert.Equal(t, "eu", got.Spec.Namespace)
+	assert.Equal(t, "eu", got.Metadata.Labels["tier"])
+
+	// an environment needs a spec.json of its own
+	_, err = ParseDir(filepath.Join(root, "clusters"), "clusters")
+	assert.IsType(t, ErrNoSpec{}, err)
+}
@@ -29,8 +29,9 @@ type Config struct {
 
 // Metadata is meant for humans and not parsed
 type Metadata struct {
-	Name   string            `json:"name,omitempty"`
-	Labels map[string]string `json:"labels,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // Has and Get make Metadata a simple wrapper for labels.Labels to use our map in their querier
@@ -50,8 +51,75 @@ func (m Metadata) NameLabel() string {
 
 // Spec defines Kubernetes properties
 type Spec struct {
-	APIServer    string `json:"apiServer"`
-	Namespace    string `json:"namespace"`
-	DiffStrategy string `json:"diffStrategy,omitempty"`
-	InjectLabels bool   `json:"injectLabels,omitempty"`
+	APIServer    string   `json:"apiServer"`
+	Namespace    string   `json:"namespace"`
+	DiffStrategy string   `json:"diffStrategy,omitempty"`
+	InjectLabels bool     `json:"injectLabels,omitempty"`
+	Diff         DiffSpec `json:"diff,omitempty"`
+
+	// Entrypoints are the files (or glob patterns) relative to the
+	// environment's directory that are evaluated and combined. Defaults to
+	// `main.jsonnet`
+	Entrypoints []string `json:"entrypoints,omitempty"`
+
+	// Kubeconfig is used for all kubectl invocations instead of $KUBECONFIG.
+	// Relative paths are relative to the environment's directory
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+
+	// ChecksumAnnotations annotates pod templates with a hash of the
+	// ConfigMaps and Secrets they reference, so pods roll on config changes
+	ChecksumAnnotations bool `json:"checksumAnnotations,omitempty"`
+
+	// NamespaceLabels are added to the Namespace of spec.namespace, whether
+	// it is part of the environment or created by `tk apply
+	// --create-namespace`, e.g. for Pod Security Standards. Labels the
+	// Namespace object already sets are kept
+	NamespaceLabels map[string]string `json:"namespaceLabels,omitempty"`
+
+	// ValuesFiles are YAML or JSON files merged in order (objects recursively,
+	// other values are replaced) and exposed to Jsonnet as
+	// `std.extVar("tanka.dev/values")`, e.g. for cluster-specific replica
+	// counts. Relative paths are relative to the environment's directory
+	ValuesFiles []string `json:"valuesFiles,omitempty"`
+
+	// ImageRewrite replaces prefixes (e.g. the registry) of container images
+	// at render time. The first matching rule wins
+	ImageRewrite []ImageRewrite `json:"imageRewrite,omitempty"`
+}
+
+// ImageRewrite replaces the prefix From of container images by To. Prefixes
+// match whole path components of the repository, e.g. `docker.io` or
+// `quay.io/prometheus`. Images without a registry are matched as if
+// `docker.io` (and `library/` for official images) was given.
+type ImageRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DiffSpec configures `tk diff`
+type DiffSpec struct {
+	// IgnoreKinds are never diffed. Either `kind` or `group/kind`
+	IgnoreKinds []string `json:"ignoreKinds,omitempty"`
+
+	// UnorderedLists are compared regardless of the order of their elements.
+	// Maps the path of the list (e.g. `spec.template.spec.containers.env`) to
+	// the field identifying an element (e.g. `name`). An empty field compares
+	// the elements themselves, e.g. for `args`.
+	UnorderedLists map[string]string `json:"unorderedLists,omitempty"`
+
+	// IncludeStatus compares the `status` of objects as well, which is left
+	// out by default. Only affects the subset strategy and snapshots.
+	IncludeStatus bool `json:"includeStatus,omitempty"`
+
+	// IgnoreWhitespace ignores CRLF line endings and trailing whitespace of
+	// strings, which are compared as-is by default. Only affects the subset
+	// strategy and snapshots.
+	IgnoreWhitespace bool `json:"ignoreWhitespace,omitempty"`
+
+	// Normalize is a Jsonnet file evaluating to a function, which receives an
+	// object and returns it normalized (e.g. without annotations of some
+	// controller). It is applied to both the live and the desired object
+	// before comparing. Relative paths are relative to the environment's
+	// directory. Only affects the subset strategy and snapshots.
+	Normalize string `json:"normalize,omitempty"`
 }
@@ -0,0 +1,24 @@
+package tanka
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+)
+
+// renderCommand runs command (e.g. `tk show` of another Tanka version) to
+// obtain the manifests to diff against, as printed to stdout. The command is
+// run using runner, if set.
+func renderCommand(command []string, runner client.Runner) (io.Reader, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	out, err := client.Output(runner, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("running `%s` to diff against: %s", strings.Join(command, " "), err)
+	}
+
+	return bytes.NewReader(out), nil
+}
@@ -0,0 +1,93 @@
+package tanka
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const againstRender = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+data:
+  theme: dark
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: grafana
+spec:
+  ports:
+    - port: 3000
+`
+
+// fakeRender prints render like `tk show` would, recording the command
+func fakeRender(calls *[]string, render string) func(cmd *exec.Cmd) error {
+	return func(cmd *exec.Cmd) error {
+		*calls = append(*calls, strings.Join(cmd.Args, " "))
+		_, err := fmt.Fprint(cmd.Stdout, render)
+		return err
+	}
+}
+
+// TestDiffAgainstCommand checks that the state is diffed object-by-object
+// against what the command renders
+func TestDiffAgainstCommand(t *testing.T) {
+	var calls []string
+	diff := func(state, render string, mods ...Modifier) (*string, error) {
+		mods = append(mods,
+			WithManifests(strings.NewReader(state)),
+			WithDiffAgainstCommand([]string{"tk-old", "show", "environments/default"}),
+			func(opts *options) { opts.commandRunner = fakeRender(&calls, render) },
+		)
+		return Diff("testdata/project/environments/default", mods...)
+	}
+
+	// identical
+	d, err := diff(againstRender, againstRender)
+	require.NoError(t, err)
+	assert.Nil(t, d)
+	assert.Equal(t, []string{"tk-old show environments/default"}, calls)
+
+	// slightly different
+	changed := strings.Replace(againstRender, "theme: dark", "theme: light", 1)
+	d, err = diff(changed, againstRender)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Contains(t, *d, "v1.ConfigMap..grafana")
+	assert.Contains(t, *d, "-  theme: dark\n+  theme: light")
+	assert.NotContains(t, *d, "Service")
+
+	// objects only rendered by the command are deleted
+	configMap := strings.SplitN(againstRender, "---", 2)[0]
+	_, err = diff(configMap, againstRender, WithDiffFailOnDelete(true))
+	assert.Equal(t, ErrorDiffPolicy{Deleted: 1}, err)
+}
+
+func TestDiffAgainstCommandFails(t *testing.T) {
+	runner := func(cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, "Error: unknown command \"show\"")
+		return errors.New("exit status 1")
+	}
+
+	_, err := Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(againstRender)),
+		WithDiffAgainstCommand([]string{"tk-old", "show", "environments/default"}),
+		func(opts *options) { opts.commandRunner = runner },
+	)
+	assert.EqualError(t, err, "running `tk-old show environments/default` to diff against: exit status 1: Error: unknown command \"show\"")
+
+	_, err = Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(againstRender)),
+		WithDiffAgainstCommand([]string{"tk-old", "show", "environments/default"}),
+		WithDiffSnapshot(strings.NewReader(againstRender)),
+	)
+	assert.EqualError(t, err, "a snapshot and a command to diff against can't be combined")
+}
@@ -0,0 +1,91 @@
+package tanka
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/term"
+)
+
+// Delete removes all live objects from the environment's namespace that match
+// the label selector set using `WithDeleteSelector`. This is independent of
+// what Jsonnet currently produces, which is useful for removing retired
+// components.
+func Delete(baseDir string, mods ...Modifier) error {
+	opts := parseModifiers(mods)
+
+	if opts.selector == "" {
+		return errors.New("a label selector is required to delete objects")
+	}
+	if _, err := labels.Parse(opts.selector); err != nil {
+		return fmt.Errorf("parsing label selector: %s", err)
+	}
+
+	// no need to evaluate Jsonnet, we only need the cluster
+	env, _, err := loadEnv(baseDir)
+	if err != nil {
+		return err
+	}
+	kube, err := (&loaded{Env: env}).connect(opts)
+	if err != nil {
+		return err
+	}
+	defer kube.Close()
+
+	matched, err := kube.BySelector(opts.selector)
+	if err != nil {
+		return err
+	}
+
+	if len(matched) == 0 {
+		fmt.Println("Nothing found to delete.")
+		return nil
+	}
+
+	if opts.deleteDryRun {
+		fmt.Println("The following objects would be deleted:")
+		listDeletions(matched)
+		return nil
+	}
+
+	// preview
+	diff, err := kubernetes.StaticDiffer(false)(matched, client.DiffOpts{})
+	if err != nil {
+		return err
+	}
+	fmt.Print(term.Colordiff(*diff).String())
+
+	warnRemoveFinalizers(opts.delete)
+
+	// prompt for confirm
+	if opts.apply.AutoApprove {
+	} else if err := confirmPrompt("Deleting from", env.Spec.Namespace, kube.Info()); err != nil {
+		return err
+	}
+
+	// exactly the previewed objects, not those matching by now
+	return kube.Delete(matched, opts.delete)
+}
+
+// listDeletions prints the objects of list in the order they would be deleted
+func listDeletions(list manifest.List) {
+	for _, m := range kubernetes.DeleteOrder(list) {
+		fmt.Println(util.DiffName(m))
+	}
+}
+
+// warnRemoveFinalizers warns before deleting, if the finalizers of objects
+// stuck terminating are going to be removed
+func warnRemoveFinalizers(opts kubernetes.DeleteOpts) {
+	if !opts.RemoveFinalizers {
+		return
+	}
+	log.Println("Warning: the finalizers of objects stuck terminating are going to be removed. This skips the cleanup they stand for (e.g. of volumes or cloud resources), which may be left behind.")
+}
@@ -0,0 +1,151 @@
+package tanka
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const policySnapshot = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+data:
+  theme: dark
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: grafana
+spec:
+  ports:
+    - port: 3000
+`
+
+// TestDiffPolicy checks that WithDiffFailOnAdd and WithDiffFailOnDelete fail
+// the diff only if it creates or deletes objects, while still returning it
+func TestDiffPolicy(t *testing.T) {
+	const (
+		configMap = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: grafana\ndata:\n  theme: light\n"
+		service   = "apiVersion: v1\nkind: Service\nmetadata:\n  name: grafana\nspec:\n  ports:\n    - port: 3000\n"
+		ingress   = "apiVersion: networking.k8s.io/v1\nkind: Ingress\nmetadata:\n  name: grafana\n"
+	)
+
+	cases := []struct {
+		name      string
+		state     string
+		addErr    error
+		deleteErr error
+	}{
+		{
+			name:  "updated",
+			state: configMap + "---\n" + service,
+		},
+		{
+			name:   "created",
+			state:  configMap + "---\n" + service + "---\n" + ingress,
+			addErr: ErrorDiffPolicy{Added: 1},
+		},
+		{
+			name:      "deleted",
+			state:     configMap,
+			deleteErr: ErrorDiffPolicy{Deleted: 1},
+		},
+	}
+
+	diff := func(state string, mods ...Modifier) (*string, error) {
+		mods = append(mods,
+			WithManifests(strings.NewReader(state)),
+			WithDiffSnapshot(strings.NewReader(policySnapshot)),
+		)
+		return Diff("testdata/project/environments/default", mods...)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := diff(c.state)
+			require.NoError(t, err)
+			require.NotNil(t, d)
+
+			d, err = diff(c.state, WithDiffFailOnAdd(true))
+			assert.Equal(t, c.addErr, err)
+			assert.NotNil(t, d)
+
+			d, err = diff(c.state, WithDiffFailOnDelete(true))
+			assert.Equal(t, c.deleteErr, err)
+			assert.NotNil(t, d)
+		})
+	}
+
+	// both combined
+	_, err := diff(service+"---\n"+ingress, WithDiffFailOnAdd(true), WithDiffFailOnDelete(true))
+	assert.Equal(t, ErrorDiffPolicy{Added: 1, Deleted: 1}, err)
+	assert.EqualError(t, err, "the diff creates 1 and deletes 1 object(s), which is forbidden")
+}
+
+// TestDiffLastApplied checks that the state is compared against the
+// last-applied-configuration of the snapshot objects
+func TestDiffLastApplied(t *testing.T) {
+	const snapshot = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: '{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"grafana"},"data":{"theme":"dark"}}'
+data:
+  theme: dark
+  managedByController: "true"
+`
+	state := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: grafana\ndata:\n  theme: dark\n"
+
+	d, err := Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(state)),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+		WithDiffLastApplied(true),
+	)
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	_, err = Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(state)),
+		WithDiffLastApplied(true),
+	)
+	assert.Error(t, err)
+}
+
+// TestDiffNormalize checks that spec.diff.normalize is applied to both the
+// state and the snapshot, so that the annotation it strips makes no difference
+func TestDiffNormalize(t *testing.T) {
+	const snapshot = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+  annotations:
+    autoscaler.example.com/last-scaled: "2020-06-01T12:00:00Z"
+spec:
+  replicas: 1
+`
+	state := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: grafana\n  annotations:\n    autoscaler.example.com/last-scaled: '2020-06-02T08:30:00Z'\nspec:\n  replicas: 1\n"
+
+	d, err := Diff("testdata/project/environments/normalize",
+		WithManifests(strings.NewReader(state)),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+	)
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	// other changes are still reported
+	d, err = Diff("testdata/project/environments/normalize",
+		WithManifests(strings.NewReader(strings.Replace(state, "replicas: 1", "replicas: 2", 1))),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+	)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Contains(t, *d, "+  replicas: 2")
+	assert.NotContains(t, *d, "autoscaler.example.com")
+}
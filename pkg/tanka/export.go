@@ -0,0 +1,358 @@
+package tanka
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+const (
+	// DefaultExportFormat is the default template for the names of exported
+	// files
+	DefaultExportFormat = "{{.apiVersion}}.{{.kind}}-{{.metadata.name}}"
+	// DefaultExportExtension is the default extension of exported files
+	DefaultExportExtension = "yaml"
+)
+
+// Sink receives the files written by Export. Paths are relative and use
+// forward slashes.
+type Sink interface {
+	Write(path string, data []byte) error
+}
+
+// PruningSink is a Sink that knows the files it holds already, so that Export
+// can remove those it no longer produces (see WithExportPrune) and PlanExport
+// can tell which ones it changes
+type PruningSink interface {
+	Sink
+	// List returns the paths of all files the sink holds
+	List() ([]string, error)
+	// Read returns the contents of the file at path
+	Read(path string) ([]byte, error)
+	// Remove deletes the file at path
+	Remove(path string) error
+}
+
+// SinkOpener opens the Sink at location, which is the target given to
+// OpenSink with the `<scheme>://` prefix removed
+type SinkOpener func(location string) (Sink, error)
+
+var (
+	sinksMu sync.Mutex
+	sinks   = map[string]SinkOpener{
+		"file": OpenDirSink,
+	}
+)
+
+// RegisterSink makes sinks of a scheme available to OpenSink, so that
+// `<scheme>://<location>` targets are opened using open. Registering a scheme
+// again replaces it.
+func RegisterSink(scheme string, open SinkOpener) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks[scheme] = open
+}
+
+// OpenSink opens the Sink the target refers to. Targets of the form
+// `<scheme>://<location>` use the sink registered for the scheme, all others
+// are directories of the local filesystem.
+func OpenSink(target string) (Sink, error) {
+	scheme, location := "file", target
+	if i := strings.Index(target, "://"); i > 0 {
+		scheme, location = target[:i], target[i+len("://"):]
+	}
+
+	sinksMu.Lock()
+	open, ok := sinks[scheme]
+	sinksMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no sink registered for `%s://`", scheme)
+	}
+	return open(location)
+}
+
+// OpenPruningSink is like OpenSink, but directories of the local filesystem
+// may hold files already, which the export replaces. Sinks of other schemes
+// must implement PruningSink.
+func OpenPruningSink(target string) (PruningSink, error) {
+	if i := strings.Index(target, "://"); i < 0 {
+		return DirSink(target), nil
+	} else if target[:i] == "file" {
+		return DirSink(target[i+len("://"):]), nil
+	}
+
+	sink, err := OpenSink(target)
+	if err != nil {
+		return nil, err
+	}
+	ps, ok := sink.(PruningSink)
+	if !ok {
+		return nil, fmt.Errorf("the sink of `%s` can't list its files", target)
+	}
+	return ps, nil
+}
+
+// DirSink writes files below a directory of the local filesystem
+type DirSink string
+
+// OpenDirSink returns a DirSink for dir, which must be empty. It is created if
+// it does not exist yet.
+func OpenDirSink(dir string) (Sink, error) {
+	empty, err := dirEmpty(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Checking target dir: %s", err)
+	}
+	if !empty {
+		return nil, fmt.Errorf("Target dir `%s` not empty. Aborting.", dir)
+	}
+	return DirSink(dir), nil
+}
+
+// Write writes data to path below the directory. Missing parent directories
+// are created.
+func (d DirSink) Write(path string, data []byte) error {
+	name := filepath.Join(string(d), filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// List returns the paths of the files directly in the directory. Exported
+// names never contain slashes, so subdirectories (e.g. `.git` or those of
+// other tools) are left alone. A missing directory holds no files.
+func (d DirSink) List() ([]string, error) {
+	infos, err := ioutil.ReadDir(string(d))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, info := range infos {
+		if !info.IsDir() {
+			paths = append(paths, info.Name())
+		}
+	}
+	return paths, nil
+}
+
+// Read returns the contents of the file at path below the directory
+func (d DirSink) Read(path string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(path)))
+}
+
+// Remove deletes the file at path below the directory
+func (d DirSink) Remove(path string) error {
+	return os.Remove(filepath.Join(string(d), filepath.FromSlash(path)))
+}
+
+func dirEmpty(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return true, os.MkdirAll(dir, os.ModePerm)
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+// MemorySink keeps the written files in memory, e.g. for tests
+type MemorySink struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemorySink returns an empty MemorySink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{files: make(map[string][]byte)}
+}
+
+// Write stores data at path, replacing what was written there before
+func (m *MemorySink) Write(path string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[path] = append([]byte(nil), data...)
+	return nil
+}
+
+// Files returns the paths of all written files, sorted
+func (m *MemorySink) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for p := range m.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// List returns the paths of all written files, sorted
+func (m *MemorySink) List() ([]string, error) {
+	return m.Files(), nil
+}
+
+// Read returns the data written to path
+func (m *MemorySink) Read(path string) ([]byte, error) {
+	data, ok := m.Get(path)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+// Remove forgets the file at path
+func (m *MemorySink) Remove(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[path]; !ok {
+		return os.ErrNotExist
+	}
+	delete(m.files, path)
+	return nil
+}
+
+// Get returns the data written to path, if any
+func (m *MemorySink) Get(path string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[path]
+	return data, ok
+}
+
+var exportFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+}
+
+// Export parses the environment at the given directory (a `baseDir`) and
+// writes each Kubernetes object as a YAML file to sink. Files are named using
+// the template set by `WithExportFormat`, see DefaultExportFormat. Using
+// WithExportPrune, files of earlier exports that are no longer produced are
+// removed afterwards.
+func Export(baseDir string, sink Sink, mods ...Modifier) error {
+	opts := parseModifiers(mods)
+
+	var ps PruningSink
+	if opts.exportPrune {
+		var ok bool
+		if ps, ok = sink.(PruningSink); !ok {
+			return errors.New("pruning requires a sink that can list its files")
+		}
+	}
+
+	files, err := exportFiles(baseDir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := sink.Write(f.path, f.data); err != nil {
+			return fmt.Errorf("Writing manifest: %s", err)
+		}
+	}
+
+	if !opts.exportPrune {
+		return nil
+	}
+	stale, err := staleFiles(ps, files, opts.extension())
+	if err != nil {
+		return err
+	}
+	for _, path := range stale {
+		if err := ps.Remove(path); err != nil {
+			return fmt.Errorf("Pruning %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// exportFile is a single file written by Export
+type exportFile struct {
+	path string
+	data []byte
+	// the object written to path
+	m manifest.Manifest
+}
+
+// exportFiles renders the files Export writes, in the order of the objects
+func exportFiles(baseDir string, opts *options) ([]exportFile, error) {
+	format := opts.exportFormat
+	if format == "" {
+		format = DefaultExportFormat
+	}
+
+	// exit early if the template is bad
+	tmpl, err := template.New("").Funcs(exportFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing name format: %s", err)
+	}
+
+	l, err := load(baseDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]exportFile, 0, len(l.Resources))
+	for _, m := range l.Resources {
+		buf := bytes.Buffer{}
+		if err := tmpl.Execute(&buf, m); err != nil {
+			return nil, errors.Wrap(err, "executing name template")
+		}
+		name := strings.Replace(buf.String(), "/", "-", -1)
+
+		files = append(files, exportFile{path: name + "." + opts.extension(), data: []byte(m.String()), m: m})
+	}
+	return files, nil
+}
+
+// staleFiles returns the files of sink with the given extension that are not
+// part of files, sorted
+func staleFiles(sink PruningSink, files []exportFile, extension string) ([]string, error) {
+	existing, err := sink.List()
+	if err != nil {
+		return nil, fmt.Errorf("Listing existing files: %s", err)
+	}
+
+	produced := make(map[string]bool, len(files))
+	for _, f := range files {
+		produced[f.path] = true
+	}
+
+	var stale []string
+	for _, path := range existing {
+		if !produced[path] && strings.HasSuffix(path, "."+extension) {
+			stale = append(stale, path)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// extension returns the extension of exported files
+func (opts *options) extension() string {
+	if opts.exportExtension == "" {
+		return DefaultExportExtension
+	}
+	return opts.exportExtension
+}
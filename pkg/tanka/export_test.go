@@ -0,0 +1,205 @@
+package tanka
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exportManifests = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: grafana
+`
+
+// TestExport checks that each object is written to the sink, named by the
+// template
+func TestExport(t *testing.T) {
+	sink := NewMemorySink()
+	err := Export("testdata/project/environments/default", sink,
+		WithManifests(strings.NewReader(exportManifests)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apps-v1.Deployment-grafana.yaml", "v1.Service-grafana.yaml"}, sink.Files())
+
+	data, ok := sink.Get("v1.Service-grafana.yaml")
+	require.True(t, ok)
+	assert.Contains(t, string(data), "kind: Service")
+
+	sink = NewMemorySink()
+	err = Export("testdata/project/environments/default", sink,
+		WithManifests(strings.NewReader(exportManifests)),
+		WithExportFormat("{{.kind | lower}}/{{.metadata.name}}"),
+		WithExportExtension("yml"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deployment-grafana.yml", "service-grafana.yml"}, sink.Files())
+
+	err = Export("testdata/project/environments/default", NewMemorySink(),
+		WithExportFormat("{{.kind"),
+	)
+	assert.Error(t, err)
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(string, []byte) error {
+	return errors.New("bucket unreachable")
+}
+
+func TestExportSinkError(t *testing.T) {
+	err := Export("testdata/project/environments/default", failingSink{},
+		WithManifests(strings.NewReader(exportManifests)),
+	)
+	assert.EqualError(t, err, "Writing manifest: bucket unreachable")
+}
+
+// TestOpenSink checks that targets are opened by the sink registered for their
+// scheme, defaulting to directories
+func TestOpenSink(t *testing.T) {
+	mem := NewMemorySink()
+	RegisterSink("mem", func(location string) (Sink, error) {
+		assert.Equal(t, "archive", location)
+		return mem, nil
+	})
+
+	sink, err := OpenSink("mem://archive")
+	require.NoError(t, err)
+	assert.Same(t, mem, sink)
+
+	_, err = OpenSink("s3://bucket")
+	assert.EqualError(t, err, "no sink registered for `s3://`")
+
+	dir, err := ioutil.TempDir("", "tk-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink, err = OpenSink(filepath.Join(dir, "out"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Write("nested/file.yaml", []byte("kind: Service")))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "out", "nested", "file.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Service", string(data))
+
+	// directories must be empty
+	_, err = OpenSink("file://" + filepath.Join(dir, "out"))
+	assert.Error(t, err)
+}
+
+const planManifests = exportManifests + `---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: grafana
+`
+
+// TestPlanExport checks that the files of a previous export are classified,
+// without touching them
+func TestPlanExport(t *testing.T) {
+	sink := DirSink("testdata/export")
+	before, err := sink.List()
+	require.NoError(t, err)
+
+	plan, err := PlanExport("testdata/project/environments/default", sink,
+		WithManifests(strings.NewReader(planManifests)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, ExportPlan{
+		{Path: "apps-v1.Deployment-grafana.yaml", Action: ExportUnchanged},
+		{Path: "networking.k8s.io-v1.Ingress-grafana.yaml", Action: ExportNew},
+		{Path: "v1.Service-grafana.yaml", Action: ExportChanged},
+	}, plan)
+
+	// stale files are only listed when pruning, others never
+	plan, err = PlanExport("testdata/project/environments/default", sink,
+		WithManifests(strings.NewReader(planManifests)),
+		WithExportPrune(true),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, `unchanged apps-v1.Deployment-grafana.yaml
+new       networking.k8s.io-v1.Ingress-grafana.yaml
+removed   v1.ConfigMap-retired.yaml
+changed   v1.Service-grafana.yaml
+1 new, 1 changed, 1 unchanged, 1 removed`, plan.String())
+
+	after, err := sink.List()
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	// nothing exported yet
+	plan, err = PlanExport("testdata/project/environments/default", DirSink("testdata/export/missing"),
+		WithManifests(strings.NewReader(exportManifests)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, ExportPlan{
+		{Path: "apps-v1.Deployment-grafana.yaml", Action: ExportNew},
+		{Path: "v1.Service-grafana.yaml", Action: ExportNew},
+	}, plan)
+	_, err = os.Stat("testdata/export/missing")
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestExportPrune checks that files no longer produced are removed from a
+// copy of the fixture, leaving those of other extensions and subdirectories
+// alone
+func TestExportPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tk-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fixture, err := DirSink("testdata/export").List()
+	require.NoError(t, err)
+	for _, path := range append(fixture, ".hidden/v1.ConfigMap-hidden.yaml") {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/export", path))
+		require.NoError(t, err)
+		require.NoError(t, DirSink(dir).Write(path, data))
+	}
+	nested, err := ioutil.ReadFile("testdata/export/.hidden/v1.ConfigMap-hidden.yaml")
+	require.NoError(t, err)
+	require.NoError(t, DirSink(dir).Write("charts/v1.ConfigMap-hidden.yaml", nested))
+
+	sink, err := OpenPruningSink(dir)
+	require.NoError(t, err)
+	err = Export("testdata/project/environments/default", sink,
+		WithManifests(strings.NewReader(planManifests)),
+		WithExportPrune(true),
+	)
+	require.NoError(t, err)
+
+	files, err := sink.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"README.md",
+		"apps-v1.Deployment-grafana.yaml",
+		"networking.k8s.io-v1.Ingress-grafana.yaml",
+		"v1.Service-grafana.yaml",
+	}, files)
+	_, err = os.Stat(filepath.Join(dir, ".hidden/v1.ConfigMap-hidden.yaml"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "charts/v1.ConfigMap-hidden.yaml"))
+	assert.NoError(t, err)
+
+	data, err := sink.Read("v1.Service-grafana.yaml")
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "NodePort")
+
+	// sinks that can't list their files can't be pruned
+	err = Export("testdata/project/environments/default", failingSink{},
+		WithManifests(strings.NewReader(planManifests)),
+		WithExportPrune(true),
+	)
+	assert.EqualError(t, err, "pruning requires a sink that can list its files")
+}
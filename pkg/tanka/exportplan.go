@@ -0,0 +1,154 @@
+package tanka
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// ExportAction is what an export does to a single file
+type ExportAction string
+
+// Actions of an ExportPlan
+const (
+	// the file does not exist yet
+	ExportNew ExportAction = "new"
+	// the file exists with different contents
+	ExportChanged ExportAction = "changed"
+	// the file exists with the same contents
+	ExportUnchanged ExportAction = "unchanged"
+	// the file exists, but is no longer produced. Only with WithExportPrune
+	ExportRemoved ExportAction = "removed"
+	// the file exists and holds a sealed Secret, which is not compared. Only
+	// with WithSealSecrets
+	ExportSealed ExportAction = "sealed"
+)
+
+// PlannedFile is a file an export writes or removes
+type PlannedFile struct {
+	Path   string
+	Action ExportAction
+}
+
+// ExportPlan lists what Export would do to the files of a sink, sorted by path
+type ExportPlan []PlannedFile
+
+// String returns one line per file, followed by the number of files per
+// action
+func (p ExportPlan) String() string {
+	var b strings.Builder
+	counts := make(map[ExportAction]int)
+	for _, f := range p {
+		fmt.Fprintf(&b, "%-9s %s\n", f.Action, f.Path)
+		counts[f.Action]++
+	}
+
+	summary := []string{
+		fmt.Sprintf("%d new", counts[ExportNew]),
+		fmt.Sprintf("%d changed", counts[ExportChanged]),
+		fmt.Sprintf("%d unchanged", counts[ExportUnchanged]),
+	}
+	if counts[ExportSealed] > 0 {
+		summary = append(summary, fmt.Sprintf("%d sealed", counts[ExportSealed]))
+	}
+	if counts[ExportRemoved] > 0 {
+		summary = append(summary, fmt.Sprintf("%d removed", counts[ExportRemoved]))
+	}
+	b.WriteString(strings.Join(summary, ", "))
+	return b.String()
+}
+
+// PlanExport returns what Export would do to the files of sink using the same
+// modifiers, without writing or removing anything.
+//
+// Sealing encrypts anew on every run, so that sealed Secrets would always
+// differ. Instead of running the command of WithSealSecrets, each Secret is
+// planned as the SealedSecret `kubeseal` prints for it (keeping name and
+// namespace), whose file is either new or sealed.
+func PlanExport(baseDir string, sink PruningSink, mods ...Modifier) (ExportPlan, error) {
+	opts := parseModifiers(mods)
+
+	sealed := make(map[string]bool)
+	if len(opts.sealCommand) > 0 {
+		opts.sealCommand = nil
+		opts.transforms = append(opts.transforms, planSealing(sealed))
+	}
+
+	files, err := exportFiles(baseDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the last write of a path wins, just like in Export
+	produced := make(map[string]exportFile, len(files))
+	for _, f := range files {
+		produced[f.path] = f
+	}
+
+	plan := make(ExportPlan, 0, len(produced))
+	for path, f := range produced {
+		existing, err := sink.Read(path)
+		switch {
+		case os.IsNotExist(err):
+			plan = append(plan, PlannedFile{Path: path, Action: ExportNew})
+		case err != nil:
+			return nil, fmt.Errorf("Reading %s: %s", path, err)
+		case sealed[sealedKey(f.m)]:
+			plan = append(plan, PlannedFile{Path: path, Action: ExportSealed})
+		case bytes.Equal(existing, f.data):
+			plan = append(plan, PlannedFile{Path: path, Action: ExportUnchanged})
+		default:
+			plan = append(plan, PlannedFile{Path: path, Action: ExportChanged})
+		}
+	}
+
+	if opts.exportPrune {
+		stale, err := staleFiles(sink, files, opts.extension())
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range stale {
+			plan = append(plan, PlannedFile{Path: path, Action: ExportRemoved})
+		}
+	}
+
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Path < plan[j].Path })
+	return plan, nil
+}
+
+// planSealing returns a Transform that replaces each Secret by a SealedSecret
+// of the same name and namespace, like `kubeseal` does, without encrypting
+// anything. The replacements are recorded in sealed.
+func planSealing(sealed map[string]bool) Transform {
+	return func(list manifest.List) (manifest.List, error) {
+		out := make(manifest.List, 0, len(list))
+		for _, m := range list {
+			if m.Kind() != "Secret" {
+				out = append(out, m)
+				continue
+			}
+
+			meta := map[string]interface{}{"name": m.Metadata().Name()}
+			if ns := m.Metadata().Namespace(); ns != "" {
+				meta["namespace"] = ns
+			}
+			s := manifest.Manifest{
+				"apiVersion": "bitnami.com/v1alpha1",
+				"kind":       "SealedSecret",
+				"metadata":   meta,
+			}
+			sealed[sealedKey(s)] = true
+			out = append(out, s)
+		}
+		return out, nil
+	}
+}
+
+// sealedKey identifies m among the objects planned by planSealing
+func sealedKey(m manifest.Manifest) string {
+	return m.Metadata().Namespace() + "/" + m.KindName()
+}
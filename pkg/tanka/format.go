@@ -1,10 +1,12 @@
 package tanka
 
 import (
+	"bufio"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/gobwas/glob"
 	"github.com/google/go-jsonnet/formatter"
@@ -30,6 +32,11 @@ type FormatOpts struct {
 // like persisting to disc
 type OutFn func(name, content string) error
 
+// IgnoreFile lists globs (one per line) of files to be left alone when
+// formatting the directory it is placed in. Lines starting with `#` are
+// comments.
+const IgnoreFile = ".tkignore"
+
 // FormatFiles takes a list of files and directories, processes them and returns
 // which files were formatted and perhaps an error.
 func FormatFiles(fds []string, opts *FormatOpts) ([]string, error) {
@@ -100,6 +107,11 @@ func findFiles(target string, excludes []glob.Glob) ([]string, error) {
 		return []string{target}, nil
 	}
 
+	ignores, err := loadIgnores(target)
+	if err != nil {
+		return nil, err
+	}
+
 	var files []string
 
 	// godirwalk is faster than filepath.Walk, 'cause no os.Stat required
@@ -116,6 +128,17 @@ func findFiles(target string, excludes []glob.Glob) ([]string, error) {
 				}
 			}
 
+			// ignored using .tkignore?
+			rel, err := filepath.Rel(target, path)
+			if err != nil {
+				return err
+			}
+			for _, g := range ignores {
+				if g.Match(filepath.ToSlash(rel)) {
+					return nil
+				}
+			}
+
 			// only .jsonnet or .libsonnet
 			if ext := filepath.Ext(path); ext == ".jsonnet" || ext == ".libsonnet" {
 				files = append(files, path)
@@ -131,3 +154,36 @@ func findFiles(target string, excludes []glob.Glob) ([]string, error) {
 
 	return files, nil
 }
+
+// loadIgnores reads the IgnoreFile of dir, if any. Patterns are relative to
+// dir and also match everything below a directory.
+func loadIgnores(dir string) ([]glob.Glob, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var globs []glob.Glob
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.Trim(line, "/")
+
+		for _, p := range []string{line, line + "/**"} {
+			g, err := glob.Compile(p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing %s", IgnoreFile)
+			}
+			globs = append(globs, g)
+		}
+	}
+
+	return globs, scanner.Err()
+}
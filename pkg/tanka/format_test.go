@@ -0,0 +1,106 @@
+package tanka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fmtFixture copies testdata/fmt into a temporary directory, so that it can be
+// formatted in place. The caller removes it.
+func fmtFixture(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tk-fmt")
+	require.NoError(t, err)
+
+	src := filepath.Join("testdata", "fmt")
+	err = filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		if fi.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0755)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, rel), data, 0644)
+	})
+	require.NoError(t, err)
+
+	return dir
+}
+
+func fmtExcludes() []glob.Glob {
+	return []glob.Glob{glob.MustCompile("**/vendor/**")}
+}
+
+func relAll(t *testing.T, dir string, paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		rel, err := filepath.Rel(dir, p)
+		require.NoError(t, err)
+		out[i] = filepath.ToSlash(rel)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var unformatted = []string{
+	"lib/unformatted.libsonnet",
+	"unformatted.jsonnet",
+}
+
+func TestFormatFilesCheck(t *testing.T) {
+	dir := fmtFixture(t)
+	defer os.RemoveAll(dir)
+	before, err := ioutil.ReadFile(filepath.Join(dir, "unformatted.jsonnet"))
+	require.NoError(t, err)
+
+	changed, err := FormatFiles([]string{dir}, &FormatOpts{
+		Excludes: fmtExcludes(),
+		OutFn:    func(name, content string) error { return nil },
+	})
+	require.NoError(t, err)
+
+	// .tkignore and vendor/ are left out
+	assert.Equal(t, unformatted, relAll(t, dir, changed))
+
+	// nothing rewritten
+	after, err := ioutil.ReadFile(filepath.Join(dir, "unformatted.jsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+}
+
+func TestFormatFilesRewrite(t *testing.T) {
+	dir := fmtFixture(t)
+	defer os.RemoveAll(dir)
+
+	changed, err := FormatFiles([]string{dir}, &FormatOpts{Excludes: fmtExcludes()})
+	require.NoError(t, err)
+	assert.Equal(t, unformatted, relAll(t, dir, changed))
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "unformatted.jsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  foo: 'bar',\n  baz: [1, 2],\n}\n", string(got))
+
+	// ignored files are untouched
+	ignored, err := ioutil.ReadFile(filepath.Join(dir, "ignored", "unformatted.jsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{foo:\"bar\"}\n", string(ignored))
+
+	// formatted now
+	changed, err = FormatFiles([]string{dir}, &FormatOpts{
+		Excludes: fmtExcludes(),
+		OutFn:    func(name, content string) error { return nil },
+	})
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+}
@@ -0,0 +1,113 @@
+package tanka
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/spec"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// AnnotationSharedNamespace marks an environment as intentionally sharing its
+// cluster and namespace with others. Set to "true" to leave it out of
+// LintNamespaces.
+const AnnotationSharedNamespace = "tanka.dev/shared-namespace"
+
+// NamespaceConflict is a set of environments targeting the same namespace of
+// the same cluster, where applies are likely to clobber each other
+type NamespaceConflict struct {
+	APIServer    string
+	Namespace    string
+	Environments []string
+}
+
+// LintNamespaces finds all environments below dir and reports those sharing
+// both, spec.apiServer and spec.namespace
+func LintNamespaces(dir string) ([]NamespaceConflict, error) {
+	dirs, err := findEnvs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding environments")
+	}
+
+	envs := make([]v1alpha1.Config, 0, len(dirs))
+	for _, d := range dirs {
+		env, _, err := loadEnv(d)
+		if err != nil {
+			return nil, errors.Wrap(err, d)
+		}
+		envs = append(envs, *env)
+	}
+
+	return NamespaceConflicts(envs), nil
+}
+
+// NamespaceConflicts groups the given environments by cluster and namespace,
+// returning the groups of more than one. Environments annotated with
+// AnnotationSharedNamespace are left out.
+func NamespaceConflicts(envs []v1alpha1.Config) []NamespaceConflict {
+	type target struct{ server, ns string }
+	groups := make(map[target][]string)
+
+	for _, e := range envs {
+		if e.Metadata.Annotations[AnnotationSharedNamespace] == "true" {
+			continue
+		}
+		if e.Spec.APIServer == "" {
+			continue
+		}
+
+		t := target{server: strings.TrimSuffix(e.Spec.APIServer, "/"), ns: e.Spec.Namespace}
+		groups[t] = append(groups[t], e.Metadata.Name)
+	}
+
+	var conflicts []NamespaceConflict
+	for t, names := range groups {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Strings(names)
+		conflicts = append(conflicts, NamespaceConflict{
+			APIServer:    t.server,
+			Namespace:    t.ns,
+			Environments: names,
+		})
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].APIServer != conflicts[j].APIServer {
+			return conflicts[i].APIServer < conflicts[j].APIServer
+		}
+		return conflicts[i].Namespace < conflicts[j].Namespace
+	})
+	return conflicts
+}
+
+// findEnvs returns all directories below dir holding both, a main.jsonnet and
+// a spec.json
+func findEnvs(dir string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == "vendor" {
+			return filepath.SkipDir
+		}
+
+		for _, name := range []string{"main.jsonnet", spec.Specfile} {
+			if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+				return nil
+			}
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs, err
+}
@@ -0,0 +1,31 @@
+package tanka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintNamespaces(t *testing.T) {
+	t.Run("colliding", func(t *testing.T) {
+		got, err := LintNamespaces("testdata/lint/colliding")
+		require.NoError(t, err)
+
+		// prod-shared is annotated, prod-loki uses another namespace
+		assert.Equal(t, []NamespaceConflict{{
+			APIServer: "https://prod:6443",
+			Namespace: "grafana",
+			Environments: []string{
+				"colliding/prod-a",
+				"colliding/prod-b",
+			},
+		}}, got)
+	})
+
+	t.Run("clean", func(t *testing.T) {
+		got, err := LintNamespaces("testdata/lint/clean")
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+}
@@ -0,0 +1,62 @@
+package tanka
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+)
+
+// changedNames lists each object changed by the diff d as `<kind>/<name>`, in
+// the order of the diff. With actions, each is prefixed by `<action>\t`. The
+// objects are looked up in known by the names of the diffed files, those not
+// found (e.g. the orphans of WithDiffPrune) are parsed from the name instead.
+func changedNames(d string, actions bool, known ...manifest.List) string {
+	names := make(map[string]string)
+	for _, list := range known {
+		for _, m := range list {
+			id := util.DiffIdentity(m)
+			names[id.String()] = m.KindName()
+			names[kubectlDiffName(id)] = m.KindName()
+		}
+	}
+
+	var lines []string
+	for _, o := range util.DiffObjects(d) {
+		name, ok := names[o.Name]
+		if !ok {
+			name = parseKindName(o.Name)
+		}
+		if actions {
+			name = fmt.Sprintf("%s\t%s", o.Action, name)
+		}
+		lines = append(lines, name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// kubectlDiffName returns the name `kubectl diff` gives the file of an object
+func kubectlDiffName(id util.Identity) string {
+	return strings.TrimPrefix(fmt.Sprintf("%s.%s.%s.%s.%s", id.Group, id.Version, id.Kind, id.Namespace, id.Name), ".")
+}
+
+// parseKindName returns `<kind>/<name>` of the diffed file, which is named
+// `<apiVersion>.<kind>.<namespace>.<name>` by both, util.DiffName and `kubectl
+// diff`. API groups are lower case, so that the kind is the first part
+// starting with an upper case letter. Namespaces hold no dots, names may. The
+// file name is returned as-is if it can't be parsed.
+func parseKindName(file string) string {
+	parts := strings.Split(file, ".")
+	for i := 1; i+2 < len(parts); i++ {
+		if parts[i] == "" || !unicode.IsUpper(rune(parts[i][0])) {
+			continue
+		}
+		if name := strings.Join(parts[i+2:], "."); name != "" {
+			return parts[i] + "/" + name
+		}
+		break
+	}
+	return file
+}
@@ -0,0 +1,123 @@
+package tanka
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// TestDiffNameOnly checks that exactly the changed objects are listed, in a
+// form WithTargets accepts
+func TestDiffNameOnly(t *testing.T) {
+	const state = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+data:
+  theme: light
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: grafana
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: grafana
+spec:
+  ports:
+    - port: 3000
+`
+	snapshot := policySnapshot + `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+`
+
+	d, err := Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(state)),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+		WithDiffNameOnly(true),
+	)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, "ConfigMap/grafana\nIngress/grafana\nDeployment/grafana", *d)
+
+	// along with the actions
+	d, err = Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(state)),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+		WithDiffNameOnly(true),
+		WithDiffNameActions(true),
+	)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, "updated\tConfigMap/grafana\ncreated\tIngress/grafana\ndeleted\tDeployment/grafana", *d)
+
+	// along with a policy
+	_, err = Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(state)),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+		WithDiffNameOnly(true),
+		WithDiffFailOnDelete(true),
+	)
+	assert.Equal(t, ErrorDiffPolicy{Deleted: 1}, err)
+
+	_, err = Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(state)),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+		WithDiffNameOnly(true),
+		WithDiffSummarize(true),
+	)
+	assert.Error(t, err)
+}
+
+// TestChangedNamesKubectl checks that the files of `kubectl diff` are matched
+// as well, parsing unknown ones
+func TestChangedNamesKubectl(t *testing.T) {
+	const d = `diff -u -N /tmp/LIVE-4211/apps.v1.StatefulSet.loki.ingester /tmp/MERGED-4211/apps.v1.StatefulSet.loki.ingester
+--- /tmp/LIVE-4211/apps.v1.StatefulSet.loki.ingester	2020-11-01 12:00:00.000000000 +0000
++++ /tmp/MERGED-4211/apps.v1.StatefulSet.loki.ingester	2020-11-01 12:00:00.000000000 +0000
+@@ -1 +1 @@
+-replicas: 1
++replicas: 2
+diff -u -N /tmp/LIVE-4211/v1.ConfigMap.loki.unknown /tmp/MERGED-4211/v1.ConfigMap.loki.unknown
+--- /tmp/LIVE-4211/v1.ConfigMap.loki.unknown	2020-11-01 12:00:00.000000000 +0000
++++ /tmp/MERGED-4211/v1.ConfigMap.loki.unknown	2020-11-01 12:00:00.000000000 +0000
+@@ -0,0 +1 @@
++a: b
+`
+	known := manifest.List{{
+		"apiVersion": "apps/v1",
+		"kind":       "StatefulSet",
+		"metadata":   map[string]interface{}{"name": "ingester", "namespace": "loki"},
+	}}
+
+	assert.Equal(t, "updated\tStatefulSet/ingester\ncreated\tConfigMap/unknown", changedNames(d, true, known))
+	assert.Equal(t, "StatefulSet/ingester\nConfigMap/unknown", changedNames(d, false, known))
+}
+
+func TestParseKindName(t *testing.T) {
+	cases := map[string]string{
+		// util.DiffName
+		"apps-v1.Deployment.loki.distributor":                 "Deployment/distributor",
+		"v1.Namespace..loki":                                  "Namespace/loki",
+		"monitoring.coreos.com-v1.Prometheus.monitoring.main": "Prometheus/main",
+		"v1.ConfigMap.loki.loki.config":                       "ConfigMap/loki.config",
+		// kubectl diff
+		"networking.k8s.io.v1.Ingress.loki.gateway": "Ingress/gateway",
+		// unknown
+		"grafana":         "grafana",
+		"v1.ConfigMap.ns": "v1.ConfigMap.ns",
+	}
+	for file, want := range cases {
+		assert.Equal(t, want, parseKindName(file), file)
+	}
+}
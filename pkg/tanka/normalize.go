@@ -0,0 +1,61 @@
+package tanka
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/jsonnet"
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// normalizer returns the kubernetes.Normalizer implementing
+// spec.diff.normalize of env, or nil if unset
+func normalizer(env *v1alpha1.Config) (kubernetes.Normalizer, error) {
+	if env.Spec.Diff.Normalize == "" {
+		return nil, nil
+	}
+	return jsonnetNormalizer(env.Spec.Diff.Normalize)
+}
+
+// jsonnetNormalizer returns a kubernetes.Normalizer that calls the function
+// the Jsonnet file evaluates to with each object, see
+// v1alpha1.DiffSpec.Normalize. All calls share one VM.
+func jsonnetNormalizer(file string) (kubernetes.Normalizer, error) {
+	jp, _, _, err := jpath.Resolve(filepath.Dir(file))
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving jpath of spec.diff.normalize")
+	}
+
+	importPath, err := json.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+
+	vm, err := jsonnet.NewEvaluator(jp)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(obj map[string]interface{}) (map[string]interface{}, error) {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := vm.Evaluate(fmt.Sprintf("(import %s)(%s)", importPath, data))
+		if err != nil {
+			return nil, err
+		}
+
+		var out map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &out); err != nil {
+			return nil, errors.Wrap(err, "spec.diff.normalize must return an object")
+		}
+		return out, nil
+	}, nil
+}
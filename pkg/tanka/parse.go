@@ -3,8 +3,10 @@ package tanka
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"path/filepath"
+	"sort"
 
 	"github.com/pkg/errors"
 
@@ -22,15 +24,22 @@ import (
 // 2. parseSpec: load spec.json
 // 3. evalJsonnet: evaluate Jsonnet to JSON
 // 4. process.Process: post-processing
+// 5. transform: user supplied transforms, see WithTransform, WithSealSecrets
 //
 // Also connect() is provided to connect to the cluster for live operations
 type loaded struct {
 	Env       *v1alpha1.Config
 	Resources manifest.List
+	// all objects, including those left out by skip. Pruning must know these,
+	// so that skipped objects are not taken for orphans
+	All manifest.List
+	// the objects of the snapshot diffed against, once read
+	Snapshot manifest.List
 }
 
-// connect opens a connection to the backing Kubernetes cluster.
-func (p *loaded) connect() (*kubernetes.Kubernetes, error) {
+// connect opens a connection to the backing Kubernetes cluster, running
+// kubectl as configured by opts.
+func (p *loaded) connect(opts *options) (*kubernetes.Kubernetes, error) {
 	env := *p.Env
 
 	// check env is complete
@@ -45,54 +54,151 @@ func (p *loaded) connect() (*kubernetes.Kubernetes, error) {
 		return nil, fmt.Errorf("Your Environment's spec.json seems incomplete:\n%s\n\nPlease see https://tanka.dev/config for reference", s)
 	}
 
+	normalize, err := normalizer(&env)
+	if err != nil {
+		return nil, err
+	}
+
 	// connect client
-	kube, err := kubernetes.New(env)
+	kube, err := kubernetes.New(env, normalize, opts.kubectl)
 	if err != nil {
-		return nil, errors.Wrap(err, "connecting to Kubernetes")
+		return nil, err
 	}
 
 	return kube, nil
 }
 
-// load runs all processing stages described at the Processed type
+// skip leaves out the objects annotated to skip op, see process.AnnotationSkip
+func (p *loaded) skip(op string) {
+	p.Resources = process.Skip(p.Resources, op)
+}
+
+// load runs all processing stages described at the Processed type. If
+// pre-rendered manifests were supplied, these are used instead of evaluating
+// Jsonnet.
 func load(dir string, opts *options) (*loaded, error) {
-	raw, env, err := eval(dir, opts.extCode)
+	var (
+		raw interface{}
+		env *v1alpha1.Config
+		err error
+	)
+
+	if opts.manifests != nil {
+		raw, env, err = parseManifests(dir, opts.manifests)
+	} else {
+		raw, env, err = eval(dir, opts)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	rec, err := process.Process(raw, *env, opts.targets)
+	var rec manifest.List
+	if dict, ok := raw.(map[string]interface{}); ok && len(env.Spec.Entrypoints) > 0 {
+		rec, err = processEntrypoints(dict, *env, opts.targets)
+	} else {
+		rec, err = process.Process(raw, *env, opts.targets)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transforms := append([]Transform{}, opts.transforms...)
+	if len(opts.sealCommand) > 0 {
+		transforms = append(transforms, sealEnvSecrets(opts.sealCommand, *env, opts.commandRunner))
+	}
+	rec, err = transform(rec, transforms)
 	if err != nil {
 		return nil, err
 	}
 
 	return &loaded{
 		Resources: rec,
+		All:       rec,
 		Env:       env,
 	}, nil
 }
 
+// transform runs all transforms on list in order. As these may change objects
+// (including their apply waves), the result is verified and sorted again.
+func transform(list manifest.List, transforms []Transform) (manifest.List, error) {
+	if len(transforms) == 0 {
+		return list, nil
+	}
+
+	for _, t := range transforms {
+		var err error
+		list, err = t(list)
+		if err != nil {
+			return nil, errors.Wrap(err, "transforming manifests")
+		}
+	}
+
+	for _, m := range list {
+		if err := m.Verify(); err != nil {
+			return nil, process.ValidationError{Err: errors.Wrap(err, "transforming manifests")}
+		}
+	}
+	if err := process.ValidateWaves(list); err != nil {
+		return nil, process.ValidationError{Err: err}
+	}
+	process.Sort(list)
+
+	return list, nil
+}
+
 // eval runs all processing stages describe at the Processed type apart from
-// post-processing, thus returning the raw Jsonnet result.
-func eval(dir string, extCode map[string]string) (raw map[string]interface{}, env *v1alpha1.Config, err error) {
-	_, baseDir, rootDir, err := jpath.Resolve(dir)
+// post-processing, thus returning the raw Jsonnet result. If the environment
+// has multiple entrypoints, the result is keyed by entrypoint.
+func eval(dir string, opts *options) (raw map[string]interface{}, env *v1alpha1.Config, err error) {
+	env, baseDir, err := loadEnv(dir)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "resolving jpath")
+		return nil, nil, err
 	}
 
-	env, err = parseSpec(baseDir, rootDir)
+	if len(env.Spec.Entrypoints) > 0 {
+		raw, err = evalEntrypoints(baseDir, env, opts)
+	} else {
+		raw, err = evalJsonnet(baseDir, "main.jsonnet", env, opts)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
 
-	raw, err = evalJsonnet(baseDir, env, extCode)
+	return raw, env, nil
+}
+
+// parseManifests reads a stream of pre-rendered manifests, skipping Jsonnet
+// evaluation entirely. The environment is still required for its spec.json.
+func parseManifests(dir string, r io.Reader) (raw []interface{}, env *v1alpha1.Config, err error) {
+	env, _, err = loadEnv(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err = process.ParseStream(r)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "evaluating jsonnet")
+		return nil, nil, process.ValidationError{Err: errors.Wrap(err, "reading manifests")}
 	}
 
 	return raw, env, nil
 }
 
+// loadEnv resolves the environment around dir and parses its spec.json,
+// without evaluating any Jsonnet
+func loadEnv(dir string) (env *v1alpha1.Config, baseDir string, err error) {
+	_, baseDir, rootDir, err := jpath.Resolve(dir)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "resolving jpath")
+	}
+
+	env, err = parseSpec(baseDir, rootDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return env, baseDir, nil
+}
+
 // parseEnv parses the `spec.json` of the environment and returns a
 // *kubernetes.Kubernetes from it
 func parseSpec(baseDir, rootDir string) (*v1alpha1.Config, error) {
@@ -117,32 +223,123 @@ func parseSpec(baseDir, rootDir string) (*v1alpha1.Config, error) {
 	return config, nil
 }
 
-// evalJsonnet evaluates the jsonnet environment at the given directory starting with
-// `main.jsonnet`
-func evalJsonnet(baseDir string, env *v1alpha1.Config, extCode map[string]string) (map[string]interface{}, error) {
+// evalEntrypoints evaluates each of the environment's entrypoints, returning
+// their results keyed by filename relative to baseDir
+func evalEntrypoints(baseDir string, env *v1alpha1.Config, opts *options) (map[string]interface{}, error) {
+	files, err := entrypoints(baseDir, env.Spec.Entrypoints)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]interface{}, len(files))
+	for _, f := range files {
+		dict, err := evalJsonnet(baseDir, f, env, opts)
+		if err != nil {
+			return nil, err
+		}
+		out[f] = dict
+	}
+	return out, nil
+}
+
+// entrypoints expands the given glob patterns relative to baseDir, returning a
+// sorted list of unique filenames. Each pattern must match at least one file.
+func entrypoints(baseDir string, patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, p := range patterns {
+		matches, err := filepath.Glob(filepath.Join(baseDir, p))
+		if err != nil {
+			return nil, errors.Wrapf(err, "entrypoint `%s`", p)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("entrypoint `%s` matches no files", p)
+		}
+
+		for _, m := range matches {
+			rel, err := filepath.Rel(baseDir, m)
+			if err != nil {
+				return nil, err
+			}
+			if seen[rel] {
+				continue
+			}
+			seen[rel] = true
+			files = append(files, rel)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// processEntrypoints post-processes the result of each entrypoint on its own,
+// before combining them into a single list
+func processEntrypoints(raw map[string]interface{}, env v1alpha1.Config, targets process.Matchers) (manifest.List, error) {
+	sets := make(map[string]manifest.List, len(raw))
+	for name, r := range raw {
+		rec, err := process.Process(r, env, targets)
+		if v, ok := err.(process.ValidationError); ok {
+			v.Err = errors.Wrap(v.Err, name)
+			return nil, v
+		} else if err != nil {
+			return nil, err
+		}
+		sets[name] = rec
+	}
+
+	return process.Combine(sets)
+}
+
+// evalJsonnet evaluates the jsonnet file at the given directory, which usually
+// is `main.jsonnet`
+func evalJsonnet(baseDir, file string, env *v1alpha1.Config, opts *options) (map[string]interface{}, error) {
 	jsonEnv, err := json.Marshal(env)
 	if err != nil {
 		return nil, errors.Wrap(err, "marshalling environment config")
 	}
 
+	// those of spec.json first, so that the ones of the command line override
+	valuesFiles := append(append([]string{}, env.Spec.ValuesFiles...), opts.valuesFiles...)
+	values, err := loadValues(valuesFiles)
+	if err != nil {
+		return nil, err
+	}
+	jsonValues, err := json.Marshal(values)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling values")
+	}
+
 	ext := []jsonnet.Modifier{
 		jsonnet.WithExtCode(spec.APIGroup+"/environment", string(jsonEnv)),
+		jsonnet.WithExtCode(valuesExtVar, string(jsonValues)),
+		jsonnet.WithAllowEnv(opts.allowEnv),
+	}
+	if !opts.freezeTime.IsZero() {
+		ext = append(ext, jsonnet.WithFreezeTime(opts.freezeTime))
 	}
-	for k, v := range extCode {
+	for k, v := range opts.extCode {
 		ext = append(ext, jsonnet.WithExtCode(k, v))
 	}
 
-	raw, err := jsonnet.EvaluateFile(
-		filepath.Join(baseDir, "main.jsonnet"),
-		ext...,
-	)
+	var raw string
+	eval := func() (err error) {
+		raw, err = jsonnet.EvaluateFile(filepath.Join(baseDir, file), ext...)
+		return err
+	}
+
+	if opts.traceOut != nil {
+		err = jsonnet.CaptureTraces(opts.traceOut, eval)
+	} else {
+		err = eval()
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	var dict map[string]interface{}
 	if err := json.Unmarshal([]byte(raw), &dict); err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "parsing jsonnet output")
 	}
 	return dict, nil
 }
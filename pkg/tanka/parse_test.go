@@ -0,0 +1,136 @@
+package tanka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalEnvironment(t *testing.T) {
+	raw, env, err := eval("testdata/project/environments/default", &options{})
+	require.NoError(t, err)
+	assert.Equal(t, "environments/default", env.Metadata.Name)
+
+	want := map[string]interface{}{
+		"apiVersion": "tanka.dev/v1alpha1",
+		"kind":       "Environment",
+		"metadata": map[string]interface{}{
+			"name":   "environments/default",
+			"labels": map[string]interface{}{"team": "observability"},
+		},
+		"spec": map[string]interface{}{
+			"apiServer": "https://localhost:6443",
+			"namespace": "monitoring",
+			"diff":      map[string]interface{}{},
+		},
+	}
+
+	// both, the extVar and `import "tk"`
+	assert.Equal(t, want, raw["extVar"])
+	assert.Equal(t, want, raw["tk"])
+}
+
+// TestEvalAllowEnv checks that environment variables can only be read once
+// WithAllowEnv is given
+func TestEvalAllowEnv(t *testing.T) {
+	require.NoError(t, os.Setenv("TANKA_TEST_CLUSTER", "prod"))
+	defer os.Unsetenv("TANKA_TEST_CLUSTER")
+
+	_, err := Eval("testdata/project/environments/getenv")
+	assert.Error(t, err)
+
+	raw, err := Eval("testdata/project/environments/getenv", WithAllowEnv(true))
+	require.NoError(t, err)
+	assert.Equal(t, "prod", raw["cluster"])
+}
+
+// TestEvalFreezeTime checks that the output is the same across evaluations
+// once the time is frozen
+func TestEvalFreezeTime(t *testing.T) {
+	frozen := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	first, err := Show("testdata/project/environments/freeze", WithFreezeTime(frozen))
+	require.NoError(t, err)
+	second, err := Show("testdata/project/environments/freeze", WithFreezeTime(frozen))
+	require.NoError(t, err)
+
+	assert.Equal(t, first.String(), second.String())
+	require.Len(t, first, 1)
+	assert.Equal(t, "2020-11-01T12:00:00Z", first[0].Metadata().Annotations()["example.com/rendered-at"])
+}
+
+// TestEvalValues checks that the values files of spec.json are exposed to
+// Jsonnet, merged with those given using WithValuesFiles
+func TestEvalValues(t *testing.T) {
+	list, err := Show("testdata/project/environments/values")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, map[string]interface{}{
+		"replicas": "1",
+		"theme":    "dark",
+		"endpoint": "https://dev.example.com",
+	}, list[0]["data"])
+
+	// merged in order, later ones win
+	list, err = Show("testdata/project/environments/values",
+		WithValuesFiles([]string{"testdata/project/environments/values/prod.json"}),
+	)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, map[string]interface{}{
+		"replicas": "3",
+		"theme":    "dark",
+		"endpoint": "https://prod.example.com",
+	}, list[0]["data"])
+
+	_, err = Show("testdata/project/environments/values",
+		WithValuesFiles([]string{"testdata/project/environments/values/missing.yaml"}),
+	)
+	assert.Error(t, err)
+}
+
+// TestLoadValues checks that values files are merged recursively, apart from
+// lists and other values, which are replaced
+func TestLoadValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tk-values")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base.yaml":   "grafana:\n  replicas: 1\n  plugins: [piechart]\n",
+		"prod.json":   `{"grafana": {"plugins": ["clock"], "ingress": true}}`,
+		"empty.yaml":  "",
+		"list.yaml":   "- a\n- b\n",
+		"broken.yaml": "grafana: [",
+	}
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// set to an empty object without any files, so Jsonnet can always use it
+	values, err := loadValues(nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, values)
+
+	values, err = loadValues([]string{path("base.yaml"), path("empty.yaml"), path("prod.json")})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"grafana": map[string]interface{}{
+			"replicas": float64(1),
+			"plugins":  []interface{}{"clock"},
+			"ingress":  true,
+		},
+	}, values)
+
+	_, err = loadValues([]string{path("list.yaml")})
+	assert.EqualError(t, err, "values file "+path("list.yaml")+" must hold an object")
+
+	_, err = loadValues([]string{path("broken.yaml")})
+	assert.Error(t, err)
+}
@@ -4,11 +4,17 @@ import (
 	"fmt"
 
 	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 	"github.com/grafana/tanka/pkg/term"
 )
 
 // Prune deletes all resources from the cluster, that are no longer present in
 // Jsonnet. It uses the `tanka.dev/environment` label to identify those.
+// Using `WithDeleteDryRun`, the orphaned objects are only printed.
+// Using `WithPruneResources`, only objects of the given types are pruned.
+// Objects are deleted in the reverse order of applying them, so that
+// Namespaces and CustomResourceDefinitions go last.
 func Prune(baseDir string, mods ...Modifier) error {
 	opts := parseModifiers(mods)
 
@@ -17,14 +23,15 @@ func Prune(baseDir string, mods ...Modifier) error {
 	if err != nil {
 		return err
 	}
-	kube, err := p.connect()
+
+	kube, err := p.connect(opts)
 	if err != nil {
 		return err
 	}
 	defer kube.Close()
 
 	// find orphaned resources
-	orphaned, err := kube.Orphaned(p.Resources)
+	orphaned, err := findOrphans(p, kube, opts)
 	if err != nil {
 		return err
 	}
@@ -34,14 +41,19 @@ func Prune(baseDir string, mods ...Modifier) error {
 		return nil
 	}
 
+	// only list what would be deleted
+	if opts.deleteDryRun {
+		fmt.Println("The following objects would be pruned:")
+		listDeletions(orphaned)
+		return nil
+	}
+
 	// print diff
-	diff, err := kubernetes.StaticDiffer(false)(orphaned)
-	if err != nil {
-		// static diff can't fail normally, so unlike in apply, this is fatal
-		// here
+	if err := showOrphans(orphaned); err != nil {
 		return err
 	}
-	fmt.Print(term.Colordiff(*diff).String())
+
+	warnRemoveFinalizers(opts.delete)
 
 	// prompt for confirm
 	if opts.apply.AutoApprove {
@@ -50,5 +62,69 @@ func Prune(baseDir string, mods ...Modifier) error {
 	}
 
 	// delete resources
-	return kube.Delete(orphaned, kubernetes.DeleteOpts(opts.apply))
+	return pruneOrphans(kube, orphaned, opts)
+}
+
+// findOrphans returns the objects of the environment that are no longer
+// present in Jsonnet, see kubernetes.Orphaned. Skipped objects are still part
+// of the environment, so these are never orphans.
+func findOrphans(l *loaded, kube *kubernetes.Kubernetes, opts *options) (manifest.List, error) {
+	if err := checkPruneTargets(opts); err != nil {
+		return nil, err
+	}
+
+	// objects that could never be pruned
+	if opts.pruneResources != nil {
+		if err := kubernetes.CheckPrunable(l.All, opts.pruneResources); err != nil {
+			return nil, err
+		}
+	}
+
+	return kube.Orphaned(l.All, opts.pruneResources)
+}
+
+// checkPruneTargets returns an error if only some objects are targeted, as
+// all others would be taken for orphans
+func checkPruneTargets(opts *options) error {
+	if len(opts.targets) > 0 {
+		return fmt.Errorf("pruning can't be combined with targets, as all objects not targeted would be pruned")
+	}
+	return nil
+}
+
+// orphansDiff returns the diff deleting orphaned, nil if there are none
+func orphansDiff(orphaned manifest.List) (*string, error) {
+	return kubernetes.StaticDiffer(false)(orphaned, client.DiffOpts{})
+}
+
+// showOrphans prints the diff deleting orphaned
+func showOrphans(orphaned manifest.List) error {
+	diff, err := orphansDiff(orphaned)
+	if err != nil {
+		// static diff can't fail normally, so unlike in apply, this is fatal
+		// here
+		return err
+	}
+	if diff != nil {
+		fmt.Print(term.Colordiff(*diff).String())
+	}
+	return nil
+}
+
+// pruneOrphans deletes orphaned, see Prune
+func pruneOrphans(kube *kubernetes.Kubernetes, orphaned manifest.List, opts *options) error {
+	if len(orphaned) == 0 {
+		return nil
+	}
+
+	return kube.Delete(orphaned, pruneDeleteOpts(opts))
+}
+
+// pruneDeleteOpts returns the options to delete orphans with. Pruning used to
+// be forced by WithApplyForce, so this is still honored besides
+// WithDeleteForce.
+func pruneDeleteOpts(opts *options) kubernetes.DeleteOpts {
+	del := opts.delete
+	del.Force = del.Force || opts.apply.Force
+	return del
 }
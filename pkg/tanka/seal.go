@@ -0,0 +1,127 @@
+package tanka
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// SealSecrets returns a Transform that replaces each Secret by the objects
+// command prints when receiving the Secret as YAML on stdin, for example
+// `kubeseal --format yaml` to use SealedSecrets instead.
+func SealSecrets(command []string) Transform {
+	return sealSecrets(command, nil)
+}
+
+// sealSecrets is like SealSecrets, but runs command using runner, if set
+func sealSecrets(command []string, runner client.Runner) Transform {
+	return func(list manifest.List) (manifest.List, error) {
+		if len(command) == 0 {
+			return nil, errors.New("no command given to seal Secrets with")
+		}
+
+		out := make(manifest.List, 0, len(list))
+		for _, m := range list {
+			if m.Kind() != "Secret" {
+				out = append(out, m)
+				continue
+			}
+
+			sealed, err := seal(m, command, runner)
+			if err != nil {
+				return nil, errors.Wrapf(err, "sealing %s", m.KindName())
+			}
+			out = append(out, sealed...)
+		}
+		return out, nil
+	}
+}
+
+// kubeconfigContext finds the context of the environment's cluster, replaced
+// by tests
+var kubeconfigContext = client.KubeconfigContext
+
+// sealEnvSecrets is like sealSecrets, but passes the cluster of env to
+// kubeseal (see kubesealCommand). The cluster is only looked up if there are
+// Secrets at all.
+func sealEnvSecrets(command []string, env v1alpha1.Config, runner client.Runner) Transform {
+	return func(list manifest.List) (manifest.List, error) {
+		for _, m := range list {
+			if m.Kind() != "Secret" {
+				continue
+			}
+
+			sealWith, err := kubesealCommand(command, env)
+			if err != nil {
+				return nil, err
+			}
+			return sealSecrets(sealWith, runner)(list)
+		}
+		return list, nil
+	}
+}
+
+// kubesealCommand adds `--context` and `--kubeconfig` of the cluster of env to
+// command, so that kubeseal fetches the certificate from there instead of the
+// current context. Other commands, and those choosing a cluster or certificate
+// on their own, are returned as-is.
+func kubesealCommand(command []string, env v1alpha1.Config) ([]string, error) {
+	if len(command) == 0 || filepath.Base(command[0]) != "kubeseal" || env.Spec.APIServer == "" {
+		return command, nil
+	}
+	for _, arg := range command[1:] {
+		for _, flag := range []string{"--context", "--kubeconfig", "--server", "--cert"} {
+			if arg == flag || strings.HasPrefix(arg, flag+"=") {
+				return command, nil
+			}
+		}
+	}
+
+	context, err := kubeconfigContext(env.Spec.APIServer, env.Spec.Kubeconfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding the context of spec.apiServer for kubeseal")
+	}
+
+	out := append(append([]string{}, command...), "--context", context.Name)
+	if env.Spec.Kubeconfig != "" {
+		out = append(out, "--kubeconfig", env.Spec.Kubeconfig)
+	}
+	return out, nil
+}
+
+// seal pipes m through command and parses its output
+func seal(m manifest.Manifest, command []string, runner client.Runner) (manifest.List, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(m.String())
+	out, err := client.Output(runner, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := process.ParseStream(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("%s printed no objects", command[0])
+	}
+
+	sealed := make(manifest.List, 0, len(docs))
+	for _, d := range docs {
+		obj, ok := d.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s printed a %T instead of an object", command[0], d)
+		}
+		sealed = append(sealed, manifest.Manifest(obj))
+	}
+	return sealed, nil
+}
@@ -0,0 +1,178 @@
+package tanka
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+const sealManifests = `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: grafana
+data:
+  password: aHVudGVyMg==
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+data:
+  theme: dark
+`
+
+// fakeKubeseal records the command it is invoked with and prints a
+// SealedSecret of the Secret it receives
+func fakeKubeseal(calls *[]string) func(cmd *exec.Cmd) error {
+	return func(cmd *exec.Cmd) error {
+		*calls = append(*calls, strings.Join(cmd.Args, " "))
+
+		docs, err := process.ParseStream(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		if len(docs) != 1 {
+			return fmt.Errorf("expected a single Secret, got %v", docs)
+		}
+		secret := manifest.Manifest(docs[0].(map[string]interface{}))
+		if secret.Kind() != "Secret" {
+			return fmt.Errorf("expected a Secret, got %s", secret.KindName())
+		}
+
+		_, err = fmt.Fprintf(cmd.Stdout, `apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: %s
+spec:
+  encryptedData:
+    password: AgBy3i4OJSWK+PiTySYZZA==
+`, secret.Metadata().Name())
+		return err
+	}
+}
+
+// TestSealSecrets checks that Secrets are replaced by the output of the
+// command, while other objects are kept as-is
+func TestSealSecrets(t *testing.T) {
+	var calls []string
+
+	list, err := Show("testdata/project/environments/default",
+		WithManifests(strings.NewReader(sealManifests)),
+		WithTransform(sealSecrets([]string{"kubeseal", "--format", "yaml"}, fakeKubeseal(&calls))),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"kubeseal --format yaml"}, calls)
+	require.Len(t, list, 2)
+
+	kinds := []string{list[0].Kind(), list[1].Kind()}
+	assert.ElementsMatch(t, []string{"ConfigMap", "SealedSecret"}, kinds)
+	for _, m := range list {
+		assert.Equal(t, "grafana", m.Metadata().Name())
+		assert.NotContains(t, m.String(), "aHVudGVyMg==")
+	}
+}
+
+func TestSealSecretsError(t *testing.T) {
+	failing := func(cmd *exec.Cmd) error {
+		io.WriteString(cmd.Stderr, "error: cannot fetch certificate\n")
+		return errors.New("exit status 1")
+	}
+
+	_, err := Show("testdata/project/environments/default",
+		WithManifests(strings.NewReader(sealManifests)),
+		WithTransform(sealSecrets([]string{"kubeseal"}, failing)),
+	)
+	assert.EqualError(t, err, "transforming manifests: sealing Secret/grafana: exit status 1: error: cannot fetch certificate")
+}
+
+// TestPlanExportSealed checks that dry runs don't seal, but plan the
+// SealedSecret of each Secret without comparing it
+func TestPlanExportSealed(t *testing.T) {
+	defer func(f func(string, string) (*client.Context, error)) { kubeconfigContext = f }(kubeconfigContext)
+	kubeconfigContext = fakeContext
+
+	dir, err := ioutil.TempDir("", "tk-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := DirSink(dir)
+	require.NoError(t, sink.Write("bitnami.com-v1alpha1.SealedSecret-grafana.yaml", []byte("sealed earlier\n")))
+
+	var calls []string
+	mods := func() []Modifier {
+		return []Modifier{
+			WithManifests(strings.NewReader(sealManifests)),
+			WithSealSecrets([]string{"kubeseal", "--format", "yaml"}),
+			func(opts *options) { opts.commandRunner = fakeKubeseal(&calls) },
+		}
+	}
+
+	plan, err := PlanExport("testdata/project/environments/default", sink, mods()...)
+	require.NoError(t, err)
+	assert.Equal(t, ExportPlan{
+		{Path: "bitnami.com-v1alpha1.SealedSecret-grafana.yaml", Action: ExportSealed},
+		{Path: "v1.ConfigMap-grafana.yaml", Action: ExportNew},
+	}, plan)
+	assert.Empty(t, calls)
+
+	// exporting seals for real, into the file planned
+	require.NoError(t, Export("testdata/project/environments/default", sink, append(mods(), WithExportPrune(true))...))
+	assert.Equal(t, []string{"kubeseal --format yaml --context local"}, calls)
+
+	data, err := sink.Read("bitnami.com-v1alpha1.SealedSecret-grafana.yaml")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "encryptedData")
+}
+
+// fakeContext finds the context `local` for any cluster
+func fakeContext(apiServer, kubeconfig string) (*client.Context, error) {
+	return &client.Context{Name: "local"}, nil
+}
+
+// TestKubesealCommand checks that kubeseal is pointed to the cluster of the
+// environment, unless it is told otherwise
+func TestKubesealCommand(t *testing.T) {
+	defer func(f func(string, string) (*client.Context, error)) { kubeconfigContext = f }(kubeconfigContext)
+	kubeconfigContext = fakeContext
+
+	env := v1alpha1.New()
+	env.Spec.APIServer = "https://localhost:6443"
+
+	cases := []struct {
+		name       string
+		command    []string
+		kubeconfig string
+		want       []string
+	}{
+		{name: "context", command: []string{"kubeseal", "--format", "yaml"}, want: []string{"kubeseal", "--format", "yaml", "--context", "local"}},
+		{name: "kubeconfig", command: []string{"/usr/bin/kubeseal"}, kubeconfig: "/etc/kubeconfig", want: []string{"/usr/bin/kubeseal", "--context", "local", "--kubeconfig", "/etc/kubeconfig"}},
+		{name: "cert", command: []string{"kubeseal", "--cert", "pub-cert.pem"}, want: []string{"kubeseal", "--cert", "pub-cert.pem"}},
+		{name: "ownContext", command: []string{"kubeseal", "--context=prod"}, want: []string{"kubeseal", "--context=prod"}},
+		{name: "otherCommand", command: []string{"sops", "--encrypt"}, want: []string{"sops", "--encrypt"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := *env
+			e.Spec.Kubeconfig = c.kubeconfig
+			got, err := kubesealCommand(c.command, e)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package tanka
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/jsonnet"
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/spec"
+)
+
+// ChangedSince returns the files of the environment at baseDir that were
+// changed in git since ref, which includes uncommitted and untracked changes.
+// The files of an environment are all files its `main.jsonnet` (or its
+// `spec.entrypoints`) transitively imports, the local directories passed to
+// `helmTemplate`, `kustomize` and `configMapFromDir`, its `spec.valuesFiles`
+// and the `spec.json` files it inherits from. If these can't all be known
+// without evaluating, every changed file is returned. An environment without
+// changes is not affected by what changed since ref.
+func ChangedSince(baseDir, ref string) ([]string, error) {
+	return changedSince(baseDir, ref, nil)
+}
+
+// changedSince is like ChangedSince, but runs git using runner, if set
+func changedSince(baseDir, ref string, runner client.Runner) ([]string, error) {
+	deps, err := envFiles(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := git(runner, baseDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, errors.Wrap(err, "finding git repository")
+	}
+	out, err := git(runner, baseDir, "diff", "--name-only", ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing files changed since `%s`", ref)
+	}
+	untracked, err := git(runner, root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, errors.Wrap(err, "listing untracked files")
+	}
+
+	var changed []string
+	for _, f := range strings.Split(out+"\n"+untracked, "\n") {
+		if f == "" {
+			continue
+		}
+		name := filepath.Join(root, filepath.FromSlash(f))
+		if deps.contains(name) {
+			changed = append(changed, name)
+		}
+	}
+	return changed, nil
+}
+
+// envDeps are the files and directories an environment is made of, see
+// ChangedSince
+type envDeps struct {
+	files map[string]bool
+	// directories, all files inside of which belong to the environment
+	dirs []string
+	// patterns of spec.entrypoints, which files removed since may have matched
+	entrypoints []string
+	// set if not all files are known before evaluating, so that any file
+	// may belong to the environment
+	dynamic bool
+}
+
+// contains returns whether the file name belongs to the environment
+func (d envDeps) contains(name string) bool {
+	if d.dynamic || d.files[name] {
+		return true
+	}
+	for _, dir := range d.dirs {
+		if strings.HasPrefix(name, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	for _, p := range d.entrypoints {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// envFiles returns the absolute paths of all files the environment at baseDir
+// is made of, see ChangedSince
+func envFiles(baseDir string) (*envDeps, error) {
+	dir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return nil, err
+	}
+
+	_, _, rootDir, err := jpath.Resolve(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving JPATH")
+	}
+	env, err := parseSpec(dir, rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := envDeps{files: map[string]bool{
+		filepath.Join(dir, spec.Specfile): true,
+	}}
+
+	files := []string{"main.jsonnet"}
+	if len(env.Spec.Entrypoints) > 0 {
+		for _, p := range env.Spec.Entrypoints {
+			deps.entrypoints = append(deps.entrypoints, filepath.Join(dir, p))
+		}
+		if files, err = entrypoints(dir, env.Spec.Entrypoints); err != nil {
+			files = nil
+			deps.dynamic = true
+		}
+	}
+
+	// an environment that can't be resolved fails to evaluate, which must not
+	// be skipped
+	jsonnetDeps, err := jsonnet.TransitiveDeps(dir, files)
+	if err != nil {
+		deps.dynamic = true
+	} else {
+		for _, i := range jsonnetDeps.Imports {
+			deps.files[filepath.Join(rootDir, i)] = true
+		}
+		deps.dirs = jsonnetDeps.Dirs
+		if len(jsonnetDeps.Dynamic) > 0 {
+			deps.dynamic = true
+		}
+	}
+
+	for _, v := range env.Spec.ValuesFiles {
+		deps.files[v] = true
+	}
+
+	sources, err := spec.Sources(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sources {
+		deps.files[s] = true
+	}
+	return &deps, nil
+}
+
+// git runs git in dir and returns its output without the trailing newline
+func git(runner client.Runner, dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := client.Output(runner, cmd)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
@@ -0,0 +1,164 @@
+package tanka
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sinceEnv            = "testdata/project/environments/since"
+	sinceEntrypointsEnv = "testdata/project/environments/since-entrypoints"
+)
+
+// fakeGit pretends pkg/tanka/testdata is a git repository, in which the given
+// files (relative to it) were changed since `main`
+func fakeGit(t *testing.T, changed ...string) func(cmd *exec.Cmd) error {
+	return fakeRepo(t, changed, nil)
+}
+
+// fakeRepo is like fakeGit, but also has untracked files
+func fakeRepo(t *testing.T, changed, untracked []string) func(cmd *exec.Cmd) error {
+	root := testdataRoot(t)
+	return func(cmd *exec.Cmd) error {
+		switch strings.Join(cmd.Args[1:], " ") {
+		case "rev-parse --show-toplevel":
+			fmt.Fprintln(cmd.Stdout, root)
+		case "diff --name-only main":
+			for _, c := range changed {
+				fmt.Fprintln(cmd.Stdout, c)
+			}
+		case "ls-files --others --exclude-standard":
+			for _, u := range untracked {
+				fmt.Fprintln(cmd.Stdout, u)
+			}
+		default:
+			fmt.Fprintf(cmd.Stderr, "fatal: bad revision '%s'\n", cmd.Args[len(cmd.Args)-1])
+			return errors.New("exit status 128")
+		}
+		return nil
+	}
+}
+
+// testdataRoot returns the absolute path of pkg/tanka/testdata
+func testdataRoot(t *testing.T) string {
+	root, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	root, err = filepath.EvalSymlinks(root)
+	require.NoError(t, err)
+	return root
+}
+
+func TestChangedSince(t *testing.T) {
+	cases := []struct {
+		name      string
+		env       string
+		changed   []string
+		untracked []string
+		want      []string
+	}{
+		{
+			name:    "main",
+			changed: []string{"project/environments/since/main.jsonnet"},
+			want:    []string{"project/environments/since/main.jsonnet"},
+		},
+		{
+			name:    "imported",
+			changed: []string{"project/lib/since/images.libsonnet", "project/environments/default/main.jsonnet"},
+			want:    []string{"project/lib/since/images.libsonnet"},
+		},
+		{
+			name:    "importstr",
+			changed: []string{"project/environments/since/grafana.ini"},
+			want:    []string{"project/environments/since/grafana.ini"},
+		},
+		{
+			name:    "spec",
+			changed: []string{"project/environments/since/spec.json"},
+			want:    []string{"project/environments/since/spec.json"},
+		},
+		{
+			name:    "unrelated",
+			changed: []string{"project/environments/default/main.jsonnet", "README.md"},
+		},
+		{
+			name:      "untracked",
+			untracked: []string{"project/lib/since/images.libsonnet"},
+			want:      []string{"project/lib/since/images.libsonnet"},
+		},
+		{
+			name: "entrypoints",
+			env:  sinceEntrypointsEnv,
+			changed: []string{
+				"project/environments/since-entrypoints/grafana.jsonnet",
+				"project/environments/since-entrypoints/extra-removed.jsonnet",
+				"project/environments/since-entrypoints/main.jsonnet",
+			},
+			want: []string{
+				"project/environments/since-entrypoints/grafana.jsonnet",
+				"project/environments/since-entrypoints/extra-removed.jsonnet",
+			},
+		},
+		{
+			name:    "chart",
+			env:     sinceEntrypointsEnv,
+			changed: []string{"project/environments/since-entrypoints/charts/grafana/values.yaml"},
+			want:    []string{"project/environments/since-entrypoints/charts/grafana/values.yaml"},
+		},
+		{
+			name:    "values",
+			env:     sinceEntrypointsEnv,
+			changed: []string{"project/environments/since-entrypoints/values.yaml"},
+			want:    []string{"project/environments/since-entrypoints/values.yaml"},
+		},
+		{
+			name:    "dynamic",
+			env:     "testdata/project/environments/since-dynamic",
+			changed: []string{"project/environments/default/main.jsonnet"},
+			want:    []string{"project/environments/default/main.jsonnet"},
+		},
+		{
+			name: "nothing",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			env := c.env
+			if env == "" {
+				env = sinceEnv
+			}
+			changed, err := changedSince(env, "main", fakeRepo(t, c.changed, c.untracked))
+			require.NoError(t, err)
+
+			var want []string
+			for _, w := range c.want {
+				want = append(want, filepath.Join(testdataRoot(t), w))
+			}
+			assert.Equal(t, want, changed)
+		})
+	}
+}
+
+func TestChangedSinceError(t *testing.T) {
+	_, err := changedSince(sinceEnv, "unknown", fakeGit(t))
+	assert.EqualError(t, err, "listing files changed since `unknown`: exit status 128: fatal: bad revision 'unknown'")
+}
+
+// TestApplySince checks that unaffected environments are skipped before
+// connecting to the cluster
+func TestApplySince(t *testing.T) {
+	err := Apply(sinceEnv, WithApplySince("main"), func(opts *options) {
+		opts.gitRunner = fakeGit(t, "project/environments/default/main.jsonnet")
+	})
+	assert.NoError(t, err)
+
+	err = Apply(sinceEnv, WithApplySince("main"), WithManifests(strings.NewReader("")))
+	assert.Error(t, err)
+}
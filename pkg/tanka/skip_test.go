@@ -0,0 +1,103 @@
+package tanka
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+)
+
+const skipManifests = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: managed-elsewhere
+  annotations:
+    tanka.dev/skip: apply
+`
+
+func kindNames(list manifest.List) []string {
+	names := make([]string, len(list))
+	for i, m := range list {
+		names[i] = m.KindName()
+	}
+	return names
+}
+
+// TestSkipApply checks that objects annotated to skip apply are still shown,
+// but never reach the applier
+func TestSkipApply(t *testing.T) {
+	const dir = "testdata/project/environments/default"
+
+	shown, err := Show(dir, WithManifests(strings.NewReader(skipManifests)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ConfigMap/grafana", "ConfigMap/managed-elsewhere"}, kindNames(shown))
+
+	l, err := load(dir, &options{manifests: strings.NewReader(skipManifests)})
+	require.NoError(t, err)
+	l.skip(process.SkipApply)
+	assert.Equal(t, []string{"ConfigMap/grafana"}, kindNames(l.Resources))
+
+	// skipped objects are no orphans
+	assert.Equal(t, []string{"ConfigMap/grafana", "ConfigMap/managed-elsewhere"}, kindNames(l.All))
+}
+
+// TestPruneTargets checks that only pruning all objects is possible
+func TestPruneTargets(t *testing.T) {
+	targets, err := process.StrExps("configmap/grafana")
+	require.NoError(t, err)
+
+	_, err = Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(skipManifests)),
+		WithTargets(targets),
+		WithDiffPrune(true),
+	)
+	assert.EqualError(t, err, "pruning can't be combined with targets, as all objects not targeted would be pruned")
+}
+
+// TestSkipDiff checks that objects annotated to skip diff are left out on both
+// sides of the diff
+func TestSkipDiff(t *testing.T) {
+	state := strings.Replace(skipManifests, "skip: apply", "skip: diff", 1)
+	snapshot := strings.Replace(state, "name: managed-elsewhere", "name: managed-elsewhere\n  labels: {changed: 'true'}", 1)
+
+	d, err := Diff("testdata/project/environments/default",
+		WithManifests(strings.NewReader(state)),
+		WithDiffSnapshot(strings.NewReader(snapshot)),
+	)
+	require.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+// TestPruneDeleteForce checks that pruning is forced by both WithDeleteForce
+// and WithApplyForce, the latter of which used to force it alone
+func TestPruneDeleteForce(t *testing.T) {
+	cases := []struct {
+		name string
+		mods []Modifier
+		want bool
+	}{
+		{name: "none", want: false},
+		{name: "delete", mods: []Modifier{WithDeleteForce(true)}, want: true},
+		{name: "apply", mods: []Modifier{WithApplyForce(true)}, want: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := parseModifiers(append(c.mods, WithDeleteGracePeriod(time.Second)))
+			del := pruneDeleteOpts(opts)
+			assert.Equal(t, c.want, del.Force)
+			assert.Equal(t, time.Second, del.GracePeriod)
+		})
+	}
+}
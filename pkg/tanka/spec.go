@@ -0,0 +1,56 @@
+package tanka
+
+import (
+	"github.com/grafana/tanka/pkg/spec"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// SourceFlag is the source of spec fields overridden using a Modifier, see
+// EffectiveSpec
+const SourceFlag = "flag"
+
+// EffectiveSpec returns the spec of the environment at baseDir the way the
+// other actions use it: merged with the spec.json files of its parent
+// directories and with the overrides of WithDiffStrategy,
+// WithDiffIncludeStatus and WithDiffIgnoreWhitespace applied.
+//
+// sources maps the path of each field set in a spec.json or overridden (e.g.
+// `spec.namespace`) to where its value comes from: the spec.json file or
+// SourceFlag. Other fields have their default value.
+func EffectiveSpec(baseDir string, mods ...Modifier) (env *v1alpha1.Config, sources map[string]string, err error) {
+	opts := parseModifiers(mods)
+
+	env, dir, err := loadEnv(baseDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sources, err = spec.Sources(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, path := range overrideSpec(env, opts) {
+		sources[path] = SourceFlag
+	}
+	return env, sources, nil
+}
+
+// overrideSpec applies the options that take precedence over the spec.json to
+// env, returning the paths of the fields changed
+func overrideSpec(env *v1alpha1.Config, opts *options) []string {
+	var paths []string
+	if opts.diff.Strategy != "" {
+		env.Spec.DiffStrategy = opts.diff.Strategy
+		paths = append(paths, "spec.diffStrategy")
+	}
+	if opts.includeStatus {
+		env.Spec.Diff.IncludeStatus = true
+		paths = append(paths, "spec.diff.includeStatus")
+	}
+	if opts.ignoreWhitespace {
+		env.Spec.Diff.IgnoreWhitespace = true
+		paths = append(paths, "spec.diff.ignoreWhitespace")
+	}
+	return paths
+}
@@ -0,0 +1,44 @@
+package tanka
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEffectiveSpec checks that the spec is merged with the one of its parent
+// directory and overridden by flags, reporting where each field comes from
+func TestEffectiveSpec(t *testing.T) {
+	const dir = "testdata/project/environments/inherit/prod"
+
+	env, sources, err := EffectiveSpec(dir,
+		WithDiffStrategy("subset"),
+		WithDiffIncludeStatus(true),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "environments/inherit/prod", env.Metadata.Name)
+	assert.Equal(t, "https://inherit:6443", env.Spec.APIServer)
+	assert.Equal(t, "prod", env.Spec.Namespace)
+	assert.Equal(t, []string{"Event"}, env.Spec.Diff.IgnoreKinds)
+	assert.Equal(t, "subset", env.Spec.DiffStrategy)
+	assert.True(t, env.Spec.Diff.IncludeStatus)
+	assert.False(t, env.Spec.Diff.IgnoreWhitespace)
+
+	parent, err := filepath.Abs("testdata/project/environments/inherit/spec.json")
+	require.NoError(t, err)
+	own, err := filepath.Abs(dir + "/spec.json")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"apiVersion":              own,
+		"kind":                    own,
+		"spec.apiServer":          parent,
+		"spec.namespace":          own,
+		"spec.diff.ignoreKinds":   parent,
+		"spec.diffStrategy":       SourceFlag,
+		"spec.diff.includeStatus": SourceFlag,
+	}, sources)
+}
@@ -23,7 +23,7 @@ func Status(baseDir string, mods ...Modifier) (*Info, error) {
 	if err != nil {
 		return nil, err
 	}
-	kube, err := r.connect()
+	kube, err := r.connect(opts)
 	if err != nil {
 		return nil, err
 	}
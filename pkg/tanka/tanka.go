@@ -5,7 +5,12 @@
 package tanka
 
 import (
+	"io"
+	"time"
+
 	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 	"github.com/grafana/tanka/pkg/process"
 )
 
@@ -21,14 +26,78 @@ func parseModifiers(mods []Modifier) *options {
 type options struct {
 	// `std.extVar`
 	extCode map[string]string
+	// allow `std.native('getenv')` to read environment variables
+	allowEnv bool
+	// time returned by `std.native('now')`, unless zero
+	freezeTime time.Time
+	// receives the messages of `std.trace`, if set
+	traceOut io.Writer
+	// merged after those of spec.valuesFiles
+	valuesFiles []string
+
+	// pre-rendered manifests to use instead of evaluating Jsonnet
+	manifests io.Reader
 
 	// target regular expressions to limit the working set
 	targets process.Matchers
 
+	// run on the processed manifests, in order
+	transforms []Transform
+	// command sealing Secrets after the transforms, see WithSealSecrets
+	sealCommand []string
+
 	// additional options for diff
 	diff kubernetes.DiffOpts
+	// previously captured manifests to diff against instead of the cluster
+	snapshot io.Reader
+	// command printing the manifests to diff against, used like snapshot
+	againstCommand []string
+	// runs againstCommand and sealCommand, if set
+	commandRunner client.Runner
+	// diff against the last-applied-configuration of the snapshot objects
+	lastApplied bool
+	// compare `status` as well, overriding spec.diff.includeStatus
+	includeStatus bool
+	// ignore line endings and trailing whitespace of strings, overriding
+	// spec.diff.ignoreWhitespace
+	ignoreWhitespace bool
+	// fail if the diff creates or deletes objects
+	failOnAdd, failOnDelete bool
+	// list the changed objects instead of the diff
+	nameOnly bool
+	// prefix the objects listed by nameOnly with their action
+	nameActions bool
 	// additional options for apply
 	apply kubernetes.ApplyOpts
+	// diff and apply using the same fetched live state
+	plan bool
+	// apply only the objects differing from the live state
+	onlyChanged bool
+	// don't ask `kubectl auth can-i` before applying
+	skipAuthCheck bool
+	// create spec.namespace if it does not exist
+	createNamespace bool
+	// apply only if files of the environment changed since this git ref
+	since string
+	// runs git for since, if set
+	gitRunner client.Runner
+	// additional options for delete
+	delete kubernetes.DeleteOpts
+	// only list what prune and delete would delete
+	deleteDryRun bool
+	// label selector for live objects to delete
+	selector string
+	// the only types of objects prune may delete
+	pruneResources []kubernetes.PruneResource
+	// prune the objects removed from Jsonnet after applying
+	applyPrune bool
+	// template and extension for the names of exported files
+	exportFormat, exportExtension string
+	// remove exported files of earlier runs that are no longer produced
+	exportPrune bool
+
+	// temporary files and concurrency of kubectl
+	kubectl client.Opts
 }
 
 // Modifier allow to influence the behavior of certain `tanka.*` actions. They
@@ -43,6 +112,71 @@ func WithExtCode(code map[string]string) Modifier {
 	}
 }
 
+// WithAllowEnv allows Jsonnet to read environment variables of the host using
+// `std.native('getenv')`, which fails otherwise
+func WithAllowEnv(b bool) Modifier {
+	return func(opts *options) {
+		opts.allowEnv = b
+	}
+}
+
+// WithFreezeTime makes `std.native('now')` return t instead of the current time,
+// so that the output is reproducible. The zero time is ignored.
+func WithFreezeTime(t time.Time) Modifier {
+	return func(opts *options) {
+		opts.freezeTime = t
+	}
+}
+
+// WithTraceOut writes the messages of `std.trace` to w, prefixed with the
+// location of the call. If unset, the Jsonnet VM prints them to stderr as-is.
+func WithTraceOut(w io.Writer) Modifier {
+	return func(opts *options) {
+		opts.traceOut = w
+	}
+}
+
+// WithValuesFiles merges the given YAML or JSON files into the values of the
+// environment (see v1alpha1.Spec.ValuesFiles), after those of its spec.json
+func WithValuesFiles(files []string) Modifier {
+	return func(opts *options) {
+		opts.valuesFiles = files
+	}
+}
+
+// Transform modifies the processed manifests of an environment, before they
+// are shown, diffed or applied. It may add, remove or change objects.
+type Transform func(manifest.List) (manifest.List, error)
+
+// WithTransform runs t on the manifests after evaluation (and filtering using
+// targets). Multiple transforms are run in the order given, each receiving the
+// result of the previous one. The result is sorted and validated again
+// afterwards.
+func WithTransform(t Transform) Modifier {
+	return func(opts *options) {
+		opts.transforms = append(opts.transforms, t)
+	}
+}
+
+// WithSealSecrets replaces each Secret by the objects command prints for it
+// (see SealSecrets), after all other transforms. kubeseal is pointed to the
+// cluster of the environment. Unlike WithTransform, PlanExport does not run
+// command, as sealing encrypts anew on every run.
+func WithSealSecrets(command []string) Modifier {
+	return func(opts *options) {
+		opts.sealCommand = command
+	}
+}
+
+// WithManifests skips Jsonnet evaluation and reads the YAML stream of
+// pre-rendered manifests from r instead. The remaining processing (sorting,
+// validation, labeling, ...) stays the same.
+func WithManifests(r io.Reader) Modifier {
+	return func(opts *options) {
+		opts.manifests = r
+	}
+}
+
 // WithTargets allows to submit regular expressions to limit the working set of
 // objects (https://tanka.dev/output-filtering/).
 func WithTargets(t process.Matchers) Modifier {
@@ -61,15 +195,160 @@ func WithDiffStrategy(ds string) Modifier {
 	}
 }
 
-// WithDiffSummarize enables summary mode, which invokes `diffstat(1)` on the
-// set of changes to create an overview
+// WithDiffSummarize enables summary mode, which creates an overview of the set
+// of changes in the format of `diffstat(1)`
 func WithDiffSummarize(b bool) Modifier {
 	return func(opts *options) {
 		opts.diff.Summarize = b
 	}
 }
 
-// WithApplyForce allows to invoke `kubectl apply` with the `--force` flag
+// WithDiffIgnoreKinds leaves objects of the given kinds (`kind` or
+// `group/kind`) out of the diff, in addition to spec.diff.ignoreKinds
+func WithDiffIgnoreKinds(kinds []string) Modifier {
+	return func(opts *options) {
+		opts.diff.IgnoreKinds = kinds
+	}
+}
+
+// WithDiffPatchFormat expresses the differences as patches in the given format
+// (`json` or `merge`) instead of a textual diff. An empty string is ignored.
+func WithDiffPatchFormat(format string) Modifier {
+	return func(opts *options) {
+		if format != "" {
+			opts.diff.PatchFormat = format
+		}
+	}
+}
+
+// WithDiffExplain summarizes the differences in one line per changed object,
+// e.g. `Deployment/frontend: spec.replicas 2→3`, instead of a textual diff
+func WithDiffExplain(b bool) Modifier {
+	return func(opts *options) {
+		opts.diff.Explain = b
+	}
+}
+
+// WithDiffIncludeStatus compares the `status` of objects as well, which is
+// left out by default
+func WithDiffIncludeStatus(b bool) Modifier {
+	return func(opts *options) {
+		opts.includeStatus = b
+	}
+}
+
+// WithDiffIgnoreWhitespace ignores line endings and trailing whitespace of
+// strings, which are compared as well by default
+func WithDiffIgnoreWhitespace(b bool) Modifier {
+	return func(opts *options) {
+		opts.ignoreWhitespace = b
+	}
+}
+
+// WithMaxErrors limits how many failed objects are listed when validating or
+// applying. Zero lists all of them
+func WithMaxErrors(n int) Modifier {
+	return func(opts *options) {
+		opts.diff.MaxErrors = n
+		opts.apply.MaxErrors = n
+	}
+}
+
+// WithDiffRevision compares against the given revision of the rollout history
+// of each object, instead of its current live state. Zero is ignored.
+func WithDiffRevision(revision int) Modifier {
+	return func(opts *options) {
+		opts.diff.Revision = revision
+	}
+}
+
+// WithDiffSnapshot compares against the YAML stream of previously captured
+// manifests (e.g. `tk show`) read from r, instead of the live cluster
+func WithDiffSnapshot(r io.Reader) Modifier {
+	return func(opts *options) {
+		opts.snapshot = r
+	}
+}
+
+// WithDiffAgainstCommand compares against the manifests command prints to
+// stdout (for example `tk show` of another version of Tanka), the same way as
+// WithDiffSnapshot does. command is run as-is, without a shell.
+func WithDiffAgainstCommand(command []string) Modifier {
+	return func(opts *options) {
+		opts.againstCommand = command
+	}
+}
+
+// WithDiffNameOnly lists each changed object as `<kind>/<name>` instead of
+// the full diff, e.g. for passing them to `WithTargets`
+func WithDiffNameOnly(b bool) Modifier {
+	return func(opts *options) {
+		opts.nameOnly = b
+	}
+}
+
+// WithDiffNameActions prefixes the objects listed by WithDiffNameOnly with
+// their action (`created`, `updated` or `deleted`), separated by a tab
+func WithDiffNameActions(b bool) Modifier {
+	return func(opts *options) {
+		opts.nameActions = b
+	}
+}
+
+// WithDiffFailOnAdd fails the diff with an ErrorDiffPolicy if objects are
+// created
+func WithDiffFailOnAdd(b bool) Modifier {
+	return func(opts *options) {
+		opts.failOnAdd = b
+	}
+}
+
+// WithDiffFailOnDelete fails the diff with an ErrorDiffPolicy if objects are
+// deleted
+func WithDiffFailOnDelete(b bool) Modifier {
+	return func(opts *options) {
+		opts.failOnDelete = b
+	}
+}
+
+// WithDiffPrune also shows the objects removed from Jsonnet as deleted, as
+// Prune would delete them. Requires the cluster.
+func WithDiffPrune(b bool) Modifier {
+	return func(opts *options) {
+		opts.diff.Prune = b
+	}
+}
+
+// WithDiffLastApplied compares against the last-applied-configuration
+// annotation of the objects of the snapshot (see WithDiffSnapshot) instead of
+// the full objects. Objects lacking it are considered to be created.
+func WithDiffLastApplied(b bool) Modifier {
+	return func(opts *options) {
+		opts.lastApplied = b
+	}
+}
+
+// WithDiffFullContext makes the diff hold the entire objects as context
+// instead of only the lines around each change, e.g. for an external diff tool
+// (see util.RenderDiff)
+func WithDiffFullContext(b bool) Modifier {
+	return func(opts *options) {
+		opts.diff.FullContext = b
+	}
+}
+
+// WithDiffStream writes the diff of each object to w as soon as it is
+// computed, while Diff still returns the entire diff. Each write holds whole
+// objects. Summaries, patches, explanations, revisions and names can't be
+// streamed.
+func WithDiffStream(w io.Writer) Modifier {
+	return func(opts *options) {
+		opts.diff.Out = w
+	}
+}
+
+// WithApplyForce allows to invoke `kubectl apply` with the `--force` flag.
+// Prune also deletes with `--force` then, see WithDeleteForce
 func WithApplyForce(b bool) Modifier {
 	return func(opts *options) {
 		opts.apply.Force = b
@@ -83,9 +362,223 @@ func WithApplyValidate(b bool) Modifier {
 	}
 }
 
+// WithApplyObjectTimeout aborts applying a single object after the given
+// duration
+func WithApplyObjectTimeout(d time.Duration) Modifier {
+	return func(opts *options) {
+		opts.apply.ObjectTimeout = d
+	}
+}
+
+// WithApplyWaveTimeout limits how long to wait for the objects of an apply
+// wave to become ready, before the next wave is applied
+func WithApplyWaveTimeout(d time.Duration) Modifier {
+	return func(opts *options) {
+		opts.apply.WaveTimeout = d
+	}
+}
+
+// WithApplyContinueOnError causes apply to record failed objects and move on,
+// instead of aborting on the first failure
+func WithApplyContinueOnError(b bool) Modifier {
+	return func(opts *options) {
+		opts.apply.ContinueOnError = b
+	}
+}
+
+// WithApplyParallelism applies up to n objects of each apply wave at once.
+// Zero or one applies them one by one
+func WithApplyParallelism(n int) Modifier {
+	return func(opts *options) {
+		opts.apply.Parallelism = n
+	}
+}
+
+// WithApplyDiff fetches the live state only once, to both show the diff and
+// apply against it. Objects modified in between fail to apply.
+func WithApplyDiff(b bool) Modifier {
+	return func(opts *options) {
+		opts.plan = b
+	}
+}
+
+// WithApplyOnlyChanged applies only the objects that differ from their live
+// state (or don't exist yet), skipping unchanged ones. The live state is
+// fetched once for all objects, like with WithApplyDiff.
+func WithApplyOnlyChanged(b bool) Modifier {
+	return func(opts *options) {
+		opts.onlyChanged = b
+	}
+}
+
+// WithApplySince skips applying the environment if none of its files changed
+// in git since ref, see ChangedSince. An empty string is ignored.
+func WithApplySince(ref string) Modifier {
+	return func(opts *options) {
+		opts.since = ref
+	}
+}
+
+// WithApplyPrune deletes the objects removed from Jsonnet after applying, like
+// Prune does. These are shown along with the diff and confirmed with it.
+func WithApplyPrune(b bool) Modifier {
+	return func(opts *options) {
+		opts.applyPrune = b
+	}
+}
+
+// WithApplyCreateNamespace creates spec.namespace (labeled like the
+// environment) before applying, if it does not exist on the cluster. Otherwise
+// the apply fails with an ErrorNamespaceMissing beforehand.
+func WithApplyCreateNamespace(b bool) Modifier {
+	return func(opts *options) {
+		opts.createNamespace = b
+	}
+}
+
+// WithApplySkipAuthCheck skips checking whether the current user is permitted
+// to apply all objects (`kubectl auth can-i`) before applying
+func WithApplySkipAuthCheck(b bool) Modifier {
+	return func(opts *options) {
+		opts.skipAuthCheck = b
+	}
+}
+
+// WithApplyServerSide uses server-side apply (`kubectl apply --server-side`)
+// instead of the client-side three-way merge
+func WithApplyServerSide(b bool) Modifier {
+	return func(opts *options) {
+		opts.apply.ServerSide = b
+	}
+}
+
+// WithApplyForceConflicts takes ownership of fields co-owned by other field
+// managers during server-side apply, instead of failing
+func WithApplyForceConflicts(b bool) Modifier {
+	return func(opts *options) {
+		opts.apply.ForceConflicts = b
+	}
+}
+
+// WithApplyProgress writes a line to w for each object being applied. If
+// interval is non-zero, at most one line per interval is written instead.
+func WithApplyProgress(w io.Writer, interval time.Duration) Modifier {
+	return func(opts *options) {
+		opts.apply.Progress = w
+		opts.apply.ProgressInterval = interval
+	}
+}
+
 // WithApplyAutoApprove allows to skip the interactive approval
 func WithApplyAutoApprove(b bool) Modifier {
 	return func(opts *options) {
 		opts.apply.AutoApprove = b
 	}
 }
+
+// WithDeleteDryRun causes prune and delete to only print the objects instead
+// of deleting them, in the order they would be deleted
+func WithDeleteDryRun(b bool) Modifier {
+	return func(opts *options) {
+		opts.deleteDryRun = b
+	}
+}
+
+// WithDeleteSelector sets the label selector (kubectl syntax) used to find the
+// live objects to delete
+func WithDeleteSelector(selector string) Modifier {
+	return func(opts *options) {
+		opts.selector = selector
+	}
+}
+
+// WithDeleteForce allows to invoke `kubectl delete` with the `--force` flag,
+// for all objects deleted by prune and delete (including those pruned after
+// applying)
+func WithDeleteForce(b bool) Modifier {
+	return func(opts *options) {
+		opts.delete.Force = b
+	}
+}
+
+// WithDeleteGracePeriod gives the objects deleted by prune and delete d to
+// terminate gracefully, instead of their default
+func WithDeleteGracePeriod(d time.Duration) Modifier {
+	return func(opts *options) {
+		opts.delete.GracePeriod = d
+	}
+}
+
+// WithDeleteTerminatingTimeout reports the objects deleted by prune and
+// delete that are still terminating after d (e.g. because of their
+// finalizers) as stuck, see kubernetes.ErrorStuckTerminating
+func WithDeleteTerminatingTimeout(d time.Duration) Modifier {
+	return func(opts *options) {
+		opts.delete.TerminatingTimeout = d
+	}
+}
+
+// WithDeleteRemoveFinalizers removes the finalizers of objects stuck
+// terminating during prune and delete, so that they are gone right away.
+// Dangerous: the cleanup the finalizers stand for is skipped.
+func WithDeleteRemoveFinalizers(b bool) Modifier {
+	return func(opts *options) {
+		opts.delete.RemoveFinalizers = b
+	}
+}
+
+// WithPruneResources limits prune to delete objects of the given types only,
+// instead of all types that can be listed. Pruning fails if objects of other
+// types are present in Jsonnet, as these could never be pruned.
+func WithPruneResources(resources []kubernetes.PruneResource) Modifier {
+	return func(opts *options) {
+		opts.pruneResources = resources
+	}
+}
+
+// WithExportFormat sets the template for the names of exported files, see
+// DefaultExportFormat. An empty string is ignored.
+func WithExportFormat(format string) Modifier {
+	return func(opts *options) {
+		if format != "" {
+			opts.exportFormat = format
+		}
+	}
+}
+
+// WithExportExtension sets the extension of exported files, see
+// DefaultExportExtension. An empty string is ignored.
+func WithExportExtension(ext string) Modifier {
+	return func(opts *options) {
+		if ext != "" {
+			opts.exportExtension = ext
+		}
+	}
+}
+
+// WithExportPrune makes Export remove the files of the sink that have the
+// export extension, but are not produced by the export. The sink must be a
+// PruningSink.
+func WithExportPrune(b bool) Modifier {
+	return func(opts *options) {
+		opts.exportPrune = b
+	}
+}
+
+// WithTempDir creates temporary files (for diffing, and those of kubectl)
+// below dir instead of the system default. dir must be writable, see
+// util.CheckTempDir
+func WithTempDir(dir string) Modifier {
+	return func(opts *options) {
+		opts.kubectl.TempDir = dir
+	}
+}
+
+// WithClusterLimiter bounds how many kubectl commands run at once. The limit
+// is shared by all calls given the same Limiter, e.g. those diffing multiple
+// environments in parallel. Nil is unlimited
+func WithClusterLimiter(l *client.Limiter) Modifier {
+	return func(opts *options) {
+		opts.kubectl.Limiter = l
+	}
+}
@@ -0,0 +1,12 @@
+// strips the annotations of the autoscaler, which change all the time
+function(obj)
+  local annotations = if std.objectHas(obj.metadata, 'annotations') then obj.metadata.annotations else {};
+  obj {
+    metadata+: {
+      annotations: {
+        [k]: annotations[k]
+        for k in std.objectFields(annotations)
+        if !std.startsWith(k, 'autoscaler.example.com/')
+      },
+    },
+  }
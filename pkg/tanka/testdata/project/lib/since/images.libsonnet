@@ -0,0 +1,3 @@
+{
+  grafana: 'grafana/grafana:7.3.0',
+}
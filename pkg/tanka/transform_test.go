@@ -0,0 +1,101 @@
+package tanka
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+)
+
+const transformManifests = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+spec:
+  template:
+    spec:
+      containers:
+        - name: grafana
+          image: grafana/grafana:7.1.0
+        - name: sidecar
+          image: docker.io/kiwigrid/k8s-sidecar:0.1.151
+`
+
+// rewriteRegistry returns a Transform that pulls all images from registry
+func rewriteRegistry(registry string) Transform {
+	return func(list manifest.List) (manifest.List, error) {
+		for _, m := range list {
+			containers, _ := m.Get("spec.template.spec.containers")
+			for _, c := range containers.([]interface{}) {
+				c := c.(map[string]interface{})
+				image := strings.TrimPrefix(c["image"].(string), "docker.io/")
+				c["image"] = registry + "/" + image
+			}
+		}
+		return list, nil
+	}
+}
+
+func images(t *testing.T, m manifest.Manifest) []string {
+	var out []string
+	containers, ok := m.Get("spec.template.spec.containers")
+	require.True(t, ok)
+	for _, c := range containers.([]interface{}) {
+		out = append(out, c.(map[string]interface{})["image"].(string))
+	}
+	return out
+}
+
+// TestTransform checks that transforms are run in order on the processed
+// manifests and that their result is what is shown, diffed and applied
+func TestTransform(t *testing.T) {
+	addNamespace := func(list manifest.List) (manifest.List, error) {
+		return append(list, manifest.Manifest{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "monitoring"},
+		}), nil
+	}
+
+	list, err := Show("testdata/project/environments/default",
+		WithManifests(strings.NewReader(transformManifests)),
+		WithTransform(rewriteRegistry("registry.example.com")),
+		WithTransform(addNamespace),
+	)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	// sorted again, Namespaces first
+	assert.Equal(t, "Namespace", list[0].Kind())
+	assert.Equal(t, []string{
+		"registry.example.com/grafana/grafana:7.1.0",
+		"registry.example.com/kiwigrid/k8s-sidecar:0.1.151",
+	}, images(t, list[1]))
+}
+
+func TestTransformError(t *testing.T) {
+	_, err := Show("testdata/project/environments/default",
+		WithManifests(strings.NewReader(transformManifests)),
+		WithTransform(func(manifest.List) (manifest.List, error) {
+			return nil, errors.New("registry unreachable")
+		}),
+	)
+	assert.EqualError(t, err, "transforming manifests: registry unreachable")
+
+	// transforms must return valid objects
+	_, err = Show("testdata/project/environments/default",
+		WithManifests(strings.NewReader(transformManifests)),
+		WithTransform(func(list manifest.List) (manifest.List, error) {
+			delete(list[0], "kind")
+			return list, nil
+		}),
+	)
+	var verr process.ValidationError
+	assert.True(t, errors.As(err, &verr), "expected ValidationError, got %T", err)
+}
@@ -0,0 +1,94 @@
+package tanka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/grafana/tanka/pkg/spec"
+)
+
+// valuesExtVar holds the merged values files of the environment, see
+// v1alpha1.Spec.ValuesFiles and WithValuesFiles. It is always set, to `{}`
+// without any values files.
+const valuesExtVar = spec.APIGroup + "/values"
+
+// ValuesExtCode merges the given values files like WithValuesFiles does and
+// returns the ext var holding them along with its code, for evaluating Jsonnet
+// outside of an environment
+func ValuesExtCode(files []string) (key, code string, err error) {
+	values, err := loadValues(files)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", "", errors.Wrap(err, "marshalling values")
+	}
+	return valuesExtVar, string(data), nil
+}
+
+// loadValues reads the given YAML or JSON files and merges them in order:
+// objects are merged recursively, other values of later files replace those
+// of earlier ones
+func loadValues(files []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, file := range files {
+		v, err := readValues(file)
+		if err != nil {
+			return nil, err
+		}
+		values = mergeValues(values, v)
+	}
+	return values, nil
+}
+
+// readValues reads a single values file, which must hold an object
+func readValues(file string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading values file")
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrapf(err, "parsing values file %s", file)
+	}
+	if doc == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	// round-trip through JSON, so that the types match those of Jsonnet
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "converting values file %s to json", file)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("values file %s must hold an object", file)
+	}
+	return values, nil
+}
+
+// mergeValues merges override into base. Objects are merged recursively,
+// other values of override replace those of base.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		out[k] = v
+	}
+
+	for k, v := range override {
+		o, isObj := v.(map[string]interface{})
+		b, wasObj := out[k].(map[string]interface{})
+		if isObj && wasObj {
+			out[k] = mergeValues(b, o)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -2,38 +2,90 @@ package tanka
 
 import (
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/fatih/color"
+	"github.com/pkg/errors"
 
 	"github.com/grafana/tanka/pkg/kubernetes"
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/process"
 	"github.com/grafana/tanka/pkg/term"
 )
 
 // Apply parses the environment at the given directory (a `baseDir`) and applies
 // the evaluated jsonnet to the Kubernetes cluster defined in the environments
 // `spec.json`.
+// Using `WithApplyPrune`, objects removed from Jsonnet are deleted afterwards.
 func Apply(baseDir string, mods ...Modifier) error {
 	opts := parseModifiers(mods)
 
+	if opts.since != "" {
+		if opts.manifests != nil {
+			return fmt.Errorf("changes since a git ref can't be detected for pre-rendered manifests")
+		}
+		changed, err := changedSince(baseDir, opts.since, opts.gitRunner)
+		if err != nil {
+			return err
+		}
+		if len(changed) == 0 {
+			fmt.Printf("Skipping environment `%s`, none of its files changed since `%s`\n", baseDir, opts.since)
+			return nil
+		}
+	}
+
 	l, err := load(baseDir, opts)
 	if err != nil {
 		return err
 	}
-	kube, err := l.connect()
+	l.skip(process.SkipApply)
+
+	kube, err := l.connect(opts)
 	if err != nil {
 		return err
 	}
 	defer kube.Close()
+	warnDeprecated(kube, l.Resources)
+
+	// fail early if RBAC would block parts of the apply
+	if !opts.skipAuthCheck {
+		if err := kube.CheckAuth(l.Resources); err != nil {
+			return err
+		}
+	}
+
+	// fail fast instead of failing for each object, unless it may be created
+	createNs := ""
+	if err := kube.CheckNamespace(l.Resources); err != nil {
+		missing, ok := err.(kubernetes.ErrorNamespaceMissing)
+		if !ok || !opts.createNamespace {
+			return err
+		}
+		createNs = missing.Namespace
+	}
+
+	// objects removed from Jsonnet, deleted after applying
+	var orphaned manifest.List
+	if opts.applyPrune {
+		if orphaned, err = findOrphans(l, kube, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.plan || opts.onlyChanged {
+		return applyPlan(l, kube, opts, createNs, orphaned)
+	}
 
 	// show diff
-	diff, err := kube.Diff(l.Resources, kubernetes.DiffOpts{Strategy: opts.diff.Strategy})
+	diff, err := kube.Diff(l.Resources, kubernetes.DiffOpts{Strategy: opts.diff.Strategy, MaxErrors: opts.diff.MaxErrors})
 	switch {
 	case err != nil:
 		// This is not fatal, the diff is not strictly required
 		fmt.Println("Error diffing:", err)
-	case diff == nil:
+	case diff == nil && len(orphaned) == 0:
 		tmp := "Warning: There are no differences. Your apply may not do anything at all."
 		diff = &tmp
 	}
@@ -43,6 +95,9 @@ func Apply(baseDir string, mods ...Modifier) error {
 		b := term.Colordiff(*diff)
 		fmt.Print(b.String())
 	}
+	if err := showOrphans(orphaned); err != nil {
+		return err
+	}
 
 	// prompt for confirmation
 	if opts.apply.AutoApprove {
@@ -50,7 +105,84 @@ func Apply(baseDir string, mods ...Modifier) error {
 		return err
 	}
 
-	return kube.Apply(l.Resources, opts.apply)
+	if err := createNamespace(kube, createNs, opts); err != nil {
+		return err
+	}
+
+	results, err := kube.Apply(l.Resources, opts.apply)
+	fmt.Print(results.Summary(opts.apply.MaxErrors))
+	if err != nil {
+		return err
+	}
+
+	// only once everything is applied, as the orphans may be replaced
+	return pruneOrphans(kube, orphaned, opts)
+}
+
+// applyPlan fetches the live state once, shows the diff against it and applies
+// exactly that. Objects changed in the meantime fail to apply. With
+// onlyChanged, objects not differing from the live state are left out.
+// Orphaned objects are deleted afterwards.
+func applyPlan(l *loaded, kube *kubernetes.Kubernetes, opts *options, createNs string, orphaned manifest.List) error {
+	plan, err := kube.Plan(l.Resources)
+	if err != nil {
+		return err
+	}
+
+	if opts.onlyChanged {
+		changed, err := plan.Changed()
+		if err != nil {
+			return errors.Wrap(err, "diffing")
+		}
+		fmt.Printf("Skipping %d of %d objects, which are unchanged\n", len(plan.State)-len(changed), len(plan.State))
+		plan.State = changed
+	}
+
+	diff, err := plan.Diff()
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "diffing")
+	case diff == nil && len(orphaned) == 0:
+		tmp := "Warning: There are no differences. Your apply may not do anything at all."
+		diff = &tmp
+	}
+	if diff != nil {
+		b := term.Colordiff(*diff)
+		fmt.Print(b.String())
+	}
+	if err := showOrphans(orphaned); err != nil {
+		return err
+	}
+
+	if opts.apply.AutoApprove {
+	} else if err := confirmPrompt("Applying to", l.Env.Spec.Namespace, kube.Info()); err != nil {
+		return err
+	}
+
+	if err := createNamespace(kube, createNs, opts); err != nil {
+		return err
+	}
+
+	var results kubernetes.ApplyResults
+	if opts.plan {
+		results, err = kube.ApplyPlan(plan, opts.apply)
+	} else {
+		results, err = kube.Apply(plan.State, opts.apply)
+	}
+	fmt.Print(results.Summary(opts.apply.MaxErrors))
+	if err != nil {
+		return err
+	}
+	return pruneOrphans(kube, orphaned, opts)
+}
+
+// createNamespace creates the Namespace of the given name, if any
+func createNamespace(kube *kubernetes.Kubernetes, name string, opts *options) error {
+	if name == "" {
+		return nil
+	}
+	fmt.Printf("Creating namespace `%s`\n", name)
+	return kube.CreateNamespace(name, opts.apply.WaveTimeout)
 }
 
 // confirmPrompt asks the user for confirmation before apply
@@ -70,10 +202,23 @@ func confirmPrompt(action, namespace string, info client.Info) error {
 
 // Diff parses the environment at the given directory (a `baseDir`) and returns
 // the differences from the live cluster state in `diff(1)` format. If the
-// `WithDiffSummarize` modifier is used, a histogram created using `diffstat(1)`
-// is returned instead.
+// `WithDiffSummarize` modifier is used, a histogram in the format of
+// `diffstat(1)` is returned instead. Use util.ParseDiff for a structured form.
 // The cluster information is retrieved from the environments `spec.json`.
-// NOTE: This function requires on `diff(1)`, `kubectl(1)` and perhaps `diffstat(1)`
+// NOTE: This function requires `kubectl(1)`. Except for `kubectl diff` (the
+// native diff-strategy), no external tools are invoked.
+//
+// Using `WithDiffSnapshot`, the state is compared against the snapshot instead,
+// which does not require cluster access. `WithDiffAgainstCommand` obtains the
+// snapshot by running a command.
+//
+// Using `WithDiffFailOnAdd` or `WithDiffFailOnDelete`, an ErrorDiffPolicy is
+// returned along with the differences if objects are created or deleted.
+//
+// Using `WithDiffNameOnly`, only the changed objects are listed, one
+// `<kind>/<name>` per line.
+//
+// Using `WithDiffPrune`, objects removed from Jsonnet are shown as deleted.
 func Diff(baseDir string, mods ...Modifier) (*string, error) {
 	opts := parseModifiers(mods)
 
@@ -81,13 +226,188 @@ func Diff(baseDir string, mods ...Modifier) (*string, error) {
 	if err != nil {
 		return nil, err
 	}
-	kube, err := l.connect()
+	l.skip(process.SkipDiff)
+
+	overrideSpec(l.Env, opts)
+
+	if opts.nameOnly && (opts.diff.Summarize || opts.diff.PatchFormat != "" || opts.diff.Explain) {
+		return nil, fmt.Errorf("changed objects can't be listed by name along with summaries, patches or explanations")
+	}
+	if opts.nameOnly && opts.diff.Out != nil {
+		return nil, fmt.Errorf("changed objects can't be listed by name while streaming the diff")
+	}
+	if !opts.failOnAdd && !opts.failOnDelete && !opts.nameOnly {
+		return diff(l, opts)
+	}
+
+	// the policy is checked on the full diff, it is summarized afterwards
+	if opts.diff.PatchFormat != "" {
+		return nil, fmt.Errorf("patches can't be checked for created or deleted objects")
+	}
+	if opts.diff.Explain {
+		return nil, fmt.Errorf("explanations can't be checked for created or deleted objects")
+	}
+	summarize := opts.diff.Summarize
+	opts.diff.Summarize = false
+
+	d, err := diff(l, opts)
+	if err != nil || d == nil {
+		return d, err
+	}
+
+	policyErr := checkPolicy(util.DiffChanges(*d), opts)
+	if opts.nameOnly {
+		names := changedNames(*d, opts.nameActions, l.Resources, l.Snapshot)
+		d = &names
+	}
+	if summarize {
+		if d, err = util.Diffstat(*d); err != nil {
+			return nil, err
+		}
+	}
+	return d, policyErr
+}
+
+// diff compares the loaded state against the cluster or the snapshot
+func diff(l *loaded, opts *options) (*string, error) {
+	if opts.diff.Prune {
+		if err := checkPruneTargets(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.againstCommand) > 0 {
+		if opts.snapshot != nil {
+			return nil, fmt.Errorf("a snapshot and a command to diff against can't be combined")
+		}
+		r, err := renderCommand(opts.againstCommand, opts.commandRunner)
+		if err != nil {
+			return nil, err
+		}
+		opts.snapshot = r
+	}
+
+	if opts.lastApplied && opts.snapshot == nil {
+		return nil, fmt.Errorf("the last-applied-configuration can only be diffed against a snapshot")
+	}
+
+	if opts.snapshot != nil {
+		if opts.diff.Prune {
+			return nil, fmt.Errorf("pruned objects can only be shown against the cluster, not a snapshot")
+		}
+		if opts.diff.PatchFormat != "" {
+			return nil, fmt.Errorf("patches can't be computed against a snapshot")
+		}
+		if opts.diff.Explain {
+			return nil, fmt.Errorf("explanations can't be computed against a snapshot")
+		}
+		if opts.diff.Revision > 0 {
+			return nil, fmt.Errorf("snapshots have no revision history")
+		}
+		return diffSnapshot(l, opts)
+	}
+
+	kube, err := l.connect(opts)
 	if err != nil {
 		return nil, err
 	}
 	defer kube.Close()
+	warnDeprecated(kube, l.Resources)
+
+	diffOpts := opts.diff
+	if diffOpts.Prune {
+		diffOpts.PruneResources = opts.pruneResources
+		diffOpts.PruneState = l.All
+	}
+	return kube.Diff(l.Resources, diffOpts)
+}
+
+// warnDeprecated logs a warning for each object using an apiVersion that is
+// deprecated in the Kubernetes version of the cluster
+func warnDeprecated(kube *kubernetes.Kubernetes, state manifest.List) {
+	for _, d := range kubernetes.Deprecations(state, kube.Info().ServerVersion) {
+		log.Println("Warning:", d)
+	}
+}
+
+// ErrorDiffPolicy occurs when a diff creates or deletes objects, while this was
+// forbidden using `WithDiffFailOnAdd` or `WithDiffFailOnDelete`
+type ErrorDiffPolicy struct {
+	// number of created objects, if forbidden
+	Added int
+	// number of deleted objects, if forbidden
+	Deleted int
+}
+
+func (e ErrorDiffPolicy) Error() string {
+	var forbidden []string
+	if e.Added > 0 {
+		forbidden = append(forbidden, fmt.Sprintf("creates %d", e.Added))
+	}
+	if e.Deleted > 0 {
+		forbidden = append(forbidden, fmt.Sprintf("deletes %d", e.Deleted))
+	}
+	return fmt.Sprintf("the diff %s object(s), which is forbidden", strings.Join(forbidden, " and "))
+}
+
+// checkPolicy returns an ErrorDiffPolicy if c contains forbidden changes
+func checkPolicy(c util.Changes, opts *options) error {
+	var e ErrorDiffPolicy
+	if opts.failOnAdd {
+		e.Added = c.Created
+	}
+	if opts.failOnDelete {
+		e.Deleted = c.Deleted
+	}
+
+	if e.Added == 0 && e.Deleted == 0 {
+		return nil
+	}
+	return e
+}
+
+// diffSnapshot compares the loaded state against the snapshot. The snapshot is
+// processed the same way the state was, so that labels and targets line up.
+func diffSnapshot(l *loaded, opts *options) (*string, error) {
+	raw, err := process.ParseStream(opts.snapshot)
+	if err != nil {
+		return nil, process.ValidationError{Err: errors.Wrap(err, "reading snapshot")}
+	}
+
+	snapshot, err := process.Process(raw, *l.Env, opts.targets)
+	if v, ok := err.(process.ValidationError); ok {
+		v.Err = errors.Wrap(v.Err, "processing snapshot")
+		return nil, v
+	} else if err != nil {
+		return nil, err
+	}
+	snapshot = process.Skip(snapshot, process.SkipDiff)
+
+	// what was applied, instead of the full objects
+	if opts.lastApplied {
+		if snapshot, err = kubernetes.LastApplied(snapshot); err != nil {
+			return nil, process.ValidationError{Err: errors.Wrap(err, "reading snapshot")}
+		}
+	}
+
+	ignore := append(append([]string{}, l.Env.Spec.Diff.IgnoreKinds...), opts.diff.IgnoreKinds...)
+	snapshot = kubernetes.IgnoreKinds(snapshot, ignore)
+	state := kubernetes.IgnoreKinds(l.Resources, ignore)
+	l.Snapshot = snapshot
+
+	normalize, err := normalizer(l.Env)
+	if err != nil {
+		return nil, err
+	}
+	if opts.diff.Out != nil && opts.diff.Summarize {
+		return nil, fmt.Errorf("only plain diffs can be streamed, not summaries")
+	}
+	d, err := kubernetes.SnapshotDiffer(snapshot, kubernetes.CompareOpts{DiffSpec: l.Env.Spec.Diff, Normalize: normalize})(state, opts.diff.DiffOpts)
+	if err != nil || d == nil || !opts.diff.Summarize {
+		return d, err
+	}
 
-	return kube.Diff(l.Resources, opts.diff)
+	return util.Diffstat(*d)
 }
 
 // Show parses the environment at the given directory (a `baseDir`) and returns
@@ -108,7 +428,7 @@ func Show(baseDir string, mods ...Modifier) (manifest.List, error) {
 func Eval(dir string, mods ...Modifier) (raw map[string]interface{}, err error) {
 	opts := parseModifiers(mods)
 
-	r, _, err := eval(dir, opts.extCode)
+	r, _, err := eval(dir, opts)
 	if err != nil {
 		return nil, err
 	}